@@ -1,19 +1,40 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"log/slog"
 	"os"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
+	"pow/internal/build"
 	"pow/internal/client"
 	"pow/internal/config"
 	"pow/internal/pow"
+	"pow/pkg/protocol"
 )
 
+// version is injected at build time with -ldflags "-X main.version=..."
+var version = "dev"
+
 func main() {
+	build.Version = version
+
+	stats := flag.Bool("stats", false, "print solve time and attempt statistics per difficulty")
+	solve := flag.Bool("solve", false, "solve -challenge locally and print the nonce, without contacting a server")
+	challenge := flag.String("challenge", "", "challenge to solve with -solve, read from stdin if empty")
+	difficulty := flag.Int("difficulty", 0, "difficulty in leading zero bytes to solve -challenge at")
+	configFile := flag.String("config", "", "YAML or JSON configuration file, overridden by environment variables")
+	flag.Parse()
+
 	// Load .env file (ignore error if file doesn't exist)
 	_ = godotenv.Load()
 
@@ -22,47 +43,193 @@ func main() {
 		Level: slog.LevelInfo,
 	}))
 
-	logger.Info("Starting Word of Wisdom TCP client...")
+	logger.Info("Starting Word of Wisdom TCP client...", "version", build.Version)
+
+	// Load and validate configuration
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		logger.Error("Invalid configuration", "error", err)
+		log.Fatalf("Configuration validation failed: %v", err)
+	}
 
-	// Load configuration
-	cfg := config.LoadClientConfig()
 	logger.Info("Configuration loaded",
 		"server_host", cfg.ServerHost,
-		"server_port", cfg.ServerPort)
+		"server_port", cfg.ServerPort,
+		"network", cfg.Network,
+		"socket_path", cfg.SocketPath,
+		"tls", cfg.TLSEnabled,
+		"solver_workers", cfg.SolverWorkers,
+		"max_accepted_difficulty", cfg.MaxAcceptedDifficulty,
+		"max_solve_attempts", cfg.MaxSolveAttempts,
+		"message_encoding", cfg.MessageEncoding)
+
+	// "client calibrate" measures local solving speed instead of requesting a quote
+	if flag.Arg(0) == "calibrate" {
+		runCalibration(logger, cfg.SolveTimeout)
+		return
+	}
+
+	// "client -solve" solves a challenge offline, e.g. to cross-check another implementation
+	if *solve {
+		if *challenge == "" {
+			line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+			if err != nil && !errors.Is(err, io.EOF) {
+				log.Fatalf("Failed to read challenge from stdin: %v", err)
+			}
+			*challenge = strings.TrimSpace(line)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.SolveTimeout)
+		defer cancel()
+		if err := runSolve(ctx, os.Stdout, *challenge, *difficulty); err != nil {
+			logger.Error("Solve failed", "error", err)
+			log.Fatal(err)
+		}
+		return
+	}
 
 	// Initialize PoW service (difficulty will be received from server)
-	powService := pow.NewSHA256HashcashService(0, 0) // Difficulty not needed for client
+	powService := pow.NewSHA256HashcashService(0, 0) // Solver only, each challenge brings its difficulty
 
 	// Create client
+	// MESSAGE_ENCODING names a known encoding once validated
+	encoding, _ := protocol.EncodingByName(cfg.MessageEncoding)
+
 	clientConfig := client.Config{
-		ServerHost:     cfg.ServerHost,
-		ServerPort:     cfg.ServerPort,
-		ConnectTimeout: cfg.ConnectTimeout,
-		ReadTimeout:    cfg.ReadTimeout,
-		WriteTimeout:   cfg.WriteTimeout,
-		SolveTimeout:   cfg.SolveTimeout,
+		ServerHost:            cfg.ServerHost,
+		ServerPort:            cfg.ServerPort,
+		ConnectTimeout:        cfg.ConnectTimeout,
+		ReadTimeout:           cfg.ReadTimeout,
+		WriteTimeout:          cfg.WriteTimeout,
+		SolveTimeout:          cfg.SolveTimeout,
+		SolveTimeoutBase:      cfg.SolveTimeoutBase,
+		SolveTimeoutFactor:    cfg.SolveTimeoutFactor,
+		TLSEnabled:            cfg.TLSEnabled,
+		TLSInsecureSkipVerify: cfg.TLSInsecureSkipVerify,
+		Category:              cfg.QuoteCategory,
+		LegacyFraming:         cfg.LegacyFraming,
+		MaxRetries:            cfg.MaxRetries,
+		RetryBaseDelay:        cfg.RetryBaseDelay,
+		Network:               cfg.Network,
+		SocketPath:            cfg.SocketPath,
+		SolverWorkers:         cfg.SolverWorkers,
+		MaxAcceptedDifficulty: cfg.MaxAcceptedDifficulty,
+		HeartbeatInterval:     cfg.HeartbeatInterval,
+		MaxSolveAttempts:      cfg.MaxSolveAttempts,
+		TrustedToken:          cfg.TrustedToken,
+		MaxMessageSize:        cfg.MaxMessageSize,
+		Encoding:              encoding,
 	}
 
 	c := client.NewClient(clientConfig, powService, logger)
 
-	// Request quote
-	ctx, cancel := context.WithTimeout(context.Background(), cfg.SolveTimeout+cfg.ConnectTimeout+cfg.ReadTimeout)
+	// Request quote, leaving room for every retry plus its longest backoff
+	attempts := time.Duration(max(cfg.MaxRetries, 0) + 1)
+	timeout := attempts*(cfg.SolveTimeout+cfg.ConnectTimeout+cfg.ReadTimeout) + (attempts-1)*client.MaxRetryDelay
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
 	logger.Info("Requesting quote from server...")
 
-	quote, err := c.RequestQuote(ctx)
+	count := cfg.QuoteCount
+	if count < 1 {
+		count = 1
+	}
+
+	quotes, err := c.RequestQuotes(ctx, count)
 	if err != nil {
 		logger.Error("Failed to get quote", "error", err)
 		log.Fatal(err)
 	}
 
-	// Print quote to user
+	// Print quotes to user
 	separator := "================================================================================"
 	fmt.Println("\n" + separator)
 	fmt.Println("Quote of the Day:")
-	fmt.Println(quote)
+	for _, quote := range quotes {
+		fmt.Println(quote)
+	}
 	fmt.Println(separator + "\n")
 
+	if *stats {
+		printSolveStats(c.Metrics())
+	}
+
 	logger.Info("Quote retrieved successfully")
 }
+
+// loadConfig loads the configuration from the environment, on top of configFile if set,
+// and validates it
+func loadConfig(configFile string) (config.ClientConfig, error) {
+	if configFile != "" {
+		return config.LoadClientConfigFromFile(configFile)
+	}
+	cfg := config.LoadClientConfig()
+	return cfg, cfg.Validate()
+}
+
+// printSolveStats prints a table of solve statistics per difficulty
+func printSolveStats(metrics *client.SolveMetrics) {
+	snapshot := metrics.Snapshot()
+	difficulties := make([]int, 0, len(snapshot))
+	for difficulty := range snapshot {
+		difficulties = append(difficulties, difficulty)
+	}
+	sort.Ints(difficulties)
+
+	fmt.Println("Solve statistics:")
+	fmt.Printf("%-10s %6s %12s %12s %12s %14s\n", "difficulty", "count", "min", "avg", "max", "avg_attempts")
+	for _, difficulty := range difficulties {
+		s := snapshot[difficulty]
+		fmt.Printf("%-10d %6d %12v %12v %12v %14.0f\n", difficulty, s.Count,
+			s.MinDuration.Round(time.Microsecond), s.AvgDuration().Round(time.Microsecond),
+			s.MaxDuration.Round(time.Microsecond), s.AvgAttempts())
+	}
+}
+
+// runSolve solves challenge at difficulty with the local PoW service, then prints
+// the nonce, whether the standalone verifier accepts it, elapsed time and attempts
+func runSolve(ctx context.Context, out io.Writer, challenge string, difficulty int) error {
+	if challenge == "" {
+		return errors.New("no challenge given")
+	}
+	if difficulty < 0 {
+		return fmt.Errorf("difficulty must not be negative, got: %d", difficulty)
+	}
+
+	powService := pow.NewSHA256HashcashService(difficulty, 0)
+
+	start := time.Now()
+	nonce, attempts, err := powService.SolveChallengeWithStats(ctx, challenge, difficulty)
+	elapsed := time.Since(start)
+	if err != nil {
+		return fmt.Errorf("failed to solve challenge: %w", err)
+	}
+
+	fmt.Fprintf(out, "Challenge:  %s\n", challenge)
+	fmt.Fprintf(out, "Difficulty: %d\n", difficulty)
+	fmt.Fprintf(out, "Nonce:      %s\n", nonce)
+	fmt.Fprintf(out, "Verified:   %t\n", pow.Verify(challenge, nonce, difficulty, pow.SHA256Hasher{}))
+	fmt.Fprintf(out, "Elapsed:    %v\n", elapsed.Round(time.Microsecond))
+	fmt.Fprintf(out, "Attempts:   %d\n", attempts)
+	return nil
+}
+
+// runCalibration prints the hash rate and the highest difficulty solvable within budget
+func runCalibration(logger *slog.Logger, budget time.Duration) {
+	logger.Info("Calibrating PoW difficulty...", "budget", budget)
+
+	calibration, err := client.CalibrateDifficulty(context.Background(), budget)
+	if err != nil {
+		logger.Error("Calibration failed", "error", err)
+		log.Fatal(err)
+	}
+
+	fmt.Printf("Hash rate: %.0f hashes/sec\n", calibration.HashesPerSecond)
+	if calibration.Difficulty == 0 {
+		fmt.Printf("No difficulty can be solved within %v; increase SOLVE_TIMEOUT\n", budget)
+		return
+	}
+	fmt.Printf("Recommended difficulty: %d (average solve time %v, budget %v)\n",
+		calibration.Difficulty, calibration.ExpectedSolveTime.Round(time.Microsecond), budget)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"pow/internal/pow"
+)
+
+func TestRunSolve(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	challenge, difficulty := "offline-test-challenge", 1
+
+	var out bytes.Buffer
+	if err := runSolve(ctx, &out, challenge, difficulty); err != nil {
+		t.Fatalf("runSolve failed: %v", err)
+	}
+
+	fields := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			t.Fatalf("Unexpected output line %q", line)
+		}
+		fields[key] = strings.TrimSpace(value)
+	}
+
+	if fields["Verified"] != "true" {
+		t.Errorf("Expected Verified true, got %q", fields["Verified"])
+	}
+	if !pow.Verify(challenge, fields["Nonce"], difficulty, pow.SHA256Hasher{}) {
+		t.Errorf("Printed nonce %q does not solve the challenge", fields["Nonce"])
+	}
+	for _, key := range []string{"Challenge", "Difficulty", "Elapsed", "Attempts"} {
+		if fields[key] == "" {
+			t.Errorf("Expected %s in output, got:\n%s", key, out.String())
+		}
+	}
+
+	t.Run("EmptyChallenge", func(t *testing.T) {
+		if err := runSolve(ctx, &out, "", difficulty); err == nil {
+			t.Error("Expected error for empty challenge")
+		}
+	})
+
+	t.Run("NegativeDifficulty", func(t *testing.T) {
+		if err := runSolve(ctx, &out, challenge, -1); err == nil {
+			t.Error("Expected error for negative difficulty")
+		}
+	})
+}
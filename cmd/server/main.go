@@ -2,20 +2,37 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"log/slog"
+	"math/big"
+	"net"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 
 	"github.com/joho/godotenv"
+	"pow/internal/build"
 	"pow/internal/config"
 	"pow/internal/pow"
 	"pow/internal/quotes"
 	"pow/internal/server"
+	"pow/pkg/protocol"
 )
 
+// version is injected at build time with -ldflags "-X main.version=..."
+var version = "dev"
+
 func main() {
+	build.Version = version
+
+	configFile := flag.String("config", "", "YAML or JSON configuration file, overridden by environment variables")
+	flag.Parse()
+
 	// Load .env file (ignore error if file doesn't exist)
 	_ = godotenv.Load()
 
@@ -24,53 +41,238 @@ func main() {
 		Level: slog.LevelInfo,
 	}))
 
-	logger.Info("Starting Word of Wisdom TCP server...")
-
-	// Load configuration
-	cfg := config.LoadServerConfig()
+	logger.Info("Starting Word of Wisdom TCP server...", "version", build.Version)
 
-	// Validate configuration
-	if err := cfg.Validate(); err != nil {
+	// Load and validate configuration
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
 		logger.Error("Invalid configuration", "error", err)
 		log.Fatalf("Configuration validation failed: %v", err)
 	}
 
 	logger.Info("Configuration loaded",
+		"config_file", *configFile,
+		"network", cfg.Network,
 		"host", cfg.Host,
 		"port", cfg.Port,
+		"socket_path", cfg.SocketPath,
 		"difficulty", cfg.Difficulty,
+		"min_effective_difficulty", cfg.MinEffectiveDifficulty,
+		"pow_algorithm", cfg.PowAlgorithm,
+		"pow_stateless", cfg.PowStateless,
+		"pow_disabled", cfg.PowDisabled,
+		"pow_namespace", cfg.PowNamespace,
+		"pow_target", cfg.PowTarget,
 		"max_connections", cfg.MaxConnections,
-		"max_active_challenges", cfg.MaxActiveChallenges)
+		"accept_queue_size", cfg.AcceptQueueSize,
+		"accept_workers", cfg.AcceptWorkers,
+		"port_retry", cfg.PortRetry,
+		"max_active_challenges", cfg.MaxActiveChallenges,
+		"cleanup_interval", cfg.CleanupInterval,
+		"admin_port", cfg.AdminPort,
+		"trusted_tokens", len(cfg.TrustedTokens),
+		"message_encoding", cfg.MessageEncoding,
+		"tls", cfg.TLSCertFile != "",
+		"rate_limit_per_ip", cfg.RateLimitPerIP,
+		"global_challenge_rate", cfg.GlobalChallengeRate)
+
+	// Setup graceful shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
 	// Initialize services
-	powService := pow.NewSHA256HashcashServiceWithLimit(cfg.Difficulty, cfg.ChallengeTTL, cfg.MaxActiveChallenges)
-	quotesService := quotes.NewInMemoryService()
+	var powService pow.ChallengeService
+	switch {
+	case cfg.PowStateless:
+		statelessService, err := pow.NewStatelessHashcashService([]byte(cfg.PowSecret), cfg.Difficulty, cfg.ChallengeTTL, cfg.ChallengeRandBytes, cfg.PowSeenCacheSize)
+		if err != nil {
+			logger.Error("Failed to create stateless PoW service", "error", err)
+			log.Fatalf("Failed to create stateless PoW service: %v", err)
+		}
+		powService = statelessService
+	case cfg.PowAlgorithm == config.PowAlgorithmArgon2id:
+		params := pow.Argon2Params{
+			Time:    uint32(cfg.Argon2Time),
+			Memory:  uint32(cfg.Argon2Memory),
+			Threads: uint8(cfg.Argon2Threads),
+		}
+		store := pow.NewInMemoryStore(cfg.CleanupInterval)
+		defer store.Close()
+		argon2Service := pow.NewArgon2HashcashServiceWithStore(cfg.Difficulty, cfg.ChallengeTTL, cfg.MaxActiveChallenges, cfg.ChallengeRandBytes, params, store)
+		argon2Service.SetTTLJitter(cfg.TTLJitterPercent)
+		powService = argon2Service
+	default:
+		store := pow.NewInMemoryStore(cfg.CleanupInterval)
+		defer store.Close()
+		sha256Service := pow.NewSHA256HashcashServiceWithStore(cfg.Difficulty, cfg.ChallengeTTL, cfg.MaxActiveChallenges, cfg.ChallengeRandBytes, store)
+		sha256Service.SetTTLJitter(cfg.TTLJitterPercent)
+		powService = sha256Service
+	}
+	if cfg.PowDisabled {
+		powService.(zeroDifficultyAllower).SetAllowZeroDifficulty(true) // NewServer warns about it
+	}
+	if cfg.PowNamespace != "" {
+		powService.(namespaceSetter).SetNamespace(cfg.PowNamespace)
+	}
+	if cfg.PowTarget != "" {
+		target, err := pow.ParseTarget(cfg.PowTarget)
+		if err != nil {
+			log.Fatalf("Invalid POW_TARGET: %v", err)
+		}
+		powService.(targetSetter).SetTarget(target) // Validate only allows it with stateful sha256
+	}
+
+	inMemoryQuotes := quotes.NewInMemoryService()
+	inMemoryQuotes.SetNoRepeat(cfg.QuotesNoRepeat)
+	var dailyQuotes quotes.DailyQuoter = inMemoryQuotes
+	if cfg.QuotesFile != "" {
+		fileService, err := quotes.NewFileService(cfg.QuotesFile)
+		if err != nil {
+			logger.Error("Failed to load quotes", "error", err, "path", cfg.QuotesFile)
+			log.Fatalf("Quotes loading failed: %v", err)
+		}
+		fileService.SetNoRepeat(cfg.QuotesNoRepeat)
+		logger.Info("Quotes loaded", "path", cfg.QuotesFile, "count", fileService.Len())
+
+		// Hot-reload quotes when the file changes
+		if cfg.QuotesReloadInterval > 0 {
+			go fileService.Watch(ctx, cfg.QuotesReloadInterval, func(err error) {
+				if err != nil {
+					logger.Error("Failed to reload quotes, keeping previous set", "error", err, "path", cfg.QuotesFile)
+					return
+				}
+				logger.Info("Quotes reloaded", "path", cfg.QuotesFile, "count", fileService.Len())
+			})
+		}
+
+		dailyQuotes = fileService
+	}
+
+	var quotesService quotes.Service = dailyQuotes
+	if cfg.QuoteMode == config.QuoteModeDaily {
+		quotesService = quotes.NewDailyService(dailyQuotes)
+	}
+
+	// Keep oversized quotes from bloating messages
+	if cfg.MaxQuoteLength > 0 {
+		quotesService = quotes.NewTruncatingService(quotesService, cfg.MaxQuoteLength)
+	}
 
 	// Create server
+	// MESSAGE_ENCODING names a known encoding once validated
+	encoding, _ := protocol.EncodingByName(cfg.MessageEncoding)
+
 	serverConfig := server.Config{
-		Host:            cfg.Host,
-		Port:            cfg.Port,
-		ReadTimeout:     cfg.ReadTimeout,
-		WriteTimeout:    cfg.WriteTimeout,
-		MaxConnections:  cfg.MaxConnections,
-		ShutdownTimeout: cfg.ShutdownTimeout,
+		Host:                     cfg.Host,
+		Port:                     cfg.Port,
+		ReadTimeout:              cfg.ReadTimeout,
+		WriteTimeout:             cfg.WriteTimeout,
+		MaxConnections:           cfg.MaxConnections,
+		MaxConnectionsPerIP:      cfg.MaxConnectionsPerIP,
+		ShutdownTimeout:          cfg.ShutdownTimeout,
+		TLSCertFile:              cfg.TLSCertFile,
+		TLSKeyFile:               cfg.TLSKeyFile,
+		RateLimitPerIP:           cfg.RateLimitPerIP,
+		RateLimitBurst:           cfg.RateLimitBurst,
+		GlobalChallengeRate:      cfg.GlobalChallengeRate,
+		MaxQuotesPerRequest:      cfg.MaxQuotesPerRequest,
+		ConnectionDeadline:       cfg.ConnectionDeadline,
+		MaxRequestsPerConnection: cfg.MaxRequestsPerConn,
+		LegacyFraming:            cfg.LegacyFraming,
+		StrictDecoding:           cfg.StrictDecoding,
+		TrustedTokens:            cfg.TrustedTokens,
+		MaxMessageSize:           cfg.MaxMessageSize,
+		TCPKeepAlive:             cfg.TCPKeepAlive,
+		Network:                  cfg.Network,
+		SocketPath:               cfg.SocketPath,
+		BusyRetryAfter:           cfg.CleanupInterval, // Expired challenges free their slots this often
+		BindToIP:                 cfg.BindToIP,
+		ServerInfo:               "pow-server/" + build.Version,
+		SubscriptionMinInterval:  cfg.SubscribeMinInterval,
+		SubscriptionMaxDuration:  cfg.SubscribeMaxDuration,
+		HeartbeatInterval:        cfg.HeartbeatInterval,
+		AcceptQueueSize:          cfg.AcceptQueueSize,
+		AcceptQueueTimeout:       cfg.AcceptQueueTimeout,
+		AcceptWorkers:            cfg.AcceptWorkers,
+		ListenRetries:            cfg.PortRetry,
+		ListenRetryDelay:         cfg.PortRetryDelay,
+		MinDifficulty:            cfg.MinEffectiveDifficulty,
+		Encoding:                 encoding,
 	}
 
-	srv := server.NewServer(serverConfig, powService, quotesService, logger)
+	// Record every challenge and proof outcome for auditing
+	if cfg.AuditLogFile != "" {
+		auditFile, err := os.OpenFile(cfg.AuditLogFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+		if err != nil {
+			logger.Error("Failed to open audit log", "error", err, "path", cfg.AuditLogFile)
+			log.Fatalf("Failed to open audit log: %v", err)
+		}
+		defer auditFile.Close()
+		serverConfig.AuditHook = server.NewJSONLinesAuditHook(auditFile)
+		logger.Info("Audit log enabled", "path", cfg.AuditLogFile)
+	}
 
-	// Setup graceful shutdown
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	srv := server.NewServer(serverConfig, powService, quotesService, logger)
 
 	// Handle OS signals
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
+	// SIGHUP applies a new POW_DIFFICULTY, e.g. to harden the server during an attack
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case <-hupChan:
+				reloadDifficulty(cfg, *configFile, powService, logger)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// Health probes outlive ctx so /readyz reports 503 while connections drain,
+	// and stop once the server has finished shutting down
+	healthCtx, stopHealth := context.WithCancel(context.Background())
+	healthDone := make(chan struct{})
+	if cfg.HealthPort != "" {
+		health := server.NewHealthServer(net.JoinHostPort(cfg.Host, cfg.HealthPort), srv, logger)
+		go func() {
+			defer close(healthDone)
+			if err := health.ListenAndServe(healthCtx); err != nil {
+				logger.Error("Health server error", "error", err)
+			}
+		}()
+	} else {
+		close(healthDone)
+	}
+
+	// The admin listener likewise keeps answering while connections drain
+	adminCtx, stopAdmin := context.WithCancel(context.Background())
+	adminDone := make(chan struct{})
+	if cfg.AdminPort != "" {
+		admin := server.NewAdminServer(net.JoinHostPort(cfg.Host, cfg.AdminPort), cfg.AdminToken, srv, difficultyValidator(cfg), logger)
+		go func() {
+			defer close(adminDone)
+			if err := admin.ListenAndServe(adminCtx); err != nil {
+				logger.Error("Admin server error", "error", err)
+			}
+		}()
+	} else {
+		close(adminDone)
+	}
+
 	// Start server in a goroutine
 	errChan := make(chan error, 1)
 	go func() {
+		err := srv.ListenAndServe(ctx)
+		stopHealth()
+		stopAdmin()
+		<-healthDone
+		<-adminDone
 		// Always send to channel, even if no error (nil means clean shutdown)
-		errChan <- srv.ListenAndServe(ctx)
+		errChan <- err
 	}()
 
 	// Wait for shutdown signal or error
@@ -89,6 +291,10 @@ func main() {
 	case err := <-errChan:
 		// Server exited on its own (not due to signal)
 		cancel()
+		if errors.Is(err, server.ErrAddressInUse) {
+			logger.Error("Address already in use, stop the other server, change SERVER_PORT or SOCKET_PATH, or set PORT_RETRY to wait for it", "error", err)
+			log.Fatal(err)
+		}
 		if err != nil {
 			logger.Error("Server error", "error", err)
 			log.Fatal(err)
@@ -99,3 +305,87 @@ func main() {
 
 	logger.Info("Server stopped")
 }
+
+// difficultySetter is implemented by every PoW service
+type difficultySetter interface {
+	SetDifficulty(difficulty int)
+}
+
+// zeroDifficultyAllower is implemented by every PoW service
+type zeroDifficultyAllower interface {
+	SetAllowZeroDifficulty(allow bool)
+}
+
+// namespaceSetter is implemented by every PoW service
+type namespaceSetter interface {
+	SetNamespace(namespace string)
+}
+
+// targetSetter is implemented by the stateful SHA-256 PoW service
+type targetSetter interface {
+	SetTarget(target *big.Int)
+}
+
+// loadConfig loads the configuration from the environment, on top of configFile if set,
+// and validates it
+func loadConfig(configFile string) (config.ServerConfig, error) {
+	if configFile != "" {
+		return config.LoadServerConfigFromFile(configFile)
+	}
+	cfg := config.LoadServerConfig()
+	return cfg, cfg.Validate()
+}
+
+// reloadDifficulty re-reads POW_DIFFICULTY, from the .env file if it sets it since the
+// process environment can't change, or else from configFile, and applies it to new
+// challenges. Challenges already issued stay verifiable at their own difficulty. An
+// invalid value keeps the current one.
+func reloadDifficulty(cfg config.ServerConfig, configFile string, powService pow.ChallengeService, logger *slog.Logger) {
+	setter, ok := powService.(difficultySetter)
+	if !ok {
+		logger.Warn("PoW service does not support changing difficulty")
+		return
+	}
+
+	difficulty, err := reloadedDifficulty(configFile)
+	if err != nil {
+		logger.Error("Invalid configuration on reload, keeping current difficulty", "error", err, "difficulty", powService.GetDifficulty())
+		return
+	}
+	if err := difficultyValidator(cfg)(difficulty); err != nil {
+		logger.Error("Invalid difficulty on reload, keeping current", "error", err, "difficulty", powService.GetDifficulty())
+		return
+	}
+
+	previous := powService.GetDifficulty()
+	setter.SetDifficulty(difficulty)
+	logger.Info("Difficulty reloaded", "previous", previous, "difficulty", difficulty)
+}
+
+// reloadedDifficulty returns POW_DIFFICULTY from the .env file if it sets it, or else
+// from the configuration loaded anew. The process environment is left alone.
+func reloadedDifficulty(configFile string) (int, error) {
+	if env, err := godotenv.Read(); err == nil {
+		if value, ok := env["POW_DIFFICULTY"]; ok {
+			difficulty, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return 0, fmt.Errorf("POW_DIFFICULTY in .env must be an integer, got: %q", value)
+			}
+			return difficulty, nil
+		}
+	}
+
+	reloaded, err := loadConfig(configFile)
+	if err != nil {
+		return 0, err
+	}
+	return reloaded.Difficulty, nil
+}
+
+// difficultyValidator returns a check that a difficulty is valid for cfg's algorithm
+func difficultyValidator(cfg config.ServerConfig) func(difficulty int) error {
+	return func(difficulty int) error {
+		cfg.Difficulty = difficulty
+		return cfg.Validate()
+	}
+}
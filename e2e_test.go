@@ -2,10 +2,13 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net"
 	"os"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -26,7 +29,7 @@ func TestE2E_FullFlow(t *testing.T) {
 	// Setup server
 	difficulty := 1 // Low difficulty for fast tests
 	powService := pow.NewSHA256HashcashService(difficulty, 5*time.Minute)
-	quotesService := quotes.NewInMemoryService()
+	quotesService := quotes.NewInMemoryServiceWithSeed(42) // Seeded, so the first quote is known
 
 	serverConfig := server.Config{
 		Host:            "127.0.0.1",
@@ -35,6 +38,7 @@ func TestE2E_FullFlow(t *testing.T) {
 		WriteTimeout:    10 * time.Second,
 		MaxConnections:  10,
 		ShutdownTimeout: 5 * time.Second,
+		ServerInfo:      "pow-server/test",
 	}
 
 	srv := server.NewServer(serverConfig, powService, quotesService, logger)
@@ -43,14 +47,8 @@ func TestE2E_FullFlow(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	serverReady := make(chan struct{})
-	go func() {
-		close(serverReady)
-		srv.ListenAndServe(ctx)
-	}()
-
-	<-serverReady
-	time.Sleep(100 * time.Millisecond) // Give server time to bind
+	go srv.ListenAndServe(ctx)
+	waitServerReady(t, srv)
 
 	// Setup client
 	clientPowService := pow.NewSHA256HashcashService(0, 0)
@@ -75,13 +73,43 @@ func TestE2E_FullFlow(t *testing.T) {
 			t.Fatalf("Failed to get quote: %v", err)
 		}
 
-		if quote == "" {
-			t.Error("Quote should not be empty")
+		if expected := quotes.NewInMemoryServiceWithSeed(42).GetRandomQuote(); quote != expected {
+			t.Errorf("Expected quote %q, got %q", expected, quote)
 		}
 
 		t.Logf("Received quote: %s", quote)
 	})
 
+	// Test: The detailed result describes the solved challenge
+	t.Run("DetailedResult", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		result, err := c.RequestQuoteDetailed(ctx)
+		if err != nil {
+			t.Fatalf("Failed to get quote: %v", err)
+		}
+
+		if result.Quote == "" {
+			t.Error("Expected a quote")
+		}
+		if result.Difficulty != difficulty {
+			t.Errorf("Expected difficulty %d, got %d", difficulty, result.Difficulty)
+		}
+		if result.Nonce == "" {
+			t.Error("Expected the accepted nonce")
+		}
+		if result.SolveDuration <= 0 {
+			t.Errorf("Expected a positive solve duration, got %v", result.SolveDuration)
+		}
+		if result.Attempts < 1 {
+			t.Errorf("Expected at least one attempt, got %d", result.Attempts)
+		}
+		if result.ServerInfo != "pow-server/test" {
+			t.Errorf("Expected server info %q, got %q", "pow-server/test", result.ServerInfo)
+		}
+	})
+
 	// Test: Invalid proof should be rejected
 	t.Run("InvalidProofRejected", func(t *testing.T) {
 		conn, err := net.DialTimeout("tcp", "127.0.0.1:18090", 5*time.Second)
@@ -98,7 +126,7 @@ func TestE2E_FullFlow(t *testing.T) {
 
 		// Send invalid proof
 		proofMsg := protocol.ProofMessage{
-			BaseMessage: protocol.BaseMessage{Type: protocol.MsgTypeProof},
+			BaseMessage: protocol.NewBaseMessage(protocol.MsgTypeProof),
 			Challenge:   challengeMsg.Challenge,
 			Nonce:       "invalid_nonce_12345",
 		}
@@ -146,7 +174,7 @@ func TestE2E_FullFlow(t *testing.T) {
 		}
 
 		proofMsg := protocol.ProofMessage{
-			BaseMessage: protocol.BaseMessage{Type: protocol.MsgTypeProof},
+			BaseMessage: protocol.NewBaseMessage(protocol.MsgTypeProof),
 			Challenge:   wrongChallenge, // Wrong challenge!
 			Nonce:       nonce,
 		}
@@ -175,6 +203,10 @@ func TestE2E_FullFlow(t *testing.T) {
 			t.Errorf("Expected 'Challenge mismatch' error, got: %s", errMsg)
 		}
 
+		if code := response["code"]; code != string(protocol.ErrCodeChallengeMismatch) {
+			t.Errorf("Expected %q error code, got: %v", protocol.ErrCodeChallengeMismatch, code)
+		}
+
 		t.Logf("Server correctly rejected wrong challenge")
 	})
 
@@ -244,14 +276,8 @@ func TestE2E_Timeout(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	serverReady := make(chan struct{})
-	go func() {
-		close(serverReady)
-		srv.ListenAndServe(ctx)
-	}()
-
-	<-serverReady
-	time.Sleep(100 * time.Millisecond) // Give server time to bind
+	go srv.ListenAndServe(ctx)
+	waitServerReady(t, srv)
 
 	// Setup client with very short timeout
 	clientPowService := pow.NewSHA256HashcashService(0, 0)
@@ -283,3 +309,1450 @@ func TestE2E_Timeout(t *testing.T) {
 	cancel()
 	time.Sleep(100 * time.Millisecond)
 }
+
+// TestE2E_ProtocolVersionMismatch tests that both sides reject incompatible protocol versions
+func TestE2E_ProtocolVersionMismatch(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	difficulty := 1
+	powService := pow.NewSHA256HashcashService(difficulty, 5*time.Minute)
+	quotesService := quotes.NewInMemoryService()
+
+	serverConfig := server.Config{
+		Host:            "127.0.0.1",
+		Port:            "18093",
+		ReadTimeout:     10 * time.Second,
+		WriteTimeout:    10 * time.Second,
+		MaxConnections:  10,
+		ShutdownTimeout: 5 * time.Second,
+	}
+
+	srv := server.NewServer(serverConfig, powService, quotesService, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go srv.ListenAndServe(ctx)
+	waitServerReady(t, srv)
+
+	// Test: Older (unversioned) client talking to a newer server
+	t.Run("OlderClientRejectedByServer", func(t *testing.T) {
+		conn, err := net.DialTimeout("tcp", "127.0.0.1:18093", 5*time.Second)
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		defer conn.Close()
+
+		var challengeMsg protocol.ChallengeMessage
+		if err := protocol.ReadMessage(conn, &challengeMsg, 10*time.Second); err != nil {
+			t.Fatalf("Failed to read challenge: %v", err)
+		}
+
+		if challengeMsg.Version != protocol.CurrentProtocolVersion {
+			t.Errorf("Expected server version %d, got %d", protocol.CurrentProtocolVersion, challengeMsg.Version)
+		}
+
+		nonce, err := powService.SolveChallenge(context.Background(), challengeMsg.Challenge, difficulty)
+		if err != nil {
+			t.Fatalf("Failed to solve challenge: %v", err)
+		}
+
+		// A pre-versioning client omits the version field entirely
+		proofMsg := protocol.ProofMessage{
+			BaseMessage: protocol.BaseMessage{Type: protocol.MsgTypeProof},
+			Challenge:   challengeMsg.Challenge,
+			Nonce:       nonce,
+		}
+
+		if err := protocol.WriteMessage(conn, proofMsg, 10*time.Second); err != nil {
+			t.Fatalf("Failed to send proof: %v", err)
+		}
+
+		var response protocol.ErrorMessage
+		if err := protocol.ReadMessage(conn, &response, 10*time.Second); err != nil {
+			t.Fatalf("Failed to read response: %v", err)
+		}
+
+		if response.Type != protocol.MsgTypeError || !strings.Contains(response.Message, "unsupported protocol version") {
+			t.Errorf("Expected protocol version error, got: %+v", response)
+		}
+	})
+
+	// Test: Current client talking to a newer server
+	t.Run("NewerServerRejectedByClient", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Failed to listen: %v", err)
+		}
+		defer listener.Close()
+
+		// Fake server that speaks a future protocol version
+		serverErr := make(chan error, 1)
+		reported := make(chan protocol.ErrorMessage, 1)
+		go func() {
+			conn, err := listener.Accept()
+			if err != nil {
+				serverErr <- err
+				return
+			}
+			defer conn.Close()
+
+			challengeMsg := protocol.ChallengeMessage{
+				BaseMessage: protocol.BaseMessage{Type: protocol.MsgTypeChallenge, Version: protocol.CurrentProtocolVersion + 1},
+				Challenge:   "1234567890:abcdef",
+				Difficulty:  difficulty,
+			}
+			if err := protocol.WriteMessage(conn, challengeMsg, 5*time.Second); err != nil {
+				serverErr <- err
+				return
+			}
+
+			var errMsg protocol.ErrorMessage
+			if err := protocol.ReadMessage(conn, &errMsg, 5*time.Second); err != nil {
+				serverErr <- err
+				return
+			}
+			reported <- errMsg
+		}()
+
+		_, port, _ := net.SplitHostPort(listener.Addr().String())
+		c := client.NewClient(client.Config{
+			ServerHost:     "127.0.0.1",
+			ServerPort:     port,
+			ConnectTimeout: 5 * time.Second,
+			ReadTimeout:    5 * time.Second,
+			WriteTimeout:   5 * time.Second,
+			SolveTimeout:   5 * time.Second,
+		}, pow.NewSHA256HashcashService(0, 0), logger)
+
+		_, err = c.RequestQuote(context.Background())
+		if err == nil || !strings.Contains(err.Error(), "unsupported protocol version") {
+			t.Errorf("Expected protocol version error from client, got: %v", err)
+		}
+
+		select {
+		case errMsg := <-reported:
+			if errMsg.Type != protocol.MsgTypeError {
+				t.Errorf("Expected client to report an error message, got type: %s", errMsg.Type)
+			}
+		case err := <-serverErr:
+			t.Fatalf("Fake server failed: %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Client did not report the version mismatch")
+		}
+	})
+}
+
+// TestE2E_BatchQuotes tests requesting several quotes for a single proof
+func TestE2E_BatchQuotes(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	powService := pow.NewSHA256HashcashService(1, 5*time.Minute)
+	quotesService := quotes.NewInMemoryService()
+
+	serverConfig := server.Config{
+		Host:                "127.0.0.1",
+		Port:                "18094",
+		ReadTimeout:         10 * time.Second,
+		WriteTimeout:        10 * time.Second,
+		MaxConnections:      10,
+		ShutdownTimeout:     5 * time.Second,
+		MaxQuotesPerRequest: 3,
+	}
+
+	srv := server.NewServer(serverConfig, powService, quotesService, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go srv.ListenAndServe(ctx)
+	waitServerReady(t, srv)
+
+	c := client.NewClient(client.Config{
+		ServerHost:     "127.0.0.1",
+		ServerPort:     "18094",
+		ConnectTimeout: 5 * time.Second,
+		ReadTimeout:    10 * time.Second,
+		WriteTimeout:   10 * time.Second,
+		SolveTimeout:   30 * time.Second,
+	}, pow.NewSHA256HashcashService(0, 0), logger)
+
+	tests := []struct {
+		name      string
+		requested int
+		want      int
+	}{
+		{name: "Single", requested: 1, want: 1},
+		{name: "Several", requested: 2, want: 2},
+		{name: "OverCap", requested: 50, want: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reqCtx, reqCancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer reqCancel()
+
+			got, err := c.RequestQuotes(reqCtx, tt.requested)
+			if err != nil {
+				t.Fatalf("RequestQuotes failed: %v", err)
+			}
+
+			if len(got) != tt.want {
+				t.Errorf("Expected %d quotes, got %d", tt.want, len(got))
+			}
+
+			for i, quote := range got {
+				if quote == "" {
+					t.Errorf("Quote %d is empty", i)
+				}
+			}
+		})
+	}
+
+	t.Run("InvalidCount", func(t *testing.T) {
+		if _, err := c.RequestQuotes(context.Background(), 0); err == nil {
+			t.Error("Expected error for non-positive count")
+		}
+	})
+}
+
+// TestE2E_TypedServerError tests that server error responses surface as *client.ServerError
+func TestE2E_TypedServerError(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	// Fake server that rejects every proof as rate limited
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		challengeMsg := protocol.ChallengeMessage{
+			BaseMessage: protocol.NewBaseMessage(protocol.MsgTypeChallenge),
+			Challenge:   "1234567890:abcdef",
+			Difficulty:  1,
+		}
+		if err := protocol.WriteMessage(conn, challengeMsg, 5*time.Second); err != nil {
+			return
+		}
+
+		var proofMsg protocol.ProofMessage
+		if err := protocol.ReadMessage(conn, &proofMsg, 5*time.Second); err != nil {
+			return
+		}
+
+		errMsg := protocol.ErrorMessage{
+			BaseMessage: protocol.NewBaseMessage(protocol.MsgTypeError),
+			Code:        protocol.ErrCodeRateLimited,
+			Message:     "rate limited",
+		}
+		protocol.WriteMessage(conn, errMsg, 5*time.Second)
+	}()
+
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	c := client.NewClient(client.Config{
+		ServerHost:     "127.0.0.1",
+		ServerPort:     port,
+		ConnectTimeout: 5 * time.Second,
+		ReadTimeout:    5 * time.Second,
+		WriteTimeout:   5 * time.Second,
+		SolveTimeout:   5 * time.Second,
+	}, pow.NewSHA256HashcashService(0, 0), logger)
+
+	_, err = c.RequestQuote(context.Background())
+	if err == nil {
+		t.Fatal("Expected server error, got nil")
+	}
+
+	var serverErr *client.ServerError
+	if !errors.As(err, &serverErr) {
+		t.Fatalf("Expected *client.ServerError in chain, got: %v", err)
+	}
+
+	if serverErr.Code != protocol.ErrCodeRateLimited {
+		t.Errorf("Expected code %q, got %q", protocol.ErrCodeRateLimited, serverErr.Code)
+	}
+
+	if serverErr.Message != "rate limited" {
+		t.Errorf("Expected message 'rate limited', got %q", serverErr.Message)
+	}
+
+	t.Logf("Client error string: %v", err)
+}
+
+// TestE2E_Session tests fetching several quotes over one keep-alive connection
+func TestE2E_Session(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	difficulty := 1
+	powService := pow.NewSHA256HashcashService(difficulty, 5*time.Minute)
+	quotesService := quotes.NewInMemoryService()
+
+	serverConfig := server.Config{
+		Host:                     "127.0.0.1",
+		Port:                     "18095",
+		ReadTimeout:              10 * time.Second,
+		WriteTimeout:             10 * time.Second,
+		MaxConnections:           10,
+		ShutdownTimeout:          5 * time.Second,
+		MaxRequestsPerConnection: 3,
+	}
+
+	srv := server.NewServer(serverConfig, powService, quotesService, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go srv.ListenAndServe(ctx)
+	waitServerReady(t, srv)
+
+	clientConfig := client.Config{
+		ServerHost:     "127.0.0.1",
+		ServerPort:     "18095",
+		ConnectTimeout: 5 * time.Second,
+		ReadTimeout:    10 * time.Second,
+		WriteTimeout:   10 * time.Second,
+		SolveTimeout:   30 * time.Second,
+	}
+
+	c := client.NewClient(clientConfig, pow.NewSHA256HashcashService(0, 0), logger)
+
+	t.Run("ThreeQuotes", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		session := c.NewSession()
+
+		if _, err := session.Next(ctx); !errors.Is(err, client.ErrSessionNotOpen) {
+			t.Errorf("Expected ErrSessionNotOpen before Open, got: %v", err)
+		}
+
+		if err := session.Open(ctx); err != nil {
+			t.Fatalf("Failed to open session: %v", err)
+		}
+
+		for i := 0; i < 3; i++ {
+			quote, err := session.Next(ctx)
+			if err != nil {
+				t.Fatalf("Quote %d failed: %v", i, err)
+			}
+			if quote == "" {
+				t.Errorf("Quote %d is empty", i)
+			}
+		}
+
+		// Server allows only 3 requests per connection
+		if _, err := session.Next(ctx); !errors.Is(err, client.ErrSessionEnded) {
+			t.Errorf("Expected ErrSessionEnded after server limit, got: %v", err)
+		}
+
+		if err := session.Close(); err != nil {
+			t.Errorf("Close failed: %v", err)
+		}
+		if err := session.Close(); err != nil {
+			t.Errorf("Second Close should be a no-op, got: %v", err)
+		}
+
+		if _, err := session.Next(ctx); !errors.Is(err, client.ErrSessionClosed) {
+			t.Errorf("Expected ErrSessionClosed after Close, got: %v", err)
+		}
+	})
+
+	t.Run("CloseMidSession", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		session := c.NewSession()
+		if err := session.Open(ctx); err != nil {
+			t.Fatalf("Failed to open session: %v", err)
+		}
+
+		if _, err := session.Next(ctx); err != nil {
+			t.Fatalf("Failed to get quote: %v", err)
+		}
+
+		if err := session.Close(); err != nil {
+			t.Errorf("Close failed: %v", err)
+		}
+
+		// Server must release the connection after the close message
+		deadline := time.Now().Add(5 * time.Second)
+		for srv.GetActiveConnections() > 0 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if active := srv.GetActiveConnections(); active != 0 {
+			t.Errorf("Expected no active connections after Close, got %d", active)
+		}
+	})
+}
+
+// countingListener tracks how many accepted connections are open at once
+type countingListener struct {
+	net.Listener
+	open atomic.Int32
+	peak atomic.Int32
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	open := l.open.Add(1)
+	for peak := l.peak.Load(); open > peak && !l.peak.CompareAndSwap(peak, open); peak = l.peak.Load() {
+	}
+	return &countedConn{Conn: conn, open: &l.open}, nil
+}
+
+// countedConn decrements its listener's open count once closed
+type countedConn struct {
+	net.Conn
+	open   *atomic.Int32
+	closed atomic.Bool
+}
+
+func (c *countedConn) Close() error {
+	if c.closed.CompareAndSwap(false, true) {
+		c.open.Add(-1)
+	}
+	return c.Conn.Close()
+}
+
+// TestE2E_Pool tests fetching many quotes concurrently over a bounded pool of sessions
+func TestE2E_Pool(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	powService := pow.NewSHA256HashcashService(1, 5*time.Minute)
+	known := map[string]bool{"First pooled quote": true, "Second pooled quote": true}
+	quotesService := quotes.NewInMemoryServiceWithQuotes([]quotes.Quote{{Text: "First pooled quote"}, {Text: "Second pooled quote"}})
+
+	// Connections end after a few rounds, so the pool has to replace its sessions
+	srv := server.NewServer(server.Config{
+		ReadTimeout:              10 * time.Second,
+		WriteTimeout:             10 * time.Second,
+		MaxConnections:           20,
+		ShutdownTimeout:          5 * time.Second,
+		MaxRequestsPerConnection: 5,
+	}, powService, quotesService, logger)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	counting := &countingListener{Listener: ln}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.Serve(ctx, counting)
+	waitServerReady(t, srv)
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	c := client.NewClient(client.Config{
+		ServerHost:     "127.0.0.1",
+		ServerPort:     port,
+		ConnectTimeout: 5 * time.Second,
+		ReadTimeout:    10 * time.Second,
+		WriteTimeout:   10 * time.Second,
+		SolveTimeout:   30 * time.Second,
+	}, pow.NewSHA256HashcashService(0, 0), logger)
+
+	const size, workers, perWorker = 4, 16, 10
+	pool := c.NewPool(size)
+
+	reqCtx, reqCancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer reqCancel()
+
+	errs := make(chan error, workers*perWorker)
+	quoteCh := make(chan string, workers*perWorker)
+	for w := 0; w < workers; w++ {
+		go func() {
+			for i := 0; i < perWorker; i++ {
+				quote, err := pool.GetQuote(reqCtx)
+				if err != nil {
+					errs <- err
+					continue
+				}
+				quoteCh <- quote
+			}
+		}()
+	}
+	for i := 0; i < workers*perWorker; i++ {
+		select {
+		case err := <-errs:
+			t.Fatalf("GetQuote failed: %v", err)
+		case quote := <-quoteCh:
+			if !known[quote] {
+				t.Errorf("Unexpected quote: %q", quote)
+			}
+		}
+	}
+
+	if peak := counting.peak.Load(); peak > size {
+		t.Errorf("Expected at most %d connections at once, got %d", size, peak)
+	}
+
+	stats := pool.Stats()
+	if stats.Size != size || stats.InUse != 0 || stats.Open > size {
+		t.Errorf("Unexpected pool stats once idle: %+v", stats)
+	}
+	// Each session serves at most 5 quotes before the server ends it
+	if minOpened := workers * perWorker / 5; stats.Opened < minOpened || stats.Discarded < stats.Opened-size {
+		t.Errorf("Expected ended sessions to be replaced, got: %+v", stats)
+	}
+
+	if err := pool.Close(); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+	if _, err := pool.GetQuote(reqCtx); !errors.Is(err, client.ErrPoolClosed) {
+		t.Errorf("Expected ErrPoolClosed after Close, got: %v", err)
+	}
+	if stats := pool.Stats(); stats.Open != 0 {
+		t.Errorf("Expected no open sessions after Close, got: %+v", stats)
+	}
+}
+
+// TestE2E_LegacyFraming tests that the little-endian compatibility mode interoperates
+func TestE2E_LegacyFraming(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	powService := pow.NewSHA256HashcashService(1, 5*time.Minute)
+	quotesService := quotes.NewInMemoryService()
+
+	serverConfig := server.Config{
+		Host:            "127.0.0.1",
+		Port:            "18096",
+		ReadTimeout:     2 * time.Second,
+		WriteTimeout:    2 * time.Second,
+		MaxConnections:  10,
+		ShutdownTimeout: 5 * time.Second,
+		LegacyFraming:   true,
+	}
+
+	srv := server.NewServer(serverConfig, powService, quotesService, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go srv.ListenAndServe(ctx)
+	waitServerReady(t, srv)
+
+	clientConfig := client.Config{
+		ServerHost:     "127.0.0.1",
+		ServerPort:     "18096",
+		ConnectTimeout: 5 * time.Second,
+		ReadTimeout:    2 * time.Second,
+		WriteTimeout:   2 * time.Second,
+		SolveTimeout:   30 * time.Second,
+	}
+
+	t.Run("LegacyClient", func(t *testing.T) {
+		legacyConfig := clientConfig
+		legacyConfig.LegacyFraming = true
+		c := client.NewClient(legacyConfig, pow.NewSHA256HashcashService(0, 0), logger)
+
+		quote, err := c.RequestQuote(context.Background())
+		if err != nil {
+			t.Fatalf("Legacy client failed against legacy server: %v", err)
+		}
+		if quote == "" {
+			t.Error("Expected non-empty quote")
+		}
+	})
+
+	t.Run("DefaultClient", func(t *testing.T) {
+		c := client.NewClient(clientConfig, pow.NewSHA256HashcashService(0, 0), logger)
+
+		if _, err := c.RequestQuote(context.Background()); err == nil {
+			t.Error("Big-endian client should not understand little-endian framing")
+		}
+	})
+}
+
+// startFlakyServer starts a fake server that answers the first failures connections
+// with an error of the given code and retry hint, and serves a quote afterwards.
+// It returns the port and a counter of accepted connections.
+func startFlakyServer(t *testing.T, failures int32, code protocol.ErrorCode, retryAfter time.Duration) (string, *int32) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	var connections int32
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func(conn net.Conn) {
+				defer conn.Close()
+
+				if atomic.AddInt32(&connections, 1) <= failures {
+					errMsg := protocol.ErrorMessage{
+						BaseMessage:  protocol.NewBaseMessage(protocol.MsgTypeError),
+						Code:         code,
+						Message:      string(code),
+						RetryAfterMs: retryAfter.Milliseconds(),
+					}
+					protocol.WriteMessage(conn, errMsg, 5*time.Second)
+					return
+				}
+
+				challengeMsg := protocol.ChallengeMessage{
+					BaseMessage: protocol.NewBaseMessage(protocol.MsgTypeChallenge),
+					Challenge:   "1234567890:abcdef",
+					Difficulty:  1,
+				}
+				if err := protocol.WriteMessage(conn, challengeMsg, 5*time.Second); err != nil {
+					return
+				}
+
+				var proofMsg protocol.ProofMessage
+				if err := protocol.ReadMessage(conn, &proofMsg, 5*time.Second); err != nil {
+					return
+				}
+
+				quoteMsg := protocol.QuoteMessage{
+					BaseMessage: protocol.NewBaseMessage(protocol.MsgTypeQuote),
+					Quote:       "Persistence pays off",
+				}
+				protocol.WriteMessage(conn, quoteMsg, 5*time.Second)
+			}(conn)
+		}
+	}()
+
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	return port, &connections
+}
+
+// TestE2E_RetryTransientErrors tests client retries with backoff
+func TestE2E_RetryTransientErrors(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	newClient := func(port string, maxRetries int) *client.Client {
+		return client.NewClient(client.Config{
+			ServerHost:     "127.0.0.1",
+			ServerPort:     port,
+			ConnectTimeout: 5 * time.Second,
+			ReadTimeout:    5 * time.Second,
+			WriteTimeout:   5 * time.Second,
+			SolveTimeout:   5 * time.Second,
+			MaxRetries:     maxRetries,
+			RetryBaseDelay: 10 * time.Millisecond,
+		}, pow.NewSHA256HashcashService(0, 0), logger)
+	}
+
+	t.Run("SucceedsAfterTransientFailures", func(t *testing.T) {
+		port, connections := startFlakyServer(t, 2, protocol.ErrCodeRateLimited, 0)
+
+		quote, err := newClient(port, 3).RequestQuote(context.Background())
+		if err != nil {
+			t.Fatalf("Expected success after retries, got: %v", err)
+		}
+		if quote != "Persistence pays off" {
+			t.Errorf("Unexpected quote: %q", quote)
+		}
+		if n := atomic.LoadInt32(connections); n != 3 {
+			t.Errorf("Expected 3 connections, got %d", n)
+		}
+	})
+
+	t.Run("GivesUpAfterMaxRetries", func(t *testing.T) {
+		port, connections := startFlakyServer(t, 10, protocol.ErrCodeOverloaded, 0)
+
+		_, err := newClient(port, 2).RequestQuote(context.Background())
+		var serverErr *client.ServerError
+		if !errors.As(err, &serverErr) || serverErr.Code != protocol.ErrCodeOverloaded {
+			t.Fatalf("Expected overloaded server error, got: %v", err)
+		}
+		if n := atomic.LoadInt32(connections); n != 3 {
+			t.Errorf("Expected 1 attempt plus 2 retries, got %d connections", n)
+		}
+	})
+
+	t.Run("HonorsRetryAfterHint", func(t *testing.T) {
+		port, connections := startFlakyServer(t, 1, protocol.ErrCodeOverloaded, 200*time.Millisecond)
+
+		start := time.Now()
+		if _, err := newClient(port, 3).RequestQuote(context.Background()); err != nil {
+			t.Fatalf("Expected success after retry, got: %v", err)
+		}
+		// The base delay is 10ms, so only the server's hint explains the wait
+		if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+			t.Errorf("Expected client to wait for the 200ms retry hint, retried after %v", elapsed)
+		}
+		if n := atomic.LoadInt32(connections); n != 2 {
+			t.Errorf("Expected 2 connections, got %d", n)
+		}
+	})
+
+	t.Run("NonRetryableFailsFast", func(t *testing.T) {
+		port, connections := startFlakyServer(t, 10, protocol.ErrCodeInvalidProof, 0)
+
+		if _, err := newClient(port, 3).RequestQuote(context.Background()); err == nil {
+			t.Fatal("Expected invalid proof error")
+		}
+		if n := atomic.LoadInt32(connections); n != 1 {
+			t.Errorf("Expected no retries for invalid proof, got %d connections", n)
+		}
+	})
+
+	t.Run("RespectsContextDeadline", func(t *testing.T) {
+		port, connections := startFlakyServer(t, 10, protocol.ErrCodeRateLimited, 0)
+
+		c := client.NewClient(client.Config{
+			ServerHost:     "127.0.0.1",
+			ServerPort:     port,
+			ConnectTimeout: 5 * time.Second,
+			ReadTimeout:    5 * time.Second,
+			WriteTimeout:   5 * time.Second,
+			SolveTimeout:   5 * time.Second,
+			MaxRetries:     10,
+			RetryBaseDelay: time.Second,
+		}, pow.NewSHA256HashcashService(0, 0), logger)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		if _, err := c.RequestQuote(ctx); err == nil {
+			t.Fatal("Expected error")
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("Client kept retrying past the context deadline (%v)", elapsed)
+		}
+		if n := atomic.LoadInt32(connections); n != 1 {
+			t.Errorf("Expected no retry that cannot finish before the deadline, got %d connections", n)
+		}
+	})
+
+	t.Run("RetriesConnectionRefused", func(t *testing.T) {
+		// Reserve a port, then free it so connections are refused
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Failed to listen: %v", err)
+		}
+		_, port, _ := net.SplitHostPort(listener.Addr().String())
+		listener.Close()
+
+		start := time.Now()
+		if _, err := newClient(port, 2).RequestQuote(context.Background()); err == nil {
+			t.Fatal("Expected connection error")
+		}
+		// Two backoffs of at least 5ms and 10ms prove the dial was retried
+		if elapsed := time.Since(start); elapsed < 15*time.Millisecond {
+			t.Errorf("Expected retries with backoff, finished in %v", elapsed)
+		}
+	})
+}
+
+// waitServerReady blocks until srv is accepting connections
+func waitServerReady(t *testing.T, srv *server.Server) {
+	t.Helper()
+
+	select {
+	case <-srv.Ready():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server did not become ready")
+	}
+}
+
+// TestE2E_SolveMetrics tests that the client records solve statistics per difficulty
+func TestE2E_SolveMetrics(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	difficulty := 1
+	powService := pow.NewSHA256HashcashService(difficulty, 5*time.Minute)
+
+	serverConfig := server.Config{
+		Host:            "127.0.0.1",
+		Port:            "0",
+		ReadTimeout:     10 * time.Second,
+		WriteTimeout:    10 * time.Second,
+		MaxConnections:  10,
+		ShutdownTimeout: 5 * time.Second,
+	}
+
+	srv := server.NewServer(serverConfig, powService, quotes.NewInMemoryService(), logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go srv.ListenAndServe(ctx)
+	waitServerReady(t, srv)
+
+	_, port, _ := net.SplitHostPort(srv.Addr().String())
+	c := client.NewClient(client.Config{
+		ServerHost:     "127.0.0.1",
+		ServerPort:     port,
+		ConnectTimeout: 5 * time.Second,
+		ReadTimeout:    10 * time.Second,
+		WriteTimeout:   10 * time.Second,
+		SolveTimeout:   30 * time.Second,
+	}, pow.NewSHA256HashcashService(0, 0), logger)
+
+	if len(c.Metrics().Snapshot()) != 0 {
+		t.Fatal("Expected no metrics before any request")
+	}
+
+	const requests = 5
+	for i := 0; i < requests; i++ {
+		if _, err := c.RequestQuote(context.Background()); err != nil {
+			t.Fatalf("Request %d failed: %v", i, err)
+		}
+	}
+
+	snapshot := c.Metrics().Snapshot()
+	stats, ok := snapshot[difficulty]
+	if !ok || len(snapshot) != 1 {
+		t.Fatalf("Expected metrics for difficulty %d only, got %+v", difficulty, snapshot)
+	}
+	if stats.Count != requests {
+		t.Errorf("Expected %d solves, got %d", requests, stats.Count)
+	}
+	if stats.MinDuration > stats.AvgDuration() || stats.AvgDuration() > stats.MaxDuration {
+		t.Errorf("Expected min <= avg <= max, got %v, %v, %v", stats.MinDuration, stats.AvgDuration(), stats.MaxDuration)
+	}
+	if stats.TotalAttempts < requests {
+		t.Errorf("Expected at least one attempt per solve, got %d", stats.TotalAttempts)
+	}
+}
+
+// countingSolver counts how often a challenge actually had to be solved
+type countingSolver struct {
+	pow.SolverService
+	solves int32
+}
+
+func (s *countingSolver) SolveChallenge(ctx context.Context, challenge string, difficulty int) (string, error) {
+	atomic.AddInt32(&s.solves, 1)
+	return s.SolverService.SolveChallenge(ctx, challenge, difficulty)
+}
+
+// TestE2E_ReuseSolvedNonce tests that a retry presented with the same challenge
+// reuses the nonce solved on a connection that dropped before the server answered
+func TestE2E_ReuseSolvedNonce(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	// Every connection gets the same challenge, as a stateless server may hand out;
+	// the first one drops right after the proof arrives
+	nonces := make(chan string, 3)
+	go func() {
+		for i := 0; ; i++ {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			challengeMsg := protocol.ChallengeMessage{
+				BaseMessage: protocol.NewBaseMessage(protocol.MsgTypeChallenge),
+				Challenge:   "1700000000:cafebabe",
+				Difficulty:  2,
+			}
+			var proofMsg protocol.ProofMessage
+			if protocol.WriteMessage(conn, challengeMsg, 5*time.Second) == nil &&
+				protocol.ReadMessage(conn, &proofMsg, 5*time.Second) == nil {
+				nonces <- proofMsg.Nonce
+				if i > 0 {
+					quoteMsg := protocol.QuoteMessage{
+						BaseMessage: protocol.NewBaseMessage(protocol.MsgTypeQuote),
+						Quote:       "Work once, use twice",
+					}
+					protocol.WriteMessage(conn, quoteMsg, 5*time.Second)
+				}
+			}
+			conn.Close()
+		}
+	}()
+
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	solver := &countingSolver{SolverService: pow.NewSHA256HashcashService(0, 0)}
+	c := client.NewClient(client.Config{
+		ServerHost:     "127.0.0.1",
+		ServerPort:     port,
+		ConnectTimeout: 5 * time.Second,
+		ReadTimeout:    5 * time.Second,
+		WriteTimeout:   5 * time.Second,
+		SolveTimeout:   30 * time.Second,
+	}, solver, logger)
+
+	if _, err := c.RequestQuote(context.Background()); err == nil {
+		t.Fatal("Expected the first request to fail when the connection drops")
+	}
+	firstNonce := <-nonces
+
+	quote, err := c.RequestQuote(context.Background())
+	if err != nil {
+		t.Fatalf("Retry failed: %v", err)
+	}
+	if quote != "Work once, use twice" {
+		t.Errorf("Unexpected quote: %q", quote)
+	}
+	if retryNonce := <-nonces; retryNonce != firstNonce {
+		t.Errorf("Expected retry to reuse nonce %q, got %q", firstNonce, retryNonce)
+	}
+	if solves := atomic.LoadInt32(&solver.solves); solves != 1 {
+		t.Errorf("Expected the challenge to be solved once, got %d solves", solves)
+	}
+
+	// Once the server answered, the cached nonce is forgotten
+	if _, err := c.RequestQuote(context.Background()); err != nil {
+		t.Fatalf("Third request failed: %v", err)
+	}
+	<-nonces
+	if solves := atomic.LoadInt32(&solver.solves); solves != 2 {
+		t.Errorf("Expected a fresh solve after the server answered, got %d solves", solves)
+	}
+}
+
+// TestE2E_ReadErrors tests that a server hanging up is reported differently from one that never answers
+func TestE2E_ReadErrors(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	newClient := func(port string) *client.Client {
+		return client.NewClient(client.Config{
+			ServerHost:     "127.0.0.1",
+			ServerPort:     port,
+			ConnectTimeout: 5 * time.Second,
+			ReadTimeout:    200 * time.Millisecond,
+			WriteTimeout:   5 * time.Second,
+			SolveTimeout:   30 * time.Second,
+		}, pow.NewSHA256HashcashService(0, 0), logger)
+	}
+
+	t.Run("ClosedBeforeChallenge", func(t *testing.T) {
+		port := startFakeServer(t, func(conn net.Conn) { conn.Close() })
+
+		_, err := newClient(port).RequestQuote(context.Background())
+		if !errors.Is(err, client.ErrConnectionClosed) {
+			t.Fatalf("Expected ErrConnectionClosed, got: %v", err)
+		}
+		if errors.Is(err, client.ErrReadTimeout) {
+			t.Errorf("Closed connection should not be reported as a timeout: %v", err)
+		}
+		if !strings.Contains(err.Error(), "before sending challenge") {
+			t.Errorf("Expected error to name the challenge, got: %v", err)
+		}
+	})
+
+	t.Run("NoChallenge", func(t *testing.T) {
+		release := make(chan struct{})
+		t.Cleanup(func() { close(release) })
+		port := startFakeServer(t, func(conn net.Conn) {
+			defer conn.Close()
+			<-release
+		})
+
+		_, err := newClient(port).RequestQuote(context.Background())
+		if !errors.Is(err, client.ErrReadTimeout) {
+			t.Fatalf("Expected ErrReadTimeout, got: %v", err)
+		}
+		if errors.Is(err, client.ErrConnectionClosed) {
+			t.Errorf("Timeout should not be reported as a closed connection: %v", err)
+		}
+		if !strings.Contains(err.Error(), "no challenge within 200ms") {
+			t.Errorf("Expected error to name the challenge and timeout, got: %v", err)
+		}
+	})
+
+	t.Run("ClosedBeforeResponse", func(t *testing.T) {
+		port := startFakeServer(t, func(conn net.Conn) {
+			defer conn.Close()
+			challengeMsg := protocol.ChallengeMessage{
+				BaseMessage: protocol.NewBaseMessage(protocol.MsgTypeChallenge),
+				Challenge:   "1700000000:0badf00d",
+				Difficulty:  1,
+			}
+			var proofMsg protocol.ProofMessage
+			if protocol.WriteMessage(conn, challengeMsg, 5*time.Second) == nil {
+				protocol.ReadMessage(conn, &proofMsg, 5*time.Second)
+			}
+		})
+
+		_, err := newClient(port).RequestQuote(context.Background())
+		if !errors.Is(err, client.ErrConnectionClosed) {
+			t.Fatalf("Expected ErrConnectionClosed, got: %v", err)
+		}
+		if !strings.Contains(err.Error(), "before sending response") {
+			t.Errorf("Expected error to name the response, got: %v", err)
+		}
+	})
+}
+
+func TestE2E_DifficultyCeiling(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	// A rogue server demanding far more work than any legitimate one would
+	proofReceived := make(chan bool, 1)
+	port := startFakeServer(t, func(conn net.Conn) {
+		defer conn.Close()
+		challengeMsg := protocol.ChallengeMessage{
+			BaseMessage: protocol.NewBaseMessage(protocol.MsgTypeChallenge),
+			Challenge:   "1700000000:0badf00d",
+			Difficulty:  1000,
+		}
+		if protocol.WriteMessage(conn, challengeMsg, 5*time.Second) != nil {
+			return
+		}
+		var proofMsg protocol.ProofMessage
+		proofReceived <- protocol.ReadMessage(conn, &proofMsg, 5*time.Second) == nil
+	})
+
+	c := client.NewClient(client.Config{
+		ServerHost:            "127.0.0.1",
+		ServerPort:            port,
+		ConnectTimeout:        5 * time.Second,
+		ReadTimeout:           5 * time.Second,
+		WriteTimeout:          5 * time.Second,
+		SolveTimeout:          30 * time.Second,
+		MaxRetries:            3,
+		MaxAcceptedDifficulty: 40,
+	}, pow.NewSHA256HashcashService(0, 0), logger)
+
+	start := time.Now()
+	_, err := c.RequestQuote(context.Background())
+	if !errors.Is(err, client.ErrDifficultyTooHigh) {
+		t.Fatalf("Expected ErrDifficultyTooHigh, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected the client to refuse immediately, took %v", elapsed)
+	}
+	if !strings.Contains(err.Error(), "8000 bits exceeds the accepted maximum of 40") {
+		t.Errorf("Expected error to name both difficulties, got: %v", err)
+	}
+
+	select {
+	case got := <-proofReceived:
+		if got {
+			t.Error("Expected the client not to send a proof")
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Expected the client to hang up")
+	}
+}
+
+// startFakeServer runs handle for every connection accepted on a random port, returning the port
+func startFakeServer(t *testing.T, handle func(net.Conn)) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go handle(conn)
+		}
+	}()
+
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	return port
+}
+
+// TestE2E_SessionHeartbeat tests that heartbeats keep an idle session open past the server's read timeout
+func TestE2E_SessionHeartbeat(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	const readTimeout = 300 * time.Millisecond
+
+	serverConfig := server.Config{
+		Host:                     "127.0.0.1",
+		Port:                     "0",
+		ReadTimeout:              readTimeout,
+		WriteTimeout:             5 * time.Second,
+		MaxConnections:           10,
+		ShutdownTimeout:          1 * time.Second,
+		MaxRequestsPerConnection: 5,
+		HeartbeatInterval:        100 * time.Millisecond,
+	}
+
+	srv := server.NewServer(serverConfig, pow.NewSHA256HashcashService(1, 5*time.Minute), quotes.NewInMemoryService(), logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go srv.ListenAndServe(ctx)
+	waitServerReady(t, srv)
+	_, port, _ := net.SplitHostPort(srv.Addr().String())
+
+	// idleSession fetches a quote, idles for several read timeouts and fetches another
+	idleSession := func(heartbeatInterval time.Duration) error {
+		c := client.NewClient(client.Config{
+			ServerHost:        "127.0.0.1",
+			ServerPort:        port,
+			ConnectTimeout:    5 * time.Second,
+			ReadTimeout:       5 * time.Second,
+			WriteTimeout:      5 * time.Second,
+			SolveTimeout:      30 * time.Second,
+			HeartbeatInterval: heartbeatInterval,
+		}, pow.NewSHA256HashcashService(0, 0), logger)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		session := c.NewSession()
+		defer session.Close()
+		if err := session.Open(ctx); err != nil {
+			t.Fatalf("Failed to open session: %v", err)
+		}
+		if _, err := session.Next(ctx); err != nil {
+			t.Fatalf("Failed to get first quote: %v", err)
+		}
+
+		time.Sleep(4 * readTimeout)
+
+		_, err := session.Next(ctx)
+		return err
+	}
+
+	t.Run("WithHeartbeats", func(t *testing.T) {
+		if err := idleSession(100 * time.Millisecond); err != nil {
+			t.Fatalf("Expected heartbeats to keep the session open, got: %v", err)
+		}
+	})
+
+	t.Run("WithoutHeartbeats", func(t *testing.T) {
+		if err := idleSession(0); err == nil {
+			t.Fatal("Expected the server to drop a silent session after its read timeout")
+		}
+	})
+}
+
+// TestE2E_TrustedToken tests that a client holding a trusted token gets quotes without solving
+func TestE2E_TrustedToken(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	const trusted = "0123456789abcdef"
+
+	// Far too hard to solve within the test's timeouts
+	powService := pow.NewSHA256HashcashService(5, 5*time.Minute)
+	srv := server.NewServer(server.Config{
+		Host:            "127.0.0.1",
+		Port:            "0",
+		ReadTimeout:     5 * time.Second,
+		WriteTimeout:    5 * time.Second,
+		MaxConnections:  10,
+		ShutdownTimeout: 1 * time.Second,
+		TrustedTokens:   []string{trusted},
+	}, powService, quotes.NewInMemoryService(), logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.ListenAndServe(ctx)
+	waitServerReady(t, srv)
+	_, port, _ := net.SplitHostPort(srv.Addr().String())
+
+	newClient := func(port, token string) *client.Client {
+		return client.NewClient(client.Config{
+			ServerHost:     "127.0.0.1",
+			ServerPort:     port,
+			ConnectTimeout: 5 * time.Second,
+			ReadTimeout:    5 * time.Second,
+			WriteTimeout:   5 * time.Second,
+			SolveTimeout:   time.Second,
+			TrustedToken:   token,
+		}, powService, logger)
+	}
+
+	result, err := newClient(port, trusted).RequestQuoteDetailed(context.Background())
+	if err != nil {
+		t.Fatalf("Expected quote with a trusted token, got: %v", err)
+	}
+	if result.Quote == "" || result.Difficulty != 0 || result.Attempts > 1 {
+		t.Errorf("Expected a quote without solving, got %+v", result)
+	}
+
+	// An untrusted token gets no free pass but still gets a quote for solving the challenge
+	powService.SetDifficulty(1)
+	result, err = newClient(port, "fedcba9876543210").RequestQuoteDetailed(context.Background())
+	if err != nil {
+		t.Fatalf("Expected quote after proof of work with an untrusted token, got: %v", err)
+	}
+	if result.Quote == "" || result.Difficulty != 1 {
+		t.Errorf("Expected a quote for a solved difficulty 1 challenge, got %+v", result)
+	}
+
+	// Servers too old to accept auth messages get a solved proof and never see the token
+	proofs := make(chan protocol.ProofMessage, 1)
+	oldPort := startFakeServer(t, func(conn net.Conn) {
+		defer conn.Close()
+		challengeMsg := protocol.ChallengeMessage{
+			BaseMessage: protocol.BaseMessage{Type: protocol.MsgTypeChallenge, Version: protocol.TokenProtocolVersion - 1},
+			Challenge:   "1700000000:0badf00d",
+			Difficulty:  1,
+		}
+		if protocol.WriteMessage(conn, challengeMsg, 5*time.Second) != nil {
+			return
+		}
+		var proofMsg protocol.ProofMessage
+		if protocol.ReadMessage(conn, &proofMsg, 5*time.Second) != nil {
+			return
+		}
+		proofs <- proofMsg
+		protocol.WriteMessage(conn, protocol.QuoteMessage{
+			BaseMessage: protocol.NewBaseMessage(protocol.MsgTypeQuote),
+			Quote:       "old",
+		}, 5*time.Second)
+	})
+
+	if _, err := newClient(oldPort, trusted).RequestQuote(context.Background()); err != nil {
+		t.Fatalf("Expected quote from the old server, got: %v", err)
+	}
+	proofMsg := <-proofs
+	if proofMsg.Type != protocol.MsgTypeProof || proofMsg.Nonce == "" {
+		t.Errorf("Expected a solved proof straight away, got %+v", proofMsg)
+	}
+}
+
+// TestE2E_MsgpackEncoding tests that a msgpack server serves msgpack clients and
+// that a client speaking the other encoding fails with a clear error
+func TestE2E_MsgpackEncoding(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	powService := pow.NewSHA256HashcashService(1, 5*time.Minute)
+	srv := server.NewServer(server.Config{
+		Host:                "127.0.0.1",
+		Port:                "0",
+		ReadTimeout:         2 * time.Second,
+		WriteTimeout:        2 * time.Second,
+		MaxConnections:      10,
+		ShutdownTimeout:     1 * time.Second,
+		MaxQuotesPerRequest: 3,
+		Encoding:            protocol.MsgpackEncoding,
+	}, powService, quotes.NewInMemoryService(), logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.ListenAndServe(ctx)
+	waitServerReady(t, srv)
+	_, port, _ := net.SplitHostPort(srv.Addr().String())
+
+	newClient := func(encoding protocol.Encoding) *client.Client {
+		return client.NewClient(client.Config{
+			ServerHost:     "127.0.0.1",
+			ServerPort:     port,
+			ConnectTimeout: 5 * time.Second,
+			ReadTimeout:    2 * time.Second,
+			WriteTimeout:   2 * time.Second,
+			SolveTimeout:   30 * time.Second,
+			Encoding:       encoding,
+		}, pow.NewSHA256HashcashService(0, 0), logger)
+	}
+
+	t.Run("MsgpackClient", func(t *testing.T) {
+		quotes, err := newClient(protocol.MsgpackEncoding).RequestQuotes(context.Background(), 3)
+		if err != nil {
+			t.Fatalf("Msgpack client failed against msgpack server: %v", err)
+		}
+		if len(quotes) != 3 {
+			t.Errorf("Expected 3 quotes, got %d", len(quotes))
+		}
+	})
+
+	t.Run("JSONClient", func(t *testing.T) {
+		_, err := newClient(nil).RequestQuote(context.Background())
+		if !errors.Is(err, protocol.ErrEncodingMismatch) {
+			t.Errorf("Expected ErrEncodingMismatch, got: %v", err)
+		}
+	})
+}
+
+func TestE2E_NilLoggers(t *testing.T) {
+	// Embedders may pass no logger at all; every log call must then be a no-op
+	powService := pow.NewSHA256HashcashService(1, 5*time.Minute)
+	srv := server.NewServer(server.Config{
+		Host:            "127.0.0.1",
+		Port:            "0",
+		ReadTimeout:     2 * time.Second,
+		WriteTimeout:    2 * time.Second,
+		MaxConnections:  10,
+		ShutdownTimeout: 1 * time.Second,
+	}, powService, quotes.NewInMemoryService(), nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- srv.ListenAndServe(ctx) }()
+	waitServerReady(t, srv)
+	_, port, _ := net.SplitHostPort(srv.Addr().String())
+
+	healthCtx, stopHealth := context.WithCancel(context.Background())
+	defer stopHealth()
+	go server.NewHealthServer("127.0.0.1:0", srv, nil).ListenAndServe(healthCtx)
+
+	c := client.NewClient(client.Config{
+		ServerHost:     "127.0.0.1",
+		ServerPort:     port,
+		ConnectTimeout: 5 * time.Second,
+		ReadTimeout:    2 * time.Second,
+		WriteTimeout:   2 * time.Second,
+		SolveTimeout:   30 * time.Second,
+	}, pow.NewSHA256HashcashService(0, 0), nil)
+
+	quote, err := c.RequestQuote(context.Background())
+	if err != nil {
+		t.Fatalf("RequestQuote failed: %v", err)
+	}
+	if quote == "" {
+		t.Error("Expected a quote")
+	}
+
+	// Failures are logged too
+	unreachable := client.NewClient(client.Config{
+		ServerHost:     "127.0.0.1",
+		ServerPort:     "1",
+		ConnectTimeout: time.Second,
+	}, pow.NewSHA256HashcashService(0, 0), nil)
+	if _, err := unreachable.RequestQuote(context.Background()); err == nil {
+		t.Error("Expected an error from an unreachable server")
+	}
+
+	cancel()
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("ListenAndServe returned: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server did not shut down")
+	}
+}
+
+func TestE2E_Namespace(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	powService := pow.NewSHA256HashcashService(2, 5*time.Minute)
+	powService.SetNamespace("tenant-a")
+	srv := server.NewServer(server.Config{
+		Host:            "127.0.0.1",
+		Port:            "0",
+		ReadTimeout:     2 * time.Second,
+		WriteTimeout:    2 * time.Second,
+		MaxConnections:  10,
+		ShutdownTimeout: 1 * time.Second,
+	}, powService, quotes.NewInMemoryService(), logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.ListenAndServe(ctx)
+	waitServerReady(t, srv)
+	_, port, _ := net.SplitHostPort(srv.Addr().String())
+
+	// The client learns the namespace from the challenge and solves over it
+	c := client.NewClient(client.Config{
+		ServerHost:     "127.0.0.1",
+		ServerPort:     port,
+		ConnectTimeout: 5 * time.Second,
+		ReadTimeout:    2 * time.Second,
+		WriteTimeout:   2 * time.Second,
+		SolveTimeout:   30 * time.Second,
+	}, pow.NewSHA256HashcashService(0, 0), logger)
+
+	for i := 0; i < 3; i++ {
+		quote, err := c.RequestQuote(context.Background())
+		if err != nil {
+			t.Fatalf("RequestQuote %d failed: %v", i, err)
+		}
+		if quote == "" {
+			t.Errorf("Expected a quote from request %d", i)
+		}
+	}
+}
+
+func TestE2E_Target(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	// Difficulty 4 would take billions of tries; the target replaces it with about 14 bits
+	powService := pow.NewSHA256HashcashService(4, 5*time.Minute)
+	target, err := pow.ParseTarget("0003" + strings.Repeat("f", 60))
+	if err != nil {
+		t.Fatalf("ParseTarget failed: %v", err)
+	}
+	powService.SetTarget(target)
+	srv := server.NewServer(server.Config{
+		Host:            "127.0.0.1",
+		Port:            "0",
+		ReadTimeout:     2 * time.Second,
+		WriteTimeout:    2 * time.Second,
+		MaxConnections:  10,
+		ShutdownTimeout: 1 * time.Second,
+	}, powService, quotes.NewInMemoryService(), logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.ListenAndServe(ctx)
+	waitServerReady(t, srv)
+	_, port, _ := net.SplitHostPort(srv.Addr().String())
+
+	// The client learns the target from the challenge and solves against it
+	c := client.NewClient(client.Config{
+		ServerHost:     "127.0.0.1",
+		ServerPort:     port,
+		ConnectTimeout: 5 * time.Second,
+		ReadTimeout:    2 * time.Second,
+		WriteTimeout:   2 * time.Second,
+		SolveTimeout:   30 * time.Second,
+	}, pow.NewSHA256HashcashService(0, 0), logger)
+
+	for i := 0; i < 3; i++ {
+		quote, err := c.RequestQuote(context.Background())
+		if err != nil {
+			t.Fatalf("RequestQuote %d failed: %v", i, err)
+		}
+		if quote == "" {
+			t.Errorf("Expected a quote from request %d", i)
+		}
+	}
+}
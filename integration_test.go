@@ -2,8 +2,17 @@ package main
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"log/slog"
+	"math/big"
+	"net"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -40,12 +49,8 @@ func TestIntegration_ClientServerFlow(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	go func() {
-		srv.ListenAndServe(ctx)
-	}()
-
-	// Give server time to start
-	time.Sleep(200 * time.Millisecond)
+	go srv.ListenAndServe(ctx)
+	waitServerReady(t, srv)
 
 	// Setup client
 	clientPowService := pow.NewSHA256HashcashService(0, 0) // Client doesn't need TTL
@@ -98,3 +103,197 @@ func TestIntegration_ClientServerFlow(t *testing.T) {
 	cancel()
 	time.Sleep(100 * time.Millisecond)
 }
+
+func TestIntegration_ClientServerFlowOverTLS(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	certFile, keyFile := writeSelfSignedCert(t)
+
+	// Setup server
+	powService := pow.NewSHA256HashcashService(1, 5*time.Minute)
+	quotesService := quotes.NewInMemoryService()
+
+	serverConfig := server.Config{
+		Host:            "127.0.0.1",
+		Port:            "18092",
+		ReadTimeout:     10 * time.Second,
+		WriteTimeout:    10 * time.Second,
+		MaxConnections:  10,
+		ShutdownTimeout: 5 * time.Second,
+		TLSCertFile:     certFile,
+		TLSKeyFile:      keyFile,
+	}
+
+	srv := server.NewServer(serverConfig, powService, quotesService, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go srv.ListenAndServe(ctx)
+	waitServerReady(t, srv)
+
+	clientConfig := client.Config{
+		ServerHost:            "127.0.0.1",
+		ServerPort:            "18092",
+		ConnectTimeout:        5 * time.Second,
+		ReadTimeout:           10 * time.Second,
+		WriteTimeout:          10 * time.Second,
+		SolveTimeout:          30 * time.Second,
+		TLSEnabled:            true,
+		TLSInsecureSkipVerify: true, // Self-signed certificate
+	}
+
+	t.Run("SuccessfulQuoteRetrieval", func(t *testing.T) {
+		c := client.NewClient(clientConfig, pow.NewSHA256HashcashService(0, 0), logger)
+
+		reqCtx, reqCancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer reqCancel()
+
+		quote, err := c.RequestQuote(reqCtx)
+		if err != nil {
+			t.Fatalf("Failed to get quote over TLS: %v", err)
+		}
+
+		if quote == "" {
+			t.Error("Quote should not be empty")
+		}
+	})
+
+	t.Run("PlaintextClientRejected", func(t *testing.T) {
+		plainConfig := clientConfig
+		plainConfig.TLSEnabled = false
+		plainConfig.ReadTimeout = 1 * time.Second
+		c := client.NewClient(plainConfig, pow.NewSHA256HashcashService(0, 0), logger)
+
+		reqCtx, reqCancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer reqCancel()
+
+		if _, err := c.RequestQuote(reqCtx); err == nil {
+			t.Error("Plaintext client should not be able to talk to a TLS server")
+		}
+	})
+
+	// Cleanup
+	cancel()
+	time.Sleep(100 * time.Millisecond)
+}
+
+func TestIntegration_ClientServerFlowOverUnixSocket(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	socketPath := filepath.Join(t.TempDir(), "pow.sock")
+
+	// Leave a stale socket file behind, as a crashed server would
+	stale, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("Failed to create stale socket: %v", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	powService := pow.NewSHA256HashcashService(1, 5*time.Minute)
+	quotesService := quotes.NewInMemoryService()
+
+	serverConfig := server.Config{
+		Network:         "unix",
+		SocketPath:      socketPath,
+		ReadTimeout:     10 * time.Second,
+		WriteTimeout:    10 * time.Second,
+		MaxConnections:  10,
+		ShutdownTimeout: 5 * time.Second,
+	}
+
+	srv := server.NewServer(serverConfig, powService, quotesService, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	serverDone := make(chan error, 1)
+	go func() {
+		serverDone <- srv.ListenAndServe(ctx)
+	}()
+	waitServerReady(t, srv)
+
+	clientConfig := client.Config{
+		Network:        "unix",
+		SocketPath:     socketPath,
+		ConnectTimeout: 5 * time.Second,
+		ReadTimeout:    10 * time.Second,
+		WriteTimeout:   10 * time.Second,
+		SolveTimeout:   30 * time.Second,
+	}
+	c := client.NewClient(clientConfig, pow.NewSHA256HashcashService(0, 0), logger)
+
+	quote, err := c.RequestQuote(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to get quote over Unix socket: %v", err)
+	}
+	if quote == "" {
+		t.Error("Received empty quote")
+	}
+
+	cancel()
+	select {
+	case err := <-serverDone:
+		if err != nil {
+			t.Errorf("Server returned error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server did not shut down")
+	}
+
+	if _, err := os.Stat(socketPath); !os.IsNotExist(err) {
+		t.Errorf("Expected socket file to be removed on shutdown, got: %v", err)
+	}
+}
+
+// writeSelfSignedCert generates a self-signed certificate for 127.0.0.1
+// and returns the paths of the PEM-encoded cert and key files
+func writeSelfSignedCert(t *testing.T) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "pow-test"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	certDER, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatalf("Failed to write cert: %v", err)
+	}
+
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+
+	return certFile, keyFile
+}
@@ -0,0 +1,7 @@
+// Package build holds information about the running binary
+package build
+
+// Version of the binary, set by main from a value injected at compile time:
+//
+//	go build -ldflags "-X main.version=v1.2.3" ./cmd/server
+var Version = "dev"
@@ -0,0 +1,107 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"pow/internal/pow"
+)
+
+// MaxCalibrationDifficulty is the highest SHA256 difficulty the server accepts
+const MaxCalibrationDifficulty = 5
+
+// Calibration is the outcome of CalibrateDifficulty
+type Calibration struct {
+	HashesPerSecond   float64       // Measured solving speed
+	Difficulty        int           // Highest difficulty expected to solve within the budget, 0 if none
+	ExpectedSolveTime time.Duration // Average time to solve at Difficulty
+}
+
+// CalibrateDifficulty solves synthetic SHA256 challenges at increasing difficulty
+// to measure this machine's hash rate, and recommends the highest difficulty
+// whose average solve time fits within maxDuration. Levels expected to take
+// longer than maxDuration are never attempted.
+func CalibrateDifficulty(ctx context.Context, maxDuration time.Duration) (Calibration, error) {
+	if maxDuration <= 0 {
+		return Calibration{}, fmt.Errorf("calibration budget must be positive, got: %v", maxDuration)
+	}
+
+	solver := pow.NewSHA256HashcashService(0, 0) // Throwaway service, only used for solving
+	var totalAttempts int
+	var totalTime time.Duration
+
+	for difficulty := 1; difficulty <= MaxCalibrationDifficulty; difficulty++ {
+		// Skip levels the rate measured so far says cannot fit the budget
+		if totalTime > 0 && expectedSolveTime(hashRate(totalAttempts, totalTime), difficulty) > maxDuration {
+			break
+		}
+
+		solveCtx, cancel := context.WithTimeout(ctx, maxDuration)
+		challenge := fmt.Sprintf("calibration:%d:%d", time.Now().UnixNano(), difficulty)
+		start := time.Now()
+		_, attempts, err := solver.SolveChallengeWithStats(solveCtx, challenge, difficulty)
+		elapsed := time.Since(start)
+		cancel()
+
+		if err != nil {
+			// Running out of budget on a level is a result, not a failure
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+				break
+			}
+			return Calibration{}, fmt.Errorf("calibration at difficulty %d failed: %w", difficulty, err)
+		}
+
+		totalAttempts += attempts
+		totalTime += elapsed
+	}
+
+	if totalTime <= 0 {
+		return Calibration{}, fmt.Errorf("calibration finished without a measurement")
+	}
+
+	rate := hashRate(totalAttempts, totalTime)
+	difficulty := recommendDifficulty(rate, maxDuration)
+
+	calibration := Calibration{HashesPerSecond: rate, Difficulty: difficulty}
+	if difficulty > 0 {
+		calibration.ExpectedSolveTime = expectedSolveTime(rate, difficulty)
+	}
+	return calibration, nil
+}
+
+// recommendDifficulty returns the highest difficulty, up to MaxCalibrationDifficulty,
+// whose average solve time at rate hashes per second fits within budget
+func recommendDifficulty(rate float64, budget time.Duration) int {
+	difficulty := 0
+	for d := 1; d <= MaxCalibrationDifficulty; d++ {
+		if expectedSolveTime(rate, d) > budget {
+			break
+		}
+		difficulty = d
+	}
+	return difficulty
+}
+
+// expectedSolveTime is the average time to find difficulty leading zero bytes,
+// which takes 256^difficulty hashes on average
+func expectedSolveTime(rate float64, difficulty int) time.Duration {
+	if rate <= 0 {
+		return time.Duration(math.MaxInt64)
+	}
+	seconds := math.Pow(256, float64(difficulty)) / rate
+	if seconds >= math.MaxInt64/float64(time.Second) {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// hashRate converts attempts over elapsed time into hashes per second
+func hashRate(attempts int, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(attempts) / elapsed.Seconds()
+}
@@ -0,0 +1,70 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCalibrateDifficulty(t *testing.T) {
+	calibration, err := CalibrateDifficulty(context.Background(), 100*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Calibration failed: %v", err)
+	}
+
+	if calibration.HashesPerSecond <= 0 {
+		t.Errorf("Expected a positive hash rate, got %f", calibration.HashesPerSecond)
+	}
+	if calibration.Difficulty < 0 || calibration.Difficulty > MaxCalibrationDifficulty {
+		t.Errorf("Difficulty %d out of range [0, %d]", calibration.Difficulty, MaxCalibrationDifficulty)
+	}
+	if calibration.Difficulty > 0 && calibration.ExpectedSolveTime > 100*time.Millisecond {
+		t.Errorf("Recommended difficulty %d is expected to take %v, over the budget",
+			calibration.Difficulty, calibration.ExpectedSolveTime)
+	}
+}
+
+func TestCalibrateDifficulty_InvalidBudget(t *testing.T) {
+	if _, err := CalibrateDifficulty(context.Background(), 0); err == nil {
+		t.Error("Expected error for zero budget")
+	}
+}
+
+func TestRecommendDifficulty_MonotonicAndBounded(t *testing.T) {
+	rates := []float64{1, 1e3, 1e6, 1e9, 1e15}
+	budgets := []time.Duration{time.Microsecond, time.Millisecond, time.Second, time.Minute, time.Hour, 1000 * time.Hour}
+
+	for _, rate := range rates {
+		prev := 0
+		for _, budget := range budgets {
+			d := recommendDifficulty(rate, budget)
+			if d < 0 || d > MaxCalibrationDifficulty {
+				t.Errorf("rate=%g budget=%v: difficulty %d out of range", rate, budget, d)
+			}
+			if d < prev {
+				t.Errorf("rate=%g budget=%v: difficulty dropped from %d to %d with a larger budget", rate, budget, prev, d)
+			}
+			prev = d
+		}
+	}
+
+	// More hashes per second never lowers the recommendation
+	for _, budget := range budgets {
+		prev := 0
+		for _, rate := range rates {
+			d := recommendDifficulty(rate, budget)
+			if d < prev {
+				t.Errorf("budget=%v rate=%g: difficulty dropped from %d to %d with a faster rate", budget, rate, prev, d)
+			}
+			prev = d
+		}
+	}
+
+	// 256 hashes per second solve difficulty 1 in one second on average
+	if d := recommendDifficulty(256, time.Second); d != 1 {
+		t.Errorf("Expected difficulty 1 at 256 H/s within 1s, got %d", d)
+	}
+	if d := recommendDifficulty(1e15, 1000*time.Hour); d != MaxCalibrationDifficulty {
+		t.Errorf("Expected difficulty capped at %d, got %d", MaxCalibrationDifficulty, d)
+	}
+}
@@ -2,118 +2,320 @@ package client
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"math"
+	"math/big"
 	"net"
+	"os"
 	"time"
 
 	"pow/internal/pow"
 	"pow/pkg/protocol"
 )
 
+var (
+	// ErrConnectionClosed is returned when the server hangs up before sending an expected message
+	ErrConnectionClosed = errors.New("server closed connection")
+	// ErrReadTimeout is returned when the server sends nothing within ReadTimeout
+	ErrReadTimeout = errors.New("timed out waiting for server")
+	// ErrDifficultyTooHigh is returned when a challenge exceeds MaxAcceptedDifficulty
+	ErrDifficultyTooHigh = errors.New("challenge difficulty too high")
+	// ErrUnsupportedAlgorithm is returned when a challenge names a PoW algorithm this client can't solve
+	ErrUnsupportedAlgorithm = errors.New("unsupported PoW algorithm")
+)
+
 // Config holds client configuration
 type Config struct {
-	ServerHost     string
-	ServerPort     string
-	ConnectTimeout time.Duration
-	ReadTimeout    time.Duration
-	WriteTimeout   time.Duration
-	SolveTimeout   time.Duration
+	ServerHost            string
+	ServerPort            string
+	ConnectTimeout        time.Duration
+	ReadTimeout           time.Duration
+	WriteTimeout          time.Duration
+	SolveTimeout          time.Duration // Hard cap on solving one challenge
+	SolveTimeoutBase      time.Duration // Solve timeout at difficulty 0, scaled up with difficulty; 0 always uses SolveTimeout
+	SolveTimeoutFactor    float64       // Growth of the scaled solve timeout per 8 bits of difficulty, values < 1 mean 1
+	TLSEnabled            bool
+	TLSInsecureSkipVerify bool          // Skip server certificate verification (testing only)
+	Category              string        // Optional quote category to request
+	LegacyFraming         bool          // Speak little-endian protocol version 2 framing
+	MaxRetries            int           // Retries after a transient failure, 0 disables
+	RetryBaseDelay        time.Duration // Backoff before the first retry, doubled for each next one
+	Network               string        // "tcp" (default) or "unix"
+	SocketPath            string        // Server socket file when Network is "unix"
+	SolverWorkers         int           // Goroutines searching for a nonce, values < 2 solve sequentially
+	MaxAcceptedDifficulty int           // Highest challenge difficulty in leading zero bits to solve, 0 accepts any
+	HeartbeatInterval     time.Duration // Ping the server this often while a Session is idle, 0 disables
+	MaxSolveAttempts      int           // Cap on nonces tried per challenge, applied to solvers that support one; 0 means unlimited
+	TrustedToken          string        // Pre-shared token presented before solving; servers trusting it waive the work
+	MaxMessageSize        int           // Cap on messages read or written in bytes, 0 means protocol.MaxMessageSize
+
+	// Encoding encodes message payloads and must match the server's encoding, nil means JSON
+	Encoding protocol.Encoding
+	// SolveProgress is called about every ProgressInterval nonces tried while solving,
+	// passed to each solve with pow.WithProgress. nil disables it.
+	SolveProgress pow.ProgressFunc
+	// ProgressInterval is the number of nonces between SolveProgress calls, values < 1
+	// mean pow.DefaultProgressInterval
+	ProgressInterval int
+}
+
+// ServerError is returned when the server responds with an error message.
+// Use errors.As to inspect the code, e.g. to back off on rate limiting.
+type ServerError struct {
+	Code       protocol.ErrorCode
+	Message    string
+	ConnID     string        // Server-side connection id, for finding the server's log lines
+	RetryAfter time.Duration // Server's advisory delay before retrying, 0 if none
+}
+
+// Error implements the error interface
+func (e *ServerError) Error() string {
+	msg := e.Message
+	if e.Code != "" {
+		msg = fmt.Sprintf("%s (code: %s)", msg, e.Code)
+	}
+	if e.ConnID != "" {
+		msg = fmt.Sprintf("%s [conn_id: %s]", msg, e.ConnID)
+	}
+	return msg
 }
 
 // Client represents the TCP client
 type Client struct {
 	config     Config
+	codec      protocol.Codec
 	powService pow.SolverService // Client only needs solver operations
 	logger     *slog.Logger
+	metrics    *SolveMetrics
+	nonces     *nonceCache // Solutions whose proof may not have reached the server
 }
 
-// NewClient creates a new TCP client instance
+// discardLogger drops every record, for callers that pass a nil logger
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.Level(math.MaxInt)}))
+
+// NewClient creates a new TCP client instance. A nil logger discards all logs,
+// for embedders that don't want the client's output.
 func NewClient(config Config, powService pow.SolverService, logger *slog.Logger) *Client {
+	limitAttempts(powService, config.MaxSolveAttempts)
+	if logger == nil {
+		logger = discardLogger
+	}
+
 	return &Client{
 		config:     config,
+		codec:      protocol.CodecFor(config.LegacyFraming).WithMaxSize(config.MaxMessageSize).WithEncoding(config.Encoding),
 		powService: powService,
 		logger:     logger,
+		metrics:    NewSolveMetrics(),
+		nonces:     newNonceCache(nonceCacheCapacity, nonceCacheTTL),
 	}
 }
 
+// Metrics returns the statistics of every challenge this client has solved
+func (c *Client) Metrics() *SolveMetrics {
+	return c.metrics
+}
+
+// QuoteResult is a quote together with what it took to obtain it
+type QuoteResult struct {
+	Quote         string
+	Difficulty    int           // As sent by the server: bytes for sha256, bits for argon2id
+	Nonce         string        // The accepted solution
+	SolveDuration time.Duration // Time spent solving, near 0 when a cached nonce was reused
+	Attempts      int           // Nonces tried, 0 when the solver doesn't count them
+	ServerInfo    string        // Server name and version, empty if the server doesn't send it
+}
+
+// round is the outcome of one challenge-response exchange
+type round struct {
+	result    QuoteResult // Quote is the first of quotes
+	quotes    []string
+	keepAlive bool // The server offers another challenge on the connection
+}
+
 // RequestQuote connects to the server, solves PoW challenge, and retrieves a quote
 func (c *Client) RequestQuote(ctx context.Context) (string, error) {
-	addr := net.JoinHostPort(c.config.ServerHost, c.config.ServerPort)
-	c.logger.Info("Connecting to server", "address", addr)
+	result, err := c.RequestQuoteDetailed(ctx)
+	if err != nil {
+		return "", err
+	}
+	return result.Quote, nil
+}
 
-	// Connect to server with timeout
-	conn, err := net.DialTimeout("tcp", addr, c.config.ConnectTimeout)
+// RequestQuoteDetailed works like RequestQuote but also reports the challenge
+// difficulty, the nonce and what solving it cost
+func (c *Client) RequestQuoteDetailed(ctx context.Context) (*QuoteResult, error) {
+	r, err := c.requestQuotes(ctx, 1)
 	if err != nil {
-		return "", fmt.Errorf("failed to connect to server: %w", err)
+		return nil, err
+	}
+	return &r.result, nil
+}
+
+// RequestQuotes solves a single PoW challenge and retrieves up to count quotes.
+// The server may return fewer quotes than requested if count exceeds its limit.
+func (c *Client) RequestQuotes(ctx context.Context, count int) ([]string, error) {
+	if count < 1 {
+		return nil, fmt.Errorf("quote count must be positive, got: %d", count)
+	}
+	r, err := c.requestQuotes(ctx, count)
+	if err != nil {
+		return nil, err
+	}
+	return r.quotes, nil
+}
+
+// requestQuotes performs the handshake, retrying transient failures with
+// exponential backoff until MaxRetries is exhausted or ctx would expire
+func (c *Client) requestQuotes(ctx context.Context, count int) (*round, error) {
+	for attempt := 0; ; attempt++ {
+		r, err := c.requestQuotesOnce(ctx, count)
+		if err == nil {
+			return r, nil
+		}
+
+		if attempt >= c.config.MaxRetries || !isRetryable(err) {
+			return nil, err
+		}
+
+		delay := retryDelay(c.config.RetryBaseDelay, attempt)
+		if hint := retryAfterHint(err); hint > delay {
+			delay = hint
+		}
+		c.logger.Warn("Request failed, retrying",
+			"error", err,
+			"retry", attempt+1,
+			"max_retries", c.config.MaxRetries,
+			"delay", delay)
+
+		if !sleepCtx(ctx, delay) {
+			return nil, err
+		}
+	}
+}
+
+// requestQuotesOnce performs the full challenge-response handshake over a new connection
+func (c *Client) requestQuotesOnce(ctx context.Context, count int) (*round, error) {
+	conn, err := c.connect(ctx)
+	if err != nil {
+		return nil, err
 	}
 	defer conn.Close()
 
-	c.logger.Info("Connected to server")
+	return c.solveAndFetch(ctx, c.newFramer(conn), count, false)
+}
 
-	// Read challenge from server
-	var challengeMsg protocol.ChallengeMessage
-	if err := protocol.ReadMessage(conn, &challengeMsg, c.config.ReadTimeout); err != nil {
-		return "", fmt.Errorf("failed to read challenge: %w", err)
+// connect dials the server, giving up when ctx is done, and logs the outcome
+func (c *Client) connect(ctx context.Context) (net.Conn, error) {
+	network, addr := c.serverAddr()
+	c.logger.Info("Connecting to server", "network", network, "address", addr)
+
+	// Connect to server with timeout
+	conn, err := c.dial(ctx, network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errConnect, err)
+	}
+
+	c.logger.Info("Connected to server", "tls", c.config.TLSEnabled)
+	return conn, nil
+}
+
+// solveAndFetch runs one challenge-response round on f: it reads a challenge,
+// solves it, sends the proof and reads the quotes. The round records whether the
+// server keeps the connection open for another one.
+func (c *Client) solveAndFetch(ctx context.Context, f *protocol.Framer, count int, keepAlive bool) (*round, error) {
+	challengeMsg, err := c.readChallenge(f)
+	if err != nil {
+		return nil, err
+	}
+
+	// A server new enough to accept the trusted token sends the challenge again,
+	// at difficulty 0 if it trusts the token and unchanged otherwise
+	if c.config.TrustedToken != "" && challengeMsg.Version >= protocol.TokenProtocolVersion {
+		if challengeMsg, err = c.authenticate(f, challengeMsg); err != nil {
+			return nil, err
+		}
 	}
 
 	c.logger.Info("Challenge received",
 		"challenge", challengeMsg.Challenge,
-		"difficulty", challengeMsg.Difficulty)
-
-	// Solve PoW challenge
-	solveCtx, cancel := context.WithTimeout(ctx, c.config.SolveTimeout)
-	defer cancel()
+		"difficulty", challengeMsg.Difficulty,
+		"algorithm", challengeMsg.Algorithm,
+		"binding", challengeMsg.Binding,
+		"namespace", challengeMsg.Namespace,
+		"target", challengeMsg.Target,
+		"expected_iterations", challengeMsg.ExpectedIterations,
+		"server_info", challengeMsg.ServerInfo)
 
-	c.logger.Info("Solving PoW challenge...", "difficulty", challengeMsg.Difficulty)
-	startTime := time.Now()
+	// Refuse challenges a rogue server made too hard, rather than burning CPU until SolveTimeout
+	if bits := difficultyBits(challengeMsg); c.config.MaxAcceptedDifficulty > 0 && bits > c.config.MaxAcceptedDifficulty {
+		return nil, fmt.Errorf("%w: %d bits exceeds the accepted maximum of %d", ErrDifficultyTooHigh, bits, c.config.MaxAcceptedDifficulty)
+	}
 
-	nonce, err := c.powService.SolveChallenge(solveCtx, challengeMsg.Challenge, challengeMsg.Difficulty)
+	// Tell the server right away rather than leaving it waiting for a proof
+	solver, err := c.solverFor(challengeMsg)
 	if err != nil {
-		if errors.Is(err, context.DeadlineExceeded) {
-			c.logger.Warn("PoW solving timeout",
-				"difficulty", challengeMsg.Difficulty,
-				"timeout", c.config.SolveTimeout,
-				"elapsed", time.Since(startTime))
-		} else if errors.Is(err, context.Canceled) {
-			c.logger.Info("PoW solving canceled")
-		} else {
-			c.logger.Error("PoW solving failed", "error", err)
-		}
-		return "", fmt.Errorf("failed to solve challenge: %w", err)
+		c.reportError(f, protocol.ErrCodeBadRequest, err.Error())
+		return nil, err
 	}
 
-	solveDuration := time.Since(startTime)
-	c.logger.Info("PoW challenge solved",
-		"nonce", nonce,
-		"duration", solveDuration)
+	// A namespaced or bound challenge is solved over its namespace and binding too;
+	// the proof still echoes the bare challenge
+	data := pow.ChallengeData(challengeMsg.Namespace, challengeMsg.Challenge, challengeMsg.Binding)
+	cacheKey := challengeMsg.Algorithm + ":" + data
+
+	timeout := c.solveTimeout(difficultyBits(challengeMsg))
+	solveStart := time.Now()
+	nonce, attempts, err := c.solve(ctx, solver, cacheKey, data, challengeMsg.Difficulty, timeout)
+	if err != nil {
+		return nil, err
+	}
+	r := &round{result: QuoteResult{
+		Difficulty:    challengeMsg.Difficulty,
+		Nonce:         nonce,
+		SolveDuration: time.Since(solveStart),
+		Attempts:      attempts,
+		ServerInfo:    challengeMsg.ServerInfo,
+	}}
 
 	// Send proof to server
 	proofMsg := protocol.ProofMessage{
-		BaseMessage: protocol.BaseMessage{Type: protocol.MsgTypeProof},
+		BaseMessage: c.codec.NewBaseMessage(protocol.MsgTypeProof),
 		Challenge:   challengeMsg.Challenge,
 		Nonce:       nonce,
+		Attempts:    attempts,
+		Category:    c.config.Category,
+		KeepAlive:   keepAlive,
+	}
+	if count > 1 {
+		proofMsg.Count = count
 	}
 
-	if err := protocol.WriteMessage(conn, proofMsg, c.config.WriteTimeout); err != nil {
-		return "", fmt.Errorf("failed to send proof: %w", err)
+	if err := f.Write(proofMsg); err != nil {
+		return nil, fmt.Errorf("failed to send proof: %w", err)
 	}
 
 	c.logger.Info("Proof sent to server")
 
 	// Read response from server (quote or error)
 	// Read into json.RawMessage to allow re-parsing
-	var rawResponse json.RawMessage
-	if err := protocol.ReadMessage(conn, &rawResponse, c.config.ReadTimeout); err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
+	rawResponse, err := c.readMessage(f)
+	if err != nil {
+		return nil, c.readError(err, "response")
 	}
 
+	// The server consumed the challenge, whatever it answered
+	c.nonces.forget(cacheKey)
+
 	// Parse base message to determine type
 	var baseMsg protocol.BaseMessage
 	if err := json.Unmarshal(rawResponse, &baseMsg); err != nil {
-		return "", fmt.Errorf("failed to parse response type: %w", err)
+		return nil, fmt.Errorf("failed to parse response type: %w", err)
 	}
 
 	// Parse into specific message type based on type field
@@ -121,19 +323,341 @@ func (c *Client) RequestQuote(ctx context.Context) (string, error) {
 	case protocol.MsgTypeQuote:
 		var quoteMsg protocol.QuoteMessage
 		if err := json.Unmarshal(rawResponse, &quoteMsg); err != nil {
-			return "", fmt.Errorf("failed to parse quote message: %w", err)
+			return nil, fmt.Errorf("failed to parse quote message: %w", err)
 		}
 		c.logger.Info("Quote received successfully")
-		return quoteMsg.Quote, nil
+		r.quotes, r.keepAlive = []string{quoteMsg.Quote}, quoteMsg.KeepAlive
+
+	case protocol.MsgTypeQuotes:
+		var quotesMsg protocol.QuotesMessage
+		if err := json.Unmarshal(rawResponse, &quotesMsg); err != nil {
+			return nil, fmt.Errorf("failed to parse quotes message: %w", err)
+		}
+		if len(quotesMsg.Quotes) == 0 {
+			return nil, fmt.Errorf("server returned no quotes")
+		}
+		c.logger.Info("Quotes received successfully", "count", len(quotesMsg.Quotes))
+		r.quotes, r.keepAlive = quotesMsg.Quotes, quotesMsg.KeepAlive
 
 	case protocol.MsgTypeError:
-		var errMsg protocol.ErrorMessage
-		if err := json.Unmarshal(rawResponse, &errMsg); err != nil {
-			return "", fmt.Errorf("failed to parse error message: %w", err)
+		return nil, parseServerError(rawResponse)
+
+	default:
+		return nil, fmt.Errorf("unexpected message type: %s", baseMsg.Type)
+	}
+
+	r.result.Quote = r.quotes[0]
+	return r, nil
+}
+
+// readMessage reads the next message other than a heartbeat within ReadTimeout,
+// answering heartbeats from the server on the way
+func (c *Client) readMessage(f *protocol.Framer) (json.RawMessage, error) {
+	for {
+		var raw json.RawMessage
+		if err := f.Read(&raw); err != nil {
+			return nil, err
+		}
+
+		var heartbeat protocol.HeartbeatMessage
+		if err := json.Unmarshal(raw, &heartbeat); err != nil || heartbeat.Type != protocol.MsgTypeHeartbeat {
+			return raw, nil // Malformed messages are reported by the caller's own parsing
+		}
+		if !heartbeat.Reply {
+			reply := protocol.HeartbeatMessage{BaseMessage: c.codec.NewBaseMessage(protocol.MsgTypeHeartbeat), Reply: true}
+			if err := f.Write(reply); err != nil {
+				return nil, fmt.Errorf("failed to answer heartbeat: %w", err)
+			}
+		}
+	}
+}
+
+// readError explains a failed read of the message named what, telling a server
+// that hung up apart from one that never answered
+func (c *Client) readError(err error, what string) error {
+	switch {
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return fmt.Errorf("%w before sending %s: %w", ErrConnectionClosed, what, err)
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		return fmt.Errorf("%w: no %s within %v: %w", ErrReadTimeout, what, c.config.ReadTimeout, err)
+	default:
+		return fmt.Errorf("failed to read %s: %w", what, err)
+	}
+}
+
+// readChallenge reads a challenge from f; a busy server sends an error instead
+func (c *Client) readChallenge(f *protocol.Framer) (protocol.ChallengeMessage, error) {
+	var challengeMsg protocol.ChallengeMessage
+	rawChallenge, err := c.readMessage(f)
+	if err != nil {
+		if protocol.IsProtocolViolation(err) {
+			c.reportError(f, protocol.ErrCodeBadRequest, "Invalid message: "+protocol.ViolationReason(err))
 		}
-		return "", fmt.Errorf("server error: %s", errMsg.Message)
+		return challengeMsg, c.readError(err, "challenge")
+	}
+
+	if err := json.Unmarshal(rawChallenge, &challengeMsg); err != nil {
+		return challengeMsg, fmt.Errorf("failed to parse challenge: %w", err)
+	}
+	if challengeMsg.Type == protocol.MsgTypeError {
+		return challengeMsg, parseServerError(rawChallenge)
+	}
+
+	// Reject servers speaking an incompatible protocol version, telling them why
+	if err := protocol.CheckVersion(challengeMsg.Version); err != nil {
+		c.reportError(f, protocol.ErrCodeUnsupportedVersion, err.Error())
+		return challengeMsg, fmt.Errorf("incompatible server: %w", err)
+	}
+	return challengeMsg, nil
+}
+
+// authenticate presents the trusted token in answer to challengeMsg and returns the
+// challenge the server sends back, which is still to be solved
+func (c *Client) authenticate(f *protocol.Framer, challengeMsg protocol.ChallengeMessage) (protocol.ChallengeMessage, error) {
+	authMsg := protocol.AuthMessage{
+		BaseMessage: c.codec.NewBaseMessage(protocol.MsgTypeAuth),
+		Token:       c.config.TrustedToken,
+	}
+	if err := f.Write(authMsg); err != nil {
+		return challengeMsg, fmt.Errorf("failed to send auth: %w", err)
+	}
+
+	challengeMsg, err := c.readChallenge(f)
+	if err != nil {
+		return challengeMsg, err
+	}
+	if challengeMsg.Difficulty == 0 {
+		c.logger.Info("Trusted token accepted, proof of work waived")
+	} else {
+		c.logger.Warn("Trusted token rejected, solving the challenge", "difficulty", challengeMsg.Difficulty)
+	}
+	return challengeMsg, nil
+}
+
+// parseServerError decodes an error message into a ServerError
+func parseServerError(raw json.RawMessage) error {
+	var errMsg protocol.ErrorMessage
+	if err := json.Unmarshal(raw, &errMsg); err != nil {
+		return fmt.Errorf("failed to parse error message: %w", err)
+	}
+	return fmt.Errorf("server error: %w", &ServerError{
+		Code:       errMsg.Code,
+		Message:    errMsg.Message,
+		ConnID:     errMsg.ConnID,
+		RetryAfter: time.Duration(errMsg.RetryAfterMs) * time.Millisecond,
+	})
+}
+
+// solve finds a nonce for data, reusing one cached under key from an earlier
+// attempt whose proof never got an answer. Attempts is 0 for cached nonces.
+func (c *Client) solve(ctx context.Context, solver pow.SolverService, key, data string, difficulty int, timeout time.Duration) (string, int, error) {
+	if nonce, ok := c.nonces.get(key, difficulty); ok {
+		c.logger.Info("Reusing cached PoW solution", "difficulty", difficulty, "nonce", nonce)
+		return nonce, 0, nil
+	}
+
+	solveCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	solveCtx = pow.WithProgress(solveCtx, c.config.SolveProgress, c.config.ProgressInterval)
+
+	c.logger.Info("Solving PoW challenge...", "difficulty", difficulty, "timeout", timeout)
+	startTime := time.Now()
+
+	nonce, attempts, err := solveWithStats(solveCtx, solver, data, difficulty, c.config.SolverWorkers)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			c.logger.Warn("PoW solving timeout",
+				"difficulty", difficulty,
+				"timeout", timeout,
+				"elapsed", time.Since(startTime))
+		} else if errors.Is(err, context.Canceled) {
+			c.logger.Info("PoW solving canceled")
+		} else {
+			c.logger.Error("PoW solving failed", "error", err)
+		}
+		return "", 0, fmt.Errorf("failed to solve challenge: %w", err)
+	}
+
+	solveDuration := time.Since(startTime)
+	c.metrics.Record(difficulty, solveDuration, attempts)
+	c.logger.Info("PoW challenge solved",
+		"nonce", nonce,
+		"attempts", attempts,
+		"duration", solveDuration)
+
+	// Keep the work until the server answers, in case the connection drops first
+	c.nonces.put(key, nonce, difficulty)
+	return nonce, attempts, nil
+}
+
+// solveWithStats solves a challenge, across workers goroutines when more than one is
+// asked for and the solver supports it, counting attempts when the solver supports it.
+// Attempts is 0 for solvers that don't report them.
+func solveWithStats(ctx context.Context, solver pow.SolverService, challenge string, difficulty int, workers int) (string, int, error) {
+	if parallelSolver, ok := solver.(pow.ParallelStatsSolverService); ok && workers > 1 {
+		return parallelSolver.SolveChallengeParallelWithStats(ctx, challenge, difficulty, workers)
+	}
+	if parallelSolver, ok := solver.(pow.ParallelSolverService); ok && workers > 1 {
+		nonce, err := parallelSolver.SolveChallengeParallel(ctx, challenge, difficulty, workers)
+		return nonce, 0, err
+	}
+
+	if statsSolver, ok := solver.(pow.StatsSolverService); ok {
+		return statsSolver.SolveChallengeWithStats(ctx, challenge, difficulty)
+	}
+
+	nonce, err := solver.SolveChallenge(ctx, challenge, difficulty)
+	return nonce, 0, err
+}
+
+// reportError tells the server why the client is giving up on the connection
+func (c *Client) reportError(f *protocol.Framer, code protocol.ErrorCode, message string) {
+	errMsg := protocol.ErrorMessage{
+		BaseMessage: c.codec.NewBaseMessage(protocol.MsgTypeError),
+		Code:        code,
+		Message:     message,
+	}
+	if err := f.Write(errMsg); err != nil {
+		c.logger.Warn("Failed to report error to server", "error", err, "code", code)
+	}
+}
+
+// newFramer frames messages on conn, each read within ReadTimeout and written within WriteTimeout
+func (c *Client) newFramer(conn net.Conn) *protocol.Framer {
+	return protocol.NewFramer(conn, c.codec, c.config.ReadTimeout, c.config.WriteTimeout)
+}
+
+// serverAddr returns the network and address to dial
+func (c *Client) serverAddr() (string, string) {
+	if c.config.Network == "unix" {
+		return "unix", c.config.SocketPath
+	}
+	return "tcp", net.JoinHostPort(c.config.ServerHost, c.config.ServerPort)
+}
+
+// dial connects to the server over plain TCP or TLS depending on configuration,
+// within ConnectTimeout and until ctx is done
+func (c *Client) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: c.config.ConnectTimeout}
+	if !c.config.TLSEnabled {
+		return dialer.DialContext(ctx, network, addr)
+	}
+
+	tlsDialer := &tls.Dialer{
+		NetDialer: dialer,
+		Config: &tls.Config{
+			ServerName:         c.config.ServerHost, // A socket path is no host name to verify against
+			InsecureSkipVerify: c.config.TLSInsecureSkipVerify,
+			MinVersion:         tls.VersionTLS12,
+		},
+	}
+	return tlsDialer.DialContext(ctx, network, addr)
+}
+
+// solveTimeout returns how long to spend solving a challenge of the given difficulty in bits
+func (c *Client) solveTimeout(bits int) time.Duration {
+	return scaledSolveTimeout(c.config.SolveTimeoutBase, c.config.SolveTimeoutFactor, bits, c.config.SolveTimeout)
+}
+
+// scaledSolveTimeout grows base by factor per 8 bits of difficulty, i.e. per SHA256
+// difficulty level, capped at limit. Without a base every difficulty gets limit.
+func scaledSolveTimeout(base time.Duration, factor float64, bits int, limit time.Duration) time.Duration {
+	if base <= 0 {
+		return limit
+	}
+	if factor < 1 {
+		factor = 1
+	}
+	// Compare as floats, huge difficulties would overflow a Duration
+	scaled := float64(base) * math.Pow(factor, float64(bits)/8)
+	if scaled >= float64(limit) {
+		return limit
+	}
+	return time.Duration(scaled)
+}
+
+// difficultyBits returns the challenge difficulty in leading zero bits.
+// SHA256 difficulty counts zero bytes, Argon2id difficulty already counts bits,
+// and a target needs as many bits as it has leading zeros.
+func difficultyBits(challengeMsg protocol.ChallengeMessage) int {
+	if target, err := pow.ParseTarget(challengeMsg.Target); err == nil {
+		return pow.TargetBits(target)
+	}
+	if challengeMsg.Algorithm == protocol.AlgorithmArgon2id {
+		return challengeMsg.Difficulty
+	}
+	return challengeMsg.Difficulty * 8
+}
+
+// attemptLimiter is implemented by solvers that can cap the nonces tried per solve
+type attemptLimiter interface {
+	SetMaxSolveAttempts(attempts int)
+}
+
+// limitAttempts applies a positive attempt cap to solver if it supports one
+func limitAttempts(solver pow.SolverService, attempts int) {
+	if limiter, ok := solver.(attemptLimiter); ok && attempts > 0 {
+		limiter.SetMaxSolveAttempts(attempts)
+	}
+}
+
+// solverFor returns the solver matching the algorithm announced in the challenge
+func (c *Client) solverFor(challengeMsg protocol.ChallengeMessage) (pow.SolverService, error) {
+	switch challengeMsg.Algorithm {
+	case "", protocol.AlgorithmSHA256:
+		if challengeMsg.Target != "" {
+			return c.targetSolverFor(challengeMsg.Target)
+		}
+		return c.powService, nil
+
+	case protocol.AlgorithmArgon2id:
+		if challengeMsg.Target != "" {
+			return nil, fmt.Errorf("argon2id challenges can't have a target")
+		}
+		if challengeMsg.Argon2 == nil {
+			return nil, fmt.Errorf("argon2id challenge is missing cost parameters")
+		}
+		params := pow.Argon2Params{
+			Time:    challengeMsg.Argon2.Time,
+			Memory:  challengeMsg.Argon2.Memory,
+			Threads: challengeMsg.Argon2.Threads,
+		}
+		solver := pow.NewArgon2HashcashService(0, 0, params) // Client doesn't need TTL
+		solver.SetMaxSolveAttempts(c.config.MaxSolveAttempts)
+		return solver, nil
 
 	default:
-		return "", fmt.Errorf("unexpected message type: %s", baseMsg.Type)
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedAlgorithm, challengeMsg.Algorithm)
+	}
+}
+
+// targetSolverFor returns a solver for sha256 challenges against the hex target
+func (c *Client) targetSolverFor(hexTarget string) (pow.SolverService, error) {
+	target, err := pow.ParseTarget(hexTarget)
+	if err != nil {
+		return nil, err
+	}
+	solver, ok := c.powService.(pow.TargetSolverService)
+	if !ok {
+		return nil, fmt.Errorf("%w: solver can't solve against a target", ErrUnsupportedAlgorithm)
 	}
+	return targetSolver{solver: solver, target: target}, nil
+}
+
+// targetSolver solves challenges against a target, ignoring the difficulty they come with
+type targetSolver struct {
+	solver pow.TargetSolverService
+	target *big.Int
+}
+
+// SolveChallenge finds a nonce whose hash is at most the target
+func (s targetSolver) SolveChallenge(ctx context.Context, challenge string, _ int) (string, error) {
+	nonce, _, err := s.solver.SolveTargetWithStats(ctx, challenge, s.target)
+	return nonce, err
+}
+
+// SolveChallengeWithStats finds a nonce whose hash is at most the target and reports
+// how many nonces were tried
+func (s targetSolver) SolveChallengeWithStats(ctx context.Context, challenge string, _ int) (string, int, error) {
+	return s.solver.SolveTargetWithStats(ctx, challenge, s.target)
 }
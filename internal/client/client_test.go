@@ -0,0 +1,278 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"pow/internal/pow"
+	"pow/pkg/protocol"
+)
+
+// recordingSolver records which solving method was used and with how many workers
+type recordingSolver struct {
+	*pow.SHA256HashcashService
+	parallelWorkers int // 0 if no parallel solve was made
+}
+
+func (s *recordingSolver) SolveChallengeParallel(ctx context.Context, challenge string, difficulty int, workers int) (string, error) {
+	s.parallelWorkers = workers
+	return s.SHA256HashcashService.SolveChallengeParallel(ctx, challenge, difficulty, workers)
+}
+
+func (s *recordingSolver) SolveChallengeParallelWithStats(ctx context.Context, challenge string, difficulty int, workers int) (string, int, error) {
+	s.parallelWorkers = workers
+	return s.SHA256HashcashService.SolveChallengeParallelWithStats(ctx, challenge, difficulty, workers)
+}
+
+func TestSolveWithStats_Workers(t *testing.T) {
+	const challenge, difficulty = "1700000000:feedface", 1
+	ctx := context.Background()
+
+	sequential, _, err := pow.NewSHA256HashcashService(0, 0).SolveChallengeWithStats(ctx, challenge, difficulty)
+	if err != nil {
+		t.Fatalf("SolveChallengeWithStats failed: %v", err)
+	}
+
+	t.Run("ConfiguredWorkersAreUsed", func(t *testing.T) {
+		solver := &recordingSolver{SHA256HashcashService: pow.NewSHA256HashcashService(0, 0)}
+
+		nonce, attempts, err := solveWithStats(ctx, solver, challenge, difficulty, 3)
+		if err != nil {
+			t.Fatalf("solveWithStats failed: %v", err)
+		}
+		if solver.parallelWorkers != 3 {
+			t.Errorf("Expected parallel solve with 3 workers, got %d", solver.parallelWorkers)
+		}
+		if attempts < 1 {
+			t.Errorf("Expected parallel solve to report attempts, got %d", attempts)
+		}
+		if valid, _ := verifyNonce(challenge, nonce, difficulty); !valid {
+			t.Errorf("Parallel nonce %q does not solve the challenge", nonce)
+		}
+	})
+
+	t.Run("OneWorkerIsSequential", func(t *testing.T) {
+		solver := &recordingSolver{SHA256HashcashService: pow.NewSHA256HashcashService(0, 0)}
+
+		nonce, attempts, err := solveWithStats(ctx, solver, challenge, difficulty, 1)
+		if err != nil {
+			t.Fatalf("solveWithStats failed: %v", err)
+		}
+		if solver.parallelWorkers != 0 {
+			t.Errorf("Expected no parallel solve with 1 worker, got %d workers", solver.parallelWorkers)
+		}
+		if nonce != sequential {
+			t.Errorf("Expected the sequential nonce %q, got %q", sequential, nonce)
+		}
+		if attempts < 1 {
+			t.Errorf("Expected sequential solve to report attempts, got %d", attempts)
+		}
+	})
+}
+
+// verifyNonce checks nonce against a freshly stored copy of challenge
+func verifyNonce(challenge, nonce string, difficulty int) (bool, error) {
+	store := pow.NewInMemoryStore(0)
+	store.Put(challenge, pow.ChallengeMeta{IssuedAt: time.Now(), Difficulty: difficulty}, time.Minute)
+	verifier := pow.NewSHA256HashcashServiceWithStore(difficulty, time.Minute, 0, 0, store)
+	return verifier.VerifyProof(challenge, nonce)
+}
+
+func TestScaledSolveTimeout(t *testing.T) {
+	const base, factor, limit = 10 * time.Millisecond, 256, time.Minute
+
+	// Each SHA256 difficulty level (8 bits) multiplies the timeout by factor until the cap
+	tests := []struct {
+		bits int
+		want time.Duration
+	}{
+		{0, 10 * time.Millisecond},
+		{4, 160 * time.Millisecond}, // Argon2id difficulties fall between levels
+		{8, 2560 * time.Millisecond},
+		{16, limit}, // 655.36s is above the cap
+		{40, limit},
+		{8000, limit}, // Far beyond what a Duration can hold
+	}
+
+	prev := time.Duration(0)
+	for _, tt := range tests {
+		got := scaledSolveTimeout(base, factor, tt.bits, limit)
+		if got != tt.want {
+			t.Errorf("scaledSolveTimeout(%d bits) = %v, want %v", tt.bits, got, tt.want)
+		}
+		if got < prev {
+			t.Errorf("Timeout shrank from %v to %v at %d bits", prev, got, tt.bits)
+		}
+		prev = got
+	}
+
+	// Without a base every difficulty gets the flat cap, as before scaling existed
+	if got := scaledSolveTimeout(0, factor, 8, limit); got != limit {
+		t.Errorf("Expected flat timeout %v without a base, got %v", limit, got)
+	}
+	// A factor below 1 would shrink the timeout with difficulty
+	if got := scaledSolveTimeout(base, 0, 16, limit); got != base {
+		t.Errorf("Expected factor < 1 to keep the base %v, got %v", base, got)
+	}
+}
+
+func TestSolverFor(t *testing.T) {
+	sha256Solver := pow.NewSHA256HashcashService(0, 0)
+	c := NewClient(Config{}, sha256Solver, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	challenge := func(algorithm string, params *protocol.Argon2Params) protocol.ChallengeMessage {
+		return protocol.ChallengeMessage{Challenge: "1700000000:feedface", Algorithm: algorithm, Argon2: params}
+	}
+
+	// Servers predating the algorithm field send sha256 challenges
+	for _, algorithm := range []string{"", protocol.AlgorithmSHA256} {
+		solver, err := c.solverFor(challenge(algorithm, nil))
+		if err != nil {
+			t.Fatalf("solverFor(%q) failed: %v", algorithm, err)
+		}
+		if solver != pow.SolverService(sha256Solver) {
+			t.Errorf("Expected the configured solver for %q, got %T", algorithm, solver)
+		}
+	}
+
+	// Argon2id is solved with the cost parameters the server sent
+	solver, err := c.solverFor(challenge(protocol.AlgorithmArgon2id, &protocol.Argon2Params{Time: 1, Memory: 64, Threads: 2}))
+	if err != nil {
+		t.Fatalf("solverFor(argon2id) failed: %v", err)
+	}
+	argon2Solver, ok := solver.(*pow.Argon2HashcashService)
+	if !ok {
+		t.Fatalf("Expected an argon2id solver, got %T", solver)
+	}
+	if params := argon2Solver.GetParams(); params != (pow.Argon2Params{Time: 1, Memory: 64, Threads: 2}) {
+		t.Errorf("Expected the server's cost parameters, got %+v", params)
+	}
+
+	// The attempt cap applies to the configured solver and to per-challenge ones
+	capped := NewClient(Config{MaxSolveAttempts: 10}, pow.NewSHA256HashcashService(0, 0), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	for _, msg := range []protocol.ChallengeMessage{
+		challenge(protocol.AlgorithmSHA256, nil),
+		challenge(protocol.AlgorithmArgon2id, &protocol.Argon2Params{Time: 1, Memory: 64, Threads: 1}),
+	} {
+		solver, err := capped.solverFor(msg)
+		if err != nil {
+			t.Fatalf("solverFor(%q) failed: %v", msg.Algorithm, err)
+		}
+		if _, err := solver.SolveChallenge(context.Background(), msg.Challenge, 255); !errors.Is(err, pow.ErrSolveAttemptsExceeded) {
+			t.Errorf("Expected ErrSolveAttemptsExceeded from the %q solver, got: %v", msg.Algorithm, err)
+		}
+	}
+
+	if _, err := c.solverFor(challenge(protocol.AlgorithmArgon2id, nil)); err == nil {
+		t.Error("Expected an error for argon2id without cost parameters")
+	}
+	if _, err := c.solverFor(challenge("scrypt", nil)); !errors.Is(err, ErrUnsupportedAlgorithm) {
+		t.Errorf("Expected ErrUnsupportedAlgorithm, got: %v", err)
+	}
+}
+
+func TestSolveProgress(t *testing.T) {
+	t.Run("Sequential", func(t *testing.T) {
+		var reports []uint64
+		c := NewClient(Config{
+			SolveProgress:    func(attempts uint64, _ time.Duration) { reports = append(reports, attempts) },
+			ProgressInterval: 4,
+		}, pow.NewSHA256HashcashService(0, 0), nil)
+
+		// Argon2id solvers are made per challenge and get the callback with each solve
+		// too; at a few hashes per millisecond they are the kind of slow solve progress
+		// is meant for
+		solver, err := c.solverFor(protocol.ChallengeMessage{
+			Challenge: "1700000000:progress",
+			Algorithm: protocol.AlgorithmArgon2id,
+			Argon2:    &protocol.Argon2Params{Time: 1, Memory: 64, Threads: 1},
+		})
+		if err != nil {
+			t.Fatalf("solverFor failed: %v", err)
+		}
+
+		_, attempts, err := c.solve(context.Background(), solver, "progress", "1700000000:progress", 6, time.Minute)
+		if err != nil {
+			t.Fatalf("solve failed: %v", err)
+		}
+		if attempts <= 4 {
+			t.Fatalf("Solve took %d attempts, too few to report progress", attempts)
+		}
+		if len(reports) == 0 || reports[0] != 4 {
+			t.Errorf("Expected progress reports every 4 attempts, got %v after %d attempts", reports, attempts)
+		}
+	})
+
+	// Clients solve in parallel by default on multicore machines
+	t.Run("Parallel", func(t *testing.T) {
+		var reports atomic.Int32
+		solver := pow.NewSHA256HashcashService(0, 0)
+		solver.SetMaxSolveAttempts(1 << 16)
+		c := NewClient(Config{
+			SolverWorkers:    4,
+			SolveProgress:    func(uint64, time.Duration) { reports.Add(1) },
+			ProgressInterval: 1000,
+		}, solver, nil)
+
+		// No hash has 32 leading zero bytes, so every allowed nonce is tried
+		if _, _, err := c.solve(context.Background(), solver, "progress", "1700000000:progress", 32, time.Minute); !errors.Is(err, pow.ErrSolveAttemptsExceeded) {
+			t.Fatalf("Expected ErrSolveAttemptsExceeded, got: %v", err)
+		}
+		got := reports.Load()
+		if got == 0 {
+			t.Fatal("Expected progress reports from a parallel solve")
+		}
+
+		// The callback goes with each solve, the service itself reports nothing
+		if _, _, err := solver.SolveChallengeWithStats(context.Background(), "1700000000:progress", 32); !errors.Is(err, pow.ErrSolveAttemptsExceeded) {
+			t.Fatalf("Expected ErrSolveAttemptsExceeded, got: %v", err)
+		}
+		if after := reports.Load(); after != got {
+			t.Errorf("Expected no reports from a solve outside the client, got %d more", after-got)
+		}
+	})
+}
+
+func TestSessionOpen_ContextEndsDial(t *testing.T) {
+	// A server that accepts but never answers stalls the TLS handshake
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	c := NewClient(Config{
+		ServerHost:     host,
+		ServerPort:     port,
+		TLSEnabled:     true,
+		ConnectTimeout: time.Minute,
+	}, pow.NewSHA256HashcashService(0, 0), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err = c.NewSession().Open(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the context deadline to end the dial, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Open returned after %v, long after the context ended", elapsed)
+	}
+}
@@ -0,0 +1,77 @@
+package client
+
+import (
+	"sync"
+	"time"
+)
+
+// SolveStats summarizes the challenges solved at one difficulty
+type SolveStats struct {
+	Count         int
+	MinDuration   time.Duration
+	MaxDuration   time.Duration
+	TotalDuration time.Duration
+	TotalAttempts int // Zero when the solver doesn't report attempts
+}
+
+// AvgDuration returns the mean solve duration
+func (s SolveStats) AvgDuration() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.TotalDuration / time.Duration(s.Count)
+}
+
+// AvgAttempts returns the mean number of nonces tried per solve
+func (s SolveStats) AvgAttempts() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return float64(s.TotalAttempts) / float64(s.Count)
+}
+
+// SolveMetrics accumulates solve statistics keyed by difficulty.
+// It is safe for concurrent use.
+type SolveMetrics struct {
+	byDifficulty map[int]*SolveStats
+	mu           sync.Mutex // Protects byDifficulty
+}
+
+// NewSolveMetrics creates an empty metrics accumulator
+func NewSolveMetrics() *SolveMetrics {
+	return &SolveMetrics{byDifficulty: make(map[int]*SolveStats)}
+}
+
+// Record adds one solve at difficulty that took duration and attempts nonces
+func (m *SolveMetrics) Record(difficulty int, duration time.Duration, attempts int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats, exists := m.byDifficulty[difficulty]
+	if !exists {
+		stats = &SolveStats{MinDuration: duration, MaxDuration: duration}
+		m.byDifficulty[difficulty] = stats
+	}
+
+	stats.Count++
+	stats.TotalDuration += duration
+	stats.TotalAttempts += attempts
+	if duration < stats.MinDuration {
+		stats.MinDuration = duration
+	}
+	if duration > stats.MaxDuration {
+		stats.MaxDuration = duration
+	}
+}
+
+// Snapshot returns a copy of the statistics keyed by difficulty
+func (m *SolveMetrics) Snapshot() map[int]SolveStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snapshot := make(map[int]SolveStats, len(m.byDifficulty))
+	for difficulty, stats := range m.byDifficulty {
+		snapshot[difficulty] = *stats
+	}
+	return snapshot
+}
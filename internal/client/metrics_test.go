@@ -0,0 +1,72 @@
+package client
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSolveMetrics_Record(t *testing.T) {
+	metrics := NewSolveMetrics()
+
+	metrics.Record(1, 10*time.Millisecond, 100)
+	metrics.Record(1, 30*time.Millisecond, 300)
+	metrics.Record(1, 20*time.Millisecond, 200)
+	metrics.Record(2, 5*time.Second, 70000)
+
+	snapshot := metrics.Snapshot()
+	if len(snapshot) != 2 {
+		t.Fatalf("Expected stats for 2 difficulties, got %d", len(snapshot))
+	}
+
+	d1 := snapshot[1]
+	if d1.Count != 3 {
+		t.Errorf("Expected count 3, got %d", d1.Count)
+	}
+	if d1.MinDuration != 10*time.Millisecond || d1.MaxDuration != 30*time.Millisecond {
+		t.Errorf("Expected min 10ms and max 30ms, got %v and %v", d1.MinDuration, d1.MaxDuration)
+	}
+	if d1.AvgDuration() != 20*time.Millisecond {
+		t.Errorf("Expected avg 20ms, got %v", d1.AvgDuration())
+	}
+	if d1.AvgAttempts() != 200 {
+		t.Errorf("Expected avg attempts 200, got %f", d1.AvgAttempts())
+	}
+
+	if d2 := snapshot[2]; d2.Count != 1 || d2.MinDuration != 5*time.Second || d2.MaxDuration != 5*time.Second {
+		t.Errorf("Unexpected stats for difficulty 2: %+v", d2)
+	}
+
+	// Snapshots are copies
+	metrics.Record(1, time.Millisecond, 1)
+	if snapshot[1].Count != 3 {
+		t.Error("Snapshot changed after a later record")
+	}
+}
+
+func TestSolveMetrics_Concurrent(t *testing.T) {
+	metrics := NewSolveMetrics()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				metrics.Record(1, time.Millisecond, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if stats := metrics.Snapshot()[1]; stats.Count != 1000 || stats.TotalAttempts != 1000 {
+		t.Errorf("Expected 1000 records, got %+v", stats)
+	}
+}
+
+func TestSolveStats_Empty(t *testing.T) {
+	var stats SolveStats
+	if stats.AvgDuration() != 0 || stats.AvgAttempts() != 0 {
+		t.Error("Expected zero averages for empty stats")
+	}
+}
@@ -0,0 +1,121 @@
+package client
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+const (
+	// nonceCacheCapacity is the number of solved challenges a client remembers
+	nonceCacheCapacity = 128
+	// nonceCacheTTL matches the server's default challenge TTL; older solutions are useless
+	nonceCacheTTL = 5 * time.Minute
+)
+
+// nonceCache remembers nonces solved for challenges whose proof may not have
+// reached the server, so a retry presented with the same challenge (as a
+// stateless server may do) reuses the work instead of solving again.
+// Entries expire after a TTL and, when the cache is full, the oldest is evicted.
+type nonceCache struct {
+	capacity int
+	ttl      time.Duration
+	entries  map[string]*list.Element // map[key]element in order
+	order    *list.List               // Front is oldest
+	now      func() time.Time         // Overridable for tests
+	mu       sync.Mutex               // Protects entries and order
+}
+
+// nonceEntry is a single solved challenge
+type nonceEntry struct {
+	key        string
+	nonce      string
+	difficulty int
+	expiry     time.Time
+}
+
+// newNonceCache creates a nonce cache holding at most capacity entries for ttl each
+func newNonceCache(capacity int, ttl time.Duration) *nonceCache {
+	return &nonceCache{
+		capacity: capacity,
+		ttl:      ttl,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+		now:      time.Now,
+	}
+}
+
+// get returns the nonce solved for key at difficulty or higher, if still cached
+func (c *nonceCache) get(key string, difficulty int) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, exists := c.entries[key]
+	if !exists {
+		return "", false
+	}
+
+	entry := elem.Value.(*nonceEntry)
+	if !c.now().Before(entry.expiry) {
+		c.remove(elem)
+		return "", false
+	}
+	if entry.difficulty < difficulty {
+		return "", false
+	}
+	return entry.nonce, true
+}
+
+// put remembers nonce as the solution for key at difficulty
+func (c *nonceCache) put(key, nonce string, difficulty int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, exists := c.entries[key]; exists {
+		c.remove(elem)
+	}
+
+	now := c.now()
+	c.evict(now)
+
+	c.entries[key] = c.order.PushBack(&nonceEntry{
+		key:        key,
+		nonce:      nonce,
+		difficulty: difficulty,
+		expiry:     now.Add(c.ttl),
+	})
+}
+
+// forget drops key, e.g. once the server has consumed its challenge
+func (c *nonceCache) forget(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, exists := c.entries[key]; exists {
+		c.remove(elem)
+	}
+}
+
+// evict drops expired entries from the front and, if still full,
+// the oldest one. Must be called with mu held.
+func (c *nonceCache) evict(now time.Time) {
+	for elem := c.order.Front(); elem != nil; elem = c.order.Front() {
+		if len(c.entries) < c.capacity && now.Before(elem.Value.(*nonceEntry).expiry) {
+			return
+		}
+		c.remove(elem)
+	}
+}
+
+// remove deletes elem from the cache. Must be called with mu held.
+func (c *nonceCache) remove(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*nonceEntry).key)
+}
+
+// size returns the number of cached nonces
+func (c *nonceCache) size() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
@@ -0,0 +1,81 @@
+package client
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestNonceCache_Reuse(t *testing.T) {
+	cache := newNonceCache(4, time.Minute)
+
+	cache.put("challenge", "42", 3)
+
+	if nonce, ok := cache.get("challenge", 3); !ok || nonce != "42" {
+		t.Errorf("Expected cached nonce 42, got %q (ok=%v)", nonce, ok)
+	}
+	// A nonce solved at a higher difficulty also satisfies a lower one
+	if _, ok := cache.get("challenge", 2); !ok {
+		t.Error("Expected nonce to satisfy a lower difficulty")
+	}
+	if _, ok := cache.get("challenge", 4); ok {
+		t.Error("Expected nonce not to satisfy a higher difficulty")
+	}
+	if _, ok := cache.get("other", 3); ok {
+		t.Error("Expected miss for unknown challenge")
+	}
+
+	cache.forget("challenge")
+	if _, ok := cache.get("challenge", 3); ok {
+		t.Error("Expected forgotten nonce to be gone")
+	}
+}
+
+func TestNonceCache_EvictsOldestWhenFull(t *testing.T) {
+	cache := newNonceCache(3, time.Minute)
+
+	for i := 0; i < 5; i++ {
+		cache.put(fmt.Sprintf("challenge-%d", i), fmt.Sprint(i), 1)
+	}
+
+	if size := cache.size(); size != 3 {
+		t.Errorf("Expected size capped at 3, got %d", size)
+	}
+	for i := 0; i < 2; i++ {
+		if _, ok := cache.get(fmt.Sprintf("challenge-%d", i), 1); ok {
+			t.Errorf("Expected challenge-%d to be evicted", i)
+		}
+	}
+	for i := 2; i < 5; i++ {
+		if _, ok := cache.get(fmt.Sprintf("challenge-%d", i), 1); !ok {
+			t.Errorf("Expected challenge-%d to be cached", i)
+		}
+	}
+}
+
+func TestNonceCache_Expiry(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	cache := newNonceCache(3, time.Minute)
+	cache.now = func() time.Time { return now }
+
+	cache.put("old", "1", 1)
+	now = now.Add(30 * time.Second)
+	cache.put("new", "2", 1)
+
+	now = now.Add(45 * time.Second)
+
+	// The expired entry makes room before any live one is evicted
+	cache.put("a", "3", 1)
+	cache.put("b", "4", 1)
+	if _, ok := cache.get("old", 1); ok {
+		t.Error("Expected expired nonce to miss")
+	}
+	for _, key := range []string{"new", "a", "b"} {
+		if _, ok := cache.get(key, 1); !ok {
+			t.Errorf("Expected live nonce %q to hit", key)
+		}
+	}
+	if size := cache.size(); size != 3 {
+		t.Errorf("Expected 3 cached nonces, got %d", size)
+	}
+}
@@ -0,0 +1,181 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrPoolClosed is returned by GetQuote after Close
+var ErrPoolClosed = errors.New("pool is closed")
+
+// PoolStats is a snapshot of a pool's utilization
+type PoolStats struct {
+	Size      int // Cap on sessions open at once
+	Open      int // Sessions connected, idle or in use
+	InUse     int // Sessions fetching a quote
+	Opened    int // Sessions opened so far
+	Discarded int // Sessions closed because the server ended them or a round failed
+}
+
+// Pool fetches quotes concurrently over up to a fixed number of keep-alive sessions,
+// reusing idle ones. Sessions the server ends or that fail are discarded and replaced
+// by new ones on demand. It is safe for concurrent use.
+type Pool struct {
+	client *Client
+	slots  chan struct{} // Holds a token per session in use, bounding them to the pool size
+	idle   []*Session    // Open sessions waiting for a round, most recently used last
+	stats  PoolStats
+	closed bool
+	mu     sync.Mutex // Protects idle, stats and closed
+}
+
+// NewPool creates a pool of up to size sessions, values < 1 mean 1. Sessions are
+// opened as GetQuote needs them.
+func (c *Client) NewPool(size int) *Pool {
+	if size < 1 {
+		size = 1
+	}
+	return &Pool{
+		client: c,
+		slots:  make(chan struct{}, size),
+		stats:  PoolStats{Size: size},
+	}
+}
+
+// GetQuote fetches a quote on an idle session, or on a new one while fewer than the
+// pool size are open, waiting for a session to free up otherwise. An idle session
+// that turns out to be dead is discarded and the quote fetched on a new one.
+func (p *Pool) GetQuote(ctx context.Context) (string, error) {
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	defer func() { <-p.slots }()
+
+	session, err := p.take()
+	if err != nil {
+		return "", err
+	}
+	if session != nil {
+		quote, err := session.Next(ctx)
+		if err == nil {
+			p.put(session)
+			return quote, nil
+		}
+		// The server may have ended or dropped the connection while it sat idle
+		p.client.logger.Debug("Discarding pooled session", "error", err)
+		p.discard(session)
+		if ctx.Err() != nil {
+			return "", err
+		}
+	}
+
+	session, err = p.open(ctx)
+	if err != nil {
+		return "", err
+	}
+	quote, err := session.Next(ctx)
+	if err != nil {
+		p.discard(session)
+		return "", err
+	}
+	p.put(session)
+	return quote, nil
+}
+
+// Stats returns the pool's current utilization
+func (p *Pool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stats
+}
+
+// Close closes the idle sessions and those in use once their round ends. GetQuote
+// returns ErrPoolClosed afterwards. It is safe to call Close multiple times.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	idle := p.idle
+	p.idle = nil
+	p.closed = true
+	p.stats.Open -= len(idle)
+	p.mu.Unlock()
+
+	var errs []error
+	for _, session := range idle {
+		if err := session.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// take returns the most recently used idle session, or nil if there is none
+func (p *Pool) take() (*Session, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil, ErrPoolClosed
+	}
+	if len(p.idle) == 0 {
+		return nil, nil
+	}
+	session := p.idle[len(p.idle)-1]
+	p.idle = p.idle[:len(p.idle)-1]
+	p.stats.InUse++
+	return session, nil
+}
+
+// open connects a new session for the caller's round
+func (p *Pool) open(ctx context.Context) (*Session, error) {
+	session := p.client.NewSession()
+	if err := session.Open(ctx); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.stats.Open++
+	p.stats.InUse++
+	p.stats.Opened++
+	p.mu.Unlock()
+	return session, nil
+}
+
+// put returns session to the idle list after a successful round. It discards the
+// session instead if the server won't serve another round on it, and closes it if
+// the pool is closed.
+func (p *Pool) put(session *Session) {
+	if session.ended() {
+		p.discard(session)
+		return
+	}
+
+	p.mu.Lock()
+	p.stats.InUse--
+	if !p.closed {
+		p.idle = append(p.idle, session)
+		p.mu.Unlock()
+		return
+	}
+	p.stats.Open--
+	p.mu.Unlock()
+
+	if err := session.Close(); err != nil {
+		p.client.logger.Debug("Failed to close pooled session", "error", err)
+	}
+}
+
+// discard closes session, which was in use
+func (p *Pool) discard(session *Session) {
+	p.mu.Lock()
+	p.stats.Open--
+	p.stats.InUse--
+	p.stats.Discarded++
+	p.mu.Unlock()
+
+	if err := session.Close(); err != nil {
+		p.client.logger.Debug("Failed to close pooled session", "error", err)
+	}
+}
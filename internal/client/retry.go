@@ -0,0 +1,89 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"pow/pkg/protocol"
+)
+
+// MaxRetryDelay caps the exponential backoff between attempts
+const MaxRetryDelay = 30 * time.Second
+
+// errConnect marks failures to establish a connection, which are worth retrying
+var errConnect = errors.New("failed to connect to server")
+
+// isRetryable reports whether a failed request may succeed if tried again.
+// Connection failures and server errors signalling temporary overload are
+// retryable; protocol violations, invalid proofs and cancellation are not.
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	if errors.Is(err, errConnect) {
+		return true
+	}
+
+	var serverErr *ServerError
+	if errors.As(err, &serverErr) {
+		switch serverErr.Code {
+		case protocol.ErrCodeRateLimited, protocol.ErrCodeOverloaded, protocol.ErrCodeShuttingDown:
+			return true
+		}
+	}
+
+	return false
+}
+
+// retryDelay returns the backoff before retry number attempt (starting at 0):
+// the base delay doubled per attempt, capped at MaxRetryDelay, with jitter
+// picking a random point in its upper half so clients don't retry in lockstep
+func retryDelay(base time.Duration, attempt int) time.Duration {
+	delay := base
+	for i := 0; i < attempt && delay < MaxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > MaxRetryDelay {
+		delay = MaxRetryDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
+
+// retryAfterHint returns the server's advisory retry delay carried by err,
+// capped at MaxRetryDelay, or 0 if there is none
+func retryAfterHint(err error) time.Duration {
+	var serverErr *ServerError
+	if !errors.As(err, &serverErr) || serverErr.RetryAfter <= 0 {
+		return 0
+	}
+	if serverErr.RetryAfter > MaxRetryDelay {
+		return MaxRetryDelay
+	}
+	return serverErr.RetryAfter
+}
+
+// sleepCtx waits for delay, returning false without waiting if ctx would
+// end first, or as soon as ctx ends
+func sleepCtx(ctx context.Context, delay time.Duration) bool {
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+		return false
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,166 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"pow/pkg/protocol"
+)
+
+var (
+	// ErrSessionNotOpen is returned by Next before Open has succeeded
+	ErrSessionNotOpen = errors.New("session is not open")
+	// ErrSessionClosed is returned by Open and Next after Close
+	ErrSessionClosed = errors.New("session is closed")
+	// ErrSessionEnded is returned by Next once the server stops serving the connection,
+	// either because its per-connection limit was reached or a previous round failed
+	ErrSessionEnded = errors.New("session ended by server")
+)
+
+// Session fetches quotes over a single keep-alive connection, solving one
+// challenge per quote without redialing.
+//
+// Open must be called before Next. Next calls are serialized, since rounds on
+// the connection are strictly sequential. Once Next returns ErrSessionEnded or
+// any other error, the session cannot be reused and should be closed; open a
+// new session to continue. Close may be called at any time and more than once.
+//
+// With Config.HeartbeatInterval set, the session pings the server while idle
+// between rounds, so neither the server's read timeout nor an intermediary
+// closes the connection.
+type Session struct {
+	client *Client
+	conn   net.Conn
+	framer *protocol.Framer
+	alive  bool // Whether the server will send another challenge
+	closed bool
+	stop   chan struct{} // Closed by Close to stop heartbeats
+	mu     sync.Mutex    // Protects all fields and serializes rounds and heartbeats
+}
+
+// NewSession creates a session that is not yet connected
+func (c *Client) NewSession() *Session {
+	return &Session{client: c}
+}
+
+// Open connects to the server, giving up when ctx is done
+func (s *Session) Open(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrSessionClosed
+	}
+	if s.conn != nil {
+		return fmt.Errorf("session is already open")
+	}
+	conn, err := s.client.connect(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.conn = conn
+	s.framer = s.client.newFramer(conn)
+	s.alive = true
+
+	if interval := s.client.config.HeartbeatInterval; interval > 0 {
+		s.stop = make(chan struct{})
+		go s.heartbeat(interval, s.stop)
+	}
+	return nil
+}
+
+// heartbeat pings the server every interval until stop is closed. Rounds hold mu,
+// so pings only go out between them; the answers are skipped by the next round.
+func (s *Session) heartbeat(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		s.mu.Lock()
+		if s.closed || !s.alive {
+			s.mu.Unlock()
+			return
+		}
+		ping := protocol.HeartbeatMessage{BaseMessage: s.client.codec.NewBaseMessage(protocol.MsgTypeHeartbeat)}
+		err := s.framer.Write(ping)
+		s.mu.Unlock()
+
+		if err != nil {
+			// The next round reports the broken connection
+			s.client.logger.Debug("Failed to send heartbeat", "error", err)
+			return
+		}
+	}
+}
+
+// Next solves the next challenge on the connection and returns its quote
+func (s *Session) Next(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return "", ErrSessionClosed
+	}
+	if s.conn == nil {
+		return "", ErrSessionNotOpen
+	}
+	if !s.alive {
+		return "", ErrSessionEnded
+	}
+
+	r, err := s.client.solveAndFetch(ctx, s.framer, 1, true)
+	if err != nil {
+		s.alive = false
+		return "", err
+	}
+
+	s.alive = r.keepAlive
+	return r.result.Quote, nil
+}
+
+// ended reports whether Next can no longer fetch a quote on the session
+func (s *Session) ended() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed || !s.alive
+}
+
+// Close ends the session, telling the server when it still expects a proof.
+// It is safe to call Close multiple times.
+func (s *Session) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	if s.stop != nil {
+		close(s.stop)
+	}
+
+	if s.conn == nil {
+		return nil
+	}
+
+	// Best effort: the server treats a plain disconnect the same way
+	if s.alive {
+		closeMsg := protocol.CloseMessage{BaseMessage: s.client.codec.NewBaseMessage(protocol.MsgTypeClose)}
+		if err := s.framer.Write(closeMsg); err != nil {
+			s.client.logger.Debug("Failed to send close message", "error", err)
+		}
+	}
+
+	return s.conn.Close()
+}
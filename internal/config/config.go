@@ -2,8 +2,11 @@ package config
 
 import (
 	"fmt"
-	"os"
+	"math/big"
+	"net"
+	"runtime"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -17,7 +20,26 @@ const (
 	DefaultReadTimeout         = 30 * time.Second
 	DefaultWriteTimeout        = 10 * time.Second
 	DefaultMaxConnections      = 100
+	DefaultMaxConnectionsPerIP = 20
 	DefaultShutdownTimeout     = 30 * time.Second
+	DefaultPowAlgorithm        = "sha256"
+	DefaultArgon2Time          = 1
+	DefaultArgon2Memory        = 8 * 1024 // KiB
+	DefaultArgon2Threads       = 1
+	DefaultRateLimitPerIP      = 10.0
+	DefaultRateLimitBurst      = 20
+	DefaultMaxQuotesPerRequest = 10
+	DefaultMaxQuoteLength      = 1000
+	DefaultConnectionDeadline  = 45 * time.Second
+	DefaultMaxRequestsPerConn  = 10
+	DefaultChallengeRandBytes  = 16
+	DefaultPowSeenCacheSize    = 100000
+	DefaultSubscribeInterval   = 5 * time.Second
+	MaxDefaultCleanupInterval  = 30 * time.Second // Cap on the default CLEANUP_INTERVAL of half the TTL
+	DefaultAcceptQueueTimeout  = time.Second
+	DefaultAcceptWorkers       = 1
+	DefaultTCPKeepAlive        = 15 * time.Second
+	DefaultPortRetryDelay      = time.Second
 
 	// Default client configuration values
 	DefaultClientHost         = "localhost"
@@ -26,75 +48,287 @@ const (
 	DefaultClientReadTimeout  = 30 * time.Second
 	DefaultClientWriteTimeout = 10 * time.Second
 	DefaultSolveTimeout       = 5 * time.Minute
+	DefaultSolveTimeoutFactor = 256 // Each SHA256 difficulty level takes ~256x more attempts
+	DefaultQuoteCount         = 1
+	DefaultMaxRetries         = 3
+	DefaultRetryBaseDelay     = 500 * time.Millisecond
+	DefaultMaxAcceptedBits    = MaxDifficulty * 8 // Hardest challenge a valid server may send
 
 	// Configuration validation limits
 	MinDifficulty          = 1
 	MaxDifficulty          = 5
 	MinMaxActiveChallenges = 100
 	MinMaxConnections      = 1
+	MaxArgon2Difficulty    = 24 // Argon2id difficulty is measured in bits
+	MinArgon2MemoryPerLane = 8  // Argon2 requires at least 8 KiB per thread
+	MinRateLimitBurst      = 1
+	MinQuotesPerRequest    = 1
+	MinRequestsPerConn     = 1
+	MaxArgon2Threads       = 255
+	MinChallengeRandBytes  = 8
+	MaxChallengeRandBytes  = 1024 // Keeps challenge messages well below the protocol size limit
+	MinPowSecretSize       = 16   // Minimum HMAC secret size in bytes for stateless challenges
+	MinAdminTokenSize      = 16   // Minimum shared secret size in bytes for the admin listener
+	MinTrustedTokenSize    = 16   // Minimum size in bytes of each token that skips PoW
+	MinMaxMessageSize      = 4096 // Fits a challenge with MaxChallengeRandBytes of randomness
+	MaxMaxMessageSize      = 16 << 20
+	MinPowSeenCacheSize    = 100
+	MinSubscribeInterval   = time.Second // Quotes are pushed at whole-second intervals
+	MaxTTLJitterPercent    = 50          // Keeps every challenge valid for at least half of CHALLENGE_TTL
+	MaxPowNamespaceLength  = 64
+	MaxPowTargetDigits     = 64 // A 256-bit target in hex
+	MaxPort                = 65535
+	maxHostnameLength      = 253
+	maxHostnameLabelLength = 63
+)
+
+// Supported PoW algorithms
+const (
+	PowAlgorithmSHA256   = "sha256"
+	PowAlgorithmArgon2id = "argon2id"
+)
+
+// Supported listener networks
+const (
+	NetworkTCP  = "tcp"
+	NetworkUnix = "unix"
+)
+
+// Supported quote modes
+const (
+	QuoteModeRandom = "random"
+	QuoteModeDaily  = "daily"
+)
+
+// Supported message encodings
+const (
+	EncodingJSON    = "json"
+	EncodingMsgpack = "msgpack"
 )
 
 // ServerConfig holds server configuration
 type ServerConfig struct {
-	Host                string
-	Port                string
-	Difficulty          int
-	ChallengeTTL        time.Duration
-	MaxActiveChallenges int
-	ReadTimeout         time.Duration
-	WriteTimeout        time.Duration
-	MaxConnections      int
-	ShutdownTimeout     time.Duration
+	Host                   string
+	Port                   string
+	Difficulty             int
+	MinEffectiveDifficulty int
+	ChallengeTTL           time.Duration
+	TTLJitterPercent       int
+	CleanupInterval        time.Duration
+	MaxActiveChallenges    int
+	ReadTimeout            time.Duration
+	WriteTimeout           time.Duration
+	MaxConnections         int
+	MaxConnectionsPerIP    int
+	ShutdownTimeout        time.Duration
+	PowAlgorithm           string
+	Argon2Time             int
+	Argon2Memory           int
+	Argon2Threads          int
+	TLSCertFile            string
+	TLSKeyFile             string
+	RateLimitPerIP         float64
+	RateLimitBurst         int
+	GlobalChallengeRate    float64
+	QuotesFile             string
+	QuotesReloadInterval   time.Duration
+	QuotesNoRepeat         bool
+	QuoteMode              string
+	MaxQuotesPerRequest    int
+	MaxQuoteLength         int
+	ConnectionDeadline     time.Duration
+	MaxRequestsPerConn     int
+	ChallengeRandBytes     int
+	PowStateless           bool
+	PowDisabled            bool
+	PowNamespace           string
+	PowTarget              string
+	PowSecret              string
+	PowSeenCacheSize       int
+	BindToIP               bool
+	LegacyFraming          bool
+	StrictDecoding         bool
+	Network                string
+	SocketPath             string
+	HealthPort             string
+	AdminPort              string
+	AdminToken             string
+	TrustedTokens          []string
+	MaxMessageSize         int
+	MessageEncoding        string
+	TCPKeepAlive           time.Duration
+	AuditLogFile           string
+	SubscribeMinInterval   time.Duration
+	SubscribeMaxDuration   time.Duration
+	HeartbeatInterval      time.Duration
+	AcceptQueueSize        int
+	AcceptQueueTimeout     time.Duration
+	AcceptWorkers          int
+	PortRetry              int
+	PortRetryDelay         time.Duration
 }
 
 // ClientConfig holds client configuration
 type ClientConfig struct {
-	ServerHost     string
-	ServerPort     string
-	ConnectTimeout time.Duration
-	ReadTimeout    time.Duration
-	WriteTimeout   time.Duration
-	SolveTimeout   time.Duration
+	ServerHost            string
+	ServerPort            string
+	ConnectTimeout        time.Duration
+	ReadTimeout           time.Duration
+	WriteTimeout          time.Duration
+	SolveTimeout          time.Duration
+	SolveTimeoutBase      time.Duration
+	SolveTimeoutFactor    float64
+	TLSEnabled            bool
+	TLSInsecureSkipVerify bool
+	QuoteCategory         string
+	LegacyFraming         bool
+	QuoteCount            int
+	MaxRetries            int
+	RetryBaseDelay        time.Duration
+	Network               string
+	SocketPath            string
+	SolverWorkers         int
+	MaxAcceptedDifficulty int
+	HeartbeatInterval     time.Duration
+	MaxSolveAttempts      int
+	TrustedToken          string
+	MaxMessageSize        int
+	MessageEncoding       string
 }
 
 // LoadServerConfig loads server configuration from environment variables
 func LoadServerConfig() ServerConfig {
-	return ServerConfig{
-		Host:                getEnv("SERVER_HOST", DefaultServerHost),
-		Port:                getEnv("SERVER_PORT", DefaultServerPort),
-		Difficulty:          getEnvInt("POW_DIFFICULTY", DefaultDifficulty),
-		ChallengeTTL:        getEnvDuration("CHALLENGE_TTL", DefaultChallengeTTL),
-		MaxActiveChallenges: getEnvInt("MAX_ACTIVE_CHALLENGES", DefaultMaxActiveChallenges),
-		ReadTimeout:         getEnvDuration("READ_TIMEOUT", DefaultReadTimeout),
-		WriteTimeout:        getEnvDuration("WRITE_TIMEOUT", DefaultWriteTimeout),
-		MaxConnections:      getEnvInt("MAX_CONNECTIONS", DefaultMaxConnections),
-		ShutdownTimeout:     getEnvDuration("SHUTDOWN_TIMEOUT", DefaultShutdownTimeout),
+	return loadServerConfig(settings{})
+}
+
+// loadServerConfig loads server configuration from src
+func loadServerConfig(src settings) ServerConfig {
+	cfg := ServerConfig{
+		Host:                 normalizeHost(src.getEnv("SERVER_HOST", DefaultServerHost)),
+		Port:                 src.getEnv("SERVER_PORT", DefaultServerPort),
+		Difficulty:           src.getEnvInt("POW_DIFFICULTY", DefaultDifficulty),
+		ChallengeTTL:         src.getEnvDuration("CHALLENGE_TTL", DefaultChallengeTTL),
+		TTLJitterPercent:     src.getEnvInt("TTL_JITTER_PERCENT", 0),
+		MaxActiveChallenges:  src.getEnvInt("MAX_ACTIVE_CHALLENGES", DefaultMaxActiveChallenges),
+		ReadTimeout:          src.getEnvDuration("READ_TIMEOUT", DefaultReadTimeout),
+		WriteTimeout:         src.getEnvDuration("WRITE_TIMEOUT", DefaultWriteTimeout),
+		MaxConnections:       src.getEnvInt("MAX_CONNECTIONS", DefaultMaxConnections),
+		MaxConnectionsPerIP:  src.getEnvInt("MAX_CONNECTIONS_PER_IP", DefaultMaxConnectionsPerIP),
+		ShutdownTimeout:      src.getEnvDuration("SHUTDOWN_TIMEOUT", DefaultShutdownTimeout),
+		PowAlgorithm:         src.getEnv("POW_ALGORITHM", DefaultPowAlgorithm),
+		Argon2Time:           src.getEnvInt("ARGON2_TIME", DefaultArgon2Time),
+		Argon2Memory:         src.getEnvInt("ARGON2_MEMORY", DefaultArgon2Memory),
+		Argon2Threads:        src.getEnvInt("ARGON2_THREADS", DefaultArgon2Threads),
+		TLSCertFile:          src.getEnv("TLS_CERT_FILE", ""),
+		TLSKeyFile:           src.getEnv("TLS_KEY_FILE", ""),
+		RateLimitPerIP:       src.getEnvFloat("RATE_LIMIT_PER_IP", DefaultRateLimitPerIP),
+		RateLimitBurst:       src.getEnvInt("RATE_LIMIT_BURST", DefaultRateLimitBurst),
+		GlobalChallengeRate:  src.getEnvFloat("GLOBAL_CHALLENGE_RATE", 0),
+		QuotesFile:           src.getEnv("QUOTES_FILE", ""),
+		QuotesReloadInterval: src.getEnvDuration("QUOTES_RELOAD_INTERVAL", 0),
+		QuotesNoRepeat:       src.getEnvBool("QUOTES_NO_REPEAT", false),
+		QuoteMode:            src.getEnv("QUOTE_MODE", QuoteModeRandom),
+		MaxQuotesPerRequest:  src.getEnvInt("MAX_QUOTES_PER_REQUEST", DefaultMaxQuotesPerRequest),
+		MaxQuoteLength:       src.getEnvInt("MAX_QUOTE_LENGTH", DefaultMaxQuoteLength),
+		ConnectionDeadline:   src.getEnvDuration("CONNECTION_DEADLINE", DefaultConnectionDeadline),
+		MaxRequestsPerConn:   src.getEnvInt("MAX_REQUESTS_PER_CONNECTION", DefaultMaxRequestsPerConn),
+		ChallengeRandBytes:   src.getEnvInt("CHALLENGE_RANDOM_BYTES", DefaultChallengeRandBytes),
+		PowStateless:         src.getEnvBool("POW_STATELESS", false),
+		PowDisabled:          src.getEnvBool("POW_DISABLED", false),
+		PowNamespace:         src.getEnv("POW_NAMESPACE", ""),
+		PowTarget:            src.getEnv("POW_TARGET", ""),
+		PowSecret:            src.getEnv("POW_SECRET", ""),
+		PowSeenCacheSize:     src.getEnvInt("POW_SEEN_CACHE_SIZE", DefaultPowSeenCacheSize),
+		BindToIP:             src.getEnvBool("BIND_TO_IP", false),
+		LegacyFraming:        src.getEnvBool("LEGACY_FRAMING", false),
+		StrictDecoding:       src.getEnvBool("STRICT_DECODING", false),
+		Network:              src.getEnv("SERVER_NETWORK", NetworkTCP),
+		SocketPath:           src.getEnv("SOCKET_PATH", ""),
+		HealthPort:           src.getEnv("HEALTH_PORT", ""),
+		AdminPort:            src.getEnv("ADMIN_PORT", ""),
+		AdminToken:           src.getEnv("ADMIN_TOKEN", ""),
+		TrustedTokens:        src.getEnvList("TRUSTED_TOKENS"),
+		MaxMessageSize:       src.getEnvInt("MAX_MESSAGE_SIZE", 0),
+		MessageEncoding:      src.getEnv("MESSAGE_ENCODING", EncodingJSON),
+		TCPKeepAlive:         src.getEnvDuration("TCP_KEEPALIVE", DefaultTCPKeepAlive),
+		AuditLogFile:         src.getEnv("AUDIT_LOG_FILE", ""),
+		SubscribeMinInterval: src.getEnvDuration("SUBSCRIPTION_MIN_INTERVAL", DefaultSubscribeInterval),
+		SubscribeMaxDuration: src.getEnvDuration("SUBSCRIPTION_MAX_DURATION", 0),
+		HeartbeatInterval:    src.getEnvDuration("HEARTBEAT_INTERVAL", 0),
+		AcceptQueueSize:      src.getEnvInt("ACCEPT_QUEUE_SIZE", 0),
+		AcceptQueueTimeout:   src.getEnvDuration("ACCEPT_QUEUE_TIMEOUT", DefaultAcceptQueueTimeout),
+		AcceptWorkers:        src.getEnvInt("ACCEPT_WORKERS", DefaultAcceptWorkers),
+		PortRetry:            src.getEnvInt("PORT_RETRY", 0),
+		PortRetryDelay:       src.getEnvDuration("PORT_RETRY_DELAY", DefaultPortRetryDelay),
+
+		MinEffectiveDifficulty: src.getEnvInt("MIN_EFFECTIVE_DIFFICULTY", MinDifficulty),
 	}
+
+	// Without proof of work challenges are issued at difficulty 0
+	if cfg.PowDisabled {
+		cfg.Difficulty = src.getEnvInt("POW_DIFFICULTY", 0)
+		cfg.MinEffectiveDifficulty = src.getEnvInt("MIN_EFFECTIVE_DIFFICULTY", 0)
+	}
+
+	// The default cleanup cadence follows the TTL, so it is read once the TTL is known
+	cfg.CleanupInterval = src.getEnvDuration("CLEANUP_INTERVAL", defaultCleanupInterval(cfg.ChallengeTTL))
+	return cfg
+}
+
+// defaultCleanupInterval returns half of ttl, capped at MaxDefaultCleanupInterval
+func defaultCleanupInterval(ttl time.Duration) time.Duration {
+	if ttl/2 < MaxDefaultCleanupInterval {
+		return ttl / 2
+	}
+	return MaxDefaultCleanupInterval
 }
 
 // LoadClientConfig loads client configuration from environment variables
 func LoadClientConfig() ClientConfig {
+	return loadClientConfig(settings{})
+}
+
+// loadClientConfig loads client configuration from src
+func loadClientConfig(src settings) ClientConfig {
 	return ClientConfig{
-		ServerHost:     getEnv("SERVER_HOST", DefaultClientHost),
-		ServerPort:     getEnv("SERVER_PORT", DefaultClientPort),
-		ConnectTimeout: getEnvDuration("CONNECT_TIMEOUT", DefaultConnectTimeout),
-		ReadTimeout:    getEnvDuration("READ_TIMEOUT", DefaultClientReadTimeout),
-		WriteTimeout:   getEnvDuration("WRITE_TIMEOUT", DefaultClientWriteTimeout),
-		SolveTimeout:   getEnvDuration("SOLVE_TIMEOUT", DefaultSolveTimeout),
+		ServerHost:            normalizeHost(src.getEnv("SERVER_HOST", DefaultClientHost)),
+		ServerPort:            src.getEnv("SERVER_PORT", DefaultClientPort),
+		ConnectTimeout:        src.getEnvDuration("CONNECT_TIMEOUT", DefaultConnectTimeout),
+		ReadTimeout:           src.getEnvDuration("READ_TIMEOUT", DefaultClientReadTimeout),
+		WriteTimeout:          src.getEnvDuration("WRITE_TIMEOUT", DefaultClientWriteTimeout),
+		SolveTimeout:          src.getEnvDuration("SOLVE_TIMEOUT", DefaultSolveTimeout),
+		SolveTimeoutBase:      src.getEnvDuration("SOLVE_TIMEOUT_BASE", 0),
+		SolveTimeoutFactor:    src.getEnvFloat("SOLVE_TIMEOUT_FACTOR", DefaultSolveTimeoutFactor),
+		TLSEnabled:            src.getEnvBool("TLS_ENABLED", false),
+		TLSInsecureSkipVerify: src.getEnvBool("TLS_INSECURE_SKIP_VERIFY", false),
+		QuoteCategory:         src.getEnv("QUOTE_CATEGORY", ""),
+		LegacyFraming:         src.getEnvBool("LEGACY_FRAMING", false),
+		QuoteCount:            src.getEnvInt("QUOTE_COUNT", DefaultQuoteCount),
+		MaxRetries:            src.getEnvInt("MAX_RETRIES", DefaultMaxRetries),
+		RetryBaseDelay:        src.getEnvDuration("RETRY_BASE_DELAY", DefaultRetryBaseDelay),
+		Network:               src.getEnv("SERVER_NETWORK", NetworkTCP),
+		SocketPath:            src.getEnv("SOCKET_PATH", ""),
+		SolverWorkers:         src.getEnvInt("SOLVER_WORKERS", runtime.NumCPU()),
+		MaxAcceptedDifficulty: src.getEnvInt("MAX_ACCEPTED_DIFFICULTY", DefaultMaxAcceptedBits),
+		HeartbeatInterval:     src.getEnvDuration("HEARTBEAT_INTERVAL", 0),
+		MaxSolveAttempts:      src.getEnvInt("MAX_SOLVE_ATTEMPTS", 0),
+		TrustedToken:          src.getEnv("TRUSTED_TOKEN", ""),
+		MaxMessageSize:        src.getEnvInt("MAX_MESSAGE_SIZE", 0),
+		MessageEncoding:       src.getEnv("MESSAGE_ENCODING", EncodingJSON),
 	}
 }
 
-// getEnv gets environment variable or returns default value
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
+// getEnv gets a setting or returns default value
+func (s settings) getEnv(key, defaultValue string) string {
+	if value := s.lookup(key); value != "" {
 		return value
 	}
 	return defaultValue
 }
 
-// getEnvInt gets environment variable as int or returns default value
-func getEnvInt(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
+// getEnvInt gets a setting as int or returns default value
+func (s settings) getEnvInt(key string, defaultValue int) int {
+	if value := s.lookup(key); value != "" {
 		if intValue, err := strconv.Atoi(value); err == nil {
 			return intValue
 		}
@@ -103,9 +337,20 @@ func getEnvInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
-// getEnvDuration gets environment variable as duration or returns default value
-func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
-	if value := os.Getenv(key); value != "" {
+// getEnvFloat gets a setting as float64 or returns default value
+func (s settings) getEnvFloat(key string, defaultValue float64) float64 {
+	if value := s.lookup(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+		fmt.Printf("Warning: invalid value for %s, using default: %g\n", key, defaultValue)
+	}
+	return defaultValue
+}
+
+// getEnvDuration gets a setting as duration or returns default value
+func (s settings) getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := s.lookup(key); value != "" {
 		if duration, err := time.ParseDuration(value); err == nil {
 			return duration
 		}
@@ -114,20 +359,115 @@ func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
 	return defaultValue
 }
 
+// getEnvBool gets a setting as bool or returns default value
+func (s settings) getEnvBool(key string, defaultValue bool) bool {
+	if value := s.lookup(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+		fmt.Printf("Warning: invalid boolean for %s, using default: %t\n", key, defaultValue)
+	}
+	return defaultValue
+}
+
+// getEnvList gets a setting as a comma-separated list, dropping empty items
+func (s settings) getEnvList(key string) []string {
+	var items []string
+	for _, item := range strings.Split(s.lookup(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 // Validate validates server configuration
 func (c ServerConfig) Validate() error {
 	if c.ChallengeTTL <= 0 {
 		return fmt.Errorf("CHALLENGE_TTL must be positive, got: %v", c.ChallengeTTL)
 	}
-	if c.Difficulty < MinDifficulty || c.Difficulty > MaxDifficulty {
-		return fmt.Errorf("POW_DIFFICULTY must be between %d and %d, got: %d", MinDifficulty, MaxDifficulty, c.Difficulty)
+	if c.TTLJitterPercent < 0 || c.TTLJitterPercent > MaxTTLJitterPercent {
+		return fmt.Errorf("TTL_JITTER_PERCENT must be between 0 and %d, got: %d", MaxTTLJitterPercent, c.TTLJitterPercent)
+	}
+	if c.CleanupInterval <= 0 {
+		return fmt.Errorf("CLEANUP_INTERVAL must be positive, got: %v", c.CleanupInterval)
+	}
+	if c.PowDisabled && c.Difficulty != 0 {
+		return fmt.Errorf("POW_DIFFICULTY must be 0 when POW_DISABLED is set, got: %d", c.Difficulty)
+	}
+	if !c.PowDisabled && c.Difficulty == 0 {
+		return fmt.Errorf("POW_DIFFICULTY 0 disables proof of work, set POW_DISABLED=true to run without it")
+	}
+	if c.MinEffectiveDifficulty < 0 || c.MinEffectiveDifficulty > c.Difficulty {
+		return fmt.Errorf("MIN_EFFECTIVE_DIFFICULTY must be between 0 and POW_DIFFICULTY (%d), got: %d", c.Difficulty, c.MinEffectiveDifficulty)
+	}
+	switch c.PowAlgorithm {
+	case PowAlgorithmSHA256:
+		if !c.PowDisabled && (c.Difficulty < MinDifficulty || c.Difficulty > MaxDifficulty) {
+			return fmt.Errorf("POW_DIFFICULTY must be between %d and %d, got: %d", MinDifficulty, MaxDifficulty, c.Difficulty)
+		}
+	case PowAlgorithmArgon2id:
+		if !c.PowDisabled && (c.Difficulty < MinDifficulty || c.Difficulty > MaxArgon2Difficulty) {
+			return fmt.Errorf("POW_DIFFICULTY must be between %d and %d bits for argon2id, got: %d", MinDifficulty, MaxArgon2Difficulty, c.Difficulty)
+		}
+		if c.Argon2Time < 1 {
+			return fmt.Errorf("ARGON2_TIME must be positive, got: %d", c.Argon2Time)
+		}
+		if c.Argon2Threads < 1 || c.Argon2Threads > MaxArgon2Threads {
+			return fmt.Errorf("ARGON2_THREADS must be between 1 and %d, got: %d", MaxArgon2Threads, c.Argon2Threads)
+		}
+		if c.Argon2Memory < MinArgon2MemoryPerLane*c.Argon2Threads {
+			return fmt.Errorf("ARGON2_MEMORY must be at least %d KiB for %d threads, got: %d", MinArgon2MemoryPerLane*c.Argon2Threads, c.Argon2Threads, c.Argon2Memory)
+		}
+	default:
+		return fmt.Errorf("POW_ALGORITHM must be %q or %q, got: %q", PowAlgorithmSHA256, PowAlgorithmArgon2id, c.PowAlgorithm)
+	}
+	if len(c.PowNamespace) > MaxPowNamespaceLength {
+		return fmt.Errorf("POW_NAMESPACE must be at most %d bytes, got: %d", MaxPowNamespaceLength, len(c.PowNamespace))
+	}
+	if c.PowTarget != "" {
+		if err := validatePowTarget(c); err != nil {
+			return err
+		}
+	}
+	if c.PowStateless {
+		if c.PowAlgorithm != PowAlgorithmSHA256 {
+			return fmt.Errorf("POW_STATELESS is only supported with POW_ALGORITHM=%q, got: %q", PowAlgorithmSHA256, c.PowAlgorithm)
+		}
+		if len(c.PowSecret) < MinPowSecretSize {
+			return fmt.Errorf("POW_SECRET must be at least %d bytes when POW_STATELESS is enabled, got: %d", MinPowSecretSize, len(c.PowSecret))
+		}
+		if c.PowSeenCacheSize < MinPowSeenCacheSize {
+			return fmt.Errorf("POW_SEEN_CACHE_SIZE must be at least %d, got: %d", MinPowSeenCacheSize, c.PowSeenCacheSize)
+		}
 	}
 	if c.MaxActiveChallenges < MinMaxActiveChallenges {
 		return fmt.Errorf("MAX_ACTIVE_CHALLENGES must be at least %d, got: %d", MinMaxActiveChallenges, c.MaxActiveChallenges)
 	}
+	if c.ChallengeRandBytes < MinChallengeRandBytes || c.ChallengeRandBytes > MaxChallengeRandBytes {
+		return fmt.Errorf("CHALLENGE_RANDOM_BYTES must be between %d and %d, got: %d", MinChallengeRandBytes, MaxChallengeRandBytes, c.ChallengeRandBytes)
+	}
 	if c.MaxConnections < MinMaxConnections {
 		return fmt.Errorf("MAX_CONNECTIONS must be positive, got: %d", c.MaxConnections)
 	}
+	if c.AcceptQueueSize < 0 {
+		return fmt.Errorf("ACCEPT_QUEUE_SIZE must not be negative, got: %d", c.AcceptQueueSize)
+	}
+	if c.AcceptQueueSize > 0 && c.AcceptQueueTimeout <= 0 {
+		return fmt.Errorf("ACCEPT_QUEUE_TIMEOUT must be positive when ACCEPT_QUEUE_SIZE is set, got: %v", c.AcceptQueueTimeout)
+	}
+	if c.AcceptWorkers < 1 {
+		return fmt.Errorf("ACCEPT_WORKERS must be at least 1, got: %d", c.AcceptWorkers)
+	}
+	if c.PortRetry < 0 {
+		return fmt.Errorf("PORT_RETRY must not be negative, got: %d", c.PortRetry)
+	}
+	if c.PortRetry > 0 && c.PortRetryDelay <= 0 {
+		return fmt.Errorf("PORT_RETRY_DELAY must be positive when PORT_RETRY is set, got: %v", c.PortRetryDelay)
+	}
+	if c.MaxConnectionsPerIP < 0 {
+		return fmt.Errorf("MAX_CONNECTIONS_PER_IP must not be negative, got: %d", c.MaxConnectionsPerIP)
+	}
 	if c.ReadTimeout <= 0 {
 		return fmt.Errorf("READ_TIMEOUT must be positive, got: %v", c.ReadTimeout)
 	}
@@ -137,5 +477,233 @@ func (c ServerConfig) Validate() error {
 	if c.ShutdownTimeout <= 0 {
 		return fmt.Errorf("SHUTDOWN_TIMEOUT must be positive, got: %v", c.ShutdownTimeout)
 	}
+	if c.RateLimitPerIP < 0 {
+		return fmt.Errorf("RATE_LIMIT_PER_IP must not be negative, got: %g", c.RateLimitPerIP)
+	}
+	if c.RateLimitPerIP > 0 && c.RateLimitBurst < MinRateLimitBurst {
+		return fmt.Errorf("RATE_LIMIT_BURST must be at least %d, got: %d", MinRateLimitBurst, c.RateLimitBurst)
+	}
+	if c.GlobalChallengeRate < 0 {
+		return fmt.Errorf("GLOBAL_CHALLENGE_RATE must not be negative, got: %g", c.GlobalChallengeRate)
+	}
+	if c.ConnectionDeadline < 0 {
+		return fmt.Errorf("CONNECTION_DEADLINE must not be negative, got: %v", c.ConnectionDeadline)
+	}
+	if c.MaxRequestsPerConn < MinRequestsPerConn {
+		return fmt.Errorf("MAX_REQUESTS_PER_CONNECTION must be at least %d, got: %d", MinRequestsPerConn, c.MaxRequestsPerConn)
+	}
+	if c.MaxQuotesPerRequest < MinQuotesPerRequest {
+		return fmt.Errorf("MAX_QUOTES_PER_REQUEST must be at least %d, got: %d", MinQuotesPerRequest, c.MaxQuotesPerRequest)
+	}
+	if c.MaxQuoteLength < 0 {
+		return fmt.Errorf("MAX_QUOTE_LENGTH must not be negative, got: %d", c.MaxQuoteLength)
+	}
+	if c.QuotesReloadInterval < 0 {
+		return fmt.Errorf("QUOTES_RELOAD_INTERVAL must not be negative, got: %v", c.QuotesReloadInterval)
+	}
+	if c.QuoteMode != QuoteModeRandom && c.QuoteMode != QuoteModeDaily {
+		return fmt.Errorf("QUOTE_MODE must be %q or %q, got: %q", QuoteModeRandom, QuoteModeDaily, c.QuoteMode)
+	}
+	if c.SubscribeMinInterval < MinSubscribeInterval {
+		return fmt.Errorf("SUBSCRIPTION_MIN_INTERVAL must be at least %v, got: %v", MinSubscribeInterval, c.SubscribeMinInterval)
+	}
+	if c.SubscribeMaxDuration < 0 {
+		return fmt.Errorf("SUBSCRIPTION_MAX_DURATION must not be negative, got: %v", c.SubscribeMaxDuration)
+	}
+	if c.HeartbeatInterval < 0 {
+		return fmt.Errorf("HEARTBEAT_INTERVAL must not be negative, got: %v", c.HeartbeatInterval)
+	}
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	switch c.Network {
+	case NetworkTCP:
+		if err := validateHost("SERVER_HOST", c.Host); err != nil {
+			return err
+		}
+		if err := validatePort("SERVER_PORT", c.Port, 0); err != nil {
+			return err
+		}
+	case NetworkUnix:
+		if c.SocketPath == "" {
+			return fmt.Errorf("SOCKET_PATH is required when SERVER_NETWORK=%q", NetworkUnix)
+		}
+	default:
+		return fmt.Errorf("SERVER_NETWORK must be %q or %q, got: %q", NetworkTCP, NetworkUnix, c.Network)
+	}
+	if c.HealthPort != "" {
+		if err := validatePort("HEALTH_PORT", c.HealthPort, 0); err != nil {
+			return err
+		}
+	}
+	if c.AdminPort != "" {
+		if err := validatePort("ADMIN_PORT", c.AdminPort, 0); err != nil {
+			return err
+		}
+		if len(c.AdminToken) < MinAdminTokenSize {
+			return fmt.Errorf("ADMIN_TOKEN must be at least %d bytes when ADMIN_PORT is set, got: %d", MinAdminTokenSize, len(c.AdminToken))
+		}
+	}
+	for i, token := range c.TrustedTokens {
+		if len(token) < MinTrustedTokenSize {
+			return fmt.Errorf("TRUSTED_TOKENS entries must be at least %d bytes, entry %d has: %d", MinTrustedTokenSize, i+1, len(token))
+		}
+	}
+	if err := validateMaxMessageSize(c.MaxMessageSize); err != nil {
+		return err
+	}
+	if err := validateMessageEncoding(c.MessageEncoding); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Validate validates client configuration
+func (c ClientConfig) Validate() error {
+	if c.ConnectTimeout <= 0 {
+		return fmt.Errorf("CONNECT_TIMEOUT must be positive, got: %v", c.ConnectTimeout)
+	}
+	if c.ReadTimeout <= 0 {
+		return fmt.Errorf("READ_TIMEOUT must be positive, got: %v", c.ReadTimeout)
+	}
+	if c.WriteTimeout <= 0 {
+		return fmt.Errorf("WRITE_TIMEOUT must be positive, got: %v", c.WriteTimeout)
+	}
+	if c.SolverWorkers < 1 {
+		return fmt.Errorf("SOLVER_WORKERS must be at least 1, got: %d", c.SolverWorkers)
+	}
+	if c.SolveTimeout <= 0 {
+		return fmt.Errorf("SOLVE_TIMEOUT must be positive, got: %v", c.SolveTimeout)
+	}
+	if c.SolveTimeoutBase < 0 {
+		return fmt.Errorf("SOLVE_TIMEOUT_BASE must not be negative, got: %v", c.SolveTimeoutBase)
+	}
+	if c.SolveTimeoutFactor < 1 {
+		return fmt.Errorf("SOLVE_TIMEOUT_FACTOR must be at least 1, got: %g", c.SolveTimeoutFactor)
+	}
+	if c.MaxAcceptedDifficulty < 0 {
+		return fmt.Errorf("MAX_ACCEPTED_DIFFICULTY must be non-negative, got: %d", c.MaxAcceptedDifficulty)
+	}
+	if c.HeartbeatInterval < 0 {
+		return fmt.Errorf("HEARTBEAT_INTERVAL must not be negative, got: %v", c.HeartbeatInterval)
+	}
+	if c.MaxSolveAttempts < 0 {
+		return fmt.Errorf("MAX_SOLVE_ATTEMPTS must be non-negative, got: %d", c.MaxSolveAttempts)
+	}
+	if err := validateMaxMessageSize(c.MaxMessageSize); err != nil {
+		return err
+	}
+	if err := validateMessageEncoding(c.MessageEncoding); err != nil {
+		return err
+	}
+	switch c.Network {
+	case NetworkTCP:
+		if err := validateHost("SERVER_HOST", c.ServerHost); err != nil {
+			return err
+		}
+		if err := validatePort("SERVER_PORT", c.ServerPort, 1); err != nil {
+			return err
+		}
+	case NetworkUnix:
+		if c.SocketPath == "" {
+			return fmt.Errorf("SOCKET_PATH is required when SERVER_NETWORK=%q", NetworkUnix)
+		}
+	default:
+		return fmt.Errorf("SERVER_NETWORK must be %q or %q, got: %q", NetworkTCP, NetworkUnix, c.Network)
+	}
+	return nil
+}
+
+// normalizeHost strips the brackets around an IPv6 literal such as [::1],
+// which net.JoinHostPort adds by itself when building the address
+func normalizeHost(host string) string {
+	host = strings.TrimSpace(host)
+	if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		return host[1 : len(host)-1]
+	}
+	return host
+}
+
+// validateHost checks that host, read from the variable name, is an IPv4 or IPv6
+// literal (optionally with a zone, as in fe80::1%eth0) or a hostname
+func validateHost(name, host string) error {
+	if host == "" {
+		return fmt.Errorf("%s must not be empty", name)
+	}
+
+	addr, _, _ := strings.Cut(host, "%")
+	if net.ParseIP(addr) != nil {
+		return nil
+	}
+	if strings.Contains(host, ":") {
+		if _, port, err := net.SplitHostPort(host); err == nil {
+			return fmt.Errorf("%s must not include a port, set SERVER_PORT=%s instead, got: %q", name, port, host)
+		}
+		return fmt.Errorf("%s is not a valid IPv6 address, got: %q", name, host)
+	}
+	if !isHostname(host) {
+		return fmt.Errorf("%s must be an IP address or hostname, got: %q", name, host)
+	}
+	return nil
+}
+
+// isHostname reports whether host is a syntactically valid DNS name. Underscores are
+// accepted since container runtimes use them in service names.
+func isHostname(host string) bool {
+	host = strings.TrimSuffix(host, ".")
+	if host == "" || len(host) > maxHostnameLength {
+		return false
+	}
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > maxHostnameLabelLength || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// validateMaxMessageSize checks that MAX_MESSAGE_SIZE is unset (0) or within bounds
+func validateMaxMessageSize(size int) error {
+	if size != 0 && (size < MinMaxMessageSize || size > MaxMaxMessageSize) {
+		return fmt.Errorf("MAX_MESSAGE_SIZE must be 0 or between %d and %d, got: %d", MinMaxMessageSize, MaxMaxMessageSize, size)
+	}
+	return nil
+}
+
+// validatePowTarget checks that POW_TARGET is a positive number of up to 64 hex
+// digits and that the chosen PoW service can check proofs against it
+func validatePowTarget(c ServerConfig) error {
+	target, ok := new(big.Int).SetString(c.PowTarget, 16)
+	if len(c.PowTarget) > MaxPowTargetDigits || !ok || target.Sign() <= 0 {
+		return fmt.Errorf("POW_TARGET must be a positive hex number of at most %d digits, got: %q", MaxPowTargetDigits, c.PowTarget)
+	}
+	if c.PowAlgorithm != PowAlgorithmSHA256 || c.PowStateless {
+		return fmt.Errorf("POW_TARGET is only supported with POW_ALGORITHM=%q and without POW_STATELESS", PowAlgorithmSHA256)
+	}
+	if c.PowDisabled {
+		return fmt.Errorf("POW_TARGET can't be set when POW_DISABLED is set")
+	}
+	return nil
+}
+
+// validateMessageEncoding checks that MESSAGE_ENCODING names a supported encoding
+func validateMessageEncoding(encoding string) error {
+	if encoding != EncodingJSON && encoding != EncodingMsgpack {
+		return fmt.Errorf("MESSAGE_ENCODING must be %q or %q, got: %q", EncodingJSON, EncodingMsgpack, encoding)
+	}
+	return nil
+}
+
+// validatePort checks that port, read from the variable name, is a number between lowest and MaxPort
+func validatePort(name, port string, lowest int) error {
+	n, err := strconv.Atoi(port)
+	if err != nil || n < lowest || n > MaxPort {
+		return fmt.Errorf("%s must be a port number between %d and %d, got: %q", name, lowest, MaxPort, port)
+	}
 	return nil
 }
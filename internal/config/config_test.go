@@ -0,0 +1,404 @@
+package config
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestValidate_Hosts(t *testing.T) {
+	tests := []struct {
+		name    string
+		host    string
+		port    string
+		wantErr string // Empty if the address is valid
+	}{
+		{"IPv4", "127.0.0.1", "8080", ""},
+		{"IPv6", "::1", "8080", ""},
+		{"IPv6Full", "2001:db8::8a2e:370:7334", "8080", ""},
+		{"IPv6Zone", "fe80::1%eth0", "8080", ""},
+		{"Hostname", "localhost", "8080", ""},
+		{"FQDN", "quotes.example.com.", "443", ""},
+		{"ServiceName", "pow_server", "8080", ""},
+		{"Empty", "", "8080", "must not be empty"},
+		{"HostWithPort", "localhost:8080", "8080", "must not include a port"},
+		{"IPv6WithPort", "[::1]:8080", "8080", "must not include a port"},
+		{"BadIPv6", "2001:db8::zz", "8080", "not a valid IPv6 address"},
+		{"BadHostname", "bad host", "8080", "must be an IP address or hostname"},
+		{"LeadingHyphen", "-example.com", "8080", "must be an IP address or hostname"},
+		{"EmptyLabel", "example..com", "8080", "must be an IP address or hostname"},
+		{"NamedPort", "localhost", "http", "must be a port number"},
+		{"PortTooHigh", "localhost", "65536", "must be a port number"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := LoadServerConfig()
+			server.Network, server.Host, server.Port = NetworkTCP, tt.host, tt.port
+			client := LoadClientConfig()
+			client.Network, client.ServerHost, client.ServerPort = NetworkTCP, tt.host, tt.port
+
+			for side, err := range map[string]error{"server": server.Validate(), "client": client.Validate()} {
+				switch {
+				case tt.wantErr == "" && err != nil:
+					t.Errorf("Expected valid %s address %q port %q, got: %v", side, tt.host, tt.port, err)
+				case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+					t.Errorf("Expected %s error containing %q, got: %v", side, tt.wantErr, err)
+				}
+			}
+
+			// Whatever passes validation must make an address the dialer can split back
+			if tt.wantErr == "" {
+				host, port, err := net.SplitHostPort(net.JoinHostPort(tt.host, tt.port))
+				if err != nil || host != tt.host || port != tt.port {
+					t.Errorf("Address for %q:%q does not round-trip: %q %q %v", tt.host, tt.port, host, port, err)
+				}
+			}
+		})
+	}
+}
+
+func TestValidate_PortZero(t *testing.T) {
+	// A server may listen on a random port, a client can't dial one
+	server := LoadServerConfig()
+	server.Network, server.Port = NetworkTCP, "0"
+	if err := server.Validate(); err != nil {
+		t.Errorf("Expected port 0 to be valid for the server, got: %v", err)
+	}
+
+	client := LoadClientConfig()
+	client.Network, client.ServerPort = NetworkTCP, "0"
+	if err := client.Validate(); err == nil {
+		t.Error("Expected port 0 to be rejected for the client")
+	}
+}
+
+func TestNormalizeHost(t *testing.T) {
+	tests := map[string]string{
+		"[::1]":       "::1",
+		" localhost ": "localhost",
+		"::1":         "::1",
+		"127.0.0.1":   "127.0.0.1",
+	}
+
+	for in, want := range tests {
+		if got := normalizeHost(in); got != want {
+			t.Errorf("normalizeHost(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	t.Setenv("SERVER_HOST", "[::1]")
+	if host := LoadClientConfig().ServerHost; host != "::1" {
+		t.Errorf("Expected bracketed SERVER_HOST to load as ::1, got %q", host)
+	}
+}
+
+func TestClientConfig_Validate(t *testing.T) {
+	valid := func() ClientConfig {
+		return ClientConfig{
+			ServerHost:            "localhost",
+			ServerPort:            "8080",
+			ConnectTimeout:        DefaultConnectTimeout,
+			ReadTimeout:           DefaultClientReadTimeout,
+			WriteTimeout:          DefaultClientWriteTimeout,
+			SolveTimeout:          DefaultSolveTimeout,
+			SolveTimeoutFactor:    DefaultSolveTimeoutFactor,
+			Network:               NetworkTCP,
+			MessageEncoding:       EncodingJSON,
+			SolverWorkers:         1,
+			MaxAcceptedDifficulty: DefaultMaxAcceptedBits,
+		}
+	}
+
+	if err := valid().Validate(); err != nil {
+		t.Fatalf("Expected valid config, got: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(c *ClientConfig)
+		wantErr string
+	}{
+		{"EmptyHost", func(c *ClientConfig) { c.ServerHost = "" }, "SERVER_HOST"},
+		{"EmptyPort", func(c *ClientConfig) { c.ServerPort = "" }, "SERVER_PORT"},
+		{"ZeroConnectTimeout", func(c *ClientConfig) { c.ConnectTimeout = 0 }, "CONNECT_TIMEOUT"},
+		{"NegativeReadTimeout", func(c *ClientConfig) { c.ReadTimeout = -1 }, "READ_TIMEOUT"},
+		{"ZeroWriteTimeout", func(c *ClientConfig) { c.WriteTimeout = 0 }, "WRITE_TIMEOUT"},
+		{"ZeroSolveTimeout", func(c *ClientConfig) { c.SolveTimeout = 0 }, "SOLVE_TIMEOUT"},
+		{"NoSolverWorkers", func(c *ClientConfig) { c.SolverWorkers = 0 }, "SOLVER_WORKERS"},
+		{"UnknownNetwork", func(c *ClientConfig) { c.Network = "udp" }, "SERVER_NETWORK"},
+		{"UnixWithoutSocket", func(c *ClientConfig) { c.Network = NetworkUnix }, "SOCKET_PATH"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := valid()
+			tt.modify(&c)
+			err := c.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error mentioning %s, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestServerConfig_ValidateAdmin(t *testing.T) {
+	tests := []struct {
+		name    string
+		port    string
+		token   string
+		wantErr string // Empty if the admin settings are valid
+	}{
+		{"Disabled", "", "", ""},
+		{"Enabled", "9090", "0123456789abcdef", ""},
+		{"ShortToken", "9090", "secret", "ADMIN_TOKEN must be at least"},
+		{"MissingToken", "9090", "", "ADMIN_TOKEN must be at least"},
+		{"BadPort", "admin", "0123456789abcdef", "ADMIN_PORT must be a port number"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := LoadServerConfig()
+			cfg.AdminPort, cfg.AdminToken = tt.port, tt.token
+
+			err := cfg.Validate()
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("Expected valid config, got: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("Expected error containing %q, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestServerConfig_TrustedTokens(t *testing.T) {
+	t.Setenv("TRUSTED_TOKENS", " 0123456789abcdef, ,fedcba9876543210 ")
+	cfg := LoadServerConfig()
+	if len(cfg.TrustedTokens) != 2 || cfg.TrustedTokens[0] != "0123456789abcdef" || cfg.TrustedTokens[1] != "fedcba9876543210" {
+		t.Fatalf("Expected two trimmed tokens, got %q", cfg.TrustedTokens)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected valid config, got: %v", err)
+	}
+
+	cfg.TrustedTokens = append(cfg.TrustedTokens, "short")
+	err := cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "TRUSTED_TOKENS entries must be at least 16 bytes, entry 3") {
+		t.Errorf("Expected error naming the short entry, got: %v", err)
+	}
+}
+
+func TestValidateMaxMessageSize(t *testing.T) {
+	for _, size := range []int{0, MinMaxMessageSize, 1 << 16, MaxMaxMessageSize} {
+		server, client := LoadServerConfig(), LoadClientConfig()
+		server.MaxMessageSize, client.MaxMessageSize = size, size
+		if err := server.Validate(); err != nil {
+			t.Errorf("Expected server MAX_MESSAGE_SIZE %d to be valid, got: %v", size, err)
+		}
+		if err := client.Validate(); err != nil {
+			t.Errorf("Expected client MAX_MESSAGE_SIZE %d to be valid, got: %v", size, err)
+		}
+	}
+
+	for _, size := range []int{-1, MinMaxMessageSize - 1, MaxMaxMessageSize + 1} {
+		server, client := LoadServerConfig(), LoadClientConfig()
+		server.MaxMessageSize, client.MaxMessageSize = size, size
+		if err := server.Validate(); err == nil || !strings.Contains(err.Error(), "MAX_MESSAGE_SIZE must be 0 or between") {
+			t.Errorf("Expected server MAX_MESSAGE_SIZE %d to be rejected, got: %v", size, err)
+		}
+		if err := client.Validate(); err == nil || !strings.Contains(err.Error(), "MAX_MESSAGE_SIZE must be 0 or between") {
+			t.Errorf("Expected client MAX_MESSAGE_SIZE %d to be rejected, got: %v", size, err)
+		}
+	}
+}
+
+func TestValidateMessageEncoding(t *testing.T) {
+	for _, encoding := range []string{EncodingJSON, EncodingMsgpack, "xml", ""} {
+		server, client := LoadServerConfig(), LoadClientConfig()
+		server.MessageEncoding, client.MessageEncoding = encoding, encoding
+		valid := encoding == EncodingJSON || encoding == EncodingMsgpack
+		for name, err := range map[string]error{"server": server.Validate(), "client": client.Validate()} {
+			if valid && err != nil {
+				t.Errorf("Expected %s MESSAGE_ENCODING %q to be valid, got: %v", name, encoding, err)
+			}
+			if !valid && (err == nil || !strings.Contains(err.Error(), "MESSAGE_ENCODING must be")) {
+				t.Errorf("Expected %s MESSAGE_ENCODING %q to be rejected, got: %v", name, encoding, err)
+			}
+		}
+	}
+}
+
+func TestValidateTTLJitterPercent(t *testing.T) {
+	for _, percent := range []int{0, 10, MaxTTLJitterPercent} {
+		cfg := LoadServerConfig()
+		cfg.TTLJitterPercent = percent
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("Expected TTL_JITTER_PERCENT %d to be valid, got: %v", percent, err)
+		}
+	}
+
+	for _, percent := range []int{-1, MaxTTLJitterPercent + 1} {
+		cfg := LoadServerConfig()
+		cfg.TTLJitterPercent = percent
+		if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "TTL_JITTER_PERCENT must be between") {
+			t.Errorf("Expected TTL_JITTER_PERCENT %d to be rejected, got: %v", percent, err)
+		}
+	}
+}
+
+func TestValidateAcceptWorkers(t *testing.T) {
+	cfg := LoadServerConfig()
+	if cfg.AcceptWorkers != DefaultAcceptWorkers {
+		t.Errorf("Expected default ACCEPT_WORKERS %d, got %d", DefaultAcceptWorkers, cfg.AcceptWorkers)
+	}
+
+	cfg.AcceptWorkers = 0
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "ACCEPT_WORKERS must be at least 1") {
+		t.Errorf("Expected ACCEPT_WORKERS 0 to be rejected, got: %v", err)
+	}
+}
+
+func TestValidatePowDisabled(t *testing.T) {
+	// Difficulty 0 without POW_DISABLED is most likely a mistake
+	cfg := LoadServerConfig()
+	cfg.Difficulty = 0
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "POW_DISABLED") {
+		t.Errorf("Expected POW_DIFFICULTY 0 to be rejected without POW_DISABLED, got: %v", err)
+	}
+
+	t.Setenv("POW_DISABLED", "true")
+	cfg = LoadServerConfig()
+	if !cfg.PowDisabled || cfg.Difficulty != 0 {
+		t.Fatalf("Expected POW_DISABLED to default the difficulty to 0, got disabled=%v difficulty=%d", cfg.PowDisabled, cfg.Difficulty)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected POW_DISABLED with difficulty 0 to be valid, got: %v", err)
+	}
+
+	cfg.Difficulty = 2
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "POW_DIFFICULTY must be 0 when POW_DISABLED is set") {
+		t.Errorf("Expected a nonzero difficulty to be rejected with POW_DISABLED, got: %v", err)
+	}
+}
+
+func TestValidatePowNamespace(t *testing.T) {
+	t.Setenv("POW_NAMESPACE", "tenant-a")
+	cfg := LoadServerConfig()
+	if cfg.PowNamespace != "tenant-a" {
+		t.Errorf("Expected PowNamespace tenant-a, got %q", cfg.PowNamespace)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected a short namespace to be valid, got: %v", err)
+	}
+
+	cfg.PowNamespace = strings.Repeat("a", MaxPowNamespaceLength+1)
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "POW_NAMESPACE must be at most") {
+		t.Errorf("Expected an overlong namespace to be rejected, got: %v", err)
+	}
+}
+
+func TestValidatePowTarget(t *testing.T) {
+	t.Setenv("POW_TARGET", "00000fff")
+	cfg := LoadServerConfig()
+	if cfg.PowTarget != "00000fff" {
+		t.Errorf("Expected PowTarget 00000fff, got %q", cfg.PowTarget)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected a hex target to be valid, got: %v", err)
+	}
+
+	for _, target := range []string{"0", "xyz", "-1", strings.Repeat("f", MaxPowTargetDigits+1)} {
+		cfg.PowTarget = target
+		if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "POW_TARGET must be") {
+			t.Errorf("Expected target %q to be rejected, got: %v", target, err)
+		}
+	}
+
+	cfg.PowTarget = "00000fff"
+	cfg.PowAlgorithm = PowAlgorithmArgon2id
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "POW_TARGET is only supported") {
+		t.Errorf("Expected a target with argon2id to be rejected, got: %v", err)
+	}
+}
+
+func TestValidateQuoteMode(t *testing.T) {
+	cfg := LoadServerConfig()
+	if cfg.QuoteMode != QuoteModeRandom {
+		t.Errorf("Expected QuoteMode %q by default, got %q", QuoteModeRandom, cfg.QuoteMode)
+	}
+
+	t.Setenv("QUOTE_MODE", QuoteModeDaily)
+	cfg = LoadServerConfig()
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected QUOTE_MODE=daily to be valid, got: %v", err)
+	}
+
+	cfg.QuoteMode = "hourly"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "QUOTE_MODE must be") {
+		t.Errorf("Expected an unknown QUOTE_MODE to be rejected, got: %v", err)
+	}
+}
+
+func TestValidateGlobalChallengeRate(t *testing.T) {
+	t.Setenv("GLOBAL_CHALLENGE_RATE", "2.5")
+	cfg := LoadServerConfig()
+	if cfg.GlobalChallengeRate != 2.5 {
+		t.Errorf("Expected GlobalChallengeRate 2.5, got %g", cfg.GlobalChallengeRate)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected a positive rate to be valid, got: %v", err)
+	}
+
+	cfg.GlobalChallengeRate = -1
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "GLOBAL_CHALLENGE_RATE must not be negative") {
+		t.Errorf("Expected a negative rate to be rejected, got: %v", err)
+	}
+}
+
+func TestValidatePortRetry(t *testing.T) {
+	cfg := LoadServerConfig()
+	cfg.PortRetry = 3
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected valid config, got: %v", err)
+	}
+
+	cfg.PortRetry = -1
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "PORT_RETRY must not be negative") {
+		t.Errorf("Expected PORT_RETRY error, got: %v", err)
+	}
+
+	cfg.PortRetry = 3
+	cfg.PortRetryDelay = 0
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "PORT_RETRY_DELAY must be positive") {
+		t.Errorf("Expected PORT_RETRY_DELAY error, got: %v", err)
+	}
+}
+
+func TestValidateMinEffectiveDifficulty(t *testing.T) {
+	cfg := LoadServerConfig()
+	if cfg.MinEffectiveDifficulty != MinDifficulty {
+		t.Errorf("Expected the floor to default to %d, got %d", MinDifficulty, cfg.MinEffectiveDifficulty)
+	}
+
+	cfg.MinEffectiveDifficulty = cfg.Difficulty
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected a floor at POW_DIFFICULTY to be valid, got: %v", err)
+	}
+	for _, floor := range []int{-1, cfg.Difficulty + 1} {
+		cfg.MinEffectiveDifficulty = floor
+		if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "MIN_EFFECTIVE_DIFFICULTY must be between") {
+			t.Errorf("Expected floor %d to be rejected, got: %v", floor, err)
+		}
+	}
+
+	// Without proof of work there is no floor by default
+	t.Setenv("POW_DISABLED", "true")
+	cfg = LoadServerConfig()
+	if cfg.MinEffectiveDifficulty != 0 {
+		t.Errorf("Expected no floor with POW_DISABLED, got %d", cfg.MinEffectiveDifficulty)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected valid config, got: %v", err)
+	}
+}
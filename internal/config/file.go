@@ -0,0 +1,148 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// settings looks up configuration values in environment variables and then in the
+// values of a config file, if any, so the environment overrides the file
+type settings struct {
+	file map[string]string // Config file values keyed by environment variable name
+	used map[string]bool   // Keys looked up so far, to spot unknown keys in the file
+}
+
+// lookup returns the value of the setting key, "" if it is set nowhere
+func (s settings) lookup(key string) string {
+	if s.used != nil {
+		s.used[key] = true
+	}
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return s.file[key]
+}
+
+// LoadServerConfigFromFile loads server configuration from a YAML (.yaml, .yml) or
+// JSON (.json) file whose keys are the environment variable names, such as
+// POW_DIFFICULTY. Environment variables override the file and settings in neither
+// keep their defaults. The merged configuration is validated.
+func LoadServerConfigFromFile(path string) (ServerConfig, error) {
+	src, err := readConfigFile(path)
+	if err != nil {
+		return ServerConfig{}, err
+	}
+	cfg := loadServerConfig(src)
+	if err := src.checkUnknown(path); err != nil {
+		return ServerConfig{}, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return ServerConfig{}, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return cfg, nil
+}
+
+// LoadClientConfigFromFile loads client configuration from a file like
+// LoadServerConfigFromFile, with environment variables overriding it
+func LoadClientConfigFromFile(path string) (ClientConfig, error) {
+	src, err := readConfigFile(path)
+	if err != nil {
+		return ClientConfig{}, err
+	}
+	cfg := loadClientConfig(src)
+	if err := src.checkUnknown(path); err != nil {
+		return ClientConfig{}, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return ClientConfig{}, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return cfg, nil
+}
+
+// readConfigFile parses the config file at path, picking the format from its extension
+func readConfigFile(path string) (settings, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return settings{}, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var raw map[string]interface{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber() // Keep numbers as written, so integers don't turn into floats
+		err = decoder.Decode(&raw)
+	default:
+		return settings{}, fmt.Errorf("config file %s must end in .yaml, .yml or .json, got: %q", path, ext)
+	}
+	if err != nil {
+		return settings{}, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	file := make(map[string]string, len(raw))
+	for key, value := range raw {
+		text, err := settingValue(value)
+		if err != nil {
+			return settings{}, fmt.Errorf("config file %s: %s %w", path, key, err)
+		}
+		file[key] = text
+	}
+	return settings{file: file, used: make(map[string]bool)}, nil
+}
+
+// settingValue renders a config file value the way it would be written in an
+// environment variable. Lists, such as TRUSTED_TOKENS, become comma-separated.
+func settingValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case json.Number:
+		return v.String(), nil
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			text, err := settingValue(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, text)
+		}
+		return strings.Join(items, ","), nil
+	default:
+		return "", fmt.Errorf("must be a string, number, boolean or list, got: %T", value)
+	}
+}
+
+// checkUnknown rejects keys in the config file at path that no setting looked up,
+// so a misspelt setting isn't silently ignored
+func (s settings) checkUnknown(path string) error {
+	var unknown []string
+	for key := range s.file {
+		if !s.used[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+	return fmt.Errorf("config file %s has unknown settings: %s", path, strings.Join(unknown, ", "))
+}
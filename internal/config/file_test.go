@@ -0,0 +1,114 @@
+package config
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeConfigFile writes content to a file called name in a temporary directory
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestLoadServerConfigFromFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{"YAML", "server.yaml", `
+SERVER_PORT: "9000"
+POW_DIFFICULTY: 3
+TRUSTED_TOKENS:
+  - 0123456789abcdef
+  - fedcba9876543210
+`},
+		{"JSON", "server.json", `{
+	"SERVER_PORT": 9000,
+	"POW_DIFFICULTY": 3,
+	"TRUSTED_TOKENS": ["0123456789abcdef", "fedcba9876543210"]
+}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := LoadServerConfigFromFile(writeConfigFile(t, tt.file, tt.content))
+			if err != nil {
+				t.Fatalf("LoadServerConfigFromFile failed: %v", err)
+			}
+			if cfg.Port != "9000" || cfg.Difficulty != 3 {
+				t.Errorf("Expected port 9000 and difficulty 3 from the file, got %s and %d", cfg.Port, cfg.Difficulty)
+			}
+			if len(cfg.TrustedTokens) != 2 || cfg.TrustedTokens[1] != "fedcba9876543210" {
+				t.Errorf("Expected two trusted tokens from the file, got %q", cfg.TrustedTokens)
+			}
+			if cfg.MaxConnections != DefaultMaxConnections {
+				t.Errorf("Expected the default max connections, got %d", cfg.MaxConnections)
+			}
+		})
+	}
+}
+
+func TestLoadServerConfigFromFile_EnvOverrides(t *testing.T) {
+	path := writeConfigFile(t, "server.yml", "POW_DIFFICULTY: 3\nSERVER_PORT: \"9000\"\n")
+	t.Setenv("POW_DIFFICULTY", "4")
+
+	cfg, err := LoadServerConfigFromFile(path)
+	if err != nil {
+		t.Fatalf("LoadServerConfigFromFile failed: %v", err)
+	}
+	if cfg.Difficulty != 4 {
+		t.Errorf("Expected POW_DIFFICULTY from the environment, got %d", cfg.Difficulty)
+	}
+	if cfg.Port != "9000" {
+		t.Errorf("Expected SERVER_PORT from the file, got %s", cfg.Port)
+	}
+}
+
+func TestLoadClientConfigFromFile(t *testing.T) {
+	path := writeConfigFile(t, "client.yaml", "SERVER_HOST: example.com\nSERVER_PORT: \"9000\"\n")
+	t.Setenv("SERVER_PORT", "9001")
+
+	cfg, err := LoadClientConfigFromFile(path)
+	if err != nil {
+		t.Fatalf("LoadClientConfigFromFile failed: %v", err)
+	}
+	if cfg.ServerHost != "example.com" || cfg.ServerPort != "9001" {
+		t.Errorf("Expected host from the file and port from the environment, got %s:%s", cfg.ServerHost, cfg.ServerPort)
+	}
+}
+
+func TestLoadServerConfigFromFile_Errors(t *testing.T) {
+	if _, err := LoadServerConfigFromFile(filepath.Join(t.TempDir(), "missing.yaml")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected a not-exist error for a missing file, got: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    string
+	}{
+		{"invalid YAML", "server.yaml", "POW_DIFFICULTY: [3\n", "failed to parse config file"},
+		{"invalid JSON", "server.json", `{"POW_DIFFICULTY": 3`, "failed to parse config file"},
+		{"unknown extension", "server.toml", "POW_DIFFICULTY = 3\n", "must end in .yaml, .yml or .json"},
+		{"nested value", "server.yaml", "POW_DIFFICULTY:\n  bits: 3\n", "POW_DIFFICULTY must be a string, number, boolean or list"},
+		{"unknown setting", "server.yaml", "POW_DIFFICULTY: 3\nPOW_DIFICULTY: 4\n", "unknown settings: POW_DIFICULTY"},
+		{"invalid value", "server.yaml", "POW_DIFFICULTY: 99\n", "POW_DIFFICULTY must be between"},
+	}
+	for _, tt := range tests {
+		_, err := LoadServerConfigFromFile(writeConfigFile(t, tt.file, tt.content))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected error containing %q, got: %v", tt.name, tt.want, err)
+		}
+	}
+}
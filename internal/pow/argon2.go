@@ -0,0 +1,246 @@
+package pow
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultArgon2Time is the default number of Argon2id passes over memory
+	DefaultArgon2Time = 1
+	// DefaultArgon2Memory is the default Argon2id memory cost in KiB (8 MiB)
+	DefaultArgon2Memory = 8 * 1024
+	// DefaultArgon2Threads is the default Argon2id degree of parallelism
+	DefaultArgon2Threads = 1
+	// Argon2KeyLen is the size of the Argon2id output in bytes
+	Argon2KeyLen = 32
+)
+
+// Argon2Params holds the Argon2id cost parameters.
+// Server and client must use identical parameters for proofs to verify.
+type Argon2Params struct {
+	Time    uint32 // Number of passes over memory
+	Memory  uint32 // Memory cost in KiB
+	Threads uint8  // Degree of parallelism
+}
+
+// DefaultArgon2Params returns the default Argon2id cost parameters
+func DefaultArgon2Params() Argon2Params {
+	return Argon2Params{
+		Time:    DefaultArgon2Time,
+		Memory:  DefaultArgon2Memory,
+		Threads: DefaultArgon2Threads,
+	}
+}
+
+// Argon2HashcashService implements memory-hard PoW using Argon2id.
+// Unlike SHA256 Hashcash, difficulty is the number of leading zero BITS
+// in the Argon2id output, since each attempt is far more expensive.
+type Argon2HashcashService struct {
+	difficulty int32 // Accessed atomically, may change at runtime
+	params     Argon2Params
+	store      *challengeStore
+	maxNonce   uint64 // Largest nonce tried when solving, 0 means math.MaxUint64. Overridable for tests.
+	maxTries   uint64 // Cap on nonces tried per solve, 0 means unlimited
+}
+
+// NewArgon2HashcashService creates a new Argon2id PoW service
+func NewArgon2HashcashService(difficulty int, challengeTTL time.Duration, params Argon2Params) *Argon2HashcashService {
+	return NewArgon2HashcashServiceWithLimit(difficulty, challengeTTL, DefaultMaxActiveChallenges, params)
+}
+
+// NewArgon2HashcashServiceWithLimit creates a new Argon2id PoW service with custom max challenges limit
+func NewArgon2HashcashServiceWithLimit(difficulty int, challengeTTL time.Duration, maxActiveChallenges int, params Argon2Params) *Argon2HashcashService {
+	return NewArgon2HashcashServiceWithRandomBytes(difficulty, challengeTTL, maxActiveChallenges, ChallengeRandomBytesSize, params)
+}
+
+// NewArgon2HashcashServiceWithRandomBytes creates a new Argon2id PoW service with custom max challenges
+// limit and challenge random part size. A non-positive size uses ChallengeRandomBytesSize.
+func NewArgon2HashcashServiceWithRandomBytes(difficulty int, challengeTTL time.Duration, maxActiveChallenges int, randomBytes int, params Argon2Params) *Argon2HashcashService {
+	s := &Argon2HashcashService{
+		params: params,
+		store:  newChallengeStore(challengeTTL, maxActiveChallenges, randomBytes),
+	}
+	s.SetDifficulty(difficulty)
+
+	return s
+}
+
+// NewArgon2HashcashServiceWithStore creates a new Argon2id PoW service keeping issued
+// challenges in store, e.g. a RedisStore shared by several server instances
+func NewArgon2HashcashServiceWithStore(difficulty int, challengeTTL time.Duration, maxActiveChallenges int, randomBytes int, params Argon2Params, store ChallengeStore) *Argon2HashcashService {
+	s := &Argon2HashcashService{
+		params: params,
+		store:  newChallengeStoreWithBackend(challengeTTL, maxActiveChallenges, randomBytes, store),
+	}
+	s.SetDifficulty(difficulty)
+
+	return s
+}
+
+// SetMaxSolveAttempts caps the nonces tried per solve, so solving gives up with
+// ErrSolveAttemptsExceeded after a bounded amount of work whatever the wall clock.
+// A non-positive value removes the cap. It must be called before the service is used.
+func (s *Argon2HashcashService) SetMaxSolveAttempts(attempts int) {
+	s.maxTries = uint64(max(attempts, 0))
+}
+
+// SetTTLJitter makes each challenge's TTL deviate randomly by up to percent of the
+// configured TTL, so challenges issued in a burst don't all expire at once. Zero
+// disables jitter. It must be called before the service is used.
+func (s *Argon2HashcashService) SetTTLJitter(percent int) {
+	s.store.setTTLJitter(percent)
+}
+
+// SetAllowZeroDifficulty lets the service issue challenges below difficulty 1, which
+// any nonce solves, for deployments that disable proof of work on purpose. Without it
+// such challenges fail with ErrZeroDifficulty. It must be called before the service is used.
+func (s *Argon2HashcashService) SetAllowZeroDifficulty(allow bool) {
+	s.store.setAllowZeroDifficulty(allow)
+}
+
+// SetNamespace makes the service hash namespace before every challenge it issues and
+// verify only challenges it issued under the same namespace, so one process can serve
+// several tenants whose proofs don't carry over. It must be called before the service is used.
+func (s *Argon2HashcashService) SetNamespace(namespace string) {
+	s.store.setNamespace(namespace)
+}
+
+// Namespace returns the namespace set with SetNamespace, empty by default
+func (s *Argon2HashcashService) Namespace() string {
+	return s.store.getNamespace()
+}
+
+// GenerateChallenge generates a new unique challenge
+func (s *Argon2HashcashService) GenerateChallenge() (string, error) {
+	return s.GenerateChallengeWithDifficulty(s.GetDifficulty())
+}
+
+// GenerateChallengeWithDifficulty generates a new unique challenge to be solved
+// at difficulty rather than the service's current one
+func (s *Argon2HashcashService) GenerateChallengeWithDifficulty(difficulty int) (string, error) {
+	return s.store.generate(difficulty)
+}
+
+// VerifyProof verifies that the nonce solves the challenge
+func (s *Argon2HashcashService) VerifyProof(challenge, nonce string) (bool, error) {
+	return s.VerifyProofCtx(context.Background(), challenge, nonce)
+}
+
+// VerifyProofCtx verifies that the nonce solves the challenge, skipping the
+// expensive hash if ctx is already done. The challenge is consumed either way.
+func (s *Argon2HashcashService) VerifyProofCtx(ctx context.Context, challenge, nonce string) (bool, error) {
+	return s.VerifyBoundProof(ctx, challenge, "", nonce)
+}
+
+// VerifyBoundProof verifies that the nonce solves the challenge bound to binding
+func (s *Argon2HashcashService) VerifyBoundProof(ctx context.Context, challenge, binding, nonce string) (bool, error) {
+	// Remove challenge to prevent replay attacks, even if the proof turns out invalid
+	entry, err := s.store.consume(challenge)
+	if err != nil {
+		return false, err
+	}
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	return Verify(ChallengeData(entry.Namespace, challenge, binding), nonce, entry.Difficulty, s.Hasher()), nil
+}
+
+// InvalidateChallenge removes a challenge from the active set
+func (s *Argon2HashcashService) InvalidateChallenge(challenge string) {
+	s.store.invalidate(challenge)
+}
+
+// Stats returns a snapshot of the service state
+func (s *Argon2HashcashService) Stats() (ServiceStats, error) {
+	return s.store.stats()
+}
+
+// Close stops the goroutine dropping expired challenges, for services that are
+// discarded before the process exits. The service keeps working, but expired
+// challenges pile up. A store passed to the constructor is not closed.
+func (s *Argon2HashcashService) Close() error {
+	return s.store.close()
+}
+
+// SolveChallenge finds a nonce that solves the challenge
+func (s *Argon2HashcashService) SolveChallenge(ctx context.Context, challenge string, difficulty int) (string, error) {
+	nonce, _, err := s.SolveChallengeWithStats(ctx, challenge, difficulty)
+	return nonce, err
+}
+
+// SolveChallengeWithStats finds a nonce that solves the challenge and reports
+// how many nonces were tried, including the winning one
+func (s *Argon2HashcashService) SolveChallengeWithStats(ctx context.Context, challenge string, difficulty int) (string, int, error) {
+	last, exhausted := solveLimit(s.maxNonce, s.maxTries)
+	return solveWithin(ctx, challenge, difficulty, s.Hasher(), last, exhausted)
+}
+
+// SolveChallengeParallel finds a nonce that solves the challenge using multiple workers.
+// A non-positive worker count uses one worker per CPU. Note that each worker
+// allocates the full Argon2id memory cost.
+func (s *Argon2HashcashService) SolveChallengeParallel(ctx context.Context, challenge string, difficulty int, workers int) (string, error) {
+	nonce, _, err := s.SolveChallengeParallelWithStats(ctx, challenge, difficulty, workers)
+	return nonce, err
+}
+
+// SolveChallengeParallelWithStats is SolveChallengeParallel also reporting how many
+// nonces all workers tried, including the winning one
+func (s *Argon2HashcashService) SolveChallengeParallelWithStats(ctx context.Context, challenge string, difficulty int, workers int) (string, int, error) {
+	last, exhausted := solveLimit(s.maxNonce, s.maxTries)
+	return solveParallel(ctx, workers, last, exhausted, func() func(nonce string) bool {
+		return func(nonce string) bool {
+			return hasLeadingZeroBits(s.hash(challenge, nonce), difficulty)
+		}
+	})
+}
+
+// GetDifficulty returns the current difficulty level (in bits)
+func (s *Argon2HashcashService) GetDifficulty() int {
+	return int(atomic.LoadInt32(&s.difficulty))
+}
+
+// SetDifficulty changes the difficulty for newly generated challenges.
+// Challenges already issued keep the difficulty they were issued with.
+func (s *Argon2HashcashService) SetDifficulty(difficulty int) {
+	atomic.StoreInt32(&s.difficulty, int32(difficulty))
+}
+
+// GetParams returns the Argon2id cost parameters
+func (s *Argon2HashcashService) GetParams() Argon2Params {
+	return s.params
+}
+
+// Hasher returns the Hasher verifying proofs with this service's cost parameters
+func (s *Argon2HashcashService) Hasher() Argon2idHasher {
+	return Argon2idHasher{Params: s.params}
+}
+
+// hash computes Argon2id over challenge+nonce
+func (s *Argon2HashcashService) hash(challenge, nonce string) []byte {
+	return s.Hasher().Hash(challenge, nonce)
+}
+
+// hasLeadingZeroBits checks if hash has required number of leading zero bits
+func hasLeadingZeroBits(hash []byte, bits int) bool {
+	if bits > len(hash)*8 {
+		return false
+	}
+
+	fullBytes := bits / 8
+	for i := 0; i < fullBytes; i++ {
+		if hash[i] != 0x00 {
+			return false
+		}
+	}
+
+	remainingBits := bits % 8
+	if remainingBits == 0 {
+		return true
+	}
+
+	mask := byte(0xFF << (8 - remainingBits))
+	return hash[fullBytes]&mask == 0
+}
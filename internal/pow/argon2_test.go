@@ -0,0 +1,149 @@
+package pow
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// testArgon2Params uses minimal cost so tests run quickly
+var testArgon2Params = Argon2Params{Time: 1, Memory: 64, Threads: 1}
+
+func TestArgon2HashcashService_VerifyProof(t *testing.T) {
+	difficulty := 4
+	service := NewArgon2HashcashService(difficulty, 5*time.Minute, testArgon2Params)
+	defer service.Close()
+
+	challenge, err := service.GenerateChallenge()
+	if err != nil {
+		t.Fatalf("GenerateChallenge failed: %v", err)
+	}
+
+	// Solve the challenge
+	ctx := context.Background()
+	nonce, err := service.SolveChallenge(ctx, challenge, difficulty)
+	if err != nil {
+		t.Fatalf("SolveChallenge failed: %v", err)
+	}
+
+	// Verify the proof
+	valid, err := service.VerifyProof(challenge, nonce)
+	if err != nil {
+		t.Fatalf("VerifyProof failed: %v", err)
+	}
+
+	if !valid {
+		t.Error("Proof should be valid")
+	}
+
+	// Replay must be rejected
+	valid, err = service.VerifyProof(challenge, nonce)
+	if err == nil {
+		t.Error("VerifyProof should return an error for reused challenge")
+	}
+
+	if valid {
+		t.Error("Proof should be invalid for reused challenge")
+	}
+}
+
+func TestArgon2HashcashService_VerifyProof_ParamsMismatch(t *testing.T) {
+	difficulty := 8
+	server := NewArgon2HashcashService(difficulty, 5*time.Minute, testArgon2Params)
+	defer server.Close()
+	solver := NewArgon2HashcashService(0, 0, Argon2Params{Time: 2, Memory: 64, Threads: 1})
+
+	// Fixed challenge keeps the outcome deterministic
+	challenge := "1700000000:0123456789abcdef0123456789abcdef"
+	server.store.backend.Put(challenge, ChallengeMeta{IssuedAt: time.Now(), Difficulty: difficulty}, time.Minute)
+
+	nonce, err := solver.SolveChallenge(context.Background(), challenge, difficulty)
+	if err != nil {
+		t.Fatalf("SolveChallenge failed: %v", err)
+	}
+
+	// A nonce found with different cost parameters is almost certainly invalid
+	valid, err := server.VerifyProof(challenge, nonce)
+	if err != nil {
+		t.Fatalf("VerifyProof failed: %v", err)
+	}
+
+	if valid {
+		t.Error("Proof solved with different parameters should be invalid")
+	}
+}
+
+func TestHasLeadingZeroBits(t *testing.T) {
+	tests := []struct {
+		name string
+		hash []byte
+		bits int
+		want bool
+	}{
+		{name: "Zero bits", hash: []byte{0xFF}, bits: 0, want: true},
+		{name: "4 leading zero bits", hash: []byte{0x0F, 0xFF}, bits: 4, want: true},
+		{name: "4 bits but only 3 zero", hash: []byte{0x1F, 0xFF}, bits: 4, want: false},
+		{name: "12 leading zero bits", hash: []byte{0x00, 0x0F}, bits: 12, want: true},
+		{name: "12 bits but only 11 zero", hash: []byte{0x00, 0x1F}, bits: 12, want: false},
+		{name: "Full bytes", hash: []byte{0x00, 0x00, 0x01}, bits: 16, want: true},
+		{name: "Bits exceed hash length", hash: []byte{0x00}, bits: 9, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := hasLeadingZeroBits(tt.hash, tt.bits)
+			if got != tt.want {
+				t.Errorf("hasLeadingZeroBits() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// BenchmarkSolveChallenge_Argon2_8Bits is directly comparable to
+// BenchmarkSolveChallenge_Difficulty1 (1 zero byte == 8 zero bits)
+func BenchmarkSolveChallenge_Argon2_8Bits(b *testing.B) {
+	service := NewArgon2HashcashService(8, 5*time.Minute, DefaultArgon2Params())
+	defer service.Close()
+	challenge := "benchmark_challenge"
+	ctx := context.Background()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := service.SolveChallenge(ctx, challenge, 8)
+		if err != nil {
+			b.Fatalf("SolveChallenge failed: %v", err)
+		}
+	}
+}
+
+func TestArgon2HashcashService_MaxSolveAttempts(t *testing.T) {
+	service := NewArgon2HashcashService(0, 0, testArgon2Params)
+	service.SetMaxSolveAttempts(20)
+
+	// 256 leading zero bits is unreachable, so only the cap ends the search
+	_, attempts, err := service.SolveChallengeWithStats(context.Background(), "1700000000:feedface", 256)
+	if !errors.Is(err, ErrSolveAttemptsExceeded) {
+		t.Fatalf("Expected ErrSolveAttemptsExceeded, got: %v", err)
+	}
+	if attempts != 20 {
+		t.Errorf("Expected exactly 20 attempts, got %d", attempts)
+	}
+	if _, err := service.SolveChallengeParallel(context.Background(), "1700000000:feedface", 256, 4); !errors.Is(err, ErrSolveAttemptsExceeded) {
+		t.Errorf("Expected ErrSolveAttemptsExceeded from parallel solve, got: %v", err)
+	}
+}
+
+func TestArgon2HashcashService_ZeroDifficulty(t *testing.T) {
+	service := NewArgon2HashcashService(0, 5*time.Minute, testArgon2Params)
+	defer service.Close()
+
+	if _, err := service.GenerateChallenge(); !errors.Is(err, ErrZeroDifficulty) {
+		t.Errorf("Expected ErrZeroDifficulty, got: %v", err)
+	}
+
+	service.SetAllowZeroDifficulty(true)
+	if _, err := service.GenerateChallenge(); err != nil {
+		t.Errorf("GenerateChallenge failed with zero difficulty allowed: %v", err)
+	}
+}
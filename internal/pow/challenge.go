@@ -0,0 +1,40 @@
+package pow
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrMalformedChallenge is returned by ParseChallenge for a challenge that is not
+// in the timestamp:randomhex format
+var ErrMalformedChallenge = errors.New("malformed challenge")
+
+// ParseChallenge splits a challenge in the timestamp:randomhex format issued by
+// GenerateChallenge into the time it was issued and its decoded random part
+func ParseChallenge(challenge string) (issuedAt time.Time, random []byte, err error) {
+	timestamp, randomHex, ok := strings.Cut(challenge, ":")
+	if !ok {
+		return time.Time{}, nil, fmt.Errorf("%w: no ':' between timestamp and random part", ErrMalformedChallenge)
+	}
+	return parseChallengeParts(timestamp, randomHex)
+}
+
+// parseChallengeParts decodes the timestamp and hex random part of a challenge
+func parseChallengeParts(timestamp, randomHex string) (time.Time, []byte, error) {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return time.Time{}, nil, fmt.Errorf("%w: timestamp %q is not a Unix time in seconds", ErrMalformedChallenge, timestamp)
+	}
+	if randomHex == "" {
+		return time.Time{}, nil, fmt.Errorf("%w: empty random part", ErrMalformedChallenge)
+	}
+	random, err := hex.DecodeString(randomHex)
+	if err != nil {
+		return time.Time{}, nil, fmt.Errorf("%w: random part is not hex: %v", ErrMalformedChallenge, err)
+	}
+	return time.Unix(seconds, 0), random, nil
+}
@@ -0,0 +1,67 @@
+package pow
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseChallenge(t *testing.T) {
+	issuedAt, random, err := ParseChallenge("1700000000:00ff10")
+	if err != nil {
+		t.Fatalf("ParseChallenge failed: %v", err)
+	}
+	if !issuedAt.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("Expected issue time 1700000000, got %d", issuedAt.Unix())
+	}
+	if !bytes.Equal(random, []byte{0x00, 0xff, 0x10}) {
+		t.Errorf("Expected random bytes 00ff10, got %x", random)
+	}
+
+	// Generated challenges round-trip
+	service := NewSHA256HashcashService(1, 5*time.Minute)
+	defer service.Close()
+	service.SetClock(func() time.Time { return time.Unix(1234567890, 0) })
+	challenge, err := service.GenerateChallenge()
+	if err != nil {
+		t.Fatalf("GenerateChallenge failed: %v", err)
+	}
+	issuedAt, random, err = ParseChallenge(challenge)
+	if err != nil {
+		t.Fatalf("ParseChallenge(%q) failed: %v", challenge, err)
+	}
+	if issuedAt.Unix() != 1234567890 || len(random) != ChallengeRandomBytesSize {
+		t.Errorf("Expected issue time 1234567890 and %d random bytes, got %d and %d", ChallengeRandomBytesSize, issuedAt.Unix(), len(random))
+	}
+}
+
+func TestParseChallenge_Malformed(t *testing.T) {
+	tests := []struct {
+		name      string
+		challenge string
+		wantErr   string
+	}{
+		{"Empty", "", "no ':'"},
+		{"NoColon", "1700000000deadbeef", "no ':'"},
+		{"BadHex", "1700000000:nothex", "random part is not hex"},
+		{"OddHex", "1700000000:abc", "random part is not hex"},
+		{"EmptyRandom", "1700000000:", "empty random part"},
+		{"ExtraColon", "1700000000:dead:beef", "random part is not hex"},
+		{"NonNumericTimestamp", "yesterday:deadbeef", `timestamp "yesterday" is not a Unix time`},
+		{"EmptyTimestamp", ":deadbeef", `timestamp "" is not a Unix time`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := ParseChallenge(tt.challenge)
+			if !errors.Is(err, ErrMalformedChallenge) {
+				t.Fatalf("Expected ErrMalformedChallenge, got: %v", err)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
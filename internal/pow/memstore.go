@@ -0,0 +1,159 @@
+package pow
+
+import (
+	"sync"
+	"time"
+)
+
+// ChallengeMeta records when a challenge was issued and at what difficulty,
+// so proofs stay verifiable if the service difficulty changes in between
+type ChallengeMeta struct {
+	IssuedAt   time.Time
+	Difficulty int
+	ExpiresAt  time.Time // When proofs stop being accepted, zero means IssuedAt plus the service TTL
+	Namespace  string    // Namespace of the issuing service, which alone may verify it
+}
+
+// ChallengeStore keeps issued challenges until they are verified or expire.
+// Backing it with shared storage lets any server instance verify a proof for a
+// challenge issued by another one while still rejecting replays.
+// Implementations must be safe for concurrent use.
+type ChallengeStore interface {
+	// Put stores a newly issued challenge for at least ttl
+	Put(challenge string, meta ChallengeMeta, ttl time.Duration) error
+	// GetAndDelete atomically removes a challenge, reporting whether it was present
+	GetAndDelete(challenge string) (ChallengeMeta, bool, error)
+	// Count returns the number of stored challenges, expired ones may be included
+	Count() (int, error)
+}
+
+// ChallengeInserter is implemented by ChallengeStores that can store a challenge only
+// if it is not already present. Challenges are then never overwritten on a collision,
+// which backends without it can't rule out.
+type ChallengeInserter interface {
+	// PutIfAbsent stores a challenge for at least ttl unless it is already stored,
+	// reporting whether it stored it
+	PutIfAbsent(challenge string, meta ChallengeMeta, ttl time.Duration) (bool, error)
+}
+
+// InMemoryStore is the default ChallengeStore, keeping challenges in process memory
+type InMemoryStore struct {
+	challenges map[string]memStoreEntry // map[challenge]entry
+	now        func() time.Time         // Overridable for tests
+	mu         sync.Mutex               // Protects challenges
+	done       chan struct{}            // Closed by Close to stop the cleanup goroutine
+	stopped    chan struct{}            // Closed once the cleanup goroutine has exited, nil if none runs
+	closeOnce  sync.Once
+}
+
+// memStoreEntry is a stored challenge with the time it may be forgotten
+type memStoreEntry struct {
+	meta      ChallengeMeta
+	expiresAt time.Time
+}
+
+// newTickerFunc starts a ticker firing every interval and returns its channel
+// and a function stopping it
+type newTickerFunc func(interval time.Duration) (<-chan time.Time, func())
+
+// NewInMemoryStore creates an in-memory challenge store that drops expired
+// challenges every cleanupInterval. A non-positive interval disables cleanup.
+// Close stops the cleanup goroutine.
+func NewInMemoryStore(cleanupInterval time.Duration) *InMemoryStore {
+	return newInMemoryStore(cleanupInterval, time.Now, func(interval time.Duration) (<-chan time.Time, func()) {
+		ticker := time.NewTicker(interval)
+		return ticker.C, ticker.Stop
+	})
+}
+
+// newInMemoryStore creates an in-memory challenge store cleaning up on ticks
+// from newTicker and judging expiry by now
+func newInMemoryStore(cleanupInterval time.Duration, now func() time.Time, newTicker newTickerFunc) *InMemoryStore {
+	s := &InMemoryStore{
+		challenges: make(map[string]memStoreEntry),
+		now:        now,
+		done:       make(chan struct{}),
+	}
+
+	if cleanupInterval > 0 {
+		s.stopped = make(chan struct{})
+		ticks, stop := newTicker(cleanupInterval)
+		go s.cleanupExpired(ticks, stop)
+	}
+
+	return s
+}
+
+// Put stores a challenge until ttl has passed
+func (s *InMemoryStore) Put(challenge string, meta ChallengeMeta, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.challenges[challenge] = memStoreEntry{meta: meta, expiresAt: s.now().Add(ttl)}
+	return nil
+}
+
+// PutIfAbsent stores a challenge until ttl has passed unless an unexpired one is stored already
+func (s *InMemoryStore) PutIfAbsent(challenge string, meta ChallengeMeta, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if entry, exists := s.challenges[challenge]; exists && !now.After(entry.expiresAt) {
+		return false, nil
+	}
+	s.challenges[challenge] = memStoreEntry{meta: meta, expiresAt: now.Add(ttl)}
+	return true, nil
+}
+
+// GetAndDelete removes a challenge, reporting whether it was present
+func (s *InMemoryStore) GetAndDelete(challenge string) (ChallengeMeta, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, exists := s.challenges[challenge]
+	if !exists {
+		return ChallengeMeta{}, false, nil
+	}
+	delete(s.challenges, challenge)
+	return entry.meta, true, nil
+}
+
+// Count returns the number of stored challenges, including expired ones not yet cleaned up
+func (s *InMemoryStore) Count() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.challenges), nil
+}
+
+// Close stops the cleanup goroutine and waits for it to exit. Stored challenges
+// stay usable, but expired ones are no longer dropped. Close is safe to call
+// more than once.
+func (s *InMemoryStore) Close() error {
+	s.closeOnce.Do(func() { close(s.done) })
+	if s.stopped != nil {
+		<-s.stopped
+	}
+	return nil
+}
+
+// cleanupExpired removes expired challenges on every tick until Close is called
+func (s *InMemoryStore) cleanupExpired(ticks <-chan time.Time, stop func()) {
+	defer close(s.stopped)
+	defer stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticks:
+		}
+
+		s.mu.Lock()
+		now := s.now()
+		for challenge, entry := range s.challenges {
+			if now.After(entry.expiresAt) {
+				delete(s.challenges, challenge)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
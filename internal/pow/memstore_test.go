@@ -0,0 +1,195 @@
+package pow
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	_ ChallengeStore    = (*InMemoryStore)(nil)
+	_ ChallengeInserter = (*InMemoryStore)(nil)
+)
+
+func TestInMemoryStore_PutGetAndDelete(t *testing.T) {
+	store := NewInMemoryStore(0)
+	meta := ChallengeMeta{IssuedAt: time.Unix(1700000000, 0), Difficulty: 3}
+
+	if err := store.Put("challenge", meta, time.Minute); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if count, _ := store.Count(); count != 1 {
+		t.Errorf("Expected 1 stored challenge, got %d", count)
+	}
+
+	got, found, err := store.GetAndDelete("challenge")
+	if err != nil || !found {
+		t.Fatalf("Expected stored challenge, got found=%v err=%v", found, err)
+	}
+	if !got.IssuedAt.Equal(meta.IssuedAt) || got.Difficulty != meta.Difficulty {
+		t.Errorf("Expected %+v, got %+v", meta, got)
+	}
+
+	// A challenge can only be taken once
+	if _, found, _ := store.GetAndDelete("challenge"); found {
+		t.Error("Expected challenge to be gone after GetAndDelete")
+	}
+	if count, _ := store.Count(); count != 0 {
+		t.Errorf("Expected empty store, got %d", count)
+	}
+}
+
+func TestInMemoryStore_PutIfAbsent(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	store := newInMemoryStore(0, func() time.Time { return now }, nil)
+
+	if stored, _ := store.PutIfAbsent("challenge", ChallengeMeta{Difficulty: 1}, time.Minute); !stored {
+		t.Fatal("Expected the first PutIfAbsent to store")
+	}
+	if stored, _ := store.PutIfAbsent("challenge", ChallengeMeta{Difficulty: 2}, time.Minute); stored {
+		t.Error("Expected PutIfAbsent to refuse an active challenge")
+	}
+
+	// An expired challenge awaiting cleanup may be replaced
+	now = now.Add(2 * time.Minute)
+	if stored, _ := store.PutIfAbsent("challenge", ChallengeMeta{Difficulty: 3}, time.Minute); !stored {
+		t.Error("Expected PutIfAbsent to replace an expired challenge")
+	}
+	if got, _, _ := store.GetAndDelete("challenge"); got.Difficulty != 3 {
+		t.Errorf("Expected the replacement to be stored, got difficulty %d", got.Difficulty)
+	}
+	if count, _ := store.Count(); count != 0 {
+		t.Errorf("Expected empty store, got %d", count)
+	}
+}
+
+func TestInMemoryStore_CleanupExpired(t *testing.T) {
+	store := NewInMemoryStore(10 * time.Millisecond)
+
+	store.Put("short", ChallengeMeta{IssuedAt: time.Now()}, time.Millisecond)
+	store.Put("long", ChallengeMeta{IssuedAt: time.Now()}, time.Hour)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if count, _ := store.Count(); count == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the expired challenge to be cleaned up")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, found, _ := store.GetAndDelete("long"); !found {
+		t.Error("Expected unexpired challenge to be kept")
+	}
+}
+
+func TestInMemoryStore_CleanupCadence(t *testing.T) {
+	var mu sync.Mutex
+	now := time.Unix(1700000000, 0)
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+
+	var gotInterval time.Duration
+	ticks := make(chan time.Time)
+	store := newInMemoryStore(7*time.Second, clock, func(interval time.Duration) (<-chan time.Time, func()) {
+		gotInterval = interval
+		return ticks, func() {}
+	})
+	if gotInterval != 7*time.Second {
+		t.Errorf("Expected cleanup every 7s, ticker set to %v", gotInterval)
+	}
+
+	store.Put("short", ChallengeMeta{IssuedAt: now}, 5*time.Second)
+	store.Put("long", ChallengeMeta{IssuedAt: now}, time.Minute)
+
+	// Nothing has expired by the first tick
+	mu.Lock()
+	now = now.Add(7 * time.Second / 2)
+	mu.Unlock()
+	ticks <- now
+	ticks <- now // Unbuffered: the first tick has been fully processed once this one is taken
+	if count, _ := store.Count(); count != 2 {
+		t.Errorf("Expected both challenges before expiry, got %d", count)
+	}
+
+	// The next tick drops only the expired challenge
+	mu.Lock()
+	now = now.Add(7 * time.Second)
+	mu.Unlock()
+	ticks <- now
+	ticks <- now
+	if count, _ := store.Count(); count != 1 {
+		t.Errorf("Expected 1 challenge after cleanup, got %d", count)
+	}
+	if _, found, _ := store.GetAndDelete("long"); !found {
+		t.Error("Expected unexpired challenge to be kept")
+	}
+}
+
+func TestInMemoryStore_Close(t *testing.T) {
+	ticks := make(chan time.Time)
+	stopped := make(chan struct{})
+	store := newInMemoryStore(time.Second, time.Now, func(time.Duration) (<-chan time.Time, func()) {
+		return ticks, func() { close(stopped) }
+	})
+
+	ticks <- time.Now() // The cleanup goroutine is running
+
+	closed := make(chan error, 1)
+	go func() { closed <- store.Close() }()
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not return")
+	}
+
+	// Close returns only after the goroutine stopped its ticker and exited
+	select {
+	case <-stopped:
+	default:
+		t.Error("Expected the ticker to be stopped")
+	}
+	select {
+	case ticks <- time.Now():
+		t.Error("Expected no cleanup after Close")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// The store stays usable and Close can be repeated
+	if err := store.Put("c", ChallengeMeta{}, time.Minute); err != nil {
+		t.Errorf("Put after Close failed: %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Errorf("Second Close failed: %v", err)
+	}
+
+	// Without cleanup there is nothing to wait for
+	if err := NewInMemoryStore(0).Close(); err != nil {
+		t.Errorf("Close without cleanup failed: %v", err)
+	}
+}
+
+func TestDefaultCleanupInterval(t *testing.T) {
+	tests := []struct {
+		ttl  time.Duration
+		want time.Duration
+	}{
+		{10 * time.Second, 5 * time.Second},
+		{time.Minute, 30 * time.Second},
+		{time.Hour, MaxDefaultCleanupInterval},
+	}
+
+	for _, tt := range tests {
+		if got := DefaultCleanupInterval(tt.ttl); got != tt.want {
+			t.Errorf("DefaultCleanupInterval(%v) = %v, want %v", tt.ttl, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package pow
+
+import (
+	"crypto/sha256"
+	"encoding"
+	"hash"
+	"strconv"
+)
+
+// prefixHasher computes SHA256(challenge + nonce) for many nonces without redoing
+// the work shared by all of them: the full 64-byte blocks of challenge are hashed
+// once and their midstate restored for each nonce, and the remaining bytes are
+// kept in a reused buffer so hashing a nonce allocates nothing.
+// It is not safe for concurrent use; give each goroutine its own.
+type prefixHasher struct {
+	midstate []byte    // Marshaled digest state after the full blocks, nil if challenge has none
+	digest   hash.Hash // Restored from midstate for each nonce
+	buf      []byte    // Bytes of challenge after the full blocks, followed by the current nonce
+	tail     int       // Length of the challenge part of buf
+	sum      [sha256.Size]byte
+}
+
+// newPrefixHasher prepares to hash nonces appended to challenge
+func newPrefixHasher(challenge string) *prefixHasher {
+	full := len(challenge) / sha256.BlockSize * sha256.BlockSize
+	h := &prefixHasher{
+		buf:  append(make([]byte, 0, len(challenge)-full+20), challenge[full:]...), // 20 digits fit any uint64
+		tail: len(challenge) - full,
+	}
+
+	if full > 0 {
+		h.digest = sha256.New()
+		h.digest.Write([]byte(challenge[:full]))
+		// crypto/sha256 digests have always supported marshaling their state
+		h.midstate, _ = h.digest.(encoding.BinaryMarshaler).MarshalBinary()
+	}
+
+	return h
+}
+
+// hashNonce returns SHA256(challenge + decimal nonce). The result is only valid
+// until the next call.
+func (h *prefixHasher) hashNonce(nonce uint64) []byte {
+	h.buf = strconv.AppendUint(h.buf[:h.tail], nonce, 10)
+	return h.hashTail()
+}
+
+// hashString returns SHA256(challenge + nonce). The result is only valid until the next call.
+func (h *prefixHasher) hashString(nonce string) []byte {
+	h.buf = append(h.buf[:h.tail], nonce...)
+	return h.hashTail()
+}
+
+// hashTail finishes the hash over buf, starting from the midstate if there is one
+func (h *prefixHasher) hashTail() []byte {
+	if h.midstate == nil {
+		h.sum = sha256.Sum256(h.buf)
+		return h.sum[:]
+	}
+
+	h.digest.(encoding.BinaryUnmarshaler).UnmarshalBinary(h.midstate)
+	h.digest.Write(h.buf)
+	return h.digest.Sum(h.sum[:0])
+}
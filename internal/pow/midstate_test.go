@@ -0,0 +1,102 @@
+package pow
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// naiveSolve is the reference solver: hash challenge + nonce from scratch for every nonce
+func naiveSolve(challenge string, difficulty int) (string, int) {
+	for nonce := uint64(0); ; nonce++ {
+		nonceStr := strconv.FormatUint(nonce, 10)
+		hash := sha256.Sum256([]byte(challenge + nonceStr))
+		if hasLeadingZeroBits(hash[:], difficulty*8) {
+			return nonceStr, int(nonce) + 1
+		}
+	}
+}
+
+func TestPrefixHasher_MatchesNaive(t *testing.T) {
+	// Lengths around the 64-byte block size exercise every midstate split
+	challenges := []string{
+		"",
+		"1700000000:feedface",
+		"1700000000:" + strings.Repeat("ab", 16),
+		strings.Repeat("x", 63),
+		strings.Repeat("x", 64),
+		strings.Repeat("x", 65),
+		"1700000000:" + strings.Repeat("cd", 32) + "2001:db8::8a2e:370:7334",
+	}
+
+	for _, challenge := range challenges {
+		hasher := newPrefixHasher(challenge)
+		for _, nonce := range []uint64{0, 1, 9, 10, 99, 12345, 1 << 40, ^uint64(0)} {
+			nonceStr := strconv.FormatUint(nonce, 10)
+			want := sha256.Sum256([]byte(challenge + nonceStr))
+
+			if got := hasher.hashNonce(nonce); !bytes.Equal(got, want[:]) {
+				t.Errorf("hashNonce(%q, %d) = %x, want %x", challenge, nonce, got, want)
+			}
+			if got := hasher.hashString(nonceStr); !bytes.Equal(got, want[:]) {
+				t.Errorf("hashString(%q, %q) = %x, want %x", challenge, nonceStr, got, want)
+			}
+		}
+
+		// Consecutive nonces of varying length share the buffer
+		for nonce := uint64(0); nonce < 2000; nonce++ {
+			want := sha256.Sum256([]byte(challenge + strconv.FormatUint(nonce, 10)))
+			if got := hasher.hashNonce(nonce); !bytes.Equal(got, want[:]) {
+				t.Fatalf("hashNonce(%q, %d) = %x, want %x", challenge, nonce, got, want)
+			}
+		}
+	}
+}
+
+func TestSolveChallengeWithStats_MatchesNaive(t *testing.T) {
+	service := NewSHA256HashcashService(0, 0)
+
+	for i := 0; i < 50; i++ {
+		challenge := "1700000000:" + strconv.Itoa(i) + strings.Repeat("f", i*3)
+		wantNonce, wantAttempts := naiveSolve(challenge, 1)
+
+		nonce, attempts, err := service.SolveChallengeWithStats(context.Background(), challenge, 1)
+		if err != nil {
+			t.Fatalf("SolveChallengeWithStats failed: %v", err)
+		}
+		if nonce != wantNonce || attempts != wantAttempts {
+			t.Errorf("Challenge %q: got nonce %s after %d attempts, want %s after %d", challenge, nonce, attempts, wantNonce, wantAttempts)
+		}
+	}
+}
+
+// BenchmarkHashNonce compares hashing from scratch with the prefix hasher
+// for a default challenge and a long bound one
+func BenchmarkHashNonce(b *testing.B) {
+	challenges := map[string]string{
+		"Default": "1700000000:" + strings.Repeat("ab", ChallengeRandomBytesSize),
+		"Long":    "1700000000:" + strings.Repeat("ab", 128) + "2001:db8::8a2e:370:7334",
+	}
+
+	for name, challenge := range challenges {
+		b.Run(name+"/Naive", func(b *testing.B) {
+			var sink byte
+			for i := 0; i < b.N; i++ {
+				hash := sha256.Sum256([]byte(challenge + strconv.FormatUint(uint64(i), 10)))
+				sink ^= hash[0]
+			}
+			_ = sink
+		})
+		b.Run(name+"/Prefix", func(b *testing.B) {
+			hasher := newPrefixHasher(challenge)
+			var sink byte
+			for i := 0; i < b.N; i++ {
+				sink ^= hasher.hashNonce(uint64(i))[0]
+			}
+			_ = sink
+		})
+	}
+}
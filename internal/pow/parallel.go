@@ -0,0 +1,93 @@
+package pow
+
+import (
+	"context"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// ParallelSolverService is implemented by solvers that can split the
+// nonce search across multiple goroutines
+type ParallelSolverService interface {
+	SolverService
+	SolveChallengeParallel(ctx context.Context, challenge string, difficulty int, workers int) (string, error)
+}
+
+// ParallelStatsSolverService is implemented by parallel solvers that can also report
+// how many nonces all their workers tried together
+type ParallelStatsSolverService interface {
+	ParallelSolverService
+	SolveChallengeParallelWithStats(ctx context.Context, challenge string, difficulty int, workers int) (nonce string, attempts int, err error)
+}
+
+// solveParallel splits the nonce space across workers: worker i tries nonces
+// i, i+W, i+2W, ... The first solution found cancels the remaining workers.
+// Each worker checks nonces with its own function from newSolves, which may
+// therefore keep unsynchronized state. A non-positive worker count uses runtime.NumCPU().
+// Workers stop at last, returning exhausted if none found a solution. Progress is
+// reported if ctx carries it, see WithProgress. Attempts is the number of nonces all
+// workers tried, including the winning one.
+func solveParallel(ctx context.Context, workers int, last uint64, exhausted error, newSolves func() func(nonce string) bool) (string, int, error) {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	searchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	report := progressFrom(ctx).parallel()
+	found := make(chan string, 1)
+	var wg sync.WaitGroup
+	var attempts atomic.Uint64 // Added to once per worker, so workers don't contend on it
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(start uint64) {
+			defer wg.Done()
+			if start > last {
+				return // More workers than nonces
+			}
+			solves := report.wrap(int(start), newSolves())
+			var tried uint64
+			defer func() { attempts.Add(tried) }()
+
+			for nonce := start; ; nonce += uint64(workers) {
+				select {
+				case <-searchCtx.Done():
+					return
+				default:
+					nonceStr := strconv.FormatUint(nonce, 10)
+					tried++
+					if solves(nonceStr) {
+						select {
+						case found <- nonceStr:
+							cancel()
+						default:
+							// Another worker already won
+						}
+						return
+					}
+					// Stepping past last would wrap around to nonces already tried
+					if last-nonce < uint64(workers) {
+						return
+					}
+				}
+			}
+		}(uint64(i))
+	}
+
+	wg.Wait()
+
+	tried := int(attempts.Load())
+	select {
+	case nonce := <-found:
+		return nonce, tried, nil
+	default:
+		if err := ctx.Err(); err != nil {
+			return "", tried, err
+		}
+		return "", tried, exhausted
+	}
+}
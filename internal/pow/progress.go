@@ -0,0 +1,101 @@
+package pow
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultProgressInterval is the number of nonces tried between progress reports
+// when no other interval is set
+const DefaultProgressInterval = 1 << 20
+
+// progressBatch is the most nonces a parallel worker tries before adding them to the
+// shared count, so workers rarely contend on it
+const progressBatch = 1 << 10
+
+// ProgressFunc receives the number of nonces a solve has tried so far and how long
+// it has been running, e.g. to drive a progress bar. It runs on a solving
+// goroutine, so it should return quickly. Calls for one solve never overlap.
+type ProgressFunc func(attempts uint64, elapsed time.Duration)
+
+// progressKey is the context key WithProgress stores a progress under
+type progressKey struct{}
+
+// WithProgress returns a copy of ctx that makes solves run with it call fn every
+// interval nonces tried, values < 1 meaning DefaultProgressInterval. Sequential
+// solves report exact multiples of interval. Parallel solves add up the nonces
+// their workers tried and report the total about every interval nonces. A nil fn
+// returns ctx unchanged.
+func WithProgress(ctx context.Context, fn ProgressFunc, interval int) context.Context {
+	if fn == nil {
+		return ctx
+	}
+	if interval < 1 {
+		interval = DefaultProgressInterval
+	}
+	return context.WithValue(ctx, progressKey{}, progress{fn: fn, interval: uint64(interval)})
+}
+
+// progress reports a solve's progress to fn every interval nonces
+type progress struct {
+	fn       ProgressFunc // nil disables reporting
+	interval uint64
+}
+
+// progressFrom returns the progress set on ctx by WithProgress, disabled if none is
+func progressFrom(ctx context.Context) progress {
+	p, _ := ctx.Value(progressKey{}).(progress)
+	return p
+}
+
+// wrap returns solves reporting progress before every interval-th nonce it checks.
+// Without a ProgressFunc solves is returned as is, keeping the search loop untouched.
+func (p progress) wrap(solves func(nonce uint64) bool) func(nonce uint64) bool {
+	if p.fn == nil {
+		return solves
+	}
+	start := time.Now()
+	return func(nonce uint64) bool {
+		// Nonces 0 through nonce-1 have been tried
+		if nonce > 0 && nonce%p.interval == 0 {
+			p.fn(nonce, time.Since(start))
+		}
+		return solves(nonce)
+	}
+}
+
+// parallelProgress adds up the nonces tried by the workers of a parallel solve.
+// Only the first worker reports, so fn never runs concurrently.
+type parallelProgress struct {
+	progress
+	start time.Time
+	tried atomic.Uint64
+	next  uint64 // Total at which the first worker reports next, only it touches this
+}
+
+// parallel returns the shared count for the workers of one parallel solve
+func (p progress) parallel() *parallelProgress {
+	return &parallelProgress{progress: p, start: time.Now(), next: p.interval}
+}
+
+// wrap returns solves of the given worker counting the nonces it checks into the
+// shared total. Without a ProgressFunc solves is returned as is.
+func (p *parallelProgress) wrap(worker int, solves func(nonce string) bool) func(nonce string) bool {
+	if p.fn == nil {
+		return solves
+	}
+	batch := min(p.interval, progressBatch)
+	var pending uint64
+	return func(nonce string) bool {
+		if pending++; pending == batch {
+			total := p.tried.Add(pending)
+			pending = 0
+			if worker == 0 && total >= p.next {
+				p.fn(total, time.Since(p.start))
+				p.next = (total/p.interval + 1) * p.interval
+			}
+		}
+		return solves(nonce)
+	}
+}
@@ -0,0 +1,131 @@
+package pow
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// progressRecorder collects the reports of a solve
+type progressRecorder struct {
+	attempts []uint64
+	elapsed  []time.Duration
+}
+
+func (r *progressRecorder) report(attempts uint64, elapsed time.Duration) {
+	r.attempts = append(r.attempts, attempts)
+	r.elapsed = append(r.elapsed, elapsed)
+}
+
+// check asserts that a solve taking attempts nonces was reported every interval nonces
+func (r *progressRecorder) check(t *testing.T, attempts int, interval uint64) {
+	t.Helper()
+
+	if uint64(attempts) <= interval {
+		t.Fatalf("Solve took %d attempts, too few to report progress every %d", attempts, interval)
+	}
+	if want := (uint64(attempts) - 1) / interval; uint64(len(r.attempts)) != want {
+		t.Fatalf("Expected %d progress reports for %d attempts, got %d", want, attempts, len(r.attempts))
+	}
+	for i, got := range r.attempts {
+		if want := uint64(i+1) * interval; got != want {
+			t.Errorf("Report %d: expected %d attempts, got %d", i, want, got)
+		}
+		if i > 0 && r.elapsed[i] < r.elapsed[i-1] {
+			t.Errorf("Report %d: elapsed went backwards from %v to %v", i, r.elapsed[i-1], r.elapsed[i])
+		}
+	}
+}
+
+func TestWithProgress(t *testing.T) {
+	// Argon2id is slow enough per nonce that a handful of bits takes a while
+	t.Run("Argon2id", func(t *testing.T) {
+		var recorder progressRecorder
+		service := NewArgon2HashcashService(0, 0, testArgon2Params)
+		defer service.Close()
+		ctx := WithProgress(context.Background(), recorder.report, 4)
+
+		_, attempts, err := service.SolveChallengeWithStats(ctx, "1700000000:progress", 6)
+		if err != nil {
+			t.Fatalf("SolveChallengeWithStats failed: %v", err)
+		}
+		recorder.check(t, attempts, 4)
+	})
+
+	t.Run("SHA256", func(t *testing.T) {
+		var recorder progressRecorder
+		service := NewSHA256HashcashService(0, 0)
+		defer service.Close()
+		ctx := WithProgress(context.Background(), recorder.report, 1000)
+
+		_, attempts, err := service.SolveChallengeWithStats(ctx, "1700000000:progress", 2)
+		if err != nil {
+			t.Fatalf("SolveChallengeWithStats failed: %v", err)
+		}
+		recorder.check(t, attempts, 1000)
+	})
+
+	t.Run("Target", func(t *testing.T) {
+		var recorder progressRecorder
+		service := NewSHA256HashcashService(0, 0)
+		defer service.Close()
+		ctx := WithProgress(context.Background(), recorder.report, 1000)
+
+		target, _ := new(big.Int).SetString("0000"+strings.Repeat("f", 60), 16)
+		_, attempts, err := service.SolveTargetWithStats(ctx, "1700000000:progress", target)
+		if err != nil {
+			t.Fatalf("SolveTargetWithStats failed: %v", err)
+		}
+		recorder.check(t, attempts, 1000)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		service := NewSHA256HashcashService(0, 0)
+		defer service.Close()
+		ctx := context.Background()
+		if WithProgress(ctx, nil, 1) != ctx {
+			t.Error("Expected WithProgress without a function to return ctx unchanged")
+		}
+
+		if _, _, err := service.SolveChallengeWithStats(ctx, "1700000000:progress", 1); err != nil {
+			t.Fatalf("SolveChallengeWithStats failed: %v", err)
+		}
+	})
+
+	// Parallel workers add up their nonces, the first of them reporting the total
+	t.Run("Parallel", func(t *testing.T) {
+		var mu sync.Mutex
+		var reports []uint64
+		service := NewSHA256HashcashService(0, 0)
+		defer service.Close()
+		service.SetMaxSolveAttempts(1 << 16)
+		ctx := WithProgress(context.Background(), func(attempts uint64, _ time.Duration) {
+			mu.Lock()
+			defer mu.Unlock()
+			reports = append(reports, attempts)
+		}, 1000)
+
+		// No hash has 32 leading zero bytes, so all the allowed nonces are tried
+		if _, err := service.SolveChallengeParallel(ctx, "1700000000:progress", 32, 4); !errors.Is(err, ErrSolveAttemptsExceeded) {
+			t.Fatalf("Expected ErrSolveAttemptsExceeded, got: %v", err)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if len(reports) == 0 {
+			t.Fatal("Expected progress reports from a parallel solve")
+		}
+		for i, got := range reports {
+			if got > 1<<16 {
+				t.Errorf("Report %d: %d attempts is more than were allowed", i, got)
+			}
+			if i > 0 && got <= reports[i-1] {
+				t.Errorf("Report %d: attempts went from %d to %d", i, reports[i-1], got)
+			}
+		}
+	})
+}
@@ -0,0 +1,160 @@
+package pow
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultRedisKeyPrefix namespaces challenge keys in a shared Redis database
+	DefaultRedisKeyPrefix = "pow:challenge:"
+	// redisTimeout bounds each Redis round trip so a slow Redis can't stall a handshake
+	redisTimeout = time.Second
+)
+
+// RedisClient is the subset of Redis commands RedisStore needs. It keeps this
+// package free of a Redis dependency: adapt the client library of your choice.
+type RedisClient interface {
+	// SetEx stores value under key, expiring after ttl (SET key value PX ttl)
+	SetEx(ctx context.Context, key, value string, ttl time.Duration) error
+	// GetDel atomically reads and deletes key (GETDEL, Redis 6.2+), found is false if it is missing
+	GetDel(ctx context.Context, key string) (value string, found bool, err error)
+	// CountPrefix counts keys starting with prefix, e.g. with SCAN MATCH prefix*
+	CountPrefix(ctx context.Context, prefix string) (int, error)
+}
+
+// RedisSetNXClient is implemented by RedisClients that can store a key only if it is
+// missing. RedisStore then never overwrites an active challenge on a collision.
+type RedisSetNXClient interface {
+	// SetNX stores value under key unless it exists, expiring after ttl (SET key value NX PX ttl)
+	SetNX(ctx context.Context, key, value string, ttl time.Duration) (stored bool, err error)
+}
+
+// RedisStore is a ChallengeStore shared by every server instance using the same Redis.
+// Redis expires keys by itself, so no cleanup runs in the process. Count scans keys,
+// so disable the active challenge limit (MAX_ACTIVE_CHALLENGES=0) for large deployments.
+type RedisStore struct {
+	client RedisClient
+	prefix string
+}
+
+// NewRedisStore creates a challenge store on client, namespacing keys with prefix.
+// An empty prefix uses DefaultRedisKeyPrefix.
+func NewRedisStore(client RedisClient, prefix string) *RedisStore {
+	if prefix == "" {
+		prefix = DefaultRedisKeyPrefix
+	}
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+// Put stores a challenge, letting Redis expire it after ttl
+func (s *RedisStore) Put(challenge string, meta ChallengeMeta, ttl time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	if err := s.client.SetEx(ctx, s.prefix+challenge, formatRedisMeta(meta), ttl); err != nil {
+		return fmt.Errorf("redis set failed: %w", err)
+	}
+	return nil
+}
+
+// PutIfAbsent stores a challenge unless it is already stored, letting Redis expire it
+// after ttl. Clients without SetNX fall back to Put, which overwrites.
+func (s *RedisStore) PutIfAbsent(challenge string, meta ChallengeMeta, ttl time.Duration) (bool, error) {
+	client, ok := s.client.(RedisSetNXClient)
+	if !ok {
+		return true, s.Put(challenge, meta, ttl)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	stored, err := client.SetNX(ctx, s.prefix+challenge, formatRedisMeta(meta), ttl)
+	if err != nil {
+		return false, fmt.Errorf("redis setnx failed: %w", err)
+	}
+	return stored, nil
+}
+
+// GetAndDelete removes a challenge, reporting whether it was present
+func (s *RedisStore) GetAndDelete(challenge string) (ChallengeMeta, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	value, found, err := s.client.GetDel(ctx, s.prefix+challenge)
+	if err != nil {
+		return ChallengeMeta{}, false, fmt.Errorf("redis getdel failed: %w", err)
+	}
+	if !found {
+		return ChallengeMeta{}, false, nil
+	}
+
+	meta, err := parseRedisMeta(value)
+	if err != nil {
+		return ChallengeMeta{}, false, err
+	}
+	return meta, true, nil
+}
+
+// Count returns the number of challenges stored under the prefix
+func (s *RedisStore) Count() (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	count, err := s.client.CountPrefix(ctx, s.prefix)
+	if err != nil {
+		return 0, fmt.Errorf("redis count failed: %w", err)
+	}
+	return count, nil
+}
+
+// formatRedisMeta encodes meta for parseRedisMeta
+func formatRedisMeta(meta ChallengeMeta) string {
+	value := fmt.Sprintf("%d:%d", meta.IssuedAt.UnixNano(), meta.Difficulty)
+	if !meta.ExpiresAt.IsZero() || meta.Namespace != "" {
+		var expiresAt int64 // Zero marks no expiry
+		if !meta.ExpiresAt.IsZero() {
+			expiresAt = meta.ExpiresAt.UnixNano()
+		}
+		value += fmt.Sprintf(":%d", expiresAt)
+	}
+	if meta.Namespace != "" {
+		value += ":" + meta.Namespace // Last, since it may contain colons
+	}
+	return value
+}
+
+// parseRedisMeta decodes a value written by Put: issued-at nanoseconds, difficulty
+// and, unless written by an older instance, expiry nanoseconds and the namespace if any
+func parseRedisMeta(value string) (ChallengeMeta, error) {
+	issuedAt, difficulty, ok := strings.Cut(value, ":")
+	if !ok {
+		return ChallengeMeta{}, fmt.Errorf("malformed challenge metadata: %q", value)
+	}
+	difficulty, expiresAt, hasExpiry := strings.Cut(difficulty, ":")
+	expiresAt, namespace, _ := strings.Cut(expiresAt, ":")
+
+	nanos, err := strconv.ParseInt(issuedAt, 10, 64)
+	if err != nil {
+		return ChallengeMeta{}, fmt.Errorf("malformed challenge timestamp: %w", err)
+	}
+	bits, err := strconv.Atoi(difficulty)
+	if err != nil {
+		return ChallengeMeta{}, fmt.Errorf("malformed challenge difficulty: %w", err)
+	}
+
+	meta := ChallengeMeta{IssuedAt: time.Unix(0, nanos), Difficulty: bits, Namespace: namespace}
+	if hasExpiry {
+		expiryNanos, err := strconv.ParseInt(expiresAt, 10, 64)
+		if err != nil {
+			return ChallengeMeta{}, fmt.Errorf("malformed challenge expiry: %w", err)
+		}
+		if expiryNanos != 0 {
+			meta.ExpiresAt = time.Unix(0, expiryNanos)
+		}
+	}
+	return meta, nil
+}
@@ -0,0 +1,249 @@
+package pow
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	_ ChallengeStore    = (*RedisStore)(nil)
+	_ ChallengeInserter = (*RedisStore)(nil)
+	_ RedisSetNXClient  = (*fakeRedis)(nil)
+)
+
+// fakeRedis implements RedisClient over a map, expiring keys like Redis does
+type fakeRedis struct {
+	values map[string]fakeRedisValue
+	err    error // Returned by every command when set
+	mu     sync.Mutex
+}
+
+type fakeRedisValue struct {
+	value     string
+	expiresAt time.Time
+}
+
+func newFakeRedis() *fakeRedis {
+	return &fakeRedis{values: make(map[string]fakeRedisValue)}
+}
+
+func (r *fakeRedis) SetEx(ctx context.Context, key, value string, ttl time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	r.values[key] = fakeRedisValue{value: value, expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+func (r *fakeRedis) SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return false, r.err
+	}
+	if v, exists := r.values[key]; exists && time.Now().Before(v.expiresAt) {
+		return false, nil
+	}
+	r.values[key] = fakeRedisValue{value: value, expiresAt: time.Now().Add(ttl)}
+	return true, nil
+}
+
+func (r *fakeRedis) GetDel(ctx context.Context, key string) (string, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return "", false, r.err
+	}
+	v, exists := r.values[key]
+	delete(r.values, key)
+	if !exists || time.Now().After(v.expiresAt) {
+		return "", false, nil
+	}
+	return v.value, true, nil
+}
+
+func (r *fakeRedis) CountPrefix(ctx context.Context, prefix string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return 0, r.err
+	}
+	count := 0
+	for key, v := range r.values {
+		if strings.HasPrefix(key, prefix) && time.Now().Before(v.expiresAt) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *fakeRedis) fail(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.err = err
+}
+
+func TestRedisStore_RoundTrip(t *testing.T) {
+	redis := newFakeRedis()
+	store := NewRedisStore(redis, "")
+	meta := ChallengeMeta{IssuedAt: time.Unix(1700000000, 123), Difficulty: 4, ExpiresAt: time.Unix(1700000060, 456)}
+
+	if err := store.Put("1700000000:abcd", meta, time.Minute); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if _, exists := redis.values[DefaultRedisKeyPrefix+"1700000000:abcd"]; !exists {
+		t.Error("Expected key to be namespaced with the default prefix")
+	}
+	if count, err := store.Count(); err != nil || count != 1 {
+		t.Errorf("Expected count 1, got %d (err=%v)", count, err)
+	}
+
+	got, found, err := store.GetAndDelete("1700000000:abcd")
+	if err != nil || !found {
+		t.Fatalf("Expected stored challenge, got found=%v err=%v", found, err)
+	}
+	if !got.IssuedAt.Equal(meta.IssuedAt) || got.Difficulty != meta.Difficulty || !got.ExpiresAt.Equal(meta.ExpiresAt) {
+		t.Errorf("Expected %+v, got %+v", meta, got)
+	}
+	if _, found, _ := store.GetAndDelete("1700000000:abcd"); found {
+		t.Error("Expected challenge to be gone after GetAndDelete")
+	}
+}
+
+func TestRedisStore_MetaWithoutExpiry(t *testing.T) {
+	// Values written before challenges carried their own expiry
+	meta, err := parseRedisMeta("1700000000000000123:4")
+	if err != nil {
+		t.Fatalf("parseRedisMeta failed: %v", err)
+	}
+	if !meta.IssuedAt.Equal(time.Unix(1700000000, 123)) || meta.Difficulty != 4 || !meta.ExpiresAt.IsZero() {
+		t.Errorf("Unexpected metadata %+v", meta)
+	}
+
+	if _, err := parseRedisMeta("1700000000000000123:4:soon"); err == nil {
+		t.Error("Expected an error for a malformed expiry")
+	}
+}
+
+func TestRedisStore_PutIfAbsent(t *testing.T) {
+	first := ChallengeMeta{IssuedAt: time.Unix(1700000000, 0), Difficulty: 1}
+	second := ChallengeMeta{IssuedAt: time.Unix(1700000000, 0), Difficulty: 2}
+
+	store := NewRedisStore(newFakeRedis(), "")
+	if stored, err := store.PutIfAbsent("challenge", first, time.Minute); err != nil || !stored {
+		t.Fatalf("Expected the first PutIfAbsent to store, got stored=%v err=%v", stored, err)
+	}
+	if stored, err := store.PutIfAbsent("challenge", second, time.Minute); err != nil || stored {
+		t.Errorf("Expected PutIfAbsent to refuse an active challenge, got stored=%v err=%v", stored, err)
+	}
+	if got, _, _ := store.GetAndDelete("challenge"); got.Difficulty != first.Difficulty {
+		t.Errorf("Expected the first challenge to be kept, got difficulty %d", got.Difficulty)
+	}
+
+	// Clients without SetNX overwrite, as Put does
+	store = NewRedisStore(struct{ RedisClient }{newFakeRedis()}, "")
+	store.PutIfAbsent("challenge", first, time.Minute)
+	if stored, err := store.PutIfAbsent("challenge", second, time.Minute); err != nil || !stored {
+		t.Errorf("Expected the fallback to store, got stored=%v err=%v", stored, err)
+	}
+	if got, _, _ := store.GetAndDelete("challenge"); got.Difficulty != second.Difficulty {
+		t.Errorf("Expected the fallback to overwrite, got difficulty %d", got.Difficulty)
+	}
+}
+
+func TestRedisStore_Namespace(t *testing.T) {
+	store := NewRedisStore(newFakeRedis(), "")
+	issuedAt := time.Unix(1700000000, 0)
+
+	for _, meta := range []ChallengeMeta{
+		{IssuedAt: issuedAt, Difficulty: 2, ExpiresAt: issuedAt.Add(time.Minute), Namespace: "tenant:a"},
+		{IssuedAt: issuedAt, Difficulty: 2, Namespace: "no-expiry"},
+	} {
+		if err := store.Put("challenge", meta, time.Minute); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+		got, found, err := store.GetAndDelete("challenge")
+		if err != nil || !found {
+			t.Fatalf("GetAndDelete failed: found=%v err=%v", found, err)
+		}
+		if !got.IssuedAt.Equal(meta.IssuedAt) || !got.ExpiresAt.Equal(meta.ExpiresAt) || got.Namespace != meta.Namespace {
+			t.Errorf("Expected %+v, got %+v", meta, got)
+		}
+	}
+}
+
+func TestRedisStore_SharedAcrossInstances(t *testing.T) {
+	difficulty := 1
+	redis := newFakeRedis()
+	issuer := NewSHA256HashcashServiceWithStore(difficulty, 5*time.Minute, DefaultMaxActiveChallenges, 0, NewRedisStore(redis, ""))
+	verifier := NewSHA256HashcashServiceWithStore(difficulty, 5*time.Minute, DefaultMaxActiveChallenges, 0, NewRedisStore(redis, ""))
+
+	challenge, err := issuer.GenerateChallenge()
+	if err != nil {
+		t.Fatalf("GenerateChallenge failed: %v", err)
+	}
+	nonce, err := issuer.SolveChallenge(context.Background(), challenge, difficulty)
+	if err != nil {
+		t.Fatalf("SolveChallenge failed: %v", err)
+	}
+
+	// Another instance verifies the proof, and neither accepts it again
+	if valid, err := verifier.VerifyProof(challenge, nonce); err != nil || !valid {
+		t.Fatalf("Expected valid proof on second instance, got valid=%v err=%v", valid, err)
+	}
+	if _, err := issuer.VerifyProof(challenge, nonce); err == nil {
+		t.Error("Expected replay on the issuing instance to be rejected")
+	}
+	if _, err := verifier.VerifyProof(challenge, nonce); err == nil {
+		t.Error("Expected replay on the verifying instance to be rejected")
+	}
+}
+
+func TestRedisStore_SharedLimit(t *testing.T) {
+	redis := newFakeRedis()
+	a := NewSHA256HashcashServiceWithStore(1, 5*time.Minute, 2, 0, NewRedisStore(redis, ""))
+	b := NewSHA256HashcashServiceWithStore(1, 5*time.Minute, 2, 0, NewRedisStore(redis, ""))
+
+	if _, err := a.GenerateChallenge(); err != nil {
+		t.Fatalf("GenerateChallenge failed: %v", err)
+	}
+	if _, err := b.GenerateChallenge(); err != nil {
+		t.Fatalf("GenerateChallenge failed: %v", err)
+	}
+	if _, err := a.GenerateChallenge(); !errors.Is(err, ErrTooManyChallenges) {
+		t.Errorf("Expected the limit to count challenges of both instances, got: %v", err)
+	}
+}
+
+func TestRedisStore_Errors(t *testing.T) {
+	redis := newFakeRedis()
+	service := NewSHA256HashcashServiceWithStore(1, 5*time.Minute, DefaultMaxActiveChallenges, 0, NewRedisStore(redis, ""))
+
+	challenge, err := service.GenerateChallenge()
+	if err != nil {
+		t.Fatalf("GenerateChallenge failed: %v", err)
+	}
+
+	redisDown := errors.New("connection refused")
+	redis.fail(redisDown)
+
+	if _, err := service.GenerateChallenge(); !errors.Is(err, redisDown) {
+		t.Errorf("Expected Redis error from GenerateChallenge, got: %v", err)
+	}
+	if _, err := service.VerifyProof(challenge, "0"); !errors.Is(err, redisDown) {
+		t.Errorf("Expected Redis error from VerifyProof, got: %v", err)
+	}
+
+	// Garbage under a challenge key is reported rather than trusted
+	redis.fail(nil)
+	redis.SetEx(context.Background(), DefaultRedisKeyPrefix+"1700000000:0bad", "not-metadata", time.Minute)
+	if _, err := service.VerifyProof("1700000000:0bad", "0"); err == nil || errors.Is(err, ErrMalformedChallenge) {
+		t.Error("Expected error for malformed metadata")
+	}
+}
@@ -0,0 +1,88 @@
+package pow
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// DefaultSeenCacheCapacity is the default number of used challenges remembered in stateless mode
+const DefaultSeenCacheCapacity = 100000
+
+// seenCache is a bounded LRU set of used challenges for replay attack prevention.
+// Entries are forgotten once they expire or, when the cache is full, in least
+// recently used order. Evicting an unexpired entry re-opens that challenge to
+// replay, so capacity should cover the challenges verified within one TTL.
+type seenCache struct {
+	capacity int
+	entries  map[string]*list.Element // map[challenge]element in order
+	order    *list.List               // Front is least recently used
+	now      func() time.Time         // Overridable for tests
+	mu       sync.Mutex               // Protects entries and order
+}
+
+// seenEntry is a single remembered challenge
+type seenEntry struct {
+	challenge string
+	expiry    time.Time
+}
+
+// newSeenCache creates a seen cache holding at most capacity challenges.
+// A non-positive capacity uses DefaultSeenCacheCapacity.
+func newSeenCache(capacity int) *seenCache {
+	if capacity <= 0 {
+		capacity = DefaultSeenCacheCapacity
+	}
+
+	return &seenCache{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+		now:      time.Now,
+	}
+}
+
+// add records challenge until expiry, reporting false if it is already present
+func (c *seenCache) add(challenge string, expiry time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+
+	if elem, exists := c.entries[challenge]; exists {
+		if now.Before(elem.Value.(*seenEntry).expiry) {
+			c.order.MoveToBack(elem)
+			return false
+		}
+		c.remove(elem)
+	}
+
+	c.evict(now)
+
+	c.entries[challenge] = c.order.PushBack(&seenEntry{challenge: challenge, expiry: expiry})
+	return true
+}
+
+// evict drops expired entries from the front and, if still full,
+// the least recently used one. Must be called with mu held.
+func (c *seenCache) evict(now time.Time) {
+	for elem := c.order.Front(); elem != nil; elem = c.order.Front() {
+		if len(c.entries) < c.capacity && now.Before(elem.Value.(*seenEntry).expiry) {
+			return
+		}
+		c.remove(elem)
+	}
+}
+
+// remove deletes elem from the cache. Must be called with mu held.
+func (c *seenCache) remove(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*seenEntry).challenge)
+}
+
+// size returns the number of remembered challenges
+func (c *seenCache) size() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
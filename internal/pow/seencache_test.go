@@ -0,0 +1,95 @@
+package pow
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSeenCache_RejectsDuplicates(t *testing.T) {
+	cache := newSeenCache(10)
+	expiry := time.Now().Add(time.Minute)
+
+	if !cache.add("a", expiry) {
+		t.Fatal("First add should succeed")
+	}
+	if cache.add("a", expiry) {
+		t.Error("Duplicate add should be rejected")
+	}
+	if !cache.add("b", expiry) {
+		t.Error("Different challenge should be accepted")
+	}
+}
+
+func TestSeenCache_Expiry(t *testing.T) {
+	cache := newSeenCache(10)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	cache.add("a", now.Add(time.Minute))
+
+	// Once expired, an entry no longer blocks and is dropped on the next add
+	now = now.Add(2 * time.Minute)
+	cache.add("b", now.Add(time.Minute))
+	if size := cache.size(); size != 1 {
+		t.Errorf("Expected expired entry to be evicted, got %d entries", size)
+	}
+	if !cache.add("a", now.Add(time.Minute)) {
+		t.Error("Expired entry should not be reported as seen")
+	}
+}
+
+func TestSeenCache_CapacityEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := newSeenCache(2)
+	expiry := time.Now().Add(time.Minute)
+
+	cache.add("a", expiry)
+	cache.add("b", expiry)
+	cache.add("a", expiry) // Replay attempt refreshes "a"
+	cache.add("c", expiry) // Evicts "b"
+
+	if size := cache.size(); size != 2 {
+		t.Fatalf("Expected capacity to bound cache at 2, got %d", size)
+	}
+	if cache.add("a", expiry) {
+		t.Error("Recently used entry should have been kept")
+	}
+	if !cache.add("b", expiry) {
+		t.Error("Least recently used entry should have been evicted")
+	}
+}
+
+func TestSeenCache_Concurrent(t *testing.T) {
+	cache := newSeenCache(1000)
+	expiry := time.Now().Add(time.Minute)
+
+	var wg sync.WaitGroup
+	accepted := make(chan string, 800)
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				challenge := fmt.Sprintf("c%d", i)
+				if cache.add(challenge, expiry) {
+					accepted <- challenge
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(accepted)
+
+	// Each challenge must be accepted exactly once across all goroutines
+	seen := make(map[string]bool)
+	for challenge := range accepted {
+		if seen[challenge] {
+			t.Errorf("Challenge %s accepted more than once", challenge)
+		}
+		seen[challenge] = true
+	}
+	if len(seen) != 100 {
+		t.Errorf("Expected 100 accepted challenges, got %d", len(seen))
+	}
+}
@@ -1,38 +1,65 @@
 package pow
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
-	"crypto/sha256"
-	"encoding/hex"
-	"fmt"
-	"strconv"
-	"sync"
+	"errors"
+	"io"
+	"math"
+	"math/big"
+	"sync/atomic"
 	"time"
 )
 
 const (
 	// DefaultMaxActiveChallenges is the default limit for active challenges
 	DefaultMaxActiveChallenges = 100000
-	// ChallengeRandomBytesSize is the size of random bytes in challenge
+	// ChallengeRandomBytesSize is the default size of random bytes in challenge
 	ChallengeRandomBytesSize = 16
+	// MaxDefaultCleanupInterval caps the default cleanup interval for long challenge TTLs
+	MaxDefaultCleanupInterval = 30 * time.Second
 )
 
 // ChallengeService defines the interface for server-side PoW operations
 // (challenge generation and verification)
 type ChallengeService interface {
 	GenerateChallenge() (string, error)
+	GenerateChallengeWithDifficulty(difficulty int) (string, error)
 	VerifyProof(challenge, nonce string) (bool, error)
+	VerifyProofCtx(ctx context.Context, challenge, nonce string) (bool, error)
+	VerifyBoundProof(ctx context.Context, challenge, binding, nonce string) (bool, error)
 	InvalidateChallenge(challenge string)
 	GetDifficulty() int
+	Namespace() string
 }
 
+// ServiceStats is a snapshot of a challenge service's state
+type ServiceStats struct {
+	ActiveChallenges int // Issued challenges not yet verified, invalidated or cleaned up
+}
+
+// ErrNonceSpaceExhausted is returned by solvers that tried every nonce without
+// finding a solution, which only happens at difficulties no hash can meet
+var ErrNonceSpaceExhausted = errors.New("nonce space exhausted")
+
+// ErrSolveAttemptsExceeded is returned by solvers that tried as many nonces as
+// their maximum solve attempts allow without finding a solution
+var ErrSolveAttemptsExceeded = errors.New("solve attempts exceeded")
+
 // SolverService defines the interface for client-side PoW operations
 // (challenge solving)
 type SolverService interface {
 	SolveChallenge(ctx context.Context, challenge string, difficulty int) (string, error)
 }
 
+// StatsSolverService is implemented by solvers that can report how many
+// nonces they tried, which helps tune difficulty
+type StatsSolverService interface {
+	SolverService
+	SolveChallengeWithStats(ctx context.Context, challenge string, difficulty int) (nonce string, attempts int, err error)
+}
+
 // Service combines both ChallengeService and SolverService
 // SHA256HashcashService implements this full interface
 type Service interface {
@@ -42,130 +69,235 @@ type Service interface {
 
 // SHA256HashcashService implements PoW using SHA256 Hashcash algorithm
 type SHA256HashcashService struct {
-	difficulty          int
-	challengeTTL        time.Duration
-	maxActiveChallenges int
-	activeChallenges    map[string]time.Time // map[challenge]timestamp for replay attack prevention
-	mu                  sync.RWMutex         // Protects activeChallenges map
+	difficulty int32 // Accessed atomically, may change at runtime
+	store      *challengeStore
+	maxNonce   uint64 // Largest nonce tried when solving, 0 means math.MaxUint64. Overridable for tests.
+	maxTries   uint64 // Cap on nonces tried per solve, 0 means unlimited
+
+	// target, when set, is the highest hash a proof may have, replacing the difficulty
+	target *big.Int
 }
 
-// NewSHA256HashcashService creates a new PoW service
+// NewSHA256HashcashService creates a new PoW service. Clients that only solve
+// challenges may pass difficulty 0 and no TTL, since each challenge brings its own
+// difficulty; generating a challenge at difficulty 0 fails with ErrZeroDifficulty.
 func NewSHA256HashcashService(difficulty int, challengeTTL time.Duration) *SHA256HashcashService {
 	return NewSHA256HashcashServiceWithLimit(difficulty, challengeTTL, DefaultMaxActiveChallenges)
 }
 
 // NewSHA256HashcashServiceWithLimit creates a new PoW service with custom max challenges limit
 func NewSHA256HashcashServiceWithLimit(difficulty int, challengeTTL time.Duration, maxActiveChallenges int) *SHA256HashcashService {
+	return NewSHA256HashcashServiceWithRandomBytes(difficulty, challengeTTL, maxActiveChallenges, ChallengeRandomBytesSize)
+}
+
+// NewSHA256HashcashServiceWithRandomBytes creates a new PoW service with custom max challenges
+// limit and challenge random part size. A non-positive size uses ChallengeRandomBytesSize.
+func NewSHA256HashcashServiceWithRandomBytes(difficulty int, challengeTTL time.Duration, maxActiveChallenges int, randomBytes int) *SHA256HashcashService {
 	s := &SHA256HashcashService{
-		difficulty:          difficulty,
-		challengeTTL:        challengeTTL,
-		maxActiveChallenges: maxActiveChallenges,
-		activeChallenges:    make(map[string]time.Time),
+		store: newChallengeStore(challengeTTL, maxActiveChallenges, randomBytes),
 	}
+	s.SetDifficulty(difficulty)
+
+	return s
+}
 
-	// Start cleanup goroutine for expired challenges only if TTL is positive
-	// (client doesn't need cleanup as it doesn't generate challenges)
-	if challengeTTL > 0 {
-		go s.cleanupExpiredChallenges()
+// NewSHA256HashcashServiceWithStore creates a new PoW service keeping issued challenges
+// in store, e.g. a RedisStore shared by several server instances
+func NewSHA256HashcashServiceWithStore(difficulty int, challengeTTL time.Duration, maxActiveChallenges int, randomBytes int, store ChallengeStore) *SHA256HashcashService {
+	s := &SHA256HashcashService{
+		store: newChallengeStoreWithBackend(challengeTTL, maxActiveChallenges, randomBytes, store),
 	}
+	s.SetDifficulty(difficulty)
 
 	return s
 }
 
-// GenerateChallenge generates a new unique challenge
-func (s *SHA256HashcashService) GenerateChallenge() (string, error) {
-	// Generate random bytes
-	randomBytes := make([]byte, ChallengeRandomBytesSize)
-	if _, err := rand.Read(randomBytes); err != nil {
-		return "", fmt.Errorf("failed to generate random bytes: %w", err)
+// SetClock replaces the clock used to timestamp and expire challenges, nil restores time.Now.
+// It lets tests produce known challenges and must be called before the service is used.
+func (s *SHA256HashcashService) SetClock(now func() time.Time) {
+	if now == nil {
+		now = time.Now
 	}
+	s.store.setClock(now)
+}
 
-	// Create challenge: timestamp + random hex string
-	timestamp := time.Now().Unix()
-	challenge := fmt.Sprintf("%d:%s", timestamp, hex.EncodeToString(randomBytes))
+// SetRandSource replaces the source of the random part of challenges, nil restores
+// crypto/rand. It lets tests produce known challenges and must be called before the
+// service is used.
+func (s *SHA256HashcashService) SetRandSource(r io.Reader) {
+	if r == nil {
+		r = rand.Reader
+	}
+	s.store.setRandom(r)
+}
 
-	// Store challenge with timestamp for replay attack prevention
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// SetMaxSolveAttempts caps the nonces tried per solve, so solving gives up with
+// ErrSolveAttemptsExceeded after a bounded amount of work whatever the wall clock.
+// A non-positive value removes the cap. It must be called before the service is used.
+func (s *SHA256HashcashService) SetMaxSolveAttempts(attempts int) {
+	s.maxTries = uint64(max(attempts, 0))
+}
 
-	// Check if we've reached the limit of active challenges
-	if s.maxActiveChallenges > 0 && len(s.activeChallenges) >= s.maxActiveChallenges {
-		return "", fmt.Errorf("maximum active challenges limit reached (%d)", s.maxActiveChallenges)
-	}
+// SetTTLJitter makes each challenge's TTL deviate randomly by up to percent of the
+// configured TTL, so challenges issued in a burst don't all expire at once. Zero
+// disables jitter. It must be called before the service is used.
+func (s *SHA256HashcashService) SetTTLJitter(percent int) {
+	s.store.setTTLJitter(percent)
+}
 
-	s.activeChallenges[challenge] = time.Now()
+// SetAllowZeroDifficulty lets the service issue challenges below difficulty 1, which
+// any nonce solves, for deployments that disable proof of work on purpose. Without it
+// such challenges fail with ErrZeroDifficulty. It must be called before the service is used.
+func (s *SHA256HashcashService) SetAllowZeroDifficulty(allow bool) {
+	s.store.setAllowZeroDifficulty(allow)
+}
 
-	return challenge, nil
+// SetNamespace makes the service hash namespace before every challenge it issues and
+// verify only challenges it issued under the same namespace, so one process can serve
+// several tenants whose proofs don't carry over. It must be called before the service is used.
+func (s *SHA256HashcashService) SetNamespace(namespace string) {
+	s.store.setNamespace(namespace)
 }
 
-// VerifyProof verifies that the nonce solves the challenge
-func (s *SHA256HashcashService) VerifyProof(challenge, nonce string) (bool, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// Namespace returns the namespace set with SetNamespace, empty by default
+func (s *SHA256HashcashService) Namespace() string {
+	return s.store.getNamespace()
+}
 
-	// Check if challenge exists and is not expired
-	timestamp, exists := s.activeChallenges[challenge]
-	if !exists {
-		return false, fmt.Errorf("challenge not found or already used")
+// SetTarget makes proofs valid when their hash, read as a 256-bit number, is at most
+// target, Bitcoin-style, for finer control over the work than whole zero bytes give.
+// Challenge difficulties are then ignored, and nil restores them. It must be called
+// before the service is used.
+func (s *SHA256HashcashService) SetTarget(target *big.Int) {
+	if target != nil {
+		target = new(big.Int).Set(target)
 	}
+	s.target = target
+}
 
-	// Check if challenge is expired
-	if time.Since(timestamp) > s.challengeTTL {
-		delete(s.activeChallenges, challenge)
-		return false, fmt.Errorf("challenge expired")
+// Target returns the target set with SetTarget, nil if proofs are checked against difficulties
+func (s *SHA256HashcashService) Target() *big.Int {
+	if s.target == nil {
+		return nil
 	}
+	return new(big.Int).Set(s.target)
+}
 
-	// Compute hash
-	data := challenge + nonce
-	hash := sha256.Sum256([]byte(data))
+// GenerateChallenge generates a new unique challenge
+func (s *SHA256HashcashService) GenerateChallenge() (string, error) {
+	return s.GenerateChallengeWithDifficulty(s.GetDifficulty())
+}
 
-	// Check if hash has required number of leading zeros
-	if !s.hasLeadingZeros(hash[:], s.difficulty) {
-		// SECURITY: Remove invalid proof attempt to prevent memory exhaustion
-		delete(s.activeChallenges, challenge)
-		return false, nil
+// GenerateChallengeWithDifficulty generates a new unique challenge to be solved
+// at difficulty rather than the service's current one
+func (s *SHA256HashcashService) GenerateChallengeWithDifficulty(difficulty int) (string, error) {
+	return s.store.generate(difficulty)
+}
+
+// VerifyProof verifies that the nonce solves the challenge
+func (s *SHA256HashcashService) VerifyProof(challenge, nonce string) (bool, error) {
+	return s.VerifyProofCtx(context.Background(), challenge, nonce)
+}
+
+// VerifyProofCtx verifies that the nonce solves the challenge, giving up if ctx is done.
+// The challenge is consumed either way, so a canceled verification can't be retried.
+func (s *SHA256HashcashService) VerifyProofCtx(ctx context.Context, challenge, nonce string) (bool, error) {
+	return s.VerifyBoundProof(ctx, challenge, "", nonce)
+}
+
+// VerifyBoundProof verifies that the nonce solves the challenge bound to binding,
+// i.e. that ChallengeData + nonce hashes to enough leading zeros, or to at most the target
+func (s *SHA256HashcashService) VerifyBoundProof(ctx context.Context, challenge, binding, nonce string) (bool, error) {
+	// Remove challenge to prevent replay attacks, even if the proof turns out invalid
+	entry, err := s.store.consume(challenge)
+	if err != nil {
+		return false, err
+	}
+	if err := ctx.Err(); err != nil {
+		return false, err
 	}
 
-	// Remove challenge to prevent replay attacks
-	delete(s.activeChallenges, challenge)
+	data := ChallengeData(entry.Namespace, challenge, binding)
+	if s.target != nil {
+		return VerifyTarget(data, nonce, s.target), nil
+	}
 
-	return true, nil
+	// Check against the difficulty the challenge was issued with,
+	// not the current one, which may have changed since
+	return Verify(data, nonce, entry.Difficulty, SHA256Hasher{}), nil
 }
 
 // InvalidateChallenge removes a challenge from the active set
 // This should be called when a connection fails after challenge generation
 // to prevent memory exhaustion attacks
 func (s *SHA256HashcashService) InvalidateChallenge(challenge string) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	delete(s.activeChallenges, challenge)
+	s.store.invalidate(challenge)
+}
+
+// Stats returns a snapshot of the service state
+func (s *SHA256HashcashService) Stats() (ServiceStats, error) {
+	return s.store.stats()
+}
+
+// Close stops the goroutine dropping expired challenges, for services that are
+// discarded before the process exits. The service keeps working, but expired
+// challenges pile up. A store passed to the constructor is not closed.
+func (s *SHA256HashcashService) Close() error {
+	return s.store.close()
 }
 
 // SolveChallenge finds a nonce that solves the challenge
 func (s *SHA256HashcashService) SolveChallenge(ctx context.Context, challenge string, difficulty int) (string, error) {
-	var nonce uint64
-
-	for {
-		select {
-		case <-ctx.Done():
-			return "", ctx.Err()
-		default:
-			nonceStr := strconv.FormatUint(nonce, 10)
-			data := challenge + nonceStr
-			hash := sha256.Sum256([]byte(data))
-
-			if s.hasLeadingZeros(hash[:], difficulty) {
-				return nonceStr, nil
-			}
-
-			nonce++
+	nonce, _, err := s.SolveChallengeWithStats(ctx, challenge, difficulty)
+	return nonce, err
+}
+
+// SolveChallengeWithStats finds a nonce that solves the challenge and reports
+// how many nonces were tried, including the winning one
+func (s *SHA256HashcashService) SolveChallengeWithStats(ctx context.Context, challenge string, difficulty int) (string, int, error) {
+	last, exhausted := solveLimit(s.maxNonce, s.maxTries)
+	return solveWithin(ctx, challenge, difficulty, SHA256Hasher{}, last, exhausted)
+}
+
+// SolveTargetWithStats finds a nonce for which SHA256(challenge + nonce) is at most
+// target and reports how many nonces were tried, including the winning one
+func (s *SHA256HashcashService) SolveTargetWithStats(ctx context.Context, challenge string, target *big.Int) (string, int, error) {
+	limit := targetBytes(target)
+	prefix := newPrefixHasher(challenge)
+	last, exhausted := solveLimit(s.maxNonce, s.maxTries)
+	return searchNonces(ctx, last, exhausted, progressFrom(ctx).wrap(func(nonce uint64) bool {
+		return bytes.Compare(prefix.hashNonce(nonce), limit) <= 0
+	}))
+}
+
+// SolveChallengeParallel finds a nonce that solves the challenge using multiple workers.
+// A non-positive worker count uses one worker per CPU.
+func (s *SHA256HashcashService) SolveChallengeParallel(ctx context.Context, challenge string, difficulty int, workers int) (string, error) {
+	nonce, _, err := s.SolveChallengeParallelWithStats(ctx, challenge, difficulty, workers)
+	return nonce, err
+}
+
+// SolveChallengeParallelWithStats is SolveChallengeParallel also reporting how many
+// nonces all workers tried, including the winning one
+func (s *SHA256HashcashService) SolveChallengeParallelWithStats(ctx context.Context, challenge string, difficulty int, workers int) (string, int, error) {
+	last, exhausted := solveLimit(s.maxNonce, s.maxTries)
+	return solveParallel(ctx, workers, last, exhausted, func() func(nonce string) bool {
+		hasher := newPrefixHasher(challenge)
+		return func(nonce string) bool {
+			return s.hasLeadingZeros(hasher.hashString(nonce), difficulty)
 		}
-	}
+	})
 }
 
 // GetDifficulty returns the current difficulty level
 func (s *SHA256HashcashService) GetDifficulty() int {
-	return s.difficulty
+	return int(atomic.LoadInt32(&s.difficulty))
+}
+
+// SetDifficulty changes the difficulty for newly generated challenges.
+// Challenges already issued keep the difficulty they were issued with.
+func (s *SHA256HashcashService) SetDifficulty(difficulty int) {
+	atomic.StoreInt32(&s.difficulty, int32(difficulty))
 }
 
 // hasLeadingZeros checks if hash has required number of leading zero bytes
@@ -183,20 +315,30 @@ func (s *SHA256HashcashService) hasLeadingZeros(hash []byte, difficulty int) boo
 	return true
 }
 
-// cleanupExpiredChallenges periodically removes expired challenges
-func (s *SHA256HashcashService) cleanupExpiredChallenges() {
-	ticker := time.NewTicker(s.challengeTTL / 2)
-	defer ticker.Stop()
+// lastNonce returns the largest nonce a solver may try given its maxNonce setting
+func lastNonce(maxNonce uint64) uint64 {
+	if maxNonce == 0 {
+		return math.MaxUint64
+	}
+	return maxNonce
+}
 
-	for range ticker.C {
-		now := time.Now()
+// solveLimit returns the last nonce a solver may try and the error to report if none
+// of them solves the challenge: ErrSolveAttemptsExceeded when maxTries ends the
+// search before maxNonce does, ErrNonceSpaceExhausted otherwise
+func solveLimit(maxNonce, maxTries uint64) (uint64, error) {
+	last := lastNonce(maxNonce)
+	if maxTries > 0 && maxTries-1 < last {
+		return maxTries - 1, ErrSolveAttemptsExceeded
+	}
+	return last, ErrNonceSpaceExhausted
+}
 
-		s.mu.Lock()
-		for challenge, timestamp := range s.activeChallenges {
-			if now.Sub(timestamp) > s.challengeTTL {
-				delete(s.activeChallenges, challenge)
-			}
-		}
-		s.mu.Unlock()
+// attemptsThrough returns how many nonces were tried by a search that started at 0
+// and reached nonce, saturating at math.MaxInt instead of wrapping
+func attemptsThrough(nonce uint64) int {
+	if nonce >= math.MaxInt {
+		return math.MaxInt
 	}
+	return int(nonce) + 1
 }
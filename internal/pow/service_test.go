@@ -1,15 +1,21 @@
 package pow
 
 import (
+	"bytes"
 	"context"
 	"crypto/sha256"
-	"strings"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 )
 
 func TestSHA256HashcashService_GenerateChallenge(t *testing.T) {
 	service := NewSHA256HashcashService(2, 5*time.Minute)
+	defer service.Close()
 
 	challenge, err := service.GenerateChallenge()
 	if err != nil {
@@ -21,9 +27,8 @@ func TestSHA256HashcashService_GenerateChallenge(t *testing.T) {
 	}
 
 	// Check format: timestamp:randomhex
-	parts := strings.Split(challenge, ":")
-	if len(parts) != 2 {
-		t.Errorf("Challenge should have format 'timestamp:randomhex', got: %s", challenge)
+	if _, _, err := ParseChallenge(challenge); err != nil {
+		t.Errorf("Challenge should have format 'timestamp:randomhex', got %s: %v", challenge, err)
 	}
 
 	// Generate another challenge and ensure it's different
@@ -40,6 +45,7 @@ func TestSHA256HashcashService_GenerateChallenge(t *testing.T) {
 func TestSHA256HashcashService_VerifyProof(t *testing.T) {
 	difficulty := 1
 	service := NewSHA256HashcashService(difficulty, 5*time.Minute)
+	defer service.Close()
 
 	challenge, err := service.GenerateChallenge()
 	if err != nil {
@@ -67,6 +73,7 @@ func TestSHA256HashcashService_VerifyProof(t *testing.T) {
 func TestSHA256HashcashService_VerifyProof_Invalid(t *testing.T) {
 	difficulty := 2
 	service := NewSHA256HashcashService(difficulty, 5*time.Minute)
+	defer service.Close()
 
 	challenge, err := service.GenerateChallenge()
 	if err != nil {
@@ -87,6 +94,7 @@ func TestSHA256HashcashService_VerifyProof_Invalid(t *testing.T) {
 func TestSHA256HashcashService_VerifyProof_ExpiredChallenge(t *testing.T) {
 	difficulty := 1
 	service := NewSHA256HashcashService(difficulty, 100*time.Millisecond)
+	defer service.Close()
 
 	challenge, err := service.GenerateChallenge()
 	if err != nil {
@@ -117,6 +125,7 @@ func TestSHA256HashcashService_VerifyProof_ExpiredChallenge(t *testing.T) {
 func TestSHA256HashcashService_VerifyProof_ReplayAttack(t *testing.T) {
 	difficulty := 1
 	service := NewSHA256HashcashService(difficulty, 5*time.Minute)
+	defer service.Close()
 
 	challenge, err := service.GenerateChallenge()
 	if err != nil {
@@ -151,9 +160,160 @@ func TestSHA256HashcashService_VerifyProof_ReplayAttack(t *testing.T) {
 	}
 }
 
+func TestSHA256HashcashService_VerifyProofCtx_Canceled(t *testing.T) {
+	difficulty := 1
+	service := NewSHA256HashcashService(difficulty, 5*time.Minute)
+	defer service.Close()
+
+	challenge, err := service.GenerateChallenge()
+	if err != nil {
+		t.Fatalf("GenerateChallenge failed: %v", err)
+	}
+
+	nonce, err := service.SolveChallenge(context.Background(), challenge, difficulty)
+	if err != nil {
+		t.Fatalf("SolveChallenge failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Even a correct proof isn't accepted once the caller has given up
+	valid, err := service.VerifyProofCtx(ctx, challenge, nonce)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got: %v", err)
+	}
+	if valid {
+		t.Error("Proof should not be reported valid with a canceled context")
+	}
+
+	// The challenge was consumed, so it can't be verified again
+	if _, err := service.VerifyProofCtx(context.Background(), challenge, nonce); err == nil {
+		t.Error("Expected challenge to be consumed by the canceled verification")
+	}
+}
+
+func TestSHA256HashcashService_VerifyBoundProof(t *testing.T) {
+	difficulty := 2
+	service := NewSHA256HashcashService(difficulty, 5*time.Minute)
+	defer service.Close()
+	ctx := context.Background()
+
+	// A bound challenge is solved over challenge + binding
+	solveBound := func(binding string) (string, string) {
+		challenge, err := service.GenerateChallenge()
+		if err != nil {
+			t.Fatalf("GenerateChallenge failed: %v", err)
+		}
+		nonce, err := service.SolveChallenge(ctx, challenge+binding, difficulty)
+		if err != nil {
+			t.Fatalf("SolveChallenge failed: %v", err)
+		}
+		return challenge, nonce
+	}
+
+	challenge, nonce := solveBound("192.0.2.1")
+	valid, err := service.VerifyBoundProof(context.Background(), challenge, "192.0.2.1", nonce)
+	if err != nil {
+		t.Fatalf("VerifyBoundProof failed: %v", err)
+	}
+	if !valid {
+		t.Error("Proof should be valid for the IP it was bound to")
+	}
+
+	// The same proof presented from another IP doesn't verify
+	challenge, nonce = solveBound("192.0.2.1")
+	valid, err = service.VerifyBoundProof(context.Background(), challenge, "198.51.100.7", nonce)
+	if err != nil {
+		t.Fatalf("VerifyBoundProof failed: %v", err)
+	}
+	if valid {
+		t.Error("Proof bound to one IP should be invalid from another")
+	}
+
+	// Nor does it verify unbound
+	challenge, nonce = solveBound("192.0.2.1")
+	valid, err = service.VerifyProof(challenge, nonce)
+	if err != nil {
+		t.Fatalf("VerifyProof failed: %v", err)
+	}
+	if valid {
+		t.Error("Bound proof should be invalid without its binding")
+	}
+}
+
+func TestSHA256HashcashService_VerifyProof_DifficultyChangedMidFlight(t *testing.T) {
+	service := NewSHA256HashcashService(1, 5*time.Minute)
+	defer service.Close()
+
+	challenge, err := service.GenerateChallenge()
+	if err != nil {
+		t.Fatalf("GenerateChallenge failed: %v", err)
+	}
+
+	// Raise difficulty after the challenge was issued
+	service.SetDifficulty(3)
+
+	if service.GetDifficulty() != 3 {
+		t.Errorf("Expected difficulty 3, got %d", service.GetDifficulty())
+	}
+
+	// Client solves at the difficulty it was told when the challenge was issued
+	nonce, err := service.SolveChallenge(context.Background(), challenge, 1)
+	if err != nil {
+		t.Fatalf("SolveChallenge failed: %v", err)
+	}
+
+	valid, err := service.VerifyProof(challenge, nonce)
+	if err != nil {
+		t.Fatalf("VerifyProof failed: %v", err)
+	}
+
+	if !valid {
+		t.Error("Proof should be verified against the difficulty stored with the challenge")
+	}
+
+	// New challenges must use the new difficulty
+	challenge2, err := service.GenerateChallenge()
+	if err != nil {
+		t.Fatalf("GenerateChallenge failed: %v", err)
+	}
+
+	entry, _, _ := service.store.backend.GetAndDelete(challenge2)
+
+	if entry.Difficulty != 3 {
+		t.Errorf("Expected new challenge difficulty 3, got %d", entry.Difficulty)
+	}
+}
+
+func TestSHA256HashcashService_GenerateChallengeWithDifficulty(t *testing.T) {
+	service := NewSHA256HashcashService(1, 5*time.Minute)
+	defer service.Close()
+
+	challenge, err := service.GenerateChallengeWithDifficulty(3)
+	if err != nil {
+		t.Fatalf("GenerateChallengeWithDifficulty failed: %v", err)
+	}
+	if service.GetDifficulty() != 1 {
+		t.Errorf("Expected service difficulty to stay 1, got %d", service.GetDifficulty())
+	}
+
+	// A nonce meeting only the service's difficulty does not solve the challenge
+	for i := 0; ; i++ {
+		nonce := strconv.Itoa(i)
+		if Verify(challenge, nonce, 1, SHA256Hasher{}) && !Verify(challenge, nonce, 3, SHA256Hasher{}) {
+			if valid, _ := service.VerifyProof(challenge, nonce); valid {
+				t.Error("Proof below the challenge's difficulty should be rejected")
+			}
+			break
+		}
+	}
+}
+
 func TestSHA256HashcashService_SolveChallenge(t *testing.T) {
 	difficulty := 1
 	service := NewSHA256HashcashService(difficulty, 5*time.Minute)
+	defer service.Close()
 
 	challenge := "test_challenge"
 	ctx := context.Background()
@@ -175,6 +335,7 @@ func TestSHA256HashcashService_SolveChallenge(t *testing.T) {
 func TestSHA256HashcashService_SolveChallenge_Timeout(t *testing.T) {
 	difficulty := 10 // Very high difficulty to ensure timeout
 	service := NewSHA256HashcashService(difficulty, 5*time.Minute)
+	defer service.Close()
 
 	challenge := "test_challenge"
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
@@ -190,8 +351,61 @@ func TestSHA256HashcashService_SolveChallenge_Timeout(t *testing.T) {
 	}
 }
 
+func TestSHA256HashcashService_SolveChallengeParallel(t *testing.T) {
+	difficulty := 2
+	service := NewSHA256HashcashService(difficulty, 5*time.Minute)
+	defer service.Close()
+
+	challenge, err := service.GenerateChallenge()
+	if err != nil {
+		t.Fatalf("GenerateChallenge failed: %v", err)
+	}
+
+	nonce, err := service.SolveChallengeParallel(context.Background(), challenge, difficulty, 4)
+	if err != nil {
+		t.Fatalf("SolveChallengeParallel failed: %v", err)
+	}
+
+	valid, err := service.VerifyProof(challenge, nonce)
+	if err != nil {
+		t.Fatalf("VerifyProof failed: %v", err)
+	}
+
+	if !valid {
+		t.Error("Proof from parallel solver should be valid")
+	}
+}
+
+func TestSHA256HashcashService_SolveChallengeParallel_Cancel(t *testing.T) {
+	service := NewSHA256HashcashService(10, 5*time.Minute)
+	defer service.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := service.SolveChallengeParallel(ctx, "test_challenge", 10, 0)
+	if err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got: %v", err)
+	}
+
+	// All workers must stop promptly once canceled
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Parallel solver took %v to honor cancellation", elapsed)
+	}
+}
+
+var _ ParallelSolverService = (*SHA256HashcashService)(nil)
+var _ ParallelSolverService = (*Argon2HashcashService)(nil)
+var _ ParallelStatsSolverService = (*SHA256HashcashService)(nil)
+var _ ParallelStatsSolverService = (*Argon2HashcashService)(nil)
+var _ ParallelStatsSolverService = (*StatelessHashcashService)(nil)
+var _ StatsSolverService = (*SHA256HashcashService)(nil)
+var _ StatsSolverService = (*Argon2HashcashService)(nil)
+
 func TestSHA256HashcashService_hasLeadingZeros(t *testing.T) {
 	service := NewSHA256HashcashService(2, 5*time.Minute)
+	defer service.Close()
 
 	tests := []struct {
 		name       string
@@ -243,6 +457,7 @@ func TestSHA256HashcashService_hasLeadingZeros(t *testing.T) {
 
 func BenchmarkSolveChallenge_Difficulty1(b *testing.B) {
 	service := NewSHA256HashcashService(1, 5*time.Minute)
+	defer service.Close()
 	challenge := "benchmark_challenge"
 	ctx := context.Background()
 
@@ -257,6 +472,7 @@ func BenchmarkSolveChallenge_Difficulty1(b *testing.B) {
 
 func BenchmarkSolveChallenge_Difficulty2(b *testing.B) {
 	service := NewSHA256HashcashService(2, 5*time.Minute)
+	defer service.Close()
 	challenge := "benchmark_challenge"
 	ctx := context.Background()
 
@@ -269,8 +485,52 @@ func BenchmarkSolveChallenge_Difficulty2(b *testing.B) {
 	}
 }
 
+func BenchmarkSolveChallenge_Difficulty3(b *testing.B) {
+	service := NewSHA256HashcashService(3, 5*time.Minute)
+	defer service.Close()
+	ctx := context.Background()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := service.SolveChallenge(ctx, fmt.Sprintf("benchmark_challenge_%d", i), 3)
+		if err != nil {
+			b.Fatalf("SolveChallenge failed: %v", err)
+		}
+	}
+}
+
+func BenchmarkSolveChallengeParallel_Difficulty2(b *testing.B) {
+	service := NewSHA256HashcashService(2, 5*time.Minute)
+	defer service.Close()
+	challenge := "benchmark_challenge"
+	ctx := context.Background()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := service.SolveChallengeParallel(ctx, challenge, 2, 0)
+		if err != nil {
+			b.Fatalf("SolveChallengeParallel failed: %v", err)
+		}
+	}
+}
+
+func BenchmarkSolveChallengeParallel_Difficulty3(b *testing.B) {
+	service := NewSHA256HashcashService(3, 5*time.Minute)
+	defer service.Close()
+	ctx := context.Background()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := service.SolveChallengeParallel(ctx, fmt.Sprintf("benchmark_challenge_%d", i), 3, 0)
+		if err != nil {
+			b.Fatalf("SolveChallengeParallel failed: %v", err)
+		}
+	}
+}
+
 func BenchmarkVerifyProof(b *testing.B) {
 	service := NewSHA256HashcashService(2, 5*time.Minute)
+	defer service.Close()
 	challenge := "benchmark_challenge"
 	ctx := context.Background()
 
@@ -283,12 +543,557 @@ func BenchmarkVerifyProof(b *testing.B) {
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		// Re-add challenge for each iteration
-		service.mu.Lock()
-		service.activeChallenges[challenge] = time.Now()
-		service.mu.Unlock()
+		service.store.backend.Put(challenge, ChallengeMeta{IssuedAt: time.Now(), Difficulty: 2}, time.Minute)
 		_, err := service.VerifyProof(challenge, nonce)
 		if err != nil {
 			b.Fatalf("VerifyProof failed: %v", err)
 		}
 	}
 }
+
+func TestGenerateChallenge_RandomBytes(t *testing.T) {
+	for _, size := range []int{8, 32, 64} {
+		t.Run(fmt.Sprintf("%dBytes", size), func(t *testing.T) {
+			service := NewSHA256HashcashServiceWithRandomBytes(1, 5*time.Minute, DefaultMaxActiveChallenges, size)
+			defer service.Close()
+
+			seen := make(map[string]bool)
+			for i := 0; i < 100; i++ {
+				challenge, err := service.GenerateChallenge()
+				if err != nil {
+					t.Fatalf("GenerateChallenge failed: %v", err)
+				}
+
+				_, random, err := ParseChallenge(challenge)
+				if err != nil {
+					t.Fatalf("Challenge should have format 'timestamp:randomhex', got %s: %v", challenge, err)
+				}
+				if len(random) != size {
+					t.Errorf("Expected %d random bytes, got %d", size, len(random))
+				}
+
+				if seen[challenge] {
+					t.Fatalf("Duplicate challenge: %s", challenge)
+				}
+				seen[challenge] = true
+			}
+
+			// Challenges of any size must still round-trip through verification
+			challenge, _ := service.GenerateChallenge()
+			nonce, err := service.SolveChallenge(context.Background(), challenge, 1)
+			if err != nil {
+				t.Fatalf("SolveChallenge failed: %v", err)
+			}
+			if valid, err := service.VerifyProof(challenge, nonce); err != nil || !valid {
+				t.Errorf("Expected valid proof, got valid=%v err=%v", valid, err)
+			}
+		})
+	}
+}
+
+func TestSHA256HashcashService_SolveChallengeWithStats(t *testing.T) {
+	service := NewSHA256HashcashService(1, 5*time.Minute)
+	defer service.Close()
+
+	const samples = 50
+	total := 0
+	for i := 0; i < samples; i++ {
+		challenge, err := service.GenerateChallenge()
+		if err != nil {
+			t.Fatalf("GenerateChallenge failed: %v", err)
+		}
+
+		nonce, attempts, err := service.SolveChallengeWithStats(context.Background(), challenge, 1)
+		if err != nil {
+			t.Fatalf("SolveChallengeWithStats failed: %v", err)
+		}
+		if attempts < 1 {
+			t.Fatalf("Expected at least one attempt, got %d", attempts)
+		}
+		if nonce != fmt.Sprint(attempts-1) {
+			t.Errorf("Expected attempts %d to count nonce %s", attempts, nonce)
+		}
+		total += attempts
+	}
+
+	// One zero byte takes 256 attempts on average; allow a wide margin
+	if mean := total / samples; mean < 64 || mean > 1024 {
+		t.Errorf("Mean attempts %d far from expected ~256 for difficulty 1", mean)
+	}
+}
+
+func TestSHA256HashcashService_InjectedClockAndRandomness(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	service := NewSHA256HashcashServiceWithRandomBytes(1, time.Minute, DefaultMaxActiveChallenges, 4)
+	defer service.Close()
+	service.SetClock(func() time.Time { return now })
+	service.SetRandSource(bytes.NewReader([]byte{0xde, 0xad, 0xbe, 0xef, 0x01, 0x02, 0x03, 0x04}))
+
+	challenge, err := service.GenerateChallenge()
+	if err != nil {
+		t.Fatalf("GenerateChallenge failed: %v", err)
+	}
+	if challenge != "1700000000:deadbeef" {
+		t.Errorf("Expected challenge %q, got %q", "1700000000:deadbeef", challenge)
+	}
+
+	second, err := service.GenerateChallenge()
+	if err != nil {
+		t.Fatalf("GenerateChallenge failed: %v", err)
+	}
+	if second != "1700000000:01020304" {
+		t.Errorf("Expected challenge %q, got %q", "1700000000:01020304", second)
+	}
+
+	// Expiry follows the injected clock, no sleeping needed
+	nonce, err := service.SolveChallenge(context.Background(), second, 1)
+	if err != nil {
+		t.Fatalf("SolveChallenge failed: %v", err)
+	}
+	now = now.Add(2 * time.Minute)
+	if valid, err := service.VerifyProof(second, nonce); err == nil || valid {
+		t.Errorf("Expected challenge to expire with the injected clock, got valid=%v err=%v", valid, err)
+	}
+
+	// An exhausted random source surfaces as an error
+	if _, err := service.GenerateChallenge(); err == nil {
+		t.Error("Expected error once the random source is exhausted")
+	}
+}
+
+func TestSHA256HashcashService_ChallengeCollision(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	service := NewSHA256HashcashServiceWithRandomBytes(1, time.Minute, DefaultMaxActiveChallenges, 4)
+	defer service.Close()
+	service.SetClock(func() time.Time { return now })
+	service.SetRandSource(bytes.NewReader([]byte{
+		0xde, 0xad, 0xbe, 0xef, // First challenge
+		0xde, 0xad, 0xbe, 0xef, 0x01, 0x02, 0x03, 0x04, // Collides once, then unique
+	}))
+
+	first, err := service.GenerateChallenge()
+	if err != nil {
+		t.Fatalf("GenerateChallenge failed: %v", err)
+	}
+	second, err := service.GenerateChallenge()
+	if err != nil {
+		t.Fatalf("Expected GenerateChallenge to retry past a collision, got: %v", err)
+	}
+	if second != "1700000000:01020304" {
+		t.Errorf("Expected the retried challenge %q, got %q", "1700000000:01020304", second)
+	}
+	if stats, _ := service.Stats(); stats.ActiveChallenges != 2 {
+		t.Errorf("Expected 2 active challenges, got %d", stats.ActiveChallenges)
+	}
+
+	// A source stuck on an active challenge gives up rather than overwriting it
+	service.SetRandSource(bytes.NewReader(bytes.Repeat([]byte{0xde, 0xad, 0xbe, 0xef}, maxChallengeAttempts)))
+	if _, err := service.GenerateChallenge(); !errors.Is(err, ErrChallengeCollision) {
+		t.Errorf("Expected ErrChallengeCollision, got: %v", err)
+	}
+	if stats, _ := service.Stats(); stats.ActiveChallenges != 2 {
+		t.Errorf("Expected 2 active challenges after giving up, got %d", stats.ActiveChallenges)
+	}
+
+	// The first challenge kept its place and is still verifiable once
+	nonce, err := service.SolveChallenge(context.Background(), first, 1)
+	if err != nil {
+		t.Fatalf("SolveChallenge failed: %v", err)
+	}
+	if valid, err := service.VerifyProof(first, nonce); err != nil || !valid {
+		t.Errorf("Expected the first challenge to verify, got valid=%v err=%v", valid, err)
+	}
+}
+
+func TestSHA256HashcashService_SetDifficultyConcurrently(t *testing.T) {
+	service := NewSHA256HashcashService(1, 5*time.Minute)
+	defer service.Close()
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+
+	// Flip the difficulty while challenges are issued and verified
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+				service.SetDifficulty(1 + i%2)
+			}
+		}
+	}()
+
+	var verifiers sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		verifiers.Add(1)
+		go func() {
+			defer verifiers.Done()
+			for i := 0; i < 20; i++ {
+				challenge, err := service.GenerateChallenge()
+				if err != nil {
+					t.Errorf("GenerateChallenge failed: %v", err)
+					return
+				}
+
+				// Solving at the highest difficulty in play satisfies whichever one was stored
+				nonce, err := service.SolveChallenge(context.Background(), challenge, 2)
+				if err != nil {
+					t.Errorf("SolveChallenge failed: %v", err)
+					return
+				}
+
+				valid, err := service.VerifyProof(challenge, nonce)
+				if err != nil {
+					t.Errorf("VerifyProof failed: %v", err)
+					return
+				}
+				if !valid {
+					t.Errorf("Proof for %s should be valid at its issued difficulty", challenge)
+				}
+			}
+		}()
+	}
+
+	verifiers.Wait()
+	close(stop)
+	wg.Wait()
+}
+
+func TestSHA256HashcashService_NonceSpaceExhausted(t *testing.T) {
+	service := NewSHA256HashcashService(0, 0)
+	service.maxNonce = 999
+	ctx := context.Background()
+
+	// No hash has more leading zero bytes than it is long, so every nonce fails
+	const impossible = sha256.Size + 1
+
+	_, attempts, err := service.SolveChallengeWithStats(ctx, "1700000000:feedface", impossible)
+	if !errors.Is(err, ErrNonceSpaceExhausted) {
+		t.Fatalf("Expected ErrNonceSpaceExhausted, got: %v", err)
+	}
+	if attempts != 1000 {
+		t.Errorf("Expected every nonce up to 999 tried once, got %d attempts", attempts)
+	}
+
+	for _, workers := range []int{1, 3, 2000} {
+		if _, err := service.SolveChallengeParallel(ctx, "1700000000:feedface", impossible, workers); !errors.Is(err, ErrNonceSpaceExhausted) {
+			t.Errorf("Expected ErrNonceSpaceExhausted with %d workers, got: %v", workers, err)
+		}
+	}
+
+	// The last nonce in the space is still tried
+	challenge := "1700000000:cafebabe"
+	nonce, _ := naiveSolve(challenge, 1)
+	last, _ := strconv.ParseUint(nonce, 10, 64)
+	service.maxNonce = last
+
+	if got, _, err := service.SolveChallengeWithStats(ctx, challenge, 1); err != nil || got != nonce {
+		t.Errorf("Expected nonce %s at the end of the space, got %q (err=%v)", nonce, got, err)
+	}
+	if got, err := service.SolveChallengeParallel(ctx, challenge, 1, 3); err != nil || got != nonce {
+		t.Errorf("Expected parallel nonce %s at the end of the space, got %q (err=%v)", nonce, got, err)
+	}
+}
+
+func TestSHA256HashcashService_MaxSolveAttempts(t *testing.T) {
+	service := NewSHA256HashcashService(0, 0)
+	service.SetMaxSolveAttempts(1000)
+	ctx := context.Background()
+
+	// Difficulty 8 would take ~2^64 attempts, so only the cap can end the search
+	start := time.Now()
+	_, attempts, err := service.SolveChallengeWithStats(ctx, "1700000000:feedface", 8)
+	if !errors.Is(err, ErrSolveAttemptsExceeded) {
+		t.Fatalf("Expected ErrSolveAttemptsExceeded, got: %v", err)
+	}
+	if attempts != 1000 {
+		t.Errorf("Expected exactly 1000 attempts, got %d", attempts)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the capped solve to return promptly, took %v", elapsed)
+	}
+
+	// Parallel workers share the cap and report the nonces they tried together
+	for _, workers := range []int{1, 3, 2000} {
+		_, attempts, err := service.SolveChallengeParallelWithStats(ctx, "1700000000:feedface", 8, workers)
+		if !errors.Is(err, ErrSolveAttemptsExceeded) {
+			t.Errorf("Expected ErrSolveAttemptsExceeded with %d workers, got: %v", workers, err)
+		}
+		if attempts != 1000 {
+			t.Errorf("Expected 1000 attempts across %d workers, got %d", workers, attempts)
+		}
+	}
+
+	// A solution within the cap is still found, even as the last allowed attempt
+	challenge := "1700000000:cafebabe"
+	nonce, _ := naiveSolve(challenge, 1)
+	last, _ := strconv.ParseUint(nonce, 10, 64)
+	service.SetMaxSolveAttempts(int(last) + 1)
+
+	if got, attempts, err := service.SolveChallengeWithStats(ctx, challenge, 1); err != nil || got != nonce || attempts != int(last)+1 {
+		t.Errorf("Expected nonce %s on the last attempt, got %q after %d attempts (err=%v)", nonce, got, attempts, err)
+	}
+	if got, err := service.SolveChallengeParallel(ctx, challenge, 1, 3); err != nil || got != nonce {
+		t.Errorf("Expected parallel nonce %s on the last attempt, got %q (err=%v)", nonce, got, err)
+	}
+
+	// Exhausting the nonce space first is still reported as such
+	service.maxNonce = 99
+	if _, _, err := service.SolveChallengeWithStats(ctx, "1700000000:feedface", 8); !errors.Is(err, ErrNonceSpaceExhausted) {
+		t.Errorf("Expected ErrNonceSpaceExhausted below the cap, got: %v", err)
+	}
+	service.maxNonce = 0
+
+	service.SetMaxSolveAttempts(0)
+	if got, err := service.SolveChallenge(ctx, challenge, 1); err != nil || got != nonce {
+		t.Errorf("Expected an uncapped solve to find %s, got %q (err=%v)", nonce, got, err)
+	}
+}
+
+func TestAttemptsThrough_Saturates(t *testing.T) {
+	if got := attemptsThrough(41); got != 42 {
+		t.Errorf("attemptsThrough(41) = %d, want 42", got)
+	}
+	if got := attemptsThrough(^uint64(0)); got != math.MaxInt {
+		t.Errorf("Expected attempts to saturate at math.MaxInt, got %d", got)
+	}
+}
+
+func TestSHA256HashcashService_Close(t *testing.T) {
+	service := NewSHA256HashcashService(1, 5*time.Minute)
+	backend := service.store.backend.(*InMemoryStore)
+
+	if err := service.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	select {
+	case <-backend.stopped:
+	default:
+		t.Error("Expected the cleanup goroutine to have exited")
+	}
+
+	// A store passed in belongs to the caller, who closes it
+	store := NewInMemoryStore(time.Minute)
+	defer store.Close()
+	withStore := NewSHA256HashcashServiceWithStore(1, 5*time.Minute, DefaultMaxActiveChallenges, 0, store)
+	if err := withStore.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	select {
+	case <-store.done:
+		t.Error("Expected a caller's store to be left open")
+	default:
+	}
+}
+
+func TestSHA256HashcashService_TTLJitter(t *testing.T) {
+	const ttl = 10 * time.Minute
+	now := time.Unix(1700000000, 0)
+
+	for _, percent := range []int{0, 20} {
+		t.Run(fmt.Sprintf("%dPercent", percent), func(t *testing.T) {
+			service := NewSHA256HashcashService(1, ttl)
+			defer service.Close()
+			service.SetClock(func() time.Time { return now })
+			service.SetTTLJitter(percent)
+
+			// A burst of challenges issued within the same instant
+			expiries := make(map[time.Time]bool)
+			earliest, latest := now.Add(ttl), now.Add(ttl)
+			for i := 0; i < 200; i++ {
+				challenge, err := service.GenerateChallenge()
+				if err != nil {
+					t.Fatalf("GenerateChallenge failed: %v", err)
+				}
+				expiresAt := service.store.backend.(*InMemoryStore).challenges[challenge].meta.ExpiresAt
+				expiries[expiresAt] = true
+				if expiresAt.Before(earliest) {
+					earliest = expiresAt
+				}
+				if expiresAt.After(latest) {
+					latest = expiresAt
+				}
+			}
+
+			maxOffset := ttl * time.Duration(percent) / 100
+			if earliest.Before(now.Add(ttl-maxOffset)) || latest.After(now.Add(ttl+maxOffset)) {
+				t.Errorf("Expiries %v..%v outside TTL ±%d%%", earliest.Sub(now), latest.Sub(now), percent)
+			}
+			if percent == 0 && len(expiries) != 1 {
+				t.Errorf("Expected identical expiries without jitter, got %d distinct", len(expiries))
+			}
+			// Uniform jitter over ±2 minutes leaves 200 samples spread across most of it
+			if percent > 0 && (len(expiries) < 150 || latest.Sub(earliest) < maxOffset) {
+				t.Errorf("Expected spread expiries, got %d distinct over %v", len(expiries), latest.Sub(earliest))
+			}
+		})
+	}
+}
+
+func TestSHA256HashcashService_PerChallengeExpiry(t *testing.T) {
+	difficulty := 1
+	now := time.Unix(1700000000, 0)
+	service := NewSHA256HashcashService(difficulty, time.Minute)
+	defer service.Close()
+	service.SetClock(func() time.Time { return now })
+
+	nonce, err := service.SolveChallenge(context.Background(), "1700000000:0badf00d", difficulty)
+	if err != nil {
+		t.Fatalf("SolveChallenge failed: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		expiresAt time.Time
+		wantValid bool
+	}{
+		{"ShortenedExpiryPassed", now.Add(40 * time.Second), false},
+		{"LengthenedExpiryPending", now.Add(80 * time.Second), true},
+		{"NoExpiryFallsBackToTTL", time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meta := ChallengeMeta{IssuedAt: now, Difficulty: difficulty, ExpiresAt: tt.expiresAt}
+			service.store.backend.Put("1700000000:0badf00d", meta, time.Hour)
+
+			// Past the shortened expiry but within the TTL and the lengthened expiry
+			service.SetClock(func() time.Time { return now.Add(50 * time.Second) })
+			defer service.SetClock(func() time.Time { return now })
+
+			valid, err := service.VerifyProof("1700000000:0badf00d", nonce)
+			if valid != tt.wantValid {
+				t.Errorf("Expected valid=%v, got valid=%v err=%v", tt.wantValid, valid, err)
+			}
+		})
+	}
+}
+
+func TestSHA256HashcashService_ZeroDifficulty(t *testing.T) {
+	service := NewSHA256HashcashService(0, time.Minute)
+	defer service.Close()
+
+	// Any nonce solves a difficulty-0 challenge, so it is refused unless allowed
+	for _, difficulty := range []int{0, -1} {
+		if _, err := service.GenerateChallengeWithDifficulty(difficulty); !errors.Is(err, ErrZeroDifficulty) {
+			t.Errorf("Expected ErrZeroDifficulty at difficulty %d, got: %v", difficulty, err)
+		}
+	}
+	if _, err := service.GenerateChallenge(); !errors.Is(err, ErrZeroDifficulty) {
+		t.Errorf("Expected ErrZeroDifficulty from GenerateChallenge, got: %v", err)
+	}
+	if stats, _ := service.Stats(); stats.ActiveChallenges != 0 {
+		t.Errorf("Expected refused challenges not to be stored, got %d active", stats.ActiveChallenges)
+	}
+
+	service.SetAllowZeroDifficulty(true)
+	challenge, err := service.GenerateChallenge()
+	if err != nil {
+		t.Fatalf("GenerateChallenge failed with zero difficulty allowed: %v", err)
+	}
+	valid, err := service.VerifyProof(challenge, "0")
+	if err != nil || !valid {
+		t.Errorf("Expected any nonce to solve a difficulty-0 challenge, got valid=%v err=%v", valid, err)
+	}
+}
+
+func TestSHA256HashcashService_SolverOnly(t *testing.T) {
+	// Clients solve with a zero-difficulty service, taking the difficulty from the challenge
+	server := NewSHA256HashcashService(1, time.Minute)
+	defer server.Close()
+	solver := NewSHA256HashcashService(0, 0)
+	defer solver.Close()
+
+	challenge, err := server.GenerateChallenge()
+	if err != nil {
+		t.Fatalf("GenerateChallenge failed: %v", err)
+	}
+	nonce, err := solver.SolveChallenge(context.Background(), challenge, 1)
+	if err != nil {
+		t.Fatalf("SolveChallenge failed: %v", err)
+	}
+	if valid, err := server.VerifyProof(challenge, nonce); err != nil || !valid {
+		t.Errorf("Expected the solver's nonce to verify, got valid=%v err=%v", valid, err)
+	}
+}
+
+func TestChallengeData(t *testing.T) {
+	tests := []struct {
+		namespace, challenge, binding, want string
+	}{
+		{"", "1700000000:ab", "", "1700000000:ab"},
+		{"", "1700000000:ab", "192.0.2.1", "1700000000:ab192.0.2.1"},
+		{"A", "1700000000:ab", "", "A:1700000000:ab"},
+		{"A", "1700000000:ab", "192.0.2.1", "A:1700000000:ab192.0.2.1"},
+	}
+	for _, tt := range tests {
+		if got := ChallengeData(tt.namespace, tt.challenge, tt.binding); got != tt.want {
+			t.Errorf("ChallengeData(%q, %q, %q) = %q, want %q", tt.namespace, tt.challenge, tt.binding, got, tt.want)
+		}
+	}
+}
+
+func TestSHA256HashcashService_Namespace(t *testing.T) {
+	const difficulty = 1
+	store := NewInMemoryStore(0) // Shared, as by tenants of one process
+	defer store.Close()
+	tenantA := NewSHA256HashcashServiceWithStore(difficulty, time.Minute, 0, 0, store)
+	tenantA.SetNamespace("A")
+	tenantB := NewSHA256HashcashServiceWithStore(difficulty, time.Minute, 0, 0, store)
+	tenantB.SetNamespace("B")
+
+	if tenantA.Namespace() != "A" {
+		t.Errorf("Expected namespace A, got %q", tenantA.Namespace())
+	}
+
+	// A proof solved for namespace A verifies under A
+	challenge, err := tenantA.GenerateChallenge()
+	if err != nil {
+		t.Fatalf("GenerateChallenge failed: %v", err)
+	}
+	nonce, err := tenantA.SolveChallenge(context.Background(), ChallengeData("A", challenge, ""), difficulty)
+	if err != nil {
+		t.Fatalf("SolveChallenge failed: %v", err)
+	}
+	if valid, err := tenantA.VerifyProof(challenge, nonce); err != nil || !valid {
+		t.Errorf("Expected the proof to verify in its namespace, got valid=%v err=%v", valid, err)
+	}
+
+	// The same kind of proof fails under B
+	challenge, err = tenantA.GenerateChallenge()
+	if err != nil {
+		t.Fatalf("GenerateChallenge failed: %v", err)
+	}
+	nonce, err = tenantA.SolveChallenge(context.Background(), ChallengeData("A", challenge, ""), difficulty)
+	if err != nil {
+		t.Fatalf("SolveChallenge failed: %v", err)
+	}
+	if valid, err := tenantB.VerifyProof(challenge, nonce); err == nil || valid {
+		t.Errorf("Expected an error under another namespace, got valid=%v err=%v", valid, err)
+	}
+
+	// ...and leaves the challenge to A, so another tenant can't destroy it
+	if valid, err := tenantA.VerifyProof(challenge, nonce); err != nil || !valid {
+		t.Errorf("Expected the proof to still verify in its namespace, got valid=%v err=%v", valid, err)
+	}
+
+	// A proof that ignores the namespace doesn't verify either
+	challenge, err = tenantA.GenerateChallenge()
+	if err != nil {
+		t.Fatalf("GenerateChallenge failed: %v", err)
+	}
+	var bare string
+	for i := 0; ; i++ {
+		nonce := strconv.Itoa(i)
+		if Verify(challenge, nonce, difficulty, SHA256Hasher{}) && !Verify(ChallengeData("A", challenge, ""), nonce, difficulty, SHA256Hasher{}) {
+			bare = nonce
+			break
+		}
+	}
+	if valid, err := tenantA.VerifyProof(challenge, bare); err != nil || valid {
+		t.Errorf("Expected a proof without the namespace to be invalid, got valid=%v err=%v", valid, err)
+	}
+}
@@ -0,0 +1,56 @@
+package pow
+
+import (
+	"context"
+	"strconv"
+)
+
+// Solve finds a nonce for which hasher's hash of challenge + nonce meets difficulty
+// and reports how many nonces were tried, including the winning one. It's the search
+// behind the services' SolveChallengeWithStats without any of their state, trying
+// every nonce from 0 up to math.MaxUint64. For a namespaced or bound challenge pass
+// ChallengeData. It reports progress if ctx carries it, see WithProgress.
+func Solve(ctx context.Context, challenge string, difficulty int, hasher Hasher) (string, int, error) {
+	last, exhausted := solveLimit(0, 0)
+	return solveWithin(ctx, challenge, difficulty, hasher, last, exhausted)
+}
+
+// solveWithin is Solve giving up after nonce last, with exhausted as the error
+func solveWithin(ctx context.Context, challenge string, difficulty int, hasher Hasher, last uint64, exhausted error) (string, int, error) {
+	return searchNonces(ctx, last, exhausted, progressFrom(ctx).wrap(nonceChecker(challenge, difficulty, hasher)))
+}
+
+// nonceChecker returns a function reporting whether a nonce solves challenge at
+// difficulty. SHA-256 hashes reuse the midstate of the challenge.
+func nonceChecker(challenge string, difficulty int, hasher Hasher) func(nonce uint64) bool {
+	if _, ok := hasher.(SHA256Hasher); ok {
+		prefix := newPrefixHasher(challenge)
+		return func(nonce uint64) bool {
+			return hasher.MeetsDifficulty(prefix.hashNonce(nonce), difficulty)
+		}
+	}
+	return func(nonce uint64) bool {
+		return hasher.MeetsDifficulty(hasher.Hash(challenge, strconv.FormatUint(nonce, 10)), difficulty)
+	}
+}
+
+// searchNonces tries nonces from 0 up to last until solves accepts one, returning
+// exhausted if none does
+func searchNonces(ctx context.Context, last uint64, exhausted error, solves func(nonce uint64) bool) (string, int, error) {
+	var nonce uint64
+	for {
+		select {
+		case <-ctx.Done():
+			return "", attemptsThrough(nonce) - 1, ctx.Err()
+		default:
+			if solves(nonce) {
+				return strconv.FormatUint(nonce, 10), attemptsThrough(nonce), nil
+			}
+			if nonce == last {
+				return "", attemptsThrough(nonce), exhausted
+			}
+
+			nonce++
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package pow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestSolve_MatchesServices(t *testing.T) {
+	sha256Service := NewSHA256HashcashService(0, 0)
+	defer sha256Service.Close()
+	argon2Service := NewArgon2HashcashService(0, 0, testArgon2Params)
+	defer argon2Service.Close()
+
+	tests := []struct {
+		name       string
+		service    StatsSolverService
+		hasher     Hasher
+		difficulty int
+	}{
+		{"SHA256 difficulty 0", sha256Service, SHA256Hasher{}, 0},
+		{"SHA256 difficulty 1", sha256Service, SHA256Hasher{}, 1},
+		{"SHA256 difficulty 2", sha256Service, SHA256Hasher{}, 2},
+		{"Argon2id 4 bits", argon2Service, argon2Service.Hasher(), 4},
+		{"Argon2id 6 bits", argon2Service, argon2Service.Hasher(), 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 3; i++ {
+				challenge := fmt.Sprintf("1700000000:parity%d", i)
+				wantNonce, wantAttempts, err := tt.service.SolveChallengeWithStats(context.Background(), challenge, tt.difficulty)
+				if err != nil {
+					t.Fatalf("SolveChallengeWithStats failed: %v", err)
+				}
+
+				nonce, attempts, err := Solve(context.Background(), challenge, tt.difficulty, tt.hasher)
+				if err != nil {
+					t.Fatalf("Solve failed: %v", err)
+				}
+				if nonce != wantNonce || attempts != wantAttempts {
+					t.Errorf("Solve(%q) = %s after %d attempts, the service found %s after %d", challenge, nonce, attempts, wantNonce, wantAttempts)
+				}
+				if !Verify(challenge, nonce, tt.difficulty, tt.hasher) {
+					t.Errorf("Expected nonce %s to verify", nonce)
+				}
+			}
+		})
+	}
+}
+
+func TestSolve_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// 33 zero bytes is unreachable, so only the context ends the search
+	_, attempts, err := Solve(ctx, "1700000000:feedface", 33, SHA256Hasher{})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got: %v", err)
+	}
+	if attempts != 0 {
+		t.Errorf("Expected no attempts once cancelled, got %d", attempts)
+	}
+}
+
+func BenchmarkSolve_SHA256_Difficulty2(b *testing.B) {
+	ctx := context.Background()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _, err := Solve(ctx, fmt.Sprintf("benchmark_challenge_%d", i), 2, SHA256Hasher{})
+		if err != nil {
+			b.Fatalf("Solve failed: %v", err)
+		}
+	}
+}
+
+// BenchmarkSolve_Argon2id_8Bits is directly comparable to BenchmarkSolveChallenge_Argon2_8Bits
+func BenchmarkSolve_Argon2id_8Bits(b *testing.B) {
+	hasher := Argon2idHasher{Params: DefaultArgon2Params()}
+	ctx := context.Background()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _, err := Solve(ctx, "benchmark_challenge", 8, hasher)
+		if err != nil {
+			b.Fatalf("Solve failed: %v", err)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package pow
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// MinStatelessSecretSize is the minimum HMAC secret size in bytes
+	MinStatelessSecretSize = 16
+	// statelessClockSkew tolerates challenges issued by servers whose clocks run slightly ahead
+	statelessClockSkew = 5 * time.Second
+)
+
+// StatelessHashcashService implements SHA256 Hashcash without storing issued challenges.
+// Each challenge has the format {timestamp}:{random_hex}:{difficulty}:{mac}, where mac is
+// an HMAC-SHA256 over the other fields keyed with a server secret. VerifyProof checks
+// authenticity and freshness from the challenge itself, so any server sharing the secret
+// can verify it. Replays are rejected by a bounded cache of used challenges that only
+// holds them until they expire.
+type StatelessHashcashService struct {
+	difficulty   int32 // Accessed atomically, may change at runtime
+	secret       []byte
+	challengeTTL time.Duration
+	randomBytes  int
+	solver       *SHA256HashcashService // Proofs are solved exactly like SHA256 Hashcash
+	seen         *seenCache             // Used challenges for replay attack prevention
+	allowZero    bool                   // Issue challenges below difficulty 1, i.e. disable proof of work
+	namespace    string                 // Signed into and hashed before every challenge
+}
+
+// NewStatelessHashcashService creates a new stateless PoW service.
+// A non-positive randomBytes uses ChallengeRandomBytesSize, and a non-positive
+// seenCapacity uses DefaultSeenCacheCapacity.
+func NewStatelessHashcashService(secret []byte, difficulty int, challengeTTL time.Duration, randomBytes int, seenCapacity int) (*StatelessHashcashService, error) {
+	if len(secret) < MinStatelessSecretSize {
+		return nil, fmt.Errorf("secret must be at least %d bytes, got: %d", MinStatelessSecretSize, len(secret))
+	}
+	if randomBytes <= 0 {
+		randomBytes = ChallengeRandomBytesSize
+	}
+
+	s := &StatelessHashcashService{
+		secret:       append([]byte(nil), secret...),
+		challengeTTL: challengeTTL,
+		randomBytes:  randomBytes,
+		solver:       NewSHA256HashcashService(0, 0), // Solver only, never generates challenges
+		seen:         newSeenCache(seenCapacity),
+	}
+	s.SetDifficulty(difficulty)
+
+	return s, nil
+}
+
+// SetAllowZeroDifficulty lets the service issue challenges below difficulty 1, for
+// deployments that disable proof of work on purpose. Without it such challenges fail
+// with ErrZeroDifficulty. It must be called before the service is used.
+func (s *StatelessHashcashService) SetAllowZeroDifficulty(allow bool) {
+	s.allowZero = allow
+}
+
+// SetNamespace makes the service hash namespace before every challenge it issues and
+// sign it into the challenge, so services with the same secret but another namespace
+// reject it. It must be called before the service is used.
+func (s *StatelessHashcashService) SetNamespace(namespace string) {
+	s.namespace = namespace
+}
+
+// Namespace returns the namespace set with SetNamespace, empty by default
+func (s *StatelessHashcashService) Namespace() string {
+	return s.namespace
+}
+
+// GenerateChallenge generates a new signed challenge
+func (s *StatelessHashcashService) GenerateChallenge() (string, error) {
+	return s.GenerateChallengeWithDifficulty(s.GetDifficulty())
+}
+
+// GenerateChallengeWithDifficulty generates a new signed challenge to be solved
+// at difficulty rather than the service's current one
+func (s *StatelessHashcashService) GenerateChallengeWithDifficulty(difficulty int) (string, error) {
+	if err := checkDifficulty(difficulty, s.allowZero); err != nil {
+		return "", err
+	}
+
+	randomBytes := make([]byte, s.randomBytes)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", fmt.Errorf("failed to generate random bytes: %w", err)
+	}
+
+	payload := fmt.Sprintf("%d:%s:%d", time.Now().Unix(), hex.EncodeToString(randomBytes), difficulty)
+	return payload + ":" + s.sign(payload), nil
+}
+
+// VerifyProof verifies the challenge signature and freshness, then that the nonce solves it
+func (s *StatelessHashcashService) VerifyProof(challenge, nonce string) (bool, error) {
+	return s.VerifyProofCtx(context.Background(), challenge, nonce)
+}
+
+// VerifyProofCtx is VerifyProof that gives up if ctx is done.
+// The challenge is marked used either way, so a canceled verification can't be retried.
+func (s *StatelessHashcashService) VerifyProofCtx(ctx context.Context, challenge, nonce string) (bool, error) {
+	return s.VerifyBoundProof(ctx, challenge, "", nonce)
+}
+
+// VerifyBoundProof is VerifyProofCtx for a challenge bound to binding
+func (s *StatelessHashcashService) VerifyBoundProof(ctx context.Context, challenge, binding, nonce string) (bool, error) {
+	issuedAt, difficulty, err := s.parse(challenge)
+	if err != nil {
+		return false, err
+	}
+
+	age := time.Since(issuedAt)
+	if age > s.challengeTTL {
+		return false, fmt.Errorf("challenge expired")
+	}
+	if age < -statelessClockSkew {
+		return false, fmt.Errorf("challenge issued in the future")
+	}
+
+	// Mark challenge as used to prevent replay attacks, even if the proof turns out invalid
+	if !s.markSeen(challenge, issuedAt.Add(s.challengeTTL)) {
+		return false, fmt.Errorf("challenge not found or already used")
+	}
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	return Verify(ChallengeData(s.namespace, challenge, binding), nonce, difficulty, SHA256Hasher{}), nil
+}
+
+// InvalidateChallenge prevents a challenge from being used.
+// Nothing is stored per issued challenge, so this only matters for well-formed ones.
+func (s *StatelessHashcashService) InvalidateChallenge(challenge string) {
+	issuedAt, _, err := s.parse(challenge)
+	if err != nil {
+		return
+	}
+	s.markSeen(challenge, issuedAt.Add(s.challengeTTL))
+}
+
+// SetMaxSolveAttempts caps the nonces tried per solve, see SHA256HashcashService.SetMaxSolveAttempts
+func (s *StatelessHashcashService) SetMaxSolveAttempts(attempts int) {
+	s.solver.SetMaxSolveAttempts(attempts)
+}
+
+// SolveChallenge finds a nonce that solves the challenge
+func (s *StatelessHashcashService) SolveChallenge(ctx context.Context, challenge string, difficulty int) (string, error) {
+	return s.solver.SolveChallenge(ctx, challenge, difficulty)
+}
+
+// SolveChallengeWithStats finds a nonce that solves the challenge and reports how many nonces were tried
+func (s *StatelessHashcashService) SolveChallengeWithStats(ctx context.Context, challenge string, difficulty int) (string, int, error) {
+	return s.solver.SolveChallengeWithStats(ctx, challenge, difficulty)
+}
+
+// SolveChallengeParallel finds a nonce that solves the challenge using multiple workers.
+// A non-positive worker count uses one worker per CPU.
+func (s *StatelessHashcashService) SolveChallengeParallel(ctx context.Context, challenge string, difficulty int, workers int) (string, error) {
+	return s.solver.SolveChallengeParallel(ctx, challenge, difficulty, workers)
+}
+
+// SolveChallengeParallelWithStats is SolveChallengeParallel also reporting how many
+// nonces all workers tried
+func (s *StatelessHashcashService) SolveChallengeParallelWithStats(ctx context.Context, challenge string, difficulty int, workers int) (string, int, error) {
+	return s.solver.SolveChallengeParallelWithStats(ctx, challenge, difficulty, workers)
+}
+
+// GetDifficulty returns the current difficulty level
+func (s *StatelessHashcashService) GetDifficulty() int {
+	return int(atomic.LoadInt32(&s.difficulty))
+}
+
+// SetDifficulty changes the difficulty for newly generated challenges.
+// Challenges already issued keep the difficulty signed into them.
+func (s *StatelessHashcashService) SetDifficulty(difficulty int) {
+	atomic.StoreInt32(&s.difficulty, int32(difficulty))
+}
+
+// sign returns the hex HMAC-SHA256 of payload, under the namespace if any
+func (s *StatelessHashcashService) sign(payload string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	if s.namespace != "" {
+		mac.Write([]byte(s.namespace + ":"))
+	}
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// parse authenticates a challenge and extracts its issue time and difficulty
+func (s *StatelessHashcashService) parse(challenge string) (time.Time, int, error) {
+	sep := strings.LastIndex(challenge, ":")
+	if sep < 0 {
+		return time.Time{}, 0, fmt.Errorf("%w: no signature", ErrMalformedChallenge)
+	}
+	payload, mac := challenge[:sep], challenge[sep+1:]
+
+	// Check the signature before trusting any field
+	if !hmac.Equal([]byte(mac), []byte(s.sign(payload))) {
+		return time.Time{}, 0, fmt.Errorf("invalid challenge signature")
+	}
+
+	parts := strings.Split(payload, ":")
+	if len(parts) != 3 {
+		return time.Time{}, 0, fmt.Errorf("%w: expected timestamp:randomhex:difficulty:mac", ErrMalformedChallenge)
+	}
+
+	issuedAt, _, err := parseChallengeParts(parts[0], parts[1])
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	difficulty, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("%w: difficulty %q is not a number", ErrMalformedChallenge, parts[2])
+	}
+
+	return issuedAt, difficulty, nil
+}
+
+// markSeen records a challenge until expiry, reporting false if it was already seen
+func (s *StatelessHashcashService) markSeen(challenge string, expiry time.Time) bool {
+	return s.seen.add(challenge, expiry)
+}
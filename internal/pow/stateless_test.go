@@ -0,0 +1,289 @@
+package pow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testSecret = []byte("0123456789abcdef0123456789abcdef")
+
+var _ Service = (*StatelessHashcashService)(nil)
+var _ ParallelSolverService = (*StatelessHashcashService)(nil)
+var _ StatsSolverService = (*StatelessHashcashService)(nil)
+
+func newTestStatelessService(t *testing.T, difficulty int) *StatelessHashcashService {
+	t.Helper()
+
+	service, err := NewStatelessHashcashService(testSecret, difficulty, 5*time.Minute, 0, 0)
+	if err != nil {
+		t.Fatalf("NewStatelessHashcashService failed: %v", err)
+	}
+	return service
+}
+
+func TestNewStatelessHashcashService_ShortSecret(t *testing.T) {
+	if _, err := NewStatelessHashcashService([]byte("short"), 1, time.Minute, 0, 0); err == nil {
+		t.Error("Expected error for short secret")
+	}
+}
+
+func TestStatelessHashcashService_VerifyProof(t *testing.T) {
+	difficulty := 1
+	service := newTestStatelessService(t, difficulty)
+
+	challenge, err := service.GenerateChallenge()
+	if err != nil {
+		t.Fatalf("GenerateChallenge failed: %v", err)
+	}
+
+	if parts := strings.Split(challenge, ":"); len(parts) != 4 {
+		t.Fatalf("Challenge should have format 'timestamp:randomhex:difficulty:mac', got: %s", challenge)
+	}
+
+	nonce, err := service.SolveChallenge(context.Background(), challenge, difficulty)
+	if err != nil {
+		t.Fatalf("SolveChallenge failed: %v", err)
+	}
+
+	valid, err := service.VerifyProof(challenge, nonce)
+	if err != nil {
+		t.Fatalf("VerifyProof failed: %v", err)
+	}
+	if !valid {
+		t.Error("Proof should be valid")
+	}
+
+	// Replaying the same proof must fail
+	if _, err := service.VerifyProof(challenge, nonce); err == nil {
+		t.Error("Replayed proof should be rejected")
+	}
+}
+
+func TestStatelessHashcashService_GenerateChallengeWithDifficulty(t *testing.T) {
+	service := newTestStatelessService(t, 1)
+
+	challenge, err := service.GenerateChallengeWithDifficulty(2)
+	if err != nil {
+		t.Fatalf("GenerateChallengeWithDifficulty failed: %v", err)
+	}
+	if parts := strings.Split(challenge, ":"); parts[2] != "2" {
+		t.Fatalf("Expected difficulty 2 signed into the challenge, got: %s", challenge)
+	}
+
+	nonce, err := service.SolveChallenge(context.Background(), challenge, 2)
+	if err != nil {
+		t.Fatalf("SolveChallenge failed: %v", err)
+	}
+	valid, err := service.VerifyProof(challenge, nonce)
+	if err != nil || !valid {
+		t.Errorf("Proof at the signed difficulty should be valid: %v", err)
+	}
+}
+
+func TestStatelessHashcashService_ZeroDifficulty(t *testing.T) {
+	service := newTestStatelessService(t, 0)
+
+	if _, err := service.GenerateChallenge(); !errors.Is(err, ErrZeroDifficulty) {
+		t.Errorf("Expected ErrZeroDifficulty, got: %v", err)
+	}
+
+	service.SetAllowZeroDifficulty(true)
+	challenge, err := service.GenerateChallenge()
+	if err != nil {
+		t.Fatalf("GenerateChallenge failed with zero difficulty allowed: %v", err)
+	}
+	if valid, err := service.VerifyProof(challenge, "0"); err != nil || !valid {
+		t.Errorf("Expected any nonce to solve a difficulty-0 challenge, got valid=%v err=%v", valid, err)
+	}
+}
+
+func TestStatelessHashcashService_Namespace(t *testing.T) {
+	tenantA := newTestStatelessService(t, 1)
+	tenantA.SetNamespace("A")
+	tenantB := newTestStatelessService(t, 1) // Same secret
+	tenantB.SetNamespace("B")
+
+	for _, verifier := range []*StatelessHashcashService{tenantA, tenantB} {
+		challenge, err := tenantA.GenerateChallenge()
+		if err != nil {
+			t.Fatalf("GenerateChallenge failed: %v", err)
+		}
+		nonce, err := tenantA.SolveChallenge(context.Background(), ChallengeData("A", challenge, ""), 1)
+		if err != nil {
+			t.Fatalf("SolveChallenge failed: %v", err)
+		}
+
+		valid, err := verifier.VerifyProof(challenge, nonce)
+		if verifier == tenantA && (err != nil || !valid) {
+			t.Errorf("Expected the proof to verify in its namespace, got valid=%v err=%v", valid, err)
+		}
+		if verifier == tenantB && (err == nil || valid) {
+			t.Errorf("Expected the proof solved for A to fail under B, got valid=%v err=%v", valid, err)
+		}
+	}
+}
+
+func TestStatelessHashcashService_SharedSecret(t *testing.T) {
+	difficulty := 1
+	issuer := newTestStatelessService(t, difficulty)
+	verifier := newTestStatelessService(t, difficulty)
+
+	challenge, err := issuer.GenerateChallenge()
+	if err != nil {
+		t.Fatalf("GenerateChallenge failed: %v", err)
+	}
+
+	nonce, err := issuer.SolveChallenge(context.Background(), challenge, difficulty)
+	if err != nil {
+		t.Fatalf("SolveChallenge failed: %v", err)
+	}
+
+	// Another instance with the same secret verifies without shared state
+	if valid, err := verifier.VerifyProof(challenge, nonce); err != nil || !valid {
+		t.Errorf("Expected valid proof on second instance, got valid=%v err=%v", valid, err)
+	}
+
+	other, err := NewStatelessHashcashService([]byte("another-secret-of-enough-length"), difficulty, 5*time.Minute, 0, 0)
+	if err != nil {
+		t.Fatalf("NewStatelessHashcashService failed: %v", err)
+	}
+	if _, err := other.VerifyProof(challenge, nonce); err == nil {
+		t.Error("Challenge signed with a different secret should be rejected")
+	}
+}
+
+func TestStatelessHashcashService_VerifyBoundProof(t *testing.T) {
+	difficulty := 2
+	issuer := newTestStatelessService(t, difficulty)
+	verifier := newTestStatelessService(t, difficulty)
+
+	// A proof bound to IP A verifies on any instance, but only for IP A
+	solveBound := func(binding string) (string, string) {
+		challenge, err := issuer.GenerateChallenge()
+		if err != nil {
+			t.Fatalf("GenerateChallenge failed: %v", err)
+		}
+		nonce, err := issuer.SolveChallenge(context.Background(), challenge+binding, difficulty)
+		if err != nil {
+			t.Fatalf("SolveChallenge failed: %v", err)
+		}
+		return challenge, nonce
+	}
+
+	challenge, nonce := solveBound("192.0.2.1")
+	if valid, err := verifier.VerifyBoundProof(context.Background(), challenge, "192.0.2.1", nonce); err != nil || !valid {
+		t.Errorf("Expected valid proof from the bound IP, got valid=%v err=%v", valid, err)
+	}
+
+	challenge, nonce = solveBound("192.0.2.1")
+	valid, err := verifier.VerifyBoundProof(context.Background(), challenge, "198.51.100.7", nonce)
+	if err != nil {
+		t.Fatalf("VerifyBoundProof failed: %v", err)
+	}
+	if valid {
+		t.Error("Proof bound to one IP should be invalid from another")
+	}
+}
+
+func TestStatelessHashcashService_Expired(t *testing.T) {
+	service := newTestStatelessService(t, 1)
+
+	// Sign a challenge issued well before the TTL window
+	payload := fmt.Sprintf("%d:%s:%d", time.Now().Add(-10*time.Minute).Unix(), "00112233445566778899aabbccddeeff", 1)
+	challenge := payload + ":" + service.sign(payload)
+
+	nonce, err := service.SolveChallenge(context.Background(), challenge, 1)
+	if err != nil {
+		t.Fatalf("SolveChallenge failed: %v", err)
+	}
+
+	if _, err := service.VerifyProof(challenge, nonce); err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Errorf("Expected expired error, got: %v", err)
+	}
+}
+
+func TestStatelessHashcashService_Tampered(t *testing.T) {
+	service := newTestStatelessService(t, 2)
+
+	challenge, err := service.GenerateChallenge()
+	if err != nil {
+		t.Fatalf("GenerateChallenge failed: %v", err)
+	}
+	parts := strings.Split(challenge, ":")
+
+	tests := []struct {
+		name      string
+		challenge string
+	}{
+		{"LoweredDifficulty", strings.Join([]string{parts[0], parts[1], "0", parts[3]}, ":")},
+		{"ChangedTimestamp", strings.Join([]string{"9999999999", parts[1], parts[2], parts[3]}, ":")},
+		{"ChangedRandomness", strings.Join([]string{parts[0], strings.Repeat("0", len(parts[1])), parts[2], parts[3]}, ":")},
+		{"ForgedMAC", strings.Join([]string{parts[0], parts[1], parts[2], strings.Repeat("0", len(parts[3]))}, ":")},
+		{"Malformed", "not-a-challenge"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			valid, err := service.VerifyProof(tt.challenge, "0")
+			if err == nil || valid {
+				t.Errorf("Tampered challenge should be rejected, got valid=%v err=%v", valid, err)
+			}
+		})
+	}
+}
+
+func TestStatelessHashcashService_InvalidateChallenge(t *testing.T) {
+	difficulty := 1
+	service := newTestStatelessService(t, difficulty)
+
+	challenge, err := service.GenerateChallenge()
+	if err != nil {
+		t.Fatalf("GenerateChallenge failed: %v", err)
+	}
+
+	nonce, err := service.SolveChallenge(context.Background(), challenge, difficulty)
+	if err != nil {
+		t.Fatalf("SolveChallenge failed: %v", err)
+	}
+
+	service.InvalidateChallenge(challenge)
+
+	if _, err := service.VerifyProof(challenge, nonce); err == nil {
+		t.Error("Invalidated challenge should be rejected")
+	}
+}
+
+func TestStatelessHashcashService_ReplayWithinWindow(t *testing.T) {
+	difficulty := 1
+	service := newTestStatelessService(t, difficulty)
+
+	solve := func() (string, string) {
+		challenge, err := service.GenerateChallenge()
+		if err != nil {
+			t.Fatalf("GenerateChallenge failed: %v", err)
+		}
+		nonce, err := service.SolveChallenge(context.Background(), challenge, difficulty)
+		if err != nil {
+			t.Fatalf("SolveChallenge failed: %v", err)
+		}
+		return challenge, nonce
+	}
+
+	challenge, nonce := solve()
+	if valid, err := service.VerifyProof(challenge, nonce); err != nil || !valid {
+		t.Fatalf("First verification should succeed, got valid=%v err=%v", valid, err)
+	}
+
+	if valid, err := service.VerifyProof(challenge, nonce); err == nil || valid {
+		t.Errorf("Replay should be rejected, got valid=%v err=%v", valid, err)
+	}
+
+	otherChallenge, otherNonce := solve()
+	if valid, err := service.VerifyProof(otherChallenge, otherNonce); err != nil || !valid {
+		t.Errorf("Different challenge should still succeed, got valid=%v err=%v", valid, err)
+	}
+}
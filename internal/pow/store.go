@@ -0,0 +1,284 @@
+package pow
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	mrand "math/rand"
+	"sync"
+	"time"
+)
+
+// ErrTooManyChallenges is returned by GenerateChallenge when the active challenge limit is reached
+var ErrTooManyChallenges = errors.New("maximum active challenges limit reached")
+
+// ErrNamespaceMismatch is returned when verifying a challenge issued under another namespace
+var ErrNamespaceMismatch = errors.New("challenge issued for another namespace")
+
+// ErrChallengeCollision is returned by GenerateChallenge when every attempt produced a
+// challenge that is still active, which points at a broken source of randomness
+var ErrChallengeCollision = errors.New("could not generate a unique challenge")
+
+// maxChallengeAttempts bounds how often generate draws new random bytes after a collision
+const maxChallengeAttempts = 3
+
+// ErrZeroDifficulty is returned by GenerateChallenge for a difficulty below 1, which any
+// nonce solves, unless proof of work was deliberately disabled with SetAllowZeroDifficulty
+var ErrZeroDifficulty = errors.New("difficulty below 1 disables proof of work")
+
+// challengeStore issues challenges and tracks them for replay attack prevention.
+// It is shared by all PoW algorithms, which differ only in how proofs are hashed.
+// Issued challenges are kept in a ChallengeStore backend, in memory by default.
+type challengeStore struct {
+	challengeTTL        time.Duration
+	maxActiveChallenges int
+	randomBytes         int              // Size of the random part of each challenge
+	random              io.Reader        // Source of the random part, overridable for tests
+	now                 func() time.Time // Overridable for tests
+	backend             ChallengeStore   // Where issued challenges live until verified or expired
+	ownsBackend         bool             // backend was created here, so close closes it
+	ttlJitter           float64          // Fraction of challengeTTL by which each challenge's TTL may randomly differ
+	allowZeroDifficulty bool             // Issue challenges below difficulty 1, i.e. disable proof of work
+	namespace           string           // Hashed before every challenge, so only this namespace can verify it
+	mu                  sync.RWMutex     // Protects random, now, ttlJitter, allowZeroDifficulty and namespace
+}
+
+// newChallengeStore creates a new challenge store backed by process memory
+func newChallengeStore(challengeTTL time.Duration, maxActiveChallenges int, randomBytes int) *challengeStore {
+	// Clients never generate challenges, so they don't need expired ones cleaned up
+	var cleanupInterval time.Duration
+	if challengeTTL > 0 {
+		cleanupInterval = DefaultCleanupInterval(challengeTTL)
+	}
+	cs := newChallengeStoreWithBackend(challengeTTL, maxActiveChallenges, randomBytes, NewInMemoryStore(cleanupInterval))
+	cs.ownsBackend = true
+	return cs
+}
+
+// DefaultCleanupInterval returns how often expired challenges are dropped by default:
+// every half TTL, but at least every MaxDefaultCleanupInterval
+func DefaultCleanupInterval(challengeTTL time.Duration) time.Duration {
+	if interval := challengeTTL / 2; interval < MaxDefaultCleanupInterval {
+		return interval
+	}
+	return MaxDefaultCleanupInterval
+}
+
+// newChallengeStoreWithBackend creates a new challenge store keeping challenges in backend
+func newChallengeStoreWithBackend(challengeTTL time.Duration, maxActiveChallenges int, randomBytes int, backend ChallengeStore) *challengeStore {
+	if randomBytes <= 0 {
+		randomBytes = ChallengeRandomBytesSize
+	}
+
+	return &challengeStore{
+		challengeTTL:        challengeTTL,
+		maxActiveChallenges: maxActiveChallenges,
+		randomBytes:         randomBytes,
+		random:              rand.Reader,
+		now:                 time.Now,
+		backend:             backend,
+	}
+}
+
+// generate creates and stores a new unique challenge at the given difficulty
+func (cs *challengeStore) generate(difficulty int) (string, error) {
+	cs.mu.RLock()
+	random, now, jitter, allowZero, namespace := cs.random, cs.now, cs.ttlJitter, cs.allowZeroDifficulty, cs.namespace
+	cs.mu.RUnlock()
+
+	if err := checkDifficulty(difficulty, allowZero); err != nil {
+		return "", err
+	}
+
+	// Check if we've reached the limit of active challenges. With a shared backend
+	// the count is a snapshot, so concurrent instances may overshoot slightly.
+	if cs.maxActiveChallenges > 0 {
+		count, err := cs.backend.Count()
+		if err != nil {
+			return "", fmt.Errorf("failed to count active challenges: %w", err)
+		}
+		if count >= cs.maxActiveChallenges {
+			return "", fmt.Errorf("%w (%d)", ErrTooManyChallenges, cs.maxActiveChallenges)
+		}
+	}
+
+	// Random challenges practically never collide, but a weak or deterministic source
+	// could repeat one and reset an active challenge's replay accounting, so retry
+	for attempt := 0; attempt < maxChallengeAttempts; attempt++ {
+		challenge, stored, err := cs.tryGenerate(difficulty, random, now(), jitter, namespace)
+		if err != nil {
+			return "", err
+		}
+		if stored {
+			return challenge, nil
+		}
+	}
+	return "", fmt.Errorf("%w after %d attempts", ErrChallengeCollision, maxChallengeAttempts)
+}
+
+// tryGenerate creates a challenge and stores it unless the same challenge is still
+// active, reporting whether it was stored
+func (cs *challengeStore) tryGenerate(difficulty int, random io.Reader, issuedAt time.Time, jitter float64, namespace string) (string, bool, error) {
+	// Generate random bytes
+	randomBytes := make([]byte, cs.randomBytes)
+	if _, err := io.ReadFull(random, randomBytes); err != nil {
+		return "", false, fmt.Errorf("failed to generate random bytes: %w", err)
+	}
+
+	// Create challenge: timestamp + random hex string
+	challenge := fmt.Sprintf("%d:%s", issuedAt.Unix(), hex.EncodeToString(randomBytes))
+
+	// Store challenge with timestamp and difficulty for replay attack prevention.
+	// Jitter spreads out the expiry of challenges issued in a burst.
+	ttl := jitteredTTL(cs.challengeTTL, jitter)
+	meta := ChallengeMeta{IssuedAt: issuedAt, Difficulty: difficulty, ExpiresAt: issuedAt.Add(ttl), Namespace: namespace}
+	key := storeKey(namespace, challenge)
+	inserter, ok := cs.backend.(ChallengeInserter)
+	if !ok {
+		if err := cs.backend.Put(key, meta, ttl); err != nil {
+			return "", false, fmt.Errorf("failed to store challenge: %w", err)
+		}
+		return challenge, true, nil
+	}
+	stored, err := inserter.PutIfAbsent(key, meta, ttl)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to store challenge: %w", err)
+	}
+	return challenge, stored, nil
+}
+
+// consume removes a challenge from the active set and returns its metadata,
+// or an error if it was never issued, was already used, or has expired.
+// A challenge is consumed on every verification attempt, valid or not,
+// to prevent replay attacks and memory exhaustion. Challenges of other
+// namespaces are never found, so verifying one leaves it to its own service.
+func (cs *challengeStore) consume(challenge string) (ChallengeMeta, error) {
+	if _, _, err := ParseChallenge(challenge); err != nil {
+		return ChallengeMeta{}, err
+	}
+
+	cs.mu.RLock()
+	now, namespace := cs.now, cs.namespace
+	cs.mu.RUnlock()
+
+	meta, exists, err := cs.backend.GetAndDelete(storeKey(namespace, challenge))
+	if err != nil {
+		return ChallengeMeta{}, fmt.Errorf("failed to look up challenge: %w", err)
+	}
+	if !exists {
+		return ChallengeMeta{}, fmt.Errorf("challenge not found or already used")
+	}
+
+	// Older instances stored namespaced challenges under the bare challenge
+	if meta.Namespace != namespace {
+		return ChallengeMeta{}, fmt.Errorf("%w %q", ErrNamespaceMismatch, meta.Namespace)
+	}
+
+	// The backend may still hold challenges past their TTL
+	expiresAt := meta.ExpiresAt
+	if expiresAt.IsZero() {
+		expiresAt = meta.IssuedAt.Add(cs.challengeTTL) // Stored without an expiry, e.g. by an older instance
+	}
+	if now().After(expiresAt) {
+		return ChallengeMeta{}, fmt.Errorf("challenge expired")
+	}
+
+	return meta, nil
+}
+
+// setClock replaces the clock used to timestamp and expire challenges
+func (cs *challengeStore) setClock(now func() time.Time) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.now = now
+}
+
+// setTTLJitter makes each new challenge's TTL deviate from challengeTTL by a random
+// amount of up to percent of it, in either direction. Zero disables jitter.
+func (cs *challengeStore) setTTLJitter(percent int) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.ttlJitter = float64(max(percent, 0)) / 100
+}
+
+// jitteredTTL returns ttl moved by a uniformly random fraction of itself in [-jitter, jitter)
+func jitteredTTL(ttl time.Duration, jitter float64) time.Duration {
+	if jitter <= 0 {
+		return ttl
+	}
+	return ttl + time.Duration(float64(ttl)*jitter*(2*mrand.Float64()-1))
+}
+
+// setAllowZeroDifficulty sets whether challenges below difficulty 1 may be issued
+func (cs *challengeStore) setAllowZeroDifficulty(allow bool) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.allowZeroDifficulty = allow
+}
+
+// setNamespace sets the namespace of newly issued challenges and of those it verifies
+func (cs *challengeStore) setNamespace(namespace string) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.namespace = namespace
+}
+
+// getNamespace returns the namespace set with setNamespace
+func (cs *challengeStore) getNamespace() string {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	return cs.namespace
+}
+
+// checkDifficulty returns ErrZeroDifficulty for a difficulty below 1 unless allowZero is set
+func checkDifficulty(difficulty int, allowZero bool) error {
+	if difficulty < 1 && !allowZero {
+		return fmt.Errorf("%w, got: %d", ErrZeroDifficulty, difficulty)
+	}
+	return nil
+}
+
+// setRandom replaces the source of challenge randomness
+func (cs *challengeStore) setRandom(r io.Reader) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.random = r
+}
+
+// invalidate removes a challenge from the active set
+func (cs *challengeStore) invalidate(challenge string) {
+	if _, _, err := ParseChallenge(challenge); err != nil {
+		return
+	}
+	cs.backend.GetAndDelete(storeKey(cs.getNamespace(), challenge))
+}
+
+// storeKey returns the backend key of a challenge issued under namespace. Keys of
+// namespaced challenges contain a '/', which a well-formed challenge never does,
+// so a challenge passed by a client can't name another namespace's key.
+func storeKey(namespace, challenge string) string {
+	if namespace == "" {
+		return challenge // Unchanged for services without a namespace
+	}
+	return namespace + "/" + challenge
+}
+
+// stats counts the challenges held by the backend, expired ones it has not dropped yet included
+func (cs *challengeStore) stats() (ServiceStats, error) {
+	count, err := cs.backend.Count()
+	if err != nil {
+		return ServiceStats{}, fmt.Errorf("failed to count active challenges: %w", err)
+	}
+	return ServiceStats{ActiveChallenges: count}, nil
+}
+
+// close stops the backend's background work if the store created it. A backend
+// passed in by the caller is left for the caller to close.
+func (cs *challengeStore) close() error {
+	if closer, ok := cs.backend.(io.Closer); ok && cs.ownsBackend {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package pow
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// targetHexDigits is the length of a 256-bit target in hex
+const targetHexDigits = sha256.Size * 2
+
+// ErrInvalidTarget is returned by ParseTarget for anything but a positive 256-bit hex number
+var ErrInvalidTarget = errors.New("invalid target")
+
+// TargetSolverService is implemented by solvers that can solve a challenge against a
+// target, Bitcoin-style, rather than a number of leading zeros
+type TargetSolverService interface {
+	SolveTargetWithStats(ctx context.Context, challenge string, target *big.Int) (string, int, error)
+}
+
+// ParseTarget decodes a target of up to 64 hex digits, as sent in challenge messages
+func ParseTarget(s string) (*big.Int, error) {
+	if s == "" || len(s) > targetHexDigits {
+		return nil, fmt.Errorf("%w: must be 1 to %d hex digits, got %d", ErrInvalidTarget, targetHexDigits, len(s))
+	}
+	target, ok := new(big.Int).SetString(s, 16)
+	if !ok || target.Sign() < 0 {
+		return nil, fmt.Errorf("%w: %q is not hex", ErrInvalidTarget, s)
+	}
+	if target.Sign() == 0 {
+		return nil, fmt.Errorf("%w: must be positive", ErrInvalidTarget)
+	}
+	return target, nil
+}
+
+// FormatTarget encodes target as 64 hex digits, as sent in challenge messages
+func FormatTarget(target *big.Int) string {
+	return fmt.Sprintf("%0*x", targetHexDigits, target)
+}
+
+// TargetBits returns how many leading zero bits every hash at or below target has,
+// the target's rough equivalent of a difficulty in bits
+func TargetBits(target *big.Int) int {
+	return max(sha256.Size*8-target.BitLen(), 0)
+}
+
+// TargetAttempts returns how many nonces a solver tries on average before finding a
+// hash at or below target: 2^256 / (target + 1), saturating at math.MaxUint64
+func TargetAttempts(target *big.Int) uint64 {
+	if target.Sign() < 0 {
+		return math.MaxUint64 // No hash is below it
+	}
+	space := new(big.Int).Lsh(big.NewInt(1), sha256.Size*8)
+	attempts := space.Quo(space, new(big.Int).Add(target, big.NewInt(1)))
+	if !attempts.IsUint64() {
+		return math.MaxUint64
+	}
+	return max(attempts.Uint64(), 1)
+}
+
+// VerifyTarget reports whether SHA256(challenge + nonce), read as a big-endian number,
+// is at most target. Like Verify, it only checks the hash.
+func VerifyTarget(challenge, nonce string, target *big.Int) bool {
+	return hashBelowTarget(SHA256Hasher{}.Hash(challenge, nonce), target)
+}
+
+// hashBelowTarget reports whether hash, read as a big-endian number, is at most target
+func hashBelowTarget(hash []byte, target *big.Int) bool {
+	return new(big.Int).SetBytes(hash).Cmp(target) <= 0
+}
+
+// targetBytes returns target as a 32-byte big-endian number, so SHA256 hashes can be
+// compared against it bytewise without allocating. Targets above 256 bits saturate.
+func targetBytes(target *big.Int) []byte {
+	if target.BitLen() > sha256.Size*8 {
+		return bytes.Repeat([]byte{0xff}, sha256.Size)
+	}
+	return target.FillBytes(make([]byte, sha256.Size))
+}
@@ -0,0 +1,169 @@
+package pow
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTarget(t *testing.T) {
+	target, err := ParseTarget("00000fff")
+	if err != nil {
+		t.Fatalf("ParseTarget failed: %v", err)
+	}
+	if target.Cmp(big.NewInt(0xfff)) != 0 {
+		t.Errorf("Expected target 0xfff, got %x", target)
+	}
+	if got, want := FormatTarget(target), strings.Repeat("0", 61)+"fff"; got != want {
+		t.Errorf("FormatTarget = %q, want %q", got, want)
+	}
+
+	for _, s := range []string{"", "0", "000", "-1", "xyz", strings.Repeat("f", targetHexDigits+1)} {
+		if _, err := ParseTarget(s); !errors.Is(err, ErrInvalidTarget) {
+			t.Errorf("ParseTarget(%q): expected ErrInvalidTarget, got: %v", s, err)
+		}
+	}
+	if _, err := ParseTarget(strings.Repeat("f", targetHexDigits)); err != nil {
+		t.Errorf("Expected the largest target to parse, got: %v", err)
+	}
+}
+
+func TestTargetBits(t *testing.T) {
+	tests := []struct {
+		target string
+		want   int
+	}{
+		{strings.Repeat("f", 64), 0},
+		{"7" + strings.Repeat("f", 63), 1},
+		{"00ff" + strings.Repeat("f", 60), 8},
+		{"1", 255},
+	}
+	for _, tt := range tests {
+		target, err := ParseTarget(tt.target)
+		if err != nil {
+			t.Fatalf("ParseTarget(%q) failed: %v", tt.target, err)
+		}
+		if got := TargetBits(target); got != tt.want {
+			t.Errorf("TargetBits(%s) = %d, want %d", tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestHashBelowTarget_Boundaries(t *testing.T) {
+	hash := SHA256Hasher{}.Hash("1700000000:feedface", "157")
+	value := new(big.Int).SetBytes(hash)
+	one := big.NewInt(1)
+
+	tests := []struct {
+		name   string
+		target *big.Int
+		want   bool
+	}{
+		{"target equal to the hash", value, true},
+		{"target one above the hash", new(big.Int).Add(value, one), true},
+		{"target one below the hash", new(big.Int).Sub(value, one), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hashBelowTarget(hash, tt.target); got != tt.want {
+				t.Errorf("hashBelowTarget = %v, want %v", got, tt.want)
+			}
+			if got := VerifyTarget("1700000000:feedface", "157", tt.target); got != tt.want {
+				t.Errorf("VerifyTarget = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSHA256HashcashService_SolveTarget(t *testing.T) {
+	service := NewSHA256HashcashService(1, time.Minute)
+	defer service.Close()
+	target, _ := ParseTarget("0003" + strings.Repeat("f", 60)) // About 14 zero bits
+
+	nonce, attempts, err := service.SolveTargetWithStats(context.Background(), "1700000000:feedface", target)
+	if err != nil {
+		t.Fatalf("SolveTargetWithStats failed: %v", err)
+	}
+	if attempts < 1 {
+		t.Errorf("Expected at least one attempt, got %d", attempts)
+	}
+	if !VerifyTarget("1700000000:feedface", nonce, target) {
+		t.Errorf("Expected nonce %s to meet the target", nonce)
+	}
+}
+
+func TestSHA256HashcashService_Target(t *testing.T) {
+	const difficulty = 1
+	service := NewSHA256HashcashService(difficulty, time.Minute)
+	defer service.Close()
+	target, _ := ParseTarget("0003" + strings.Repeat("f", 60))
+	service.SetTarget(target)
+
+	if got := service.Target(); got == nil || got.Cmp(target) != 0 {
+		t.Fatalf("Expected Target %x, got %v", target, got)
+	}
+	service.Target().SetInt64(1) // The returned target is a copy
+	if service.Target().Cmp(target) != 0 {
+		t.Errorf("Expected the service target to be unaffected by changes to a copy")
+	}
+
+	// A proof meeting the target verifies
+	challenge, err := service.GenerateChallenge()
+	if err != nil {
+		t.Fatalf("GenerateChallenge failed: %v", err)
+	}
+	nonce, _, err := service.SolveTargetWithStats(context.Background(), challenge, target)
+	if err != nil {
+		t.Fatalf("SolveTargetWithStats failed: %v", err)
+	}
+	if valid, err := service.VerifyProof(challenge, nonce); err != nil || !valid {
+		t.Errorf("Expected a proof meeting the target to verify, got valid=%v err=%v", valid, err)
+	}
+
+	// A proof meeting only the difficulty doesn't
+	strict := NewSHA256HashcashService(difficulty, time.Minute)
+	defer strict.Close()
+	strict.SetTarget(big.NewInt(1)) // No hash realistically gets this low
+	challenge, err = strict.GenerateChallenge()
+	if err != nil {
+		t.Fatalf("GenerateChallenge failed: %v", err)
+	}
+	nonce, err = strict.SolveChallenge(context.Background(), challenge, difficulty)
+	if err != nil {
+		t.Fatalf("SolveChallenge failed: %v", err)
+	}
+	if valid, err := strict.VerifyProof(challenge, nonce); err != nil || valid {
+		t.Errorf("Expected a proof missing the target to be rejected, got valid=%v err=%v", valid, err)
+	}
+
+	service.SetTarget(nil)
+	if service.Target() != nil {
+		t.Errorf("Expected SetTarget(nil) to clear the target")
+	}
+}
+
+func TestTargetAttempts(t *testing.T) {
+	tests := []struct {
+		target string
+		want   uint64
+	}{
+		{strings.Repeat("f", 64), 1},
+		{"7" + strings.Repeat("f", 63), 2},
+		{"00" + strings.Repeat("f", 62), 256},
+		{"0003" + strings.Repeat("f", 60), 1 << 14},
+		{"1", math.MaxUint64},
+	}
+	for _, tt := range tests {
+		target, err := ParseTarget(tt.target)
+		if err != nil {
+			t.Fatalf("ParseTarget(%q) failed: %v", tt.target, err)
+		}
+		if got := TargetAttempts(target); got != tt.want {
+			t.Errorf("TargetAttempts(%s) = %d, want %d", tt.target, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package pow
+
+import (
+	"crypto/sha256"
+	"math"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Hasher computes the hash a proof is checked against and decides whether it
+// meets a difficulty, whose unit depends on the algorithm
+type Hasher interface {
+	// Hash returns the hash of nonce appended to challenge
+	Hash(challenge, nonce string) []byte
+	// MeetsDifficulty reports whether hash has enough leading zeros for difficulty
+	MeetsDifficulty(hash []byte, difficulty int) bool
+}
+
+// SHA256Hasher is the Hasher of SHA256HashcashService, difficulty counts leading zero bytes
+type SHA256Hasher struct{}
+
+// Hash returns SHA256(challenge + nonce)
+func (SHA256Hasher) Hash(challenge, nonce string) []byte {
+	hash := sha256.Sum256([]byte(challenge + nonce))
+	return hash[:]
+}
+
+// MeetsDifficulty reports whether hash starts with difficulty zero bytes
+func (SHA256Hasher) MeetsDifficulty(hash []byte, difficulty int) bool {
+	return hasLeadingZeroBits(hash, difficulty*8)
+}
+
+// Argon2idHasher is the Hasher of Argon2HashcashService, difficulty counts leading zero bits
+type Argon2idHasher struct {
+	Params Argon2Params
+}
+
+// Hash computes Argon2id over challenge+nonce.
+// The challenge doubles as the salt, so precomputation across challenges is useless.
+func (h Argon2idHasher) Hash(challenge, nonce string) []byte {
+	return argon2.IDKey([]byte(challenge+nonce), []byte(challenge), h.Params.Time, h.Params.Memory, h.Params.Threads, Argon2KeyLen)
+}
+
+// MeetsDifficulty reports whether hash starts with difficulty zero bits
+func (Argon2idHasher) MeetsDifficulty(hash []byte, difficulty int) bool {
+	return hasLeadingZeroBits(hash, difficulty)
+}
+
+// ChallengeData returns the data hashed before the nonce for a challenge: the challenge,
+// prefixed with its namespace if any and followed by its binding if bound. Solvers pass
+// it as the challenge to solve.
+func ChallengeData(namespace, challenge, binding string) string {
+	if namespace == "" {
+		return challenge + binding
+	}
+	return namespace + ":" + challenge + binding
+}
+
+// ExpectedAttempts returns how many nonces a solver tries on average before finding a
+// hash with bits leading zero bits: 2^bits, saturating at math.MaxUint64
+func ExpectedAttempts(bits int) uint64 {
+	if bits >= 64 {
+		return math.MaxUint64
+	}
+	return 1 << max(bits, 0)
+}
+
+// Verify reports whether nonce solves challenge at difficulty. It only checks the
+// hash, without the expiry and replay protection of VerifyProof, so external solvers
+// can validate their output offline. For a namespaced or bound challenge pass ChallengeData.
+func Verify(challenge, nonce string, difficulty int, hasher Hasher) bool {
+	return hasher.MeetsDifficulty(hasher.Hash(challenge, nonce), difficulty)
+}
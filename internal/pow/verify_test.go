@@ -0,0 +1,93 @@
+package pow
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestVerify_KnownProofs(t *testing.T) {
+	argon2Hasher := Argon2idHasher{Params: testArgon2Params}
+
+	tests := []struct {
+		name       string
+		challenge  string
+		nonce      string
+		difficulty int
+		hasher     Hasher
+		want       bool
+	}{
+		{"SHA256 difficulty 1", "1700000000:feedface", "157", 1, SHA256Hasher{}, true},
+		{"SHA256 previous nonce", "1700000000:feedface", "156", 1, SHA256Hasher{}, false},
+		{"SHA256 difficulty 2", "1700000000:feedface", "18649", 2, SHA256Hasher{}, true},
+		{"SHA256 lower difficulty", "1700000000:feedface", "18649", 1, SHA256Hasher{}, true},
+		{"SHA256 higher difficulty", "1700000000:feedface", "18649", 3, SHA256Hasher{}, false},
+		{"SHA256 too few zero bytes", "1700000000:feedface", "157", 2, SHA256Hasher{}, false},
+		{"SHA256 bound challenge", "1700000000:0badf00d" + "127.0.0.1", "33466", 2, SHA256Hasher{}, true},
+		{"SHA256 binding omitted", "1700000000:0badf00d", "33466", 2, SHA256Hasher{}, false},
+		{"SHA256 difficulty 0", "1700000000:feedface", "0", 0, SHA256Hasher{}, true},
+		{"Argon2id 4 bits", "1700000000:feedface", "25", 4, argon2Hasher, true},
+		{"Argon2id 10 bits", "1700000000:feedface", "100", 10, argon2Hasher, true},
+		{"Argon2id 11 bits", "1700000000:feedface", "100", 11, argon2Hasher, false},
+		{"Argon2id other params", "1700000000:feedface", "100", 10, Argon2idHasher{Params: Argon2Params{Time: 2, Memory: 64, Threads: 1}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Verify(tt.challenge, tt.nonce, tt.difficulty, tt.hasher); got != tt.want {
+				t.Errorf("Verify(%q, %q, %d) = %v, want %v", tt.challenge, tt.nonce, tt.difficulty, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerify_IsStateless(t *testing.T) {
+	service := NewSHA256HashcashService(1, time.Minute)
+	defer service.Close()
+
+	challenge, err := service.GenerateChallenge()
+	if err != nil {
+		t.Fatalf("GenerateChallenge failed: %v", err)
+	}
+	nonce, err := service.SolveChallenge(context.Background(), challenge, 1)
+	if err != nil {
+		t.Fatalf("SolveChallenge failed: %v", err)
+	}
+
+	// Checking a proof offline neither consumes the challenge nor depends on it being issued
+	for i := 0; i < 2; i++ {
+		if !Verify(challenge, nonce, 1, SHA256Hasher{}) {
+			t.Fatalf("Verify rejected a valid proof on call %d", i+1)
+		}
+	}
+
+	valid, err := service.VerifyProof(challenge, nonce)
+	if err != nil || !valid {
+		t.Fatalf("VerifyProof = %v, %v; want true after offline checks", valid, err)
+	}
+	if !Verify(challenge, nonce, 1, SHA256Hasher{}) {
+		t.Error("Verify should still accept a proof whose challenge was consumed")
+	}
+}
+
+func TestExpectedAttempts(t *testing.T) {
+	tests := []struct {
+		bits int
+		want uint64
+	}{
+		{-1, 1},
+		{0, 1},
+		{1, 2},
+		{8, 256},
+		{16, 65536},
+		{63, 1 << 63},
+		{64, math.MaxUint64},
+		{256, math.MaxUint64},
+	}
+	for _, tt := range tests {
+		if got := ExpectedAttempts(tt.bits); got != tt.want {
+			t.Errorf("ExpectedAttempts(%d) = %d, want %d", tt.bits, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package quotes
+
+// DailyQuoter is a Service that can also select one quote per calendar day
+type DailyQuoter interface {
+	Service
+	GetQuoteOfTheDay() string
+}
+
+// DailyService serves the quote of the day from another service in place of random
+// quotes, so every client gets the same quote all day. Requests for a category
+// still get a random quote from it.
+type DailyService struct {
+	inner DailyQuoter
+}
+
+// NewDailyService wraps inner so that uncategorized quotes are its quote of the day
+func NewDailyService(inner DailyQuoter) *DailyService {
+	return &DailyService{inner: inner}
+}
+
+// GetRandomQuote returns the quote of the day
+func (s *DailyService) GetRandomQuote() string {
+	return s.inner.GetQuoteOfTheDay()
+}
+
+// GetRandomQuoteByCategory returns the quote of the day, or a random quote of the
+// category if one is given
+func (s *DailyService) GetRandomQuoteByCategory(category string) string {
+	if category == "" {
+		return s.inner.GetQuoteOfTheDay()
+	}
+	return s.inner.GetRandomQuoteByCategory(category)
+}
+
+// GetRandomStructuredQuote returns the quote of the day with its text and author separately
+func (s *DailyService) GetRandomStructuredQuote() Quote {
+	return ParseQuote(s.inner.GetQuoteOfTheDay())
+}
@@ -0,0 +1,43 @@
+package quotes
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDailyService(t *testing.T) {
+	inner := NewInMemoryServiceWithQuotes([]Quote{
+		{Text: "Stay hungry", Author: "Steve Jobs"},
+		{Text: "Know thyself", Category: "philosophy"},
+		{Text: "Carpe diem", Category: "philosophy"},
+	})
+	now := time.Date(2024, time.March, 1, 8, 0, 0, 0, time.UTC)
+	inner.SetClock(func() time.Time { return now })
+	service := NewDailyService(inner)
+
+	want := inner.GetQuoteOfTheDay()
+	for i := 0; i < 20; i++ {
+		if got := service.GetRandomQuote(); got != want {
+			t.Fatalf("GetRandomQuote = %q, want the quote of the day %q", got, want)
+		}
+		if got := service.GetRandomQuoteByCategory(""); got != want {
+			t.Fatalf("GetRandomQuoteByCategory(\"\") = %q, want the quote of the day %q", got, want)
+		}
+	}
+	if got := service.GetRandomStructuredQuote(); got != ParseQuote(want) {
+		t.Errorf("GetRandomStructuredQuote = %+v, want %+v", got, ParseQuote(want))
+	}
+
+	// Categories are still served at random
+	for i := 0; i < 20; i++ {
+		if got := service.GetRandomQuoteByCategory("philosophy"); got != "Know thyself" && got != "Carpe diem" {
+			t.Fatalf("Expected a philosophy quote, got %q", got)
+		}
+	}
+
+	// The quote moves on with the date
+	now = now.Add(24 * time.Hour)
+	if got := service.GetRandomQuote(); got == want {
+		t.Errorf("Expected a new quote the next day, got %q again", got)
+	}
+}
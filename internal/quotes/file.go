@@ -0,0 +1,252 @@
+package quotes
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// commentPrefix marks lines ignored in newline-delimited quote files
+const commentPrefix = "#"
+
+// FileService implements quotes service backed by a file or directory of files.
+// Files are either a JSON array or newline-delimited text. JSON array elements
+// may be plain strings or objects with text, weight and category fields.
+type FileService struct {
+	path              string
+	inMemory          *InMemoryService
+	loadedFingerprint string // State of path when first loaded, used by Watch
+}
+
+// NewFileService creates a quotes service that loads quotes from path.
+// If path does not exist or contains no quotes, the built-in collection is used.
+func NewFileService(path string) (*FileService, error) {
+	loadedFingerprint := fingerprint(path)
+
+	quotes, err := loadQuotesOrDefault(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileService{
+		path:              path,
+		inMemory:          NewInMemoryServiceWithQuotes(quotes),
+		loadedFingerprint: loadedFingerprint,
+	}, nil
+}
+
+// Reload re-reads quotes from disk and swaps them in atomically.
+// On error the previously loaded quotes keep being served.
+func (s *FileService) Reload() error {
+	quotes, err := loadQuotesOrDefault(s.path)
+	if err != nil {
+		return err
+	}
+
+	s.inMemory.setQuotes(quotes)
+	return nil
+}
+
+// Watch polls path every interval and reloads quotes when it changes,
+// until ctx is canceled. onReload, if not nil, is called with the result
+// of every reload attempt.
+func (s *FileService) Watch(ctx context.Context, interval time.Duration, onReload func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	lastFingerprint := s.loadedFingerprint
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			current := fingerprint(s.path)
+			if current == lastFingerprint {
+				continue
+			}
+			lastFingerprint = current
+
+			err := s.Reload()
+			if onReload != nil {
+				onReload(err)
+			}
+		}
+	}
+}
+
+// GetRandomQuote returns a random quote from the loaded collection
+// This method is safe for concurrent use
+func (s *FileService) GetRandomQuote() string {
+	return s.inMemory.GetRandomQuote()
+}
+
+// GetRandomQuoteByCategory returns a random quote from the given category
+// This method is safe for concurrent use
+func (s *FileService) GetRandomQuoteByCategory(category string) string {
+	return s.inMemory.GetRandomQuoteByCategory(category)
+}
+
+// GetRandomStructuredQuote returns a random quote with its text and author separately
+func (s *FileService) GetRandomStructuredQuote() Quote {
+	return s.inMemory.GetRandomStructuredQuote()
+}
+
+// GetQuoteOfTheDay returns the same quote for a whole UTC calendar day.
+// A reload may change it.
+func (s *FileService) GetQuoteOfTheDay() string {
+	return s.inMemory.GetQuoteOfTheDay()
+}
+
+// SetClock replaces the clock telling GetQuoteOfTheDay the date, nil restores time.Now
+func (s *FileService) SetClock(now func() time.Time) {
+	s.inMemory.SetClock(now)
+}
+
+// SetNoRepeat makes the service never return the same quote twice in a row, as
+// long as there is another quote to pick. Reloads keep the setting.
+func (s *FileService) SetNoRepeat(noRepeat bool) {
+	s.inMemory.SetNoRepeat(noRepeat)
+}
+
+// Len returns the number of quotes being served
+func (s *FileService) Len() int {
+	return s.inMemory.count()
+}
+
+// loadQuotesOrDefault loads quotes from path, falling back to the built-in
+// collection when path is missing or empty
+func loadQuotesOrDefault(path string) ([]Quote, error) {
+	quotes, err := loadQuotes(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(quotes) == 0 {
+		return builtinQuotes(), nil
+	}
+
+	return quotes, nil
+}
+
+// fingerprint summarizes the modification state of a file or directory
+// so that changes can be detected by polling
+func fingerprint(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+
+	if !info.IsDir() {
+		return fmt.Sprintf("%d:%d", info.ModTime().UnixNano(), info.Size())
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return ""
+	}
+
+	var b strings.Builder
+	for _, entry := range entries {
+		entryInfo, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(&b, "%s:%d:%d;", entry.Name(), entryInfo.ModTime().UnixNano(), entryInfo.Size())
+	}
+	return b.String()
+}
+
+// loadQuotes reads quotes from a file, or from every regular file in a directory.
+// A missing path yields no quotes and no error.
+func loadQuotes(path string) ([]Quote, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to stat quotes path: %w", err)
+	}
+
+	if !info.IsDir() {
+		return loadQuotesFile(path)
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read quotes directory: %w", err)
+	}
+
+	// Load files in a stable order, skipping hidden files and subdirectories
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && !strings.HasPrefix(entry.Name(), ".") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	var quotes []Quote
+	for _, name := range names {
+		fileQuotes, err := loadQuotesFile(filepath.Join(path, name))
+		if err != nil {
+			return nil, err
+		}
+		quotes = append(quotes, fileQuotes...)
+	}
+
+	return quotes, nil
+}
+
+// loadQuotesFile reads quotes from a single JSON or newline-delimited file
+func loadQuotesFile(path string) ([]Quote, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read quotes file: %w", err)
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var raw []Quote
+		if err := json.Unmarshal(trimmed, &raw); err != nil {
+			return nil, fmt.Errorf("failed to parse quotes file %s: %w", path, err)
+		}
+		return cleanQuotes(raw), nil
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to scan quotes file %s: %w", path, err)
+	}
+
+	return cleanQuotes(textQuotes(lines)), nil
+}
+
+// cleanQuotes trims quotes and drops blank, comment and non-UTF-8 entries
+func cleanQuotes(raw []Quote) []Quote {
+	quotes := make([]Quote, 0, len(raw))
+	for _, quote := range raw {
+		quote.Text = strings.TrimSpace(quote.Text)
+		quote.Author = strings.TrimSpace(quote.Author)
+		quote.Category = strings.TrimSpace(quote.Category)
+		if quote.Text == "" || strings.HasPrefix(quote.Text, commentPrefix) || !utf8.ValidString(quote.Text) {
+			continue
+		}
+		quotes = append(quotes, quote)
+	}
+	return quotes
+}
@@ -0,0 +1,221 @@
+package quotes
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewFileService_NewlineDelimited(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quotes.txt")
+	content := "First quote\n\n  # a comment\n  Second quote  \n\xff\xfe broken\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write quotes file: %v", err)
+	}
+
+	service, err := NewFileService(path)
+	if err != nil {
+		t.Fatalf("NewFileService failed: %v", err)
+	}
+
+	if service.Len() != 2 {
+		t.Fatalf("Expected 2 quotes, got %d", service.Len())
+	}
+
+	for i := 0; i < 20; i++ {
+		quote := service.GetRandomQuote()
+		if quote != "First quote" && quote != "Second quote" {
+			t.Errorf("Unexpected quote: %q", quote)
+		}
+	}
+}
+
+func TestNewFileService_JSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quotes.json")
+	if err := os.WriteFile(path, []byte(`["Only quote", "  "]`), 0o644); err != nil {
+		t.Fatalf("Failed to write quotes file: %v", err)
+	}
+
+	service, err := NewFileService(path)
+	if err != nil {
+		t.Fatalf("NewFileService failed: %v", err)
+	}
+
+	if quote := service.GetRandomQuote(); quote != "Only quote" {
+		t.Errorf("Expected 'Only quote', got %q", quote)
+	}
+}
+
+func TestNewFileService_JSONAuthor(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quotes.json")
+	if err := os.WriteFile(path, []byte(`[{"text": "Only quote", "author": " Someone "}]`), 0o644); err != nil {
+		t.Fatalf("Failed to write quotes file: %v", err)
+	}
+
+	service, err := NewFileService(path)
+	if err != nil {
+		t.Fatalf("NewFileService failed: %v", err)
+	}
+
+	if quote := service.GetRandomQuote(); quote != "Only quote - Someone" {
+		t.Errorf("Expected 'Only quote - Someone', got %q", quote)
+	}
+	if quote := service.GetRandomStructuredQuote(); quote.Text != "Only quote" || quote.Author != "Someone" {
+		t.Errorf("Expected text and author separately, got %+v", quote)
+	}
+}
+
+func TestNewFileService_MalformedJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quotes.json")
+	if err := os.WriteFile(path, []byte(`["unterminated`), 0o644); err != nil {
+		t.Fatalf("Failed to write quotes file: %v", err)
+	}
+
+	if _, err := NewFileService(path); err == nil {
+		t.Error("Expected error for malformed JSON")
+	}
+}
+
+func TestNewFileService_EmptyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quotes.txt")
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatalf("Failed to write quotes file: %v", err)
+	}
+
+	service, err := NewFileService(path)
+	if err != nil {
+		t.Fatalf("NewFileService failed: %v", err)
+	}
+
+	if service.Len() != len(defaultQuotes) {
+		t.Errorf("Expected fallback to %d built-in quotes, got %d", len(defaultQuotes), service.Len())
+	}
+}
+
+func TestNewFileService_NonexistentPath(t *testing.T) {
+	service, err := NewFileService(filepath.Join(t.TempDir(), "missing.txt"))
+	if err != nil {
+		t.Fatalf("NewFileService failed: %v", err)
+	}
+
+	if service.Len() != len(defaultQuotes) {
+		t.Errorf("Expected fallback to %d built-in quotes, got %d", len(defaultQuotes), service.Len())
+	}
+}
+
+func TestNewFileService_Directory(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.txt":   "Quote A\n",
+		"b.json":  `["Quote B"]`,
+		".hidden": "Hidden quote\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	service, err := NewFileService(dir)
+	if err != nil {
+		t.Fatalf("NewFileService failed: %v", err)
+	}
+
+	if service.Len() != 2 {
+		t.Errorf("Expected 2 quotes from directory, got %d", service.Len())
+	}
+}
+
+func TestFileService_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quotes.txt")
+	if err := os.WriteFile(path, []byte("Old quote\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write quotes file: %v", err)
+	}
+
+	service, err := NewFileService(path)
+	if err != nil {
+		t.Fatalf("NewFileService failed: %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte(`["New quote`), 0o644); err != nil {
+		t.Fatalf("Failed to rewrite quotes file: %v", err)
+	}
+
+	// A broken file must not replace the quotes being served
+	if err := service.Reload(); err == nil {
+		t.Error("Expected reload error for malformed file")
+	}
+	if quote := service.GetRandomQuote(); quote != "Old quote" {
+		t.Errorf("Expected old quote after failed reload, got %q", quote)
+	}
+
+	if err := os.WriteFile(path, []byte("New quote\n"), 0o644); err != nil {
+		t.Fatalf("Failed to rewrite quotes file: %v", err)
+	}
+
+	if err := service.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if quote := service.GetRandomQuote(); quote != "New quote" {
+		t.Errorf("Expected new quote after reload, got %q", quote)
+	}
+}
+
+func TestFileService_Watch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quotes.txt")
+	if err := os.WriteFile(path, []byte("Old quote\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write quotes file: %v", err)
+	}
+
+	service, err := NewFileService(path)
+	if err != nil {
+		t.Fatalf("NewFileService failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reloaded := make(chan error, 1)
+	go service.Watch(ctx, 10*time.Millisecond, func(err error) {
+		reloaded <- err
+	})
+
+	// Concurrent readers must never observe a torn state during reload
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				if quote := service.GetRandomQuote(); quote != "Old quote" && quote != "Brand new quote" {
+					t.Errorf("Unexpected quote: %q", quote)
+					return
+				}
+			}
+		}()
+	}
+
+	// Different size guarantees a fingerprint change regardless of mtime granularity
+	if err := os.WriteFile(path, []byte("Brand new quote\n"), 0o644); err != nil {
+		t.Fatalf("Failed to rewrite quotes file: %v", err)
+	}
+
+	select {
+	case err := <-reloaded:
+		if err != nil {
+			t.Fatalf("Reload failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Watcher did not reload quotes")
+	}
+
+	if quote := service.GetRandomQuote(); quote != "Brand new quote" {
+		t.Errorf("Expected new quote after watch reload, got %q", quote)
+	}
+
+	cancel()
+	wg.Wait()
+}
@@ -1,7 +1,9 @@
 package quotes
 
 import (
+	"encoding/json"
 	"math/rand"
+	"strings"
 	"sync"
 	"time"
 )
@@ -9,54 +11,309 @@ import (
 // Service defines the interface for quotes operations
 type Service interface {
 	GetRandomQuote() string
+	GetRandomQuoteByCategory(category string) string
+	GetRandomStructuredQuote() Quote
+}
+
+// noQuotesAvailable is returned when there is nothing to select from
+const noQuotesAvailable = "No quotes available"
+
+// authorSeparator separates a quote from its attribution in plain quote text
+const authorSeparator = " - "
+
+// Quote is a single quote with optional author, selection weight and category
+type Quote struct {
+	Text     string `json:"text"`
+	Author   string `json:"author,omitempty"`   // Attribution, appended to Text when served as plain text
+	Weight   int    `json:"weight,omitempty"`   // Relative selection weight, values < 1 count as 1
+	Category string `json:"category,omitempty"` // Optional category for filtered selection
+}
+
+// ParseQuote splits plain quote text of the form "text - author" at the last
+// separator. Text without one is all quote, with no author.
+func ParseQuote(text string) Quote {
+	i := strings.LastIndex(text, authorSeparator)
+	if i < 0 {
+		return Quote{Text: text}
+	}
+
+	body := strings.TrimSpace(text[:i])
+	author := strings.TrimSpace(text[i+len(authorSeparator):])
+	if body == "" || author == "" {
+		return Quote{Text: text}
+	}
+	return Quote{Text: body, Author: author}
+}
+
+// String returns the quote as plain text, followed by its author if known
+func (q Quote) String() string {
+	if q.Author == "" {
+		return q.Text
+	}
+	return q.Text + authorSeparator + q.Author
+}
+
+// structured returns q with its author split out of Text, unless it already has one
+func (q Quote) structured() Quote {
+	if q.Author != "" {
+		return q
+	}
+	parsed := ParseQuote(q.Text)
+	q.Text, q.Author = parsed.Text, parsed.Author
+	return q
+}
+
+// UnmarshalJSON accepts either a plain string or a quote object
+func (q *Quote) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*q = Quote{Text: text}
+		return nil
+	}
+
+	type plainQuote Quote // Avoids recursing into this method
+	var pq plainQuote
+	if err := json.Unmarshal(data, &pq); err != nil {
+		return err
+	}
+	*q = Quote(pq)
+	return nil
+}
+
+// weight returns the effective selection weight
+func (q Quote) weight() int {
+	if q.Weight < 1 {
+		return 1
+	}
+	return q.Weight
+}
+
+// textQuotes wraps plain strings as unweighted, uncategorized quotes
+func textQuotes(texts []string) []Quote {
+	quotes := make([]Quote, len(texts))
+	for i, text := range texts {
+		quotes[i] = Quote{Text: text}
+	}
+	return quotes
+}
+
+// builtinQuotes returns the built-in collection with authors split out of the text
+func builtinQuotes() []Quote {
+	quotes := make([]Quote, len(defaultQuotes))
+	for i, text := range defaultQuotes {
+		quotes[i] = ParseQuote(text)
+	}
+	return quotes
+}
+
+// defaultQuotes is the built-in quote collection
+var defaultQuotes = []string{
+	"The only way to do great work is to love what you do. - Steve Jobs",
+	"Innovation distinguishes between a leader and a follower. - Steve Jobs",
+	"Life is what happens when you're busy making other plans. - John Lennon",
+	"The future belongs to those who believe in the beauty of their dreams. - Eleanor Roosevelt",
+	"It is during our darkest moments that we must focus to see the light. - Aristotle",
+	"The only impossible journey is the one you never begin. - Tony Robbins",
+	"In the middle of difficulty lies opportunity. - Albert Einstein",
+	"Life is 10% what happens to you and 90% how you react to it. - Charles R. Swindoll",
+	"The best time to plant a tree was 20 years ago. The second best time is now. - Chinese Proverb",
+	"Your time is limited, don't waste it living someone else's life. - Steve Jobs",
+	"Whether you think you can or you think you can't, you're right. - Henry Ford",
+	"The only person you are destined to become is the person you decide to be. - Ralph Waldo Emerson",
+	"Go confidently in the direction of your dreams! Live the life you've imagined. - Henry David Thoreau",
+	"Everything you've ever wanted is on the other side of fear. - George Addair",
+	"Success is not final, failure is not fatal: it is the courage to continue that counts. - Winston Churchill",
+	"Hardships often prepare ordinary people for an extraordinary destiny. - C.S. Lewis",
+	"Believe you can and you're halfway there. - Theodore Roosevelt",
+	"The only limit to our realization of tomorrow will be our doubts of today. - Franklin D. Roosevelt",
+	"It does not matter how slowly you go as long as you do not stop. - Confucius",
+	"Act as if what you do makes a difference. It does. - William James",
 }
 
 // InMemoryService implements quotes service with in-memory storage
 type InMemoryService struct {
-	quotes []string
-	rng    *rand.Rand
-	mu     sync.Mutex // Protects rng from concurrent access
+	quotes      []Quote
+	totalWeight int
+	rng         *rand.Rand
+	noRepeat    bool       // Never return the same quote twice in a row
+	last        string     // Text of the last quote returned
+	mu          sync.Mutex // Protects all fields from concurrent access
+
+	// now tells GetQuoteOfTheDay the date, overridable for tests
+	now func() time.Time
 }
 
 // NewInMemoryService creates a new quotes service
 func NewInMemoryService() *InMemoryService {
-	return &InMemoryService{
-		quotes: []string{
-			"The only way to do great work is to love what you do. - Steve Jobs",
-			"Innovation distinguishes between a leader and a follower. - Steve Jobs",
-			"Life is what happens when you're busy making other plans. - John Lennon",
-			"The future belongs to those who believe in the beauty of their dreams. - Eleanor Roosevelt",
-			"It is during our darkest moments that we must focus to see the light. - Aristotle",
-			"The only impossible journey is the one you never begin. - Tony Robbins",
-			"In the middle of difficulty lies opportunity. - Albert Einstein",
-			"Life is 10% what happens to you and 90% how you react to it. - Charles R. Swindoll",
-			"The best time to plant a tree was 20 years ago. The second best time is now. - Chinese Proverb",
-			"Your time is limited, don't waste it living someone else's life. - Steve Jobs",
-			"Whether you think you can or you think you can't, you're right. - Henry Ford",
-			"The only person you are destined to become is the person you decide to be. - Ralph Waldo Emerson",
-			"Go confidently in the direction of your dreams! Live the life you've imagined. - Henry David Thoreau",
-			"Everything you've ever wanted is on the other side of fear. - George Addair",
-			"Success is not final, failure is not fatal: it is the courage to continue that counts. - Winston Churchill",
-			"Hardships often prepare ordinary people for an extraordinary destiny. - C.S. Lewis",
-			"Believe you can and you're halfway there. - Theodore Roosevelt",
-			"The only limit to our realization of tomorrow will be our doubts of today. - Franklin D. Roosevelt",
-			"It does not matter how slowly you go as long as you do not stop. - Confucius",
-			"Act as if what you do makes a difference. It does. - William James",
-		},
-		rng: rand.New(rand.NewSource(time.Now().UnixNano())),
-	}
-}
-
-// GetRandomQuote returns a random quote from the collection
+	return NewInMemoryServiceWithQuotes(builtinQuotes())
+}
+
+// NewInMemoryServiceWithSeed creates a quotes service over the built-in collection
+// whose selection is determined by seed, so tests can predict the quotes returned
+func NewInMemoryServiceWithSeed(seed int64) *InMemoryService {
+	return newInMemoryService(builtinQuotes(), seed)
+}
+
+// NewInMemoryServiceWithQuotes creates a quotes service over the given collection
+func NewInMemoryServiceWithQuotes(quotes []Quote) *InMemoryService {
+	return newInMemoryService(quotes, time.Now().UnixNano())
+}
+
+// newInMemoryService creates a quotes service over quotes, selecting with a generator seeded by seed
+func newInMemoryService(quotes []Quote, seed int64) *InMemoryService {
+	s := &InMemoryService{
+		rng: rand.New(rand.NewSource(seed)),
+		now: time.Now,
+	}
+	s.setQuotes(quotes)
+	return s
+}
+
+// SetNoRepeat makes the service never return the same quote twice in a row, as long
+// as there is another quote to pick, e.g. for rotating displays. The remaining quotes
+// keep their relative weights. It is off by default.
+func (s *InMemoryService) SetNoRepeat(noRepeat bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.noRepeat = noRepeat
+}
+
+// SetClock replaces the clock telling GetQuoteOfTheDay the date, nil restores time.Now
+func (s *InMemoryService) SetClock(now func() time.Time) {
+	if now == nil {
+		now = time.Now
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.now = now
+}
+
+// GetQuoteOfTheDay returns the same quote for a whole UTC calendar day, moving to the
+// next one in the collection every day, regardless of weights.
+// This method is safe for concurrent use
+func (s *InMemoryService) GetQuoteOfTheDay() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.quotes) == 0 {
+		return noQuotesAvailable
+	}
+
+	// Days since the Unix epoch, so every server agrees on the quote
+	day := s.now().Unix() / int64(24*time.Hour/time.Second)
+	index := day % int64(len(s.quotes))
+	if index < 0 {
+		index += int64(len(s.quotes)) // Before 1970
+	}
+	return s.quotes[index].String()
+}
+
+// GetRandomQuote returns a random quote from the collection, honoring weights.
+// Without weights every quote is equally likely.
 // This method is safe for concurrent use
 func (s *InMemoryService) GetRandomQuote() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	if len(s.quotes) == 0 {
-		return "No quotes available"
+		return noQuotesAvailable
 	}
 
+	return s.pickWeighted(s.quotes, s.totalWeight).String()
+}
+
+// GetRandomStructuredQuote is GetRandomQuote returning the quote's text and author
+// separately. This method is safe for concurrent use
+func (s *InMemoryService) GetRandomStructuredQuote() Quote {
 	s.mu.Lock()
-	index := s.rng.Intn(len(s.quotes))
-	s.mu.Unlock()
+	defer s.mu.Unlock()
 
-	return s.quotes[index]
+	if len(s.quotes) == 0 {
+		return Quote{Text: noQuotesAvailable}
+	}
+
+	return s.pickWeighted(s.quotes, s.totalWeight).structured()
+}
+
+// GetRandomQuoteByCategory returns a weighted random quote from the given category.
+// An empty category selects from all quotes.
+// This method is safe for concurrent use
+func (s *InMemoryService) GetRandomQuoteByCategory(category string) string {
+	if category == "" {
+		return s.GetRandomQuote()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var matching []Quote
+	totalWeight := 0
+	for _, quote := range s.quotes {
+		if strings.EqualFold(quote.Category, category) {
+			matching = append(matching, quote)
+			totalWeight += quote.weight()
+		}
+	}
+
+	if len(matching) == 0 {
+		return noQuotesAvailable
+	}
+
+	return s.pickWeighted(matching, totalWeight).String()
+}
+
+// pickWeighted selects a quote with probability proportional to its weight.
+// Must be called with mu held.
+func (s *InMemoryService) pickWeighted(quotes []Quote, totalWeight int) Quote {
+	quote := s.pickWeightedExcluding(quotes, totalWeight)
+	s.last = quote.Text
+	return quote
+}
+
+// pickWeightedExcluding is pickWeighted leaving out the last quote returned when
+// noRepeat is set, unless no other quote is left. Must be called with mu held.
+func (s *InMemoryService) pickWeightedExcluding(quotes []Quote, totalWeight int) Quote {
+	excluded := 0
+	if s.noRepeat {
+		for _, quote := range quotes {
+			if quote.Text == s.last {
+				excluded += quote.weight()
+			}
+		}
+		if excluded == totalWeight {
+			excluded = 0 // Nothing else to pick
+		}
+	}
+
+	target := s.rng.Intn(totalWeight - excluded)
+	for _, quote := range quotes {
+		if excluded > 0 && quote.Text == s.last {
+			continue
+		}
+		target -= quote.weight()
+		if target < 0 {
+			return quote
+		}
+	}
+	return quotes[len(quotes)-1]
+}
+
+// setQuotes atomically replaces the quote collection
+func (s *InMemoryService) setQuotes(quotes []Quote) {
+	totalWeight := 0
+	for _, quote := range quotes {
+		totalWeight += quote.weight()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.quotes = quotes
+	s.totalWeight = totalWeight
+}
+
+// count returns the number of quotes in the collection
+func (s *InMemoryService) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.quotes)
 }
@@ -0,0 +1,285 @@
+package quotes
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestInMemoryService_WeightedSelection(t *testing.T) {
+	service := NewInMemoryServiceWithQuotes([]Quote{
+		{Text: "heavy", Weight: 9},
+		{Text: "light", Weight: 1},
+	})
+
+	const draws = 10000
+	counts := make(map[string]int)
+	for i := 0; i < draws; i++ {
+		counts[service.GetRandomQuote()]++
+	}
+
+	// Expect ~90% heavy; allow generous tolerance to keep the test stable
+	heavyShare := float64(counts["heavy"]) / draws
+	if heavyShare < 0.85 || heavyShare > 0.95 {
+		t.Errorf("Expected heavy quote share around 0.9, got %.3f (%v)", heavyShare, counts)
+	}
+}
+
+func TestInMemoryService_UniformWithoutWeights(t *testing.T) {
+	service := NewInMemoryServiceWithQuotes(textQuotes([]string{"a", "b", "c", "d"}))
+
+	const draws = 10000
+	counts := make(map[string]int)
+	for i := 0; i < draws; i++ {
+		counts[service.GetRandomQuote()]++
+	}
+
+	for _, text := range []string{"a", "b", "c", "d"} {
+		share := float64(counts[text]) / draws
+		if share < 0.20 || share > 0.30 {
+			t.Errorf("Expected share around 0.25 for %q, got %.3f", text, share)
+		}
+	}
+}
+
+func TestInMemoryService_GetRandomQuoteByCategory(t *testing.T) {
+	service := NewInMemoryServiceWithQuotes([]Quote{
+		{Text: "work hard", Category: "motivation"},
+		{Text: "keep going", Category: "Motivation"},
+		{Text: "know thyself", Category: "philosophy"},
+		{Text: "uncategorized"},
+	})
+
+	for i := 0; i < 100; i++ {
+		quote := service.GetRandomQuoteByCategory("motivation")
+		if quote != "work hard" && quote != "keep going" {
+			t.Fatalf("Quote %q is not in category 'motivation'", quote)
+		}
+	}
+
+	if quote := service.GetRandomQuoteByCategory("philosophy"); quote != "know thyself" {
+		t.Errorf("Expected 'know thyself', got %q", quote)
+	}
+
+	if quote := service.GetRandomQuoteByCategory("unknown"); quote != noQuotesAvailable {
+		t.Errorf("Expected %q for unknown category, got %q", noQuotesAvailable, quote)
+	}
+
+	if quote := service.GetRandomQuoteByCategory(""); quote == noQuotesAvailable {
+		t.Error("Empty category should select from all quotes")
+	}
+}
+
+func TestInMemoryService_Seeded(t *testing.T) {
+	// The sequence for a seed is fixed by math/rand's stable source
+	want := []string{defaultQuotes[5], defaultQuotes[7], defaultQuotes[8], defaultQuotes[10], defaultQuotes[3]}
+
+	service := NewInMemoryServiceWithSeed(42)
+	for i, expected := range want {
+		if got := service.GetRandomQuote(); got != expected {
+			t.Errorf("Quote %d: expected %q, got %q", i, expected, got)
+		}
+	}
+
+	// Services with the same seed agree, whichever method draws the quotes
+	a, b := NewInMemoryServiceWithSeed(7), NewInMemoryServiceWithSeed(7)
+	for i := 0; i < 20; i++ {
+		if got, expected := a.GetRandomQuoteByCategory(""), b.GetRandomQuote(); got != expected {
+			t.Fatalf("Draw %d: seeded services diverged: %q vs %q", i, got, expected)
+		}
+	}
+}
+
+func TestInMemoryService_NoRepeat(t *testing.T) {
+	service := NewInMemoryServiceWithQuotes([]Quote{
+		{Text: "heavy", Weight: 9, Category: "a"},
+		{Text: "light", Category: "a"},
+		{Text: "other"},
+		{Text: "alone", Category: "b"},
+	})
+	service.SetNoRepeat(true)
+
+	// Concurrent callers share the last quote, so draw sequentially to check it
+	const draws = 10000
+	previous := ""
+	for i := 0; i < draws; i++ {
+		var got string
+		if i%3 == 0 {
+			got = service.GetRandomQuoteByCategory("a")
+		} else {
+			got = service.GetRandomQuote()
+		}
+		if got == previous {
+			t.Fatalf("Draw %d repeated %q", i, got)
+		}
+		previous = got
+	}
+
+	// With nothing else to pick, the only quote is returned again
+	for i := 0; i < 3; i++ {
+		if got := service.GetRandomQuoteByCategory("b"); got != "alone" {
+			t.Errorf("Expected the only quote of the category, got %q", got)
+		}
+	}
+	single := NewInMemoryServiceWithQuotes(textQuotes([]string{"only"}))
+	single.SetNoRepeat(true)
+	for i := 0; i < 3; i++ {
+		if got := single.GetRandomQuote(); got != "only" {
+			t.Errorf("Expected the only quote, got %q", got)
+		}
+	}
+}
+
+func TestInMemoryService_RepeatsByDefault(t *testing.T) {
+	service := NewInMemoryServiceWithQuotes(textQuotes([]string{"a", "b"}))
+
+	repeats := 0
+	previous := ""
+	for i := 0; i < 1000; i++ {
+		got := service.GetRandomQuote()
+		if got == previous {
+			repeats++
+		}
+		previous = got
+	}
+	if repeats == 0 {
+		t.Error("Expected uniform selection to repeat quotes sometimes")
+	}
+}
+
+func TestParseQuote(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want Quote
+	}{
+		{"WithAuthor", "Know thyself. - Socrates", Quote{Text: "Know thyself.", Author: "Socrates"}},
+		{"NoSeparator", "Anonymous wisdom", Quote{Text: "Anonymous wisdom"}},
+		{"HyphenWithoutSpaces", "Well-known words", Quote{Text: "Well-known words"}},
+		{"LastSeparatorWins", "Now - or never - Someone", Quote{Text: "Now - or never", Author: "Someone"}},
+		{"EmptyAuthor", "Dangling - ", Quote{Text: "Dangling - "}},
+		{"EmptyText", " - Nobody", Quote{Text: " - Nobody"}},
+		{"Empty", "", Quote{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseQuote(tt.text); got != tt.want {
+				t.Errorf("ParseQuote(%q) = %+v, want %+v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuiltinQuotes_Authors(t *testing.T) {
+	for i, quote := range builtinQuotes() {
+		if quote.Author == "" {
+			t.Errorf("Built-in quote %d has no author: %q", i, quote.Text)
+		}
+		if quote.String() != defaultQuotes[i] {
+			t.Errorf("Built-in quote %d serves as %q, want %q", i, quote.String(), defaultQuotes[i])
+		}
+	}
+}
+
+func TestInMemoryService_GetRandomStructuredQuote(t *testing.T) {
+	service := NewInMemoryServiceWithQuotes([]Quote{
+		{Text: "Plain text - Parsed Author", Weight: 2},
+		{Text: "Explicit", Author: "Given Author", Weight: 2},
+		{Text: "No author"},
+	})
+
+	want := map[Quote]bool{
+		{Text: "Plain text", Author: "Parsed Author", Weight: 2}: true,
+		{Text: "Explicit", Author: "Given Author", Weight: 2}:    true,
+		{Text: "No author"}: true,
+	}
+	seen := make(map[Quote]bool)
+	for i := 0; i < 200; i++ {
+		got := service.GetRandomStructuredQuote()
+		if !want[got] {
+			t.Fatalf("Unexpected structured quote %+v", got)
+		}
+		seen[got] = true
+	}
+	if len(seen) != len(want) {
+		t.Errorf("Expected every quote to be drawn, got %v", seen)
+	}
+
+	// Plain selection keeps serving the author as part of the text
+	plain := NewInMemoryServiceWithQuotes([]Quote{{Text: "Explicit", Author: "Given Author"}})
+	if got := plain.GetRandomQuote(); got != "Explicit - Given Author" {
+		t.Errorf("Expected the author appended to the plain quote, got %q", got)
+	}
+
+	empty := NewInMemoryServiceWithQuotes(nil)
+	if got := empty.GetRandomStructuredQuote(); got.Text != noQuotesAvailable || got.Author != "" {
+		t.Errorf("Expected %q without author, got %+v", noQuotesAvailable, got)
+	}
+}
+
+func TestInMemoryService_GetQuoteOfTheDay(t *testing.T) {
+	service := NewInMemoryServiceWithQuotes(textQuotes([]string{"one", "two", "three"}))
+	day := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	now := day
+	service.SetClock(func() time.Time { return now })
+
+	first := service.GetQuoteOfTheDay()
+
+	// Stable for the whole day, however quotes are otherwise drawn
+	for _, offset := range []time.Duration{time.Second, 12 * time.Hour, 24*time.Hour - time.Second} {
+		now = day.Add(offset)
+		service.GetRandomQuote()
+		if got := service.GetQuoteOfTheDay(); got != first {
+			t.Errorf("Expected %q all day, got %q at %v", first, got, now)
+		}
+	}
+
+	// The next day brings the next quote, and the cycle repeats
+	now = day.Add(24 * time.Hour)
+	second := service.GetQuoteOfTheDay()
+	if second == first {
+		t.Errorf("Expected a different quote the next day, got %q again", second)
+	}
+	now = day.Add(3 * 24 * time.Hour)
+	if got := service.GetQuoteOfTheDay(); got != first {
+		t.Errorf("Expected the quotes to cycle back to %q, got %q", first, got)
+	}
+
+	// Other instances agree
+	other := NewInMemoryServiceWithQuotes(textQuotes([]string{"one", "two", "three"}))
+	other.SetClock(func() time.Time { return now })
+	if got := other.GetQuoteOfTheDay(); got != first {
+		t.Errorf("Expected another service to pick %q, got %q", first, got)
+	}
+
+	// Dates before 1970 still select a quote
+	now = time.Date(1969, time.December, 31, 0, 0, 0, 0, time.UTC)
+	if got := service.GetQuoteOfTheDay(); got == noQuotesAvailable {
+		t.Errorf("Expected a quote before 1970, got %q", got)
+	}
+
+	if got := NewInMemoryServiceWithQuotes(nil).GetQuoteOfTheDay(); got != noQuotesAvailable {
+		t.Errorf("Expected %q from an empty collection, got %q", noQuotesAvailable, got)
+	}
+}
+
+func TestQuote_UnmarshalJSON(t *testing.T) {
+	var quotes []Quote
+	data := `["plain", {"text": "rich", "weight": 2, "category": "misc"}]`
+	if err := json.Unmarshal([]byte(data), &quotes); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	if len(quotes) != 2 {
+		t.Fatalf("Expected 2 quotes, got %d", len(quotes))
+	}
+
+	if quotes[0] != (Quote{Text: "plain"}) {
+		t.Errorf("Unexpected plain quote: %+v", quotes[0])
+	}
+
+	if quotes[1] != (Quote{Text: "rich", Weight: 2, Category: "misc"}) {
+		t.Errorf("Unexpected object quote: %+v", quotes[1])
+	}
+}
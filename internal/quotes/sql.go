@@ -0,0 +1,169 @@
+package quotes
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// sqlQueryTimeout bounds each database round trip so a slow database can't stall a handshake
+const sqlQueryTimeout = 2 * time.Second
+
+// sqlIdentifier matches table names that are safe to splice into queries
+var sqlIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// SQLService implements quotes service backed by a database table with
+// text and category columns. A random row is picked by counting the matching
+// rows and reading one at a random offset, which works on any database that
+// supports LIMIT/OFFSET and ? placeholders (SQLite, MySQL).
+// When the database fails, the last quote served is repeated, or a built-in
+// quote if none was served yet.
+type SQLService struct {
+	countAll     *sql.Stmt
+	selectAll    *sql.Stmt
+	countByCat   *sql.Stmt
+	selectByCat  *sql.Stmt
+	fallback     *InMemoryService
+	rng          *rand.Rand
+	lastQuote    string
+	lastQueryErr error
+	mu           sync.Mutex // Protects rng, lastQuote and lastQueryErr
+	queryTimeout time.Duration
+}
+
+// NewSQLService prepares the quote queries against table in db.
+// The caller keeps ownership of db; Close only releases the prepared statements.
+func NewSQLService(db *sql.DB, table string) (*SQLService, error) {
+	if !sqlIdentifier.MatchString(table) {
+		return nil, fmt.Errorf("invalid table name: %q", table)
+	}
+
+	queries := []string{
+		fmt.Sprintf("SELECT COUNT(*) FROM %s", table),
+		fmt.Sprintf("SELECT text FROM %s LIMIT 1 OFFSET ?", table),
+		fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE LOWER(category) = LOWER(?)", table),
+		fmt.Sprintf("SELECT text FROM %s WHERE LOWER(category) = LOWER(?) LIMIT 1 OFFSET ?", table),
+	}
+
+	stmts := make([]*sql.Stmt, 0, len(queries))
+	for _, query := range queries {
+		stmt, err := db.Prepare(query)
+		if err != nil {
+			for _, prepared := range stmts {
+				prepared.Close()
+			}
+			return nil, fmt.Errorf("failed to prepare quote query: %w", err)
+		}
+		stmts = append(stmts, stmt)
+	}
+
+	return &SQLService{
+		countAll:     stmts[0],
+		selectAll:    stmts[1],
+		countByCat:   stmts[2],
+		selectByCat:  stmts[3],
+		fallback:     NewInMemoryService(),
+		rng:          rand.New(rand.NewSource(time.Now().UnixNano())),
+		queryTimeout: sqlQueryTimeout,
+	}, nil
+}
+
+// GetRandomQuote returns a random quote from the table
+// This method is safe for concurrent use
+func (s *SQLService) GetRandomQuote() string {
+	return s.pick(s.countAll, s.selectAll)
+}
+
+// GetRandomQuoteByCategory returns a random quote from the given category.
+// An empty category selects from all quotes.
+// This method is safe for concurrent use
+func (s *SQLService) GetRandomQuoteByCategory(category string) string {
+	if category == "" {
+		return s.GetRandomQuote()
+	}
+	return s.pick(s.countByCat, s.selectByCat, category)
+}
+
+// GetRandomStructuredQuote returns a random quote from the table, with the author
+// parsed out of its text. This method is safe for concurrent use
+func (s *SQLService) GetRandomStructuredQuote() Quote {
+	return ParseQuote(s.GetRandomQuote())
+}
+
+// LastError returns the error of the most recent failed query, or nil if the
+// most recent query succeeded
+func (s *SQLService) LastError() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastQueryErr
+}
+
+// Close releases the prepared statements
+func (s *SQLService) Close() error {
+	var errs []error
+	for _, stmt := range []*sql.Stmt{s.countAll, s.selectAll, s.countByCat, s.selectByCat} {
+		if err := stmt.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// pick counts the rows matching filter and reads one at a random offset,
+// falling back to a cached or built-in quote on database errors
+func (s *SQLService) pick(count, selectAt *sql.Stmt, filter ...any) string {
+	ctx, cancel := context.WithTimeout(context.Background(), s.queryTimeout)
+	defer cancel()
+
+	var total int
+	if err := count.QueryRowContext(ctx, filter...).Scan(&total); err != nil {
+		return s.fail(fmt.Errorf("failed to count quotes: %w", err))
+	}
+	if total == 0 {
+		s.succeed("")
+		return noQuotesAvailable
+	}
+
+	s.mu.Lock()
+	offset := s.rng.Intn(total)
+	s.mu.Unlock()
+
+	var text string
+	args := append(filter, offset)
+	if err := selectAt.QueryRowContext(ctx, args...).Scan(&text); err != nil {
+		// Rows deleted between the two queries surface as ErrNoRows
+		return s.fail(fmt.Errorf("failed to select quote: %w", err))
+	}
+
+	s.succeed(text)
+	return text
+}
+
+// succeed records a successful query, caching text as the last known quote
+func (s *SQLService) succeed(text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastQueryErr = nil
+	if text != "" {
+		s.lastQuote = text
+	}
+}
+
+// fail records err and returns the quote to serve instead
+func (s *SQLService) fail(err error) string {
+	s.mu.Lock()
+	s.lastQueryErr = err
+	lastQuote := s.lastQuote
+	s.mu.Unlock()
+
+	if lastQuote != "" {
+		return lastQuote
+	}
+	return s.fallback.GetRandomQuote()
+}
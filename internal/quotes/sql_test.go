@@ -0,0 +1,206 @@
+package quotes
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// fakeQuotesDB is a minimal database/sql driver serving the queries SQLService
+// prepares from an in-memory table, so tests need no real database
+type fakeQuotesDB struct {
+	rows    []Quote
+	failing atomic.Bool
+}
+
+var (
+	fakeDBs   = map[string]*fakeQuotesDB{}
+	fakeDBsMu sync.Mutex
+)
+
+func init() {
+	sql.Register("fakequotes", fakeQuotesDriver{})
+}
+
+// openFakeQuotesDB registers rows under the test's name and opens a handle to them
+func openFakeQuotesDB(t *testing.T, rows []Quote) (*sql.DB, *fakeQuotesDB) {
+	t.Helper()
+
+	fake := &fakeQuotesDB{rows: rows}
+	fakeDBsMu.Lock()
+	fakeDBs[t.Name()] = fake
+	fakeDBsMu.Unlock()
+
+	db, err := sql.Open("fakequotes", t.Name())
+	if err != nil {
+		t.Fatalf("Failed to open fake database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, fake
+}
+
+type fakeQuotesDriver struct{}
+
+func (fakeQuotesDriver) Open(name string) (driver.Conn, error) {
+	fakeDBsMu.Lock()
+	defer fakeDBsMu.Unlock()
+	return &fakeQuotesConn{db: fakeDBs[name]}, nil
+}
+
+type fakeQuotesConn struct{ db *fakeQuotesDB }
+
+func (c *fakeQuotesConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeQuotesStmt{db: c.db, query: query}, nil
+}
+func (c *fakeQuotesConn) Close() error              { return nil }
+func (c *fakeQuotesConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+type fakeQuotesStmt struct {
+	db    *fakeQuotesDB
+	query string
+}
+
+func (s *fakeQuotesStmt) Close() error  { return nil }
+func (s *fakeQuotesStmt) NumInput() int { return strings.Count(s.query, "?") }
+func (s *fakeQuotesStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+
+func (s *fakeQuotesStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if s.db.failing.Load() {
+		return nil, errors.New("database is down")
+	}
+
+	matching := s.db.rows
+	if strings.Contains(s.query, "WHERE") {
+		category, _ := args[0].(string)
+		args = args[1:]
+		matching = nil
+		for _, row := range s.db.rows {
+			if strings.EqualFold(row.Category, category) {
+				matching = append(matching, row)
+			}
+		}
+	}
+
+	if strings.HasPrefix(s.query, "SELECT COUNT(*)") {
+		return &fakeQuotesRows{values: []driver.Value{int64(len(matching))}}, nil
+	}
+
+	offset, _ := args[0].(int64)
+	if int(offset) >= len(matching) {
+		return &fakeQuotesRows{}, nil
+	}
+	return &fakeQuotesRows{values: []driver.Value{matching[offset].Text}}, nil
+}
+
+// fakeQuotesRows yields at most one single-column row
+type fakeQuotesRows struct {
+	values []driver.Value
+	done   bool
+}
+
+func (r *fakeQuotesRows) Columns() []string { return []string{"value"} }
+func (r *fakeQuotesRows) Close() error      { return nil }
+func (r *fakeQuotesRows) Next(dest []driver.Value) error {
+	if r.done || r.values == nil {
+		return io.EOF
+	}
+	r.done = true
+	copy(dest, r.values)
+	return nil
+}
+
+func TestNewSQLService_InvalidTable(t *testing.T) {
+	db, _ := openFakeQuotesDB(t, nil)
+
+	if _, err := NewSQLService(db, "quotes; DROP TABLE quotes"); err == nil {
+		t.Error("Expected error for unsafe table name")
+	}
+}
+
+func TestSQLService_RandomSelection(t *testing.T) {
+	rows := []Quote{
+		{Text: "first", Category: "a"},
+		{Text: "second", Category: "b"},
+		{Text: "third", Category: "A"},
+	}
+	db, _ := openFakeQuotesDB(t, rows)
+
+	service, err := NewSQLService(db, "quotes")
+	if err != nil {
+		t.Fatalf("NewSQLService failed: %v", err)
+	}
+	defer service.Close()
+
+	seen := make(map[string]bool)
+	for i := 0; i < 200; i++ {
+		seen[service.GetRandomQuote()] = true
+	}
+	for _, row := range rows {
+		if !seen[row.Text] {
+			t.Errorf("Expected %q to be selected at least once, got %v", row.Text, seen)
+		}
+	}
+	if len(seen) != len(rows) {
+		t.Errorf("Expected only table quotes, got %v", seen)
+	}
+
+	// Category matching is case-insensitive, like the in-memory service
+	for i := 0; i < 50; i++ {
+		if quote := service.GetRandomQuoteByCategory("a"); quote != "first" && quote != "third" {
+			t.Fatalf("Expected a quote from category a, got %q", quote)
+		}
+	}
+	if quote := service.GetRandomQuoteByCategory("missing"); quote != noQuotesAvailable {
+		t.Errorf("Expected %q for empty category, got %q", noQuotesAvailable, quote)
+	}
+	if err := service.LastError(); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
+
+func TestSQLService_ErrorFallback(t *testing.T) {
+	db, fake := openFakeQuotesDB(t, []Quote{{Text: "only"}})
+
+	service, err := NewSQLService(db, "quotes")
+	if err != nil {
+		t.Fatalf("NewSQLService failed: %v", err)
+	}
+	defer service.Close()
+
+	// Without any quote served yet, a built-in quote stands in
+	fake.failing.Store(true)
+	quote := service.GetRandomQuote()
+	builtIn := false
+	for _, q := range defaultQuotes {
+		if quote == q {
+			builtIn = true
+		}
+	}
+	if !builtIn {
+		t.Errorf("Expected a built-in quote while the database is down, got %q", quote)
+	}
+	if service.LastError() == nil {
+		t.Error("Expected LastError to report the failure")
+	}
+
+	// Once a quote was served, it is repeated during outages
+	fake.failing.Store(false)
+	if quote := service.GetRandomQuote(); quote != "only" {
+		t.Fatalf("Expected quote from the database, got %q", quote)
+	}
+	if err := service.LastError(); err != nil {
+		t.Errorf("Expected LastError to clear after recovery, got %v", err)
+	}
+
+	fake.failing.Store(true)
+	if quote := service.GetRandomQuoteByCategory("any"); quote != "only" {
+		t.Errorf("Expected last known quote while the database is down, got %q", quote)
+	}
+}
@@ -0,0 +1,55 @@
+package quotes
+
+import "unicode/utf8"
+
+// ellipsis marks a quote that was cut short
+const ellipsis = "…"
+
+// TruncatingService caps the length of quotes returned by another service,
+// so oversized quotes from user-supplied files can't bloat messages
+type TruncatingService struct {
+	inner     Service
+	maxLength int
+}
+
+// NewTruncatingService wraps inner so that quotes longer than maxLength
+// characters are cut to maxLength, ending with an ellipsis
+func NewTruncatingService(inner Service, maxLength int) *TruncatingService {
+	return &TruncatingService{inner: inner, maxLength: maxLength}
+}
+
+// GetRandomQuote returns a random quote from the inner service, truncated if needed
+func (s *TruncatingService) GetRandomQuote() string {
+	return truncateQuote(s.inner.GetRandomQuote(), s.maxLength)
+}
+
+// GetRandomQuoteByCategory returns a random quote of the category, truncated if needed
+func (s *TruncatingService) GetRandomQuoteByCategory(category string) string {
+	return truncateQuote(s.inner.GetRandomQuoteByCategory(category), s.maxLength)
+}
+
+// GetRandomStructuredQuote returns a random quote from the inner service, its text
+// truncated if needed
+func (s *TruncatingService) GetRandomStructuredQuote() Quote {
+	quote := s.inner.GetRandomStructuredQuote()
+	quote.Text = truncateQuote(quote.Text, s.maxLength)
+	return quote
+}
+
+// truncateQuote cuts text to at most maxLength characters (runes), replacing the
+// tail with an ellipsis. Values < 1 disable truncation.
+func truncateQuote(text string, maxLength int) string {
+	if maxLength < 1 || utf8.RuneCountInString(text) <= maxLength {
+		return text
+	}
+
+	// Keep maxLength-1 runes so the ellipsis fits within the cap
+	kept := 0
+	for i := range text {
+		if kept == maxLength-1 {
+			return text[:i] + ellipsis
+		}
+		kept++
+	}
+	return text
+}
@@ -0,0 +1,64 @@
+package quotes
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateQuote(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		maxLength int
+		want      string
+	}{
+		{"ShorterThanCap", "short", 10, "short"},
+		{"ExactlyAtCap", "exact", 5, "exact"},
+		{"OneOverCap", "exact!", 5, "exac…"},
+		{"FarOverCap", strings.Repeat("a", 1000), 8, "aaaaaaa…"},
+		{"CapOfOne", "abc", 1, "…"},
+		{"Disabled", "unlimited", 0, "unlimited"},
+		{"MultiByteRunes", "ÄÖÜäöüß", 4, "ÄÖÜ…"},
+		{"MultiByteAtCap", "ÄÖÜ", 3, "ÄÖÜ"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncateQuote(tt.text, tt.maxLength)
+			if got != tt.want {
+				t.Errorf("truncateQuote(%q, %d) = %q, want %q", tt.text, tt.maxLength, got, tt.want)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("Truncated quote is not valid UTF-8: %q", got)
+			}
+			if tt.maxLength > 0 && utf8.RuneCountInString(got) > tt.maxLength {
+				t.Errorf("Truncated quote has %d runes, cap is %d", utf8.RuneCountInString(got), tt.maxLength)
+			}
+		})
+	}
+}
+
+func TestTruncatingService(t *testing.T) {
+	long := strings.Repeat("word ", 100)
+	inner := NewInMemoryServiceWithQuotes([]Quote{{Text: long, Category: "long"}})
+	service := NewTruncatingService(inner, 20)
+
+	if got := service.GetRandomQuote(); utf8.RuneCountInString(got) != 20 || !strings.HasSuffix(got, ellipsis) {
+		t.Errorf("Expected quote truncated to 20 runes with ellipsis, got %q", got)
+	}
+	if got := service.GetRandomQuoteByCategory("long"); utf8.RuneCountInString(got) != 20 || !strings.HasSuffix(got, ellipsis) {
+		t.Errorf("Expected category quote truncated to 20 runes with ellipsis, got %q", got)
+	}
+
+	structured := NewTruncatingService(NewInMemoryServiceWithQuotes([]Quote{{Text: long, Author: "Someone"}}), 20)
+	if got := structured.GetRandomStructuredQuote(); utf8.RuneCountInString(got.Text) != 20 || got.Author != "Someone" {
+		t.Errorf("Expected structured text truncated to 20 runes and author kept, got %+v", got)
+	}
+
+	// Short quotes pass through unchanged
+	short := NewTruncatingService(NewInMemoryServiceWithQuotes(textQuotes([]string{"brief"})), 20)
+	if got := short.GetRandomQuote(); got != "brief" {
+		t.Errorf("Expected short quote unchanged, got %q", got)
+	}
+}
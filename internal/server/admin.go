@@ -0,0 +1,204 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+
+	"go.opentelemetry.io/otel/trace"
+	"pow/internal/pow"
+	"pow/pkg/protocol"
+)
+
+// statsProvider is implemented by PoW services that track issued challenges
+type statsProvider interface {
+	Stats() (pow.ServiceStats, error)
+}
+
+// difficultySetter is implemented by PoW services whose difficulty can change at runtime
+type difficultySetter interface {
+	SetDifficulty(difficulty int)
+}
+
+// AdminServer answers stats, difficulty and drain requests for a Server on a
+// separate listener, speaking the same framing as the main protocol. Every request
+// must carry the shared token; a connection may send any number of requests.
+type AdminServer struct {
+	addr               string
+	token              string
+	srv                *Server
+	validateDifficulty func(difficulty int) error // nil accepts any difficulty
+	logger             *slog.Logger
+	wg                 sync.WaitGroup
+}
+
+// NewAdminServer creates an admin server for srv listening on addr. Requests must
+// carry token, and an empty token rejects every request. validateDifficulty vets
+// requested difficulties before they are applied; nil accepts any difficulty. A nil
+// logger discards all logs.
+func NewAdminServer(addr, token string, srv *Server, validateDifficulty func(difficulty int) error, logger *slog.Logger) *AdminServer {
+	return &AdminServer{
+		addr:               addr,
+		token:              token,
+		srv:                srv,
+		validateDifficulty: validateDifficulty,
+		logger:             orDiscard(logger),
+	}
+}
+
+// ListenAndServe serves admin requests on the configured address until ctx is canceled
+func (a *AdminServer) ListenAndServe(ctx context.Context) error {
+	ln, err := net.Listen("tcp", a.addr)
+	if err != nil {
+		return fmt.Errorf("failed to start admin listener: %w", err)
+	}
+	return a.Serve(ctx, ln)
+}
+
+// Serve serves admin requests on ln until ctx is canceled, then closes ln and
+// waits for open admin connections, whose pending I/O ctx also aborts
+func (a *AdminServer) Serve(ctx context.Context, ln net.Listener) error {
+	a.logger.Info("Admin server started", "address", ln.Addr().String())
+
+	stop := context.AfterFunc(ctx, func() { ln.Close() })
+	defer stop()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			a.logger.Error("Failed to accept admin connection", "error", err)
+			continue
+		}
+
+		a.wg.Add(1)
+		go func() {
+			defer a.wg.Done()
+			a.handleConnection(ctx, conn)
+		}()
+	}
+
+	a.wg.Wait()
+	a.logger.Info("Admin server stopped")
+	return nil
+}
+
+// handleConnection answers admin requests until the peer disconnects, idles past
+// ReadTimeout, or ctx ends
+func (a *AdminServer) handleConnection(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+
+	cs := &connState{
+		conn: conn,
+		id:   newConnID(),
+		span: trace.SpanFromContext(ctx), // Admin requests are not traced
+	}
+	cs.framer = a.srv.newFramer(conn)
+	cs.logger = a.logger.With("conn_id", cs.id, "remote_addr", conn.RemoteAddr().String(), "admin", true)
+
+	for {
+		var raw json.RawMessage
+		if err := cs.framer.ReadCtx(ctx, &raw); err != nil {
+			if !errors.Is(err, io.EOF) && ctx.Err() == nil {
+				cs.logger.Debug("Admin connection closed", "error", err)
+			}
+			return
+		}
+
+		if err := a.handleRequest(ctx, cs, raw); err != nil {
+			cs.logger.Warn("Admin request failed", "error", err)
+			return
+		}
+	}
+}
+
+// handleRequest dispatches one admin request and writes its answer. It returns
+// an error only when the connection should be closed.
+func (a *AdminServer) handleRequest(ctx context.Context, cs *connState, raw json.RawMessage) error {
+	var req protocol.SetDifficultyMessage
+	if err := a.srv.codec.Decode(raw, &req); err != nil {
+		a.srv.sendError(ctx, cs, protocol.ErrCodeBadRequest, "Invalid message: "+protocol.ViolationReason(err))
+		return err
+	}
+
+	if !a.authorized(req.Token) {
+		a.srv.sendError(ctx, cs, protocol.ErrCodeUnauthorized, "Invalid admin token")
+		return errors.New("invalid admin token")
+	}
+
+	switch req.Type {
+	case protocol.MsgTypeStatsRequest:
+	case protocol.MsgTypeSetDifficulty:
+		if err := a.setDifficulty(req.Difficulty); err != nil {
+			a.srv.sendError(ctx, cs, protocol.ErrCodeBadRequest, err.Error())
+			return nil
+		}
+	case protocol.MsgTypeDrain:
+		cs.logger.Info("Drain requested by admin")
+		a.srv.Drain()
+	default:
+		a.srv.sendError(ctx, cs, protocol.ErrCodeBadRequest, fmt.Sprintf("Unsupported admin message type %q", req.Type))
+		return nil
+	}
+
+	stats, err := a.stats()
+	if err != nil {
+		a.srv.sendError(ctx, cs, protocol.ErrCodeInternal, "Failed to collect stats")
+		return err
+	}
+	return cs.framer.WriteCtx(ctx, stats)
+}
+
+// authorized reports whether token matches the admin token, in constant time
+func (a *AdminServer) authorized(token string) bool {
+	if a.token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) == 1
+}
+
+// setDifficulty validates and applies a new difficulty for newly issued challenges
+func (a *AdminServer) setDifficulty(difficulty int) error {
+	setter, ok := a.srv.powService.(difficultySetter)
+	if !ok {
+		return errors.New("PoW service does not support changing difficulty")
+	}
+	if a.validateDifficulty != nil {
+		if err := a.validateDifficulty(difficulty); err != nil {
+			return err
+		}
+	}
+
+	previous := a.srv.powService.GetDifficulty()
+	setter.SetDifficulty(difficulty)
+	a.logger.Info("Difficulty changed by admin", "previous", previous, "difficulty", difficulty)
+	return nil
+}
+
+// stats snapshots the server and its PoW service
+func (a *AdminServer) stats() (protocol.StatsResponseMessage, error) {
+	msg := protocol.StatsResponseMessage{
+		BaseMessage:       a.srv.codec.NewBaseMessage(protocol.MsgTypeStatsResponse),
+		Difficulty:        a.srv.powService.GetDifficulty(),
+		ActiveConnections: int(a.srv.GetActiveConnections()),
+		QueuedConnections: int(a.srv.GetQueuedConnections()),
+		Draining:          a.srv.IsDraining(),
+	}
+
+	if provider, ok := a.srv.powService.(statsProvider); ok {
+		serviceStats, err := provider.Stats()
+		if err != nil {
+			return msg, fmt.Errorf("failed to collect PoW service stats: %w", err)
+		}
+		msg.ActiveChallenges = serviceStats.ActiveChallenges
+	}
+	return msg, nil
+}
@@ -0,0 +1,187 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"pow/internal/pow"
+	"pow/internal/quotes"
+	"pow/pkg/protocol"
+)
+
+const testAdminToken = "0123456789abcdef"
+
+func TestAdminServer(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	powService := pow.NewSHA256HashcashService(1, 5*time.Minute)
+	srv := NewServer(Config{
+		ReadTimeout:     5 * time.Second,
+		WriteTimeout:    5 * time.Second,
+		MaxConnections:  10,
+		ShutdownTimeout: 1 * time.Second,
+	}, powService, quotes.NewInMemoryService(), logger)
+
+	validate := func(difficulty int) error {
+		if difficulty < 1 || difficulty > 5 {
+			return fmt.Errorf("POW_DIFFICULTY must be between 1 and 5, got: %d", difficulty)
+		}
+		return nil
+	}
+
+	adminLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	adminAddr := adminLn.Addr().String()
+
+	adminCtx, stopAdmin := context.WithCancel(context.Background())
+	defer stopAdmin()
+
+	adminDone := make(chan error, 1)
+	go func() {
+		adminDone <- NewAdminServer("", testAdminToken, srv, validate, logger).Serve(adminCtx, adminLn)
+	}()
+
+	conn, err := net.Dial("tcp", adminAddr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	// roundTrip sends req and returns the stats response, or the error message
+	roundTrip := func(req interface{}) (protocol.StatsResponseMessage, protocol.ErrorMessage) {
+		t.Helper()
+		if err := protocol.WriteMessage(conn, req, 5*time.Second); err != nil {
+			t.Fatalf("Failed to send request: %v", err)
+		}
+		var resp struct {
+			protocol.StatsResponseMessage
+			Code    protocol.ErrorCode `json:"code"`
+			Message string             `json:"message"`
+		}
+		if err := protocol.ReadMessage(conn, &resp, 5*time.Second); err != nil {
+			t.Fatalf("Failed to read response: %v", err)
+		}
+		return resp.StatsResponseMessage, protocol.ErrorMessage{
+			BaseMessage: resp.BaseMessage,
+			Code:        resp.Code,
+			Message:     resp.Message,
+		}
+	}
+
+	if _, err := powService.GenerateChallenge(); err != nil {
+		t.Fatalf("Failed to generate challenge: %v", err)
+	}
+
+	t.Run("Stats", func(t *testing.T) {
+		stats, _ := roundTrip(protocol.StatsRequestMessage{
+			BaseMessage: protocol.NewBaseMessage(protocol.MsgTypeStatsRequest),
+			Token:       testAdminToken,
+		})
+		if stats.Type != protocol.MsgTypeStatsResponse {
+			t.Fatalf("Expected stats response, got %q", stats.Type)
+		}
+		if stats.Difficulty != 1 {
+			t.Errorf("Expected difficulty 1, got %d", stats.Difficulty)
+		}
+		if stats.ActiveChallenges != 1 {
+			t.Errorf("Expected 1 active challenge, got %d", stats.ActiveChallenges)
+		}
+		if stats.ActiveConnections != 0 || stats.QueuedConnections != 0 {
+			t.Errorf("Expected no connections, got %d active and %d queued", stats.ActiveConnections, stats.QueuedConnections)
+		}
+	})
+
+	t.Run("SetDifficulty", func(t *testing.T) {
+		stats, _ := roundTrip(protocol.SetDifficultyMessage{
+			BaseMessage: protocol.NewBaseMessage(protocol.MsgTypeSetDifficulty),
+			Token:       testAdminToken,
+			Difficulty:  3,
+		})
+		if stats.Type != protocol.MsgTypeStatsResponse {
+			t.Fatalf("Expected stats response, got %q", stats.Type)
+		}
+		if stats.Difficulty != 3 {
+			t.Errorf("Expected reported difficulty 3, got %d", stats.Difficulty)
+		}
+		if got := powService.GetDifficulty(); got != 3 {
+			t.Errorf("Expected service difficulty 3, got %d", got)
+		}
+	})
+
+	t.Run("InvalidDifficulty", func(t *testing.T) {
+		_, errMsg := roundTrip(protocol.SetDifficultyMessage{
+			BaseMessage: protocol.NewBaseMessage(protocol.MsgTypeSetDifficulty),
+			Token:       testAdminToken,
+			Difficulty:  99,
+		})
+		if errMsg.Type != protocol.MsgTypeError || errMsg.Code != protocol.ErrCodeBadRequest {
+			t.Fatalf("Expected bad_request error, got type %q code %q", errMsg.Type, errMsg.Code)
+		}
+		if got := powService.GetDifficulty(); got != 3 {
+			t.Errorf("Expected difficulty to stay 3, got %d", got)
+		}
+	})
+
+	t.Run("Drain", func(t *testing.T) {
+		stats, _ := roundTrip(protocol.DrainMessage{
+			BaseMessage: protocol.NewBaseMessage(protocol.MsgTypeDrain),
+			Token:       testAdminToken,
+		})
+		if stats.Type != protocol.MsgTypeStatsResponse || !stats.Draining {
+			t.Fatalf("Expected stats response reporting draining, got: %+v", stats)
+		}
+		if !srv.IsDraining() {
+			t.Error("Expected server to be draining")
+		}
+	})
+
+	t.Run("WrongToken", func(t *testing.T) {
+		_, errMsg := roundTrip(protocol.SetDifficultyMessage{
+			BaseMessage: protocol.NewBaseMessage(protocol.MsgTypeSetDifficulty),
+			Token:       "wrong",
+			Difficulty:  1,
+		})
+		if errMsg.Type != protocol.MsgTypeError || errMsg.Code != protocol.ErrCodeUnauthorized {
+			t.Fatalf("Expected unauthorized error, got type %q code %q", errMsg.Type, errMsg.Code)
+		}
+		if got := powService.GetDifficulty(); got != 3 {
+			t.Errorf("Expected difficulty to stay 3, got %d", got)
+		}
+
+		// An unauthorized peer is disconnected
+		var msg protocol.ErrorMessage
+		if err := protocol.ReadMessage(conn, &msg, 5*time.Second); err == nil {
+			t.Error("Expected connection to be closed after a wrong token")
+		}
+	})
+
+	// Shutdown closes the listener and idle admin connections
+	idle, err := net.Dial("tcp", adminAddr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer idle.Close()
+
+	stopAdmin()
+	select {
+	case err := <-adminDone:
+		if err != nil {
+			t.Errorf("Admin server returned error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Admin server did not shut down")
+	}
+
+	if _, err := net.Dial("tcp", adminAddr); err == nil {
+		t.Error("Expected admin listener to be closed")
+	}
+}
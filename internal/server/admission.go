@@ -0,0 +1,97 @@
+package server
+
+import (
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// admit starts serving conn, accepted on ep, if a connection slot is free. Otherwise it queues conn
+// to wait for one, or closes it when queueing is disabled or the queue is full.
+// Only accept loops call admit, and shutdown waits for them all to return before
+// its wg.Wait, so the wg.Add here never races it. Several accept loops may call
+// admit concurrently.
+func (s *Server) admit(conn net.Conn, ep *endpoint) {
+	if s.tryAcquireSlot() {
+		s.wg.Add(1)
+		atomic.AddInt32(&s.activeConns, 1)
+		go s.serveSlot(conn, ep)
+		return
+	}
+
+	// Reserve the queue place before checking, so concurrent admits can't overfill it
+	if !s.queueEnabled() || atomic.AddInt32(&s.queued, 1) > int32(s.config.AcceptQueueSize) {
+		if s.queueEnabled() {
+			atomic.AddInt32(&s.queued, -1)
+		}
+		s.logger.Warn("Max connections reached, rejecting connection",
+			"remote_addr", conn.RemoteAddr().String())
+		conn.Close()
+		return
+	}
+
+	s.wg.Add(1)
+	go s.waitForSlot(conn, ep)
+}
+
+// waitForSlot holds a queued connection until a slot frees up, closing it
+// if none does within AcceptQueueTimeout or the server shuts down first
+func (s *Server) waitForSlot(conn net.Conn, ep *endpoint) {
+	timer := time.NewTimer(s.config.AcceptQueueTimeout)
+	defer timer.Stop()
+
+	select {
+	case s.slots <- struct{}{}:
+		atomic.AddInt32(&s.queued, -1)
+		atomic.AddInt32(&s.activeConns, 1)
+		s.serveSlot(conn, ep)
+	case <-timer.C:
+		atomic.AddInt32(&s.queued, -1)
+		s.logger.Warn("No connection slot freed up in time, rejecting connection",
+			"remote_addr", conn.RemoteAddr().String(),
+			"waited", s.config.AcceptQueueTimeout)
+		conn.Close()
+		s.wg.Done()
+	case <-s.shutdownCh:
+		atomic.AddInt32(&s.queued, -1)
+		conn.Close()
+		s.wg.Done()
+	}
+}
+
+// serveSlot handles conn on an acquired slot, freeing the slot afterwards
+func (s *Server) serveSlot(conn net.Conn, ep *endpoint) {
+	defer s.releaseSlot()
+	s.handleEndpointConnection(s.connCtx, conn, ep)
+}
+
+// tryAcquireSlot takes a connection slot without waiting, always succeeding
+// when MaxConnections is unlimited
+func (s *Server) tryAcquireSlot() bool {
+	if s.slots == nil {
+		return true
+	}
+	select {
+	case s.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// releaseSlot frees a slot taken by tryAcquireSlot or waitForSlot
+func (s *Server) releaseSlot() {
+	if s.slots != nil {
+		<-s.slots
+	}
+}
+
+// queueEnabled reports whether connections over MaxConnections may wait for a slot
+func (s *Server) queueEnabled() bool {
+	return s.slots != nil && s.config.AcceptQueueSize > 0 && s.config.AcceptQueueTimeout > 0
+}
+
+// GetQueuedConnections returns the number of connections waiting for a slot
+func (s *Server) GetQueuedConnections() int32 {
+	return atomic.LoadInt32(&s.queued)
+}
@@ -0,0 +1,297 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"pow/internal/pow"
+	"pow/internal/quotes"
+	"pow/pkg/protocol"
+)
+
+// burst opens count connections at once and completes a handshake on each after
+// hold, so the first connections keep their slots while the rest arrive.
+// It returns how many connections got a quote.
+func burst(t *testing.T, addr string, powService pow.ChallengeService, count int, hold time.Duration) int32 {
+	t.Helper()
+
+	conns := make([]net.Conn, count)
+	for i := range conns {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		defer conn.Close()
+		conns[i] = conn
+	}
+
+	var succeeded int32
+	var wg sync.WaitGroup
+	for _, conn := range conns {
+		wg.Add(1)
+		go func(conn net.Conn) {
+			defer wg.Done()
+
+			var challengeMsg protocol.ChallengeMessage
+			if err := protocol.ReadMessage(conn, &challengeMsg, 5*time.Second); err != nil {
+				return // Rejected
+			}
+			time.Sleep(hold)
+
+			nonce, err := powService.(pow.SolverService).SolveChallenge(context.Background(), challengeMsg.Challenge, challengeMsg.Difficulty)
+			if err != nil {
+				t.Errorf("Failed to solve challenge: %v", err)
+				return
+			}
+			proofMsg := protocol.ProofMessage{
+				BaseMessage: protocol.NewBaseMessage(protocol.MsgTypeProof),
+				Challenge:   challengeMsg.Challenge,
+				Nonce:       nonce,
+			}
+			if err := protocol.WriteMessage(conn, proofMsg, 5*time.Second); err != nil {
+				return
+			}
+
+			var quoteMsg protocol.QuoteMessage
+			if err := protocol.ReadMessage(conn, &quoteMsg, 5*time.Second); err == nil && quoteMsg.Type == protocol.MsgTypeQuote {
+				atomic.AddInt32(&succeeded, 1)
+			}
+		}(conn)
+	}
+	wg.Wait()
+
+	return succeeded
+}
+
+func TestServer_AcceptQueue(t *testing.T) {
+	const maxConnections, burstSize = 2, 5
+	newConfig := func(queueSize int, queueTimeout time.Duration) Config {
+		return Config{
+			ReadTimeout:        5 * time.Second,
+			WriteTimeout:       5 * time.Second,
+			MaxConnections:     maxConnections,
+			ShutdownTimeout:    1 * time.Second,
+			AcceptQueueSize:    queueSize,
+			AcceptQueueTimeout: queueTimeout,
+		}
+	}
+
+	t.Run("BurstWaitsForSlots", func(t *testing.T) {
+		powService := pow.NewSHA256HashcashService(1, 5*time.Minute)
+		addr := startTestServer(t, newConfig(burstSize, 5*time.Second), powService)
+
+		if got := burst(t, addr, powService, burstSize, 100*time.Millisecond); got != burstSize {
+			t.Errorf("Expected all %d connections served after waiting, got %d", burstSize, got)
+		}
+	})
+
+	t.Run("QueueFullRejects", func(t *testing.T) {
+		powService := pow.NewSHA256HashcashService(1, 5*time.Minute)
+		addr := startTestServer(t, newConfig(1, 5*time.Second), powService)
+
+		// Two connections are served, one waits, the rest are closed right away
+		if got := burst(t, addr, powService, burstSize, 100*time.Millisecond); got != maxConnections+1 {
+			t.Errorf("Expected %d connections served, got %d", maxConnections+1, got)
+		}
+	})
+
+	t.Run("QueueTimeoutRejects", func(t *testing.T) {
+		powService := pow.NewSHA256HashcashService(1, 5*time.Minute)
+		addr := startTestServer(t, newConfig(burstSize, 50*time.Millisecond), powService)
+
+		// Slots are held far longer than a queued connection may wait
+		if got := burst(t, addr, powService, burstSize, 500*time.Millisecond); got != maxConnections {
+			t.Errorf("Expected only the %d connections with slots served, got %d", maxConnections, got)
+		}
+	})
+
+	t.Run("NoQueueRejects", func(t *testing.T) {
+		powService := pow.NewSHA256HashcashService(1, 5*time.Minute)
+		addr := startTestServer(t, newConfig(0, 0), powService)
+
+		if got := burst(t, addr, powService, burstSize, 100*time.Millisecond); got != maxConnections {
+			t.Errorf("Expected %d connections served without a queue, got %d", maxConnections, got)
+		}
+	})
+}
+
+func TestServer_AcceptWorkersBurst(t *testing.T) {
+	const conns = 100
+	addr := startTestServer(t, Config{
+		ReadTimeout:     5 * time.Second,
+		WriteTimeout:    5 * time.Second,
+		MaxConnections:  conns,
+		ShutdownTimeout: time.Second,
+		AcceptWorkers:   4,
+	}, pow.NewSHA256HashcashService(1, time.Minute))
+
+	// Every connection of a simultaneous burst is accepted and handed a challenge
+	var wg sync.WaitGroup
+	errs := make(chan error, conns)
+	start := make(chan struct{})
+	for i := 0; i < conns; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			conn, err := net.Dial("tcp", addr)
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer conn.Close()
+
+			var challengeMsg protocol.ChallengeMessage
+			if err := protocol.ReadMessage(conn, &challengeMsg, 5*time.Second); err != nil {
+				errs <- err
+				return
+			}
+			if challengeMsg.Type != protocol.MsgTypeChallenge {
+				errs <- fmt.Errorf("expected a challenge, got type %q", challengeMsg.Type)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+
+	failed := 0
+	for err := range errs {
+		if failed == 0 {
+			t.Errorf("Connection not served: %v", err)
+		}
+		failed++
+	}
+	if failed > 0 {
+		t.Errorf("%d of %d connections not served", failed, conns)
+	}
+}
+
+func TestServer_AcceptWorkersShutdown(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+	srv := NewServer(Config{ShutdownTimeout: time.Second, AcceptWorkers: 4}, pow.NewSHA256HashcashService(1, time.Minute), quotes.NewInMemoryService(), logger)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(ctx, ln) }()
+	<-srv.ready
+
+	// Every worker must leave its Accept for Serve to return
+	cancel()
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("Serve returned: %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Serve did not return after shutdown")
+	}
+}
+
+// tempAcceptError is a temporary Accept error, like running out of file descriptors
+type tempAcceptError struct{}
+
+func (tempAcceptError) Error() string   { return "too many open files" }
+func (tempAcceptError) Timeout() bool   { return false }
+func (tempAcceptError) Temporary() bool { return true }
+
+// scriptedListener returns errs from Accept one by one, then blocks until closed
+type scriptedListener struct {
+	mu     sync.Mutex
+	errs   []error
+	calls  []time.Time // When each Accept was called
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (l *scriptedListener) Accept() (net.Conn, error) {
+	l.mu.Lock()
+	l.calls = append(l.calls, time.Now())
+	if len(l.errs) > 0 {
+		err := l.errs[0]
+		l.errs = l.errs[1:]
+		l.mu.Unlock()
+		return nil, err
+	}
+	l.mu.Unlock()
+
+	<-l.closed
+	return nil, net.ErrClosed
+}
+
+func (l *scriptedListener) Close() error {
+	l.once.Do(func() { close(l.closed) })
+	return nil
+}
+
+func (l *scriptedListener) Addr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}
+}
+
+func TestServer_AcceptErrors(t *testing.T) {
+	broken := errors.New("listener broken")
+	ln := &scriptedListener{
+		errs:   []error{tempAcceptError{}, tempAcceptError{}, tempAcceptError{}, broken},
+		closed: make(chan struct{}),
+	}
+
+	var mu sync.Mutex
+	var reported []int
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError + 1, // Every failure is logged as an error
+	}))
+	srv := NewServer(Config{
+		ShutdownTimeout: time.Second,
+		OnAcceptError: func(err error, consecutive int) {
+			mu.Lock()
+			defer mu.Unlock()
+			reported = append(reported, consecutive)
+		},
+	}, pow.NewSHA256HashcashService(1, time.Minute), quotes.NewInMemoryService(), logger)
+
+	// The permanent error ends Serve without ctx being canceled
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(context.Background(), ln) }()
+	select {
+	case err := <-served:
+		if !errors.Is(err, broken) {
+			t.Errorf("Expected Serve to return the permanent error, got: %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Serve did not return after a permanent Accept error")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if fmt.Sprint(reported) != "[1 2 3 4]" {
+		t.Errorf("Expected every failure reported with its consecutive count, got %v", reported)
+	}
+
+	// Each retry waits at least twice as long as the one before
+	ln.mu.Lock()
+	defer ln.mu.Unlock()
+	if len(ln.calls) != 4 {
+		t.Fatalf("Expected 4 Accept calls, got %d", len(ln.calls))
+	}
+	for i := 1; i < len(ln.calls); i++ {
+		want := minAcceptBackoff << (i - 1)
+		if gap := ln.calls[i].Sub(ln.calls[i-1]); gap < want {
+			t.Errorf("Retry %d came after %v, expected a backoff of at least %v", i, gap, want)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"pow/pkg/protocol"
+)
+
+// auditBufferSize is the number of audit events queued before new ones are dropped
+const auditBufferSize = 1024
+
+// AuditHook receives every challenge the server issues and the outcome of every
+// proof it receives. addr is the client's remote address. For failed proofs,
+// reason is the error code sent to the client; it is empty on success and
+// AuditReasonTrusted when a trusted token stood in for the proof.
+// Calls are made from a single goroutine, never from the handshake itself.
+type AuditHook interface {
+	OnChallengeIssued(addr, challenge string)
+	OnProofResult(addr, challenge string, ok bool, reason string)
+}
+
+// HandshakeTimingHook is an AuditHook that also receives the timing of every
+// handshake whose proof arrived, valid or not, just before its proof result
+type HandshakeTimingHook interface {
+	AuditHook
+	OnHandshakeTiming(addr, challenge string, timing HandshakeTiming)
+}
+
+// AuditReasonTrusted is the reason given with the successful proof result of a
+// handshake whose proof was waived for a trusted token, so it is never mistaken
+// for a verified one
+const AuditReasonTrusted = "trusted"
+
+// NoopAuditHook discards all audit events
+type NoopAuditHook struct{}
+
+// OnChallengeIssued does nothing
+func (NoopAuditHook) OnChallengeIssued(addr, challenge string) {}
+
+// OnProofResult does nothing
+func (NoopAuditHook) OnProofResult(addr, challenge string, ok bool, reason string) {}
+
+// auditRecord is one line written by JSONLinesAuditHook
+type auditRecord struct {
+	Time      time.Time `json:"time"`
+	Event     string    `json:"event"` // "challenge_issued", "handshake_timing" or "proof_result"
+	Addr      string    `json:"addr"`
+	Challenge string    `json:"challenge"`
+	OK        *bool     `json:"ok,omitempty"` // Set only for proof results
+	Reason    string    `json:"reason,omitempty"`
+
+	// Set only for handshake timings, in milliseconds
+	TimeToChallengeMs *float64 `json:"time_to_challenge_ms,omitempty"`
+	ProofWaitMs       *float64 `json:"proof_wait_ms,omitempty"`
+}
+
+// JSONLinesAuditHook writes each audit event as one JSON object per line
+type JSONLinesAuditHook struct {
+	w   io.Writer
+	mu  sync.Mutex       // Serializes writes so lines never interleave
+	now func() time.Time // Overridable for tests
+}
+
+// NewJSONLinesAuditHook creates an audit hook writing JSON lines to w
+func NewJSONLinesAuditHook(w io.Writer) *JSONLinesAuditHook {
+	return &JSONLinesAuditHook{w: w, now: time.Now}
+}
+
+// OnChallengeIssued records an issued challenge
+func (h *JSONLinesAuditHook) OnChallengeIssued(addr, challenge string) {
+	h.write(auditRecord{Event: "challenge_issued", Addr: addr, Challenge: challenge})
+}
+
+// OnProofResult records the outcome of a proof
+func (h *JSONLinesAuditHook) OnProofResult(addr, challenge string, ok bool, reason string) {
+	h.write(auditRecord{Event: "proof_result", Addr: addr, Challenge: challenge, OK: &ok, Reason: reason})
+}
+
+// OnHandshakeTiming records where the time of a handshake went
+func (h *JSONLinesAuditHook) OnHandshakeTiming(addr, challenge string, timing HandshakeTiming) {
+	timeToChallenge := float64(timing.TimeToChallenge) / float64(time.Millisecond)
+	proofWait := float64(timing.ProofWait) / float64(time.Millisecond)
+	h.write(auditRecord{Event: "handshake_timing", Addr: addr, Challenge: challenge, TimeToChallengeMs: &timeToChallenge, ProofWaitMs: &proofWait})
+}
+
+// write appends record as a single line; write errors are ignored since
+// auditing must never affect serving clients
+func (h *JSONLinesAuditHook) write(record auditRecord) {
+	record.Time = h.now().UTC()
+	line, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.w.Write(append(line, '\n'))
+}
+
+// auditEvent is a queued call to an AuditHook
+type auditEvent struct {
+	issued    bool // OnChallengeIssued if true, OnProofResult otherwise unless timing is set
+	addr      string
+	challenge string
+	ok        bool
+	reason    string
+	timing    *HandshakeTiming // OnHandshakeTiming if set
+}
+
+// asyncAuditHook queues events for delivery by a background goroutine so a
+// slow sink can't stall handshakes. Events are dropped when the queue is full.
+type asyncAuditHook struct {
+	hook    AuditHook
+	timing  HandshakeTimingHook // hook if it is one, nil otherwise
+	events  chan auditEvent
+	done    chan struct{} // Closed once the queue is drained after close
+	dropped int64         // Accessed atomically
+	closed  bool
+	mu      sync.RWMutex // Protects closed and sending on events
+}
+
+// newAsyncAuditHook starts delivering events to hook
+func newAsyncAuditHook(hook AuditHook, bufferSize int) *asyncAuditHook {
+	a := &asyncAuditHook{
+		hook:   hook,
+		events: make(chan auditEvent, bufferSize),
+		done:   make(chan struct{}),
+	}
+	a.timing, _ = hook.(HandshakeTimingHook)
+	go a.run()
+	return a
+}
+
+// run delivers queued events until the queue is closed and drained
+func (a *asyncAuditHook) run() {
+	defer close(a.done)
+	for ev := range a.events {
+		switch {
+		case ev.issued:
+			a.hook.OnChallengeIssued(ev.addr, ev.challenge)
+		case ev.timing != nil:
+			a.timing.OnHandshakeTiming(ev.addr, ev.challenge, *ev.timing)
+		default:
+			a.hook.OnProofResult(ev.addr, ev.challenge, ev.ok, ev.reason)
+		}
+	}
+}
+
+// OnChallengeIssued queues an issued challenge
+func (a *asyncAuditHook) OnChallengeIssued(addr, challenge string) {
+	a.enqueue(auditEvent{issued: true, addr: addr, challenge: challenge})
+}
+
+// OnProofResult queues a proof outcome
+func (a *asyncAuditHook) OnProofResult(addr, challenge string, ok bool, reason string) {
+	a.enqueue(auditEvent{addr: addr, challenge: challenge, ok: ok, reason: reason})
+}
+
+// OnHandshakeTiming queues a handshake timing, if the hook wants timings
+func (a *asyncAuditHook) OnHandshakeTiming(addr, challenge string, timing HandshakeTiming) {
+	if a.timing != nil {
+		a.enqueue(auditEvent{addr: addr, challenge: challenge, timing: &timing})
+	}
+}
+
+// enqueue queues ev without blocking, dropping it if the queue is full or closed
+func (a *asyncAuditHook) enqueue(ev auditEvent) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if a.closed {
+		atomic.AddInt64(&a.dropped, 1)
+		return
+	}
+	select {
+	case a.events <- ev:
+	default:
+		atomic.AddInt64(&a.dropped, 1)
+	}
+}
+
+// close stops accepting events and waits until queued ones are delivered.
+// It returns the number of events dropped over the hook's lifetime.
+func (a *asyncAuditHook) close() int64 {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.events)
+	}
+	a.mu.Unlock()
+
+	<-a.done
+	return atomic.LoadInt64(&a.dropped)
+}
+
+// auditChallengeIssued reports a challenge sent on cs, if auditing is enabled
+func (s *Server) auditChallengeIssued(cs *connState, challenge string) {
+	if s.audit != nil {
+		s.audit.OnChallengeIssued(cs.conn.RemoteAddr().String(), challenge)
+	}
+}
+
+// auditHandshakeTiming reports the timing of a handshake on cs, if auditing is enabled
+func (s *Server) auditHandshakeTiming(cs *connState, challenge string, timing HandshakeTiming) {
+	if s.audit != nil {
+		s.audit.OnHandshakeTiming(cs.conn.RemoteAddr().String(), challenge, timing)
+	}
+}
+
+// auditProofResult reports the outcome of a proof received on cs, if auditing is
+// enabled. code is the error sent to the client, empty on success.
+func (s *Server) auditProofResult(cs *connState, challenge string, code protocol.ErrorCode) {
+	if s.audit != nil {
+		s.audit.OnProofResult(cs.conn.RemoteAddr().String(), challenge, code == "", string(code))
+	}
+}
+
+// auditTrustedHandshake reports a handshake on cs whose proof was waived for a
+// trusted token, if auditing is enabled
+func (s *Server) auditTrustedHandshake(cs *connState, challenge string) {
+	if s.audit != nil {
+		s.audit.OnProofResult(cs.conn.RemoteAddr().String(), challenge, true, AuditReasonTrusted)
+	}
+}
+
+// closeAudit flushes pending audit events, reporting any that were dropped
+func (s *Server) closeAudit() {
+	if s.audit == nil {
+		return
+	}
+	if dropped := s.audit.close(); dropped > 0 {
+		s.logger.Warn("Audit events dropped", "count", dropped)
+	}
+}
@@ -0,0 +1,339 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"pow/internal/pow"
+	"pow/internal/quotes"
+	"pow/pkg/protocol"
+)
+
+// recordedAuditEvent is one call received by recordingAuditHook
+type recordedAuditEvent struct {
+	event     string
+	addr      string
+	challenge string
+	ok        bool
+	reason    string
+}
+
+// recordingAuditHook collects audit events for assertions
+type recordingAuditHook struct {
+	events []recordedAuditEvent
+	mu     sync.Mutex
+}
+
+func (h *recordingAuditHook) OnChallengeIssued(addr, challenge string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.events = append(h.events, recordedAuditEvent{event: "issued", addr: addr, challenge: challenge})
+}
+
+func (h *recordingAuditHook) OnProofResult(addr, challenge string, ok bool, reason string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.events = append(h.events, recordedAuditEvent{event: "result", addr: addr, challenge: challenge, ok: ok, reason: reason})
+}
+
+func (h *recordingAuditHook) snapshot() []recordedAuditEvent {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]recordedAuditEvent(nil), h.events...)
+}
+
+func TestServer_AuditHook(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	difficulty := 2
+	powService := pow.NewSHA256HashcashService(difficulty, 5*time.Minute)
+	hook := &recordingAuditHook{}
+
+	config := Config{
+		ReadTimeout:     5 * time.Second,
+		WriteTimeout:    5 * time.Second,
+		MaxConnections:  10,
+		ShutdownTimeout: 1 * time.Second,
+		AuditHook:       hook,
+	}
+
+	srv := NewServer(config, powService, quotes.NewInMemoryService(), logger)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	serverDone := make(chan error, 1)
+	go func() {
+		serverDone <- srv.Serve(ctx, ln)
+	}()
+
+	// Successful handshake
+	okConn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer okConn.Close()
+	solveRound(t, okConn, powService, difficulty, false)
+
+	// Failed handshake: a nonce that doesn't solve the challenge
+	badConn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer badConn.Close()
+
+	var challengeMsg protocol.ChallengeMessage
+	if err := protocol.ReadMessage(badConn, &challengeMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to read challenge: %v", err)
+	}
+	badNonce := "invalid"
+	for solvesChallenge(challengeMsg.Challenge, badNonce, difficulty) {
+		badNonce += "!"
+	}
+	proofMsg := protocol.ProofMessage{
+		BaseMessage: protocol.NewBaseMessage(protocol.MsgTypeProof),
+		Challenge:   challengeMsg.Challenge,
+		Nonce:       badNonce,
+	}
+	if err := protocol.WriteMessage(badConn, proofMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to send proof: %v", err)
+	}
+	var errMsg protocol.ErrorMessage
+	if err := protocol.ReadMessage(badConn, &errMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	if errMsg.Code != protocol.ErrCodeInvalidProof {
+		t.Fatalf("Expected invalid_proof, got: %+v", errMsg)
+	}
+
+	// Shutting down flushes queued events to the hook
+	cancel()
+	select {
+	case <-serverDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server did not shut down")
+	}
+
+	events := hook.snapshot()
+	if len(events) != 4 {
+		t.Fatalf("Expected 4 audit events, got %d: %+v", len(events), events)
+	}
+
+	okAddr := okConn.LocalAddr().String()
+	if events[0].event != "issued" || events[0].addr != okAddr {
+		t.Errorf("Expected challenge issued to %s, got %+v", okAddr, events[0])
+	}
+	if events[1].event != "result" || !events[1].ok || events[1].reason != "" || events[1].challenge != events[0].challenge {
+		t.Errorf("Expected successful proof for %q, got %+v", events[0].challenge, events[1])
+	}
+
+	badAddr := badConn.LocalAddr().String()
+	if events[2].event != "issued" || events[2].addr != badAddr || events[2].challenge != challengeMsg.Challenge {
+		t.Errorf("Expected challenge %q issued to %s, got %+v", challengeMsg.Challenge, badAddr, events[2])
+	}
+	if events[3].event != "result" || events[3].ok || events[3].reason != string(protocol.ErrCodeInvalidProof) {
+		t.Errorf("Expected failed proof with reason invalid_proof, got %+v", events[3])
+	}
+}
+
+// timingAuditHook is a recordingAuditHook that also collects handshake timings
+type timingAuditHook struct {
+	recordingAuditHook
+	timings []HandshakeTiming
+}
+
+func (h *timingAuditHook) OnHandshakeTiming(addr, challenge string, timing HandshakeTiming) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.events = append(h.events, recordedAuditEvent{event: "timing", addr: addr, challenge: challenge})
+	h.timings = append(h.timings, timing)
+}
+
+func TestServer_HandshakeTiming(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	difficulty := 1
+	powService := pow.NewSHA256HashcashService(difficulty, 5*time.Minute)
+	hook := &timingAuditHook{}
+
+	srv := NewServer(Config{
+		ReadTimeout:              5 * time.Second,
+		WriteTimeout:             5 * time.Second,
+		MaxConnections:           10,
+		MaxRequestsPerConnection: 2,
+		ShutdownTimeout:          1 * time.Second,
+		AuditHook:                hook,
+	}, powService, quotes.NewInMemoryService(), logger)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	serverDone := make(chan error, 1)
+	go func() { serverDone <- srv.Serve(ctx, ln) }()
+
+	// Two rounds on one connection, the second timed from the end of the first
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	solveRound(t, conn, powService, difficulty, true)
+	solveRound(t, conn, powService, difficulty, false)
+
+	// Shutting down flushes queued events to the hook
+	cancel()
+	select {
+	case <-serverDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server did not shut down")
+	}
+
+	events := hook.snapshot()
+	wantEvents := []string{"issued", "timing", "result", "issued", "timing", "result"}
+	if len(events) != len(wantEvents) {
+		t.Fatalf("Expected %d audit events, got %d: %+v", len(wantEvents), len(events), events)
+	}
+	for i, want := range wantEvents {
+		if events[i].event != want {
+			t.Errorf("Event %d = %q, want %q", i, events[i].event, want)
+		}
+	}
+	if events[1].challenge != events[0].challenge || events[1].addr != conn.LocalAddr().String() {
+		t.Errorf("Expected the timing to be reported for %q from %s, got %+v", events[0].challenge, conn.LocalAddr(), events[1])
+	}
+
+	hook.mu.Lock()
+	timings := append([]HandshakeTiming(nil), hook.timings...)
+	hook.mu.Unlock()
+	for i, timing := range timings {
+		if timing.TimeToChallenge < 0 || timing.ProofWait < 0 {
+			t.Errorf("Expected non-negative timings for round %d, got %+v", i, timing)
+		}
+	}
+
+	// The same timings land in the server's histograms
+	snapshot := srv.Metrics().Snapshot()
+	for name, histogram := range map[string]Histogram{"TimeToChallenge": snapshot.TimeToChallenge, "ProofWait": snapshot.ProofWait} {
+		if histogram.Count != 2 {
+			t.Errorf("Expected 2 %s observations, got %d", name, histogram.Count)
+		}
+		bucketed := 0
+		for _, count := range histogram.Counts {
+			bucketed += count
+		}
+		if bucketed != histogram.Count || histogram.Sum < 0 {
+			t.Errorf("Expected %s buckets to add up to %d with a non-negative sum, got %v and %v", name, histogram.Count, histogram.Counts, histogram.Sum)
+		}
+	}
+	if want := timings[0].ProofWait + timings[1].ProofWait; snapshot.ProofWait.Sum != want {
+		t.Errorf("Expected a ProofWait sum of %v, got %v", want, snapshot.ProofWait.Sum)
+	}
+}
+
+// solvesChallenge reports whether nonce happens to solve a SHA256 challenge
+func solvesChallenge(challenge, nonce string, difficulty int) bool {
+	hash := sha256.Sum256([]byte(challenge + nonce))
+	for _, b := range hash[:difficulty] {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestAsyncAuditHook_DropsWhenSinkIsSlow(t *testing.T) {
+	release := make(chan struct{})
+	blocking := &blockingAuditHook{release: release}
+	hook := newAsyncAuditHook(blocking, 2)
+
+	// The first event occupies the sink, two more fill the queue, the rest are dropped
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		hook.OnChallengeIssued("127.0.0.1:1", "challenge")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Enqueueing blocked on the slow sink for %v", elapsed)
+	}
+
+	close(release)
+	dropped := hook.close()
+	if dropped < 7 || dropped > 8 {
+		t.Errorf("Expected 7-8 dropped events, got %d", dropped)
+	}
+	if delivered := blocking.count(); int64(delivered)+dropped != 10 {
+		t.Errorf("Expected delivered + dropped = 10, got %d + %d", delivered, dropped)
+	}
+
+	// Events after close are dropped rather than panicking
+	hook.OnProofResult("127.0.0.1:1", "challenge", true, "")
+}
+
+// blockingAuditHook waits for release before accepting each event
+type blockingAuditHook struct {
+	NoopAuditHook
+	release   chan struct{}
+	delivered int
+	mu        sync.Mutex
+}
+
+func (h *blockingAuditHook) OnChallengeIssued(addr, challenge string) {
+	<-h.release
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.delivered++
+}
+
+func (h *blockingAuditHook) count() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.delivered
+}
+
+func TestJSONLinesAuditHook(t *testing.T) {
+	var buf bytes.Buffer
+	hook := NewJSONLinesAuditHook(&buf)
+	hook.now = func() time.Time { return time.Unix(1700000000, 0) }
+
+	hook.OnChallengeIssued("192.0.2.1:4000", "abc")
+	hook.OnHandshakeTiming("192.0.2.1:4000", "abc", HandshakeTiming{TimeToChallenge: 1500 * time.Microsecond, ProofWait: 0})
+	hook.OnProofResult("192.0.2.1:4000", "abc", false, "invalid_proof")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	want := []string{
+		`{"time":"2023-11-14T22:13:20Z","event":"challenge_issued","addr":"192.0.2.1:4000","challenge":"abc"}`,
+		`{"time":"2023-11-14T22:13:20Z","event":"handshake_timing","addr":"192.0.2.1:4000","challenge":"abc","time_to_challenge_ms":1.5,"proof_wait_ms":0}`,
+		`{"time":"2023-11-14T22:13:20Z","event":"proof_result","addr":"192.0.2.1:4000","challenge":"abc","ok":false,"reason":"invalid_proof"}`,
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("Expected %d lines, got %d: %q", len(want), len(lines), buf.String())
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Errorf("Line %d = %s, want %s", i, lines[i], want[i])
+		}
+		if !json.Valid([]byte(lines[i])) {
+			t.Errorf("Line %d is not valid JSON: %s", i, lines[i])
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package server
+
+import "sync"
+
+// ipConnLimiter caps the number of concurrent connections per remote IP
+type ipConnLimiter struct {
+	max    int
+	active map[string]int // Zero counts are deleted so idle IPs cost no memory
+	mu     sync.Mutex     // Protects active
+}
+
+// newIPConnLimiter creates a limiter allowing max concurrent connections per IP
+func newIPConnLimiter(max int) *ipConnLimiter {
+	return &ipConnLimiter{
+		max:    max,
+		active: make(map[string]int),
+	}
+}
+
+// Acquire reserves a connection slot for ip, reporting false if ip is at its cap.
+// Every successful Acquire must be paired with a Release.
+func (l *ipConnLimiter) Acquire(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.active[ip] >= l.max {
+		return false
+	}
+	l.active[ip]++
+	return true
+}
+
+// Release frees a connection slot for ip
+func (l *ipConnLimiter) Release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.active[ip] <= 1 {
+		delete(l.active, ip)
+		return
+	}
+	l.active[ip]--
+}
+
+// size returns the number of IPs with active connections
+func (l *ipConnLimiter) size() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.active)
+}
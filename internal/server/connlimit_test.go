@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"pow/internal/pow"
+	"pow/internal/quotes"
+	"pow/pkg/protocol"
+)
+
+func TestIPConnLimiter_AcquireRelease(t *testing.T) {
+	limiter := newIPConnLimiter(2)
+
+	if !limiter.Acquire("10.0.0.1") || !limiter.Acquire("10.0.0.1") {
+		t.Fatal("Expected the first two connections to be allowed")
+	}
+	if limiter.Acquire("10.0.0.1") {
+		t.Error("Expected the third connection from the same IP to be rejected")
+	}
+	if !limiter.Acquire("10.0.0.2") {
+		t.Error("Expected another IP to be unaffected")
+	}
+
+	limiter.Release("10.0.0.1")
+	if !limiter.Acquire("10.0.0.1") {
+		t.Error("Expected a slot to free up after release")
+	}
+
+	limiter.Release("10.0.0.1")
+	limiter.Release("10.0.0.1")
+	limiter.Release("10.0.0.2")
+	if size := limiter.size(); size != 0 {
+		t.Errorf("Expected idle IPs to be evicted, %d still tracked", size)
+	}
+}
+
+func TestServer_MaxConnectionsPerIP(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	config := Config{
+		ReadTimeout:         5 * time.Second,
+		WriteTimeout:        5 * time.Second,
+		MaxConnections:      10,
+		MaxConnectionsPerIP: 2,
+		ShutdownTimeout:     1 * time.Second,
+	}
+
+	srv := NewServer(config, pow.NewSHA256HashcashService(1, 5*time.Minute), quotes.NewInMemoryService(), logger)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.Serve(ctx, ln)
+
+	// dial connects and returns the first message the server sends
+	dial := func() (net.Conn, protocol.ErrorMessage) {
+		t.Helper()
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		var msg protocol.ErrorMessage
+		if err := protocol.ReadMessage(conn, &msg, 5*time.Second); err != nil {
+			t.Fatalf("Failed to read first message: %v", err)
+		}
+		return conn, msg
+	}
+
+	// Two connections from 127.0.0.1 hold their challenges open
+	first, msg := dial()
+	defer first.Close()
+	if msg.Type != protocol.MsgTypeChallenge {
+		t.Fatalf("Expected challenge, got %+v", msg)
+	}
+	second, msg := dial()
+	defer second.Close()
+	if msg.Type != protocol.MsgTypeChallenge {
+		t.Fatalf("Expected challenge, got %+v", msg)
+	}
+
+	// The third is rejected although the global cap is far away
+	third, msg := dial()
+	third.Close()
+	if msg.Type != protocol.MsgTypeError || msg.Code != protocol.ErrCodeRateLimited {
+		t.Fatalf("Expected rate_limited error for third connection, got %+v", msg)
+	}
+
+	// A different client address is counted separately
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	srv.wg.Add(1)
+	atomic.AddInt32(&srv.activeConns, 1)
+	go srv.handleConnection(ctx, serverConn)
+
+	var challengeMsg protocol.ChallengeMessage
+	if err := protocol.ReadMessage(clientConn, &challengeMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to read challenge for other address: %v", err)
+	}
+	if challengeMsg.Type != protocol.MsgTypeChallenge {
+		t.Fatalf("Expected challenge for other address, got %+v", challengeMsg)
+	}
+
+	// Closing a connection frees its slot once the server notices
+	first.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		conn, msg := dial()
+		conn.Close()
+		if msg.Type == protocol.MsgTypeChallenge {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected slot to be released after a connection closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Once every connection is gone no IP stays tracked
+	second.Close()
+	clientConn.Close()
+	for srv.connLimiter.size() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected idle IPs to be evicted, %d still tracked", srv.connLimiter.size())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,38 @@
+package server
+
+// Drain stops accepting new connections while connections already accepted,
+// including queued ones, are served to completion. Keep-alive clients get no
+// further challenges after their current one. Unlike shutdown, Serve keeps
+// running until its context is canceled, so a drained process stays up until
+// it is told to exit. Drain is safe to call more than once and before Serve.
+func (s *Server) Drain() {
+	s.drainOnce.Do(func() {
+		close(s.drainCh)
+		s.logger.Info("Draining: no longer accepting connections",
+			"active_connections", s.GetActiveConnections(),
+			"queued_connections", s.GetQueuedConnections())
+
+		// Before Serve has bound the listeners, Serve closes them itself
+		select {
+		case <-s.ready:
+			s.closeListeners()
+		default:
+		}
+	})
+}
+
+// IsDraining reports whether Drain has been called
+func (s *Server) IsDraining() bool {
+	select {
+	case <-s.drainCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// isWindingDown reports whether the server has stopped accepting connections,
+// by draining or shutting down, so connections should not be kept open
+func (s *Server) isWindingDown() bool {
+	return s.IsDraining() || s.isShuttingDown()
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"pow/internal/pow"
+	"pow/internal/quotes"
+	"pow/pkg/protocol"
+)
+
+func TestServer_Drain(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	difficulty := 1
+	powService := pow.NewSHA256HashcashService(difficulty, 5*time.Minute)
+	srv := NewServer(Config{
+		ReadTimeout:              5 * time.Second,
+		WriteTimeout:             5 * time.Second,
+		MaxConnections:           10,
+		MaxRequestsPerConnection: 5,
+		ShutdownTimeout:          1 * time.Second,
+	}, powService, quotes.NewInMemoryService(), logger)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	addr := ln.Addr().String()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	serverDone := make(chan error, 1)
+	go func() {
+		serverDone <- srv.Serve(ctx, ln)
+	}()
+	waitReady(t, srv)
+
+	// Keep a handshake in flight across the drain
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	var challengeMsg protocol.ChallengeMessage
+	if err := protocol.ReadMessage(conn, &challengeMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to read challenge: %v", err)
+	}
+
+	srv.Drain()
+	srv.Drain() // Idempotent
+
+	if srv.IsReady() {
+		t.Error("Expected server not to be ready while draining")
+	}
+	if newConn, err := net.DialTimeout("tcp", addr, time.Second); err == nil {
+		newConn.Close()
+		t.Error("Expected new connections to be refused after Drain")
+	}
+
+	// The in-flight handshake completes, but the connection is not kept alive
+	nonce, err := powService.SolveChallenge(context.Background(), challengeMsg.Challenge, difficulty)
+	if err != nil {
+		t.Fatalf("Failed to solve challenge: %v", err)
+	}
+	proofMsg := protocol.ProofMessage{
+		BaseMessage: protocol.NewBaseMessage(protocol.MsgTypeProof),
+		Challenge:   challengeMsg.Challenge,
+		Nonce:       nonce,
+		KeepAlive:   true,
+	}
+	if err := protocol.WriteMessage(conn, proofMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to send proof: %v", err)
+	}
+
+	var quoteMsg protocol.QuoteMessage
+	if err := protocol.ReadMessage(conn, &quoteMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to read quote: %v", err)
+	}
+	if quoteMsg.Type != protocol.MsgTypeQuote || quoteMsg.Quote == "" {
+		t.Fatalf("Expected a quote, got: %+v", quoteMsg)
+	}
+	if quoteMsg.KeepAlive {
+		t.Error("Expected keep-alive to be declined while draining")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for srv.GetActiveConnections() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the drained connection to finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// A drained server keeps running until it is shut down
+	select {
+	case err := <-serverDone:
+		t.Fatalf("Serve returned after Drain: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	cancel()
+	select {
+	case err := <-serverDone:
+		if err != nil {
+			t.Errorf("Serve returned error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server did not shut down")
+	}
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"pow/internal/pow"
+)
+
+// EndpointConfig describes a listener served next to the main one with its own
+// proof of work, such as a low-difficulty endpoint for a trusted network beside the
+// public one. Its connections share everything else: limits, quotes and shutdown.
+type EndpointConfig struct {
+	Name       string               // Unique, tags the logs of the endpoint's connections
+	Network    string               // "tcp" (default) or "unix"
+	Addr       string               // host:port, or the socket path for "unix"
+	PowService pow.ChallengeService // Issues and verifies its challenges, e.g. with another TTL. nil shares the server's.
+	Difficulty int                  // Difficulty of its challenges in the service's units, 0 keeps the service's or DifficultyPolicy's
+}
+
+// endpoint is a listener and the proof of work asked of the connections it accepts
+type endpoint struct {
+	name       string
+	network    string
+	addr       string
+	powService pow.ChallengeService
+	difficulty int          // 0 defers to DifficultyPolicy or powService
+	listener   net.Listener // Bound by Serve
+}
+
+// AddEndpoint adds a listener that Serve binds and accepts on alongside the main one,
+// and that shuts down and drains with it. It must be called before Serve.
+func (s *Server) AddEndpoint(config EndpointConfig) error {
+	select {
+	case <-s.ready:
+		return errors.New("endpoints must be added before the server starts")
+	default:
+	}
+
+	if config.Name == "" {
+		return errors.New("endpoint name must not be empty")
+	}
+	for _, ep := range s.endpoints {
+		if ep.name == config.Name {
+			return fmt.Errorf("endpoint %q already exists", config.Name)
+		}
+	}
+	network := config.Network
+	if network == "" {
+		network = "tcp"
+	}
+	if network != "tcp" && network != "unix" {
+		return fmt.Errorf("endpoint %q: network must be tcp or unix, got: %q", config.Name, config.Network)
+	}
+	if config.Addr == "" {
+		return fmt.Errorf("endpoint %q: address must not be empty", config.Name)
+	}
+	if config.Difficulty < 0 {
+		return fmt.Errorf("endpoint %q: difficulty must not be negative, got: %d", config.Name, config.Difficulty)
+	}
+
+	ep := &endpoint{
+		name:       config.Name,
+		network:    network,
+		addr:       config.Addr,
+		powService: config.PowService,
+		difficulty: config.Difficulty,
+	}
+	if ep.powService == nil {
+		ep.powService = s.powService
+	}
+
+	// Any nonce solves a difficulty-0 challenge, so make sure that is never silent
+	if ep.difficulty == 0 && s.config.DifficultyPolicy == nil && s.config.MinDifficulty < 1 && ep.powService.GetDifficulty() < 1 {
+		s.logger.Warn("Proof of work disabled on endpoint, clients get quotes without solving challenges",
+			"endpoint", ep.name, "difficulty", ep.powService.GetDifficulty())
+	}
+
+	s.endpoints = append(s.endpoints, ep)
+	return nil
+}
+
+// EndpointAddr returns the address the endpoint called name is bound to, or nil
+// before the server is ready or if there is no such endpoint
+func (s *Server) EndpointAddr(name string) net.Addr {
+	select {
+	case <-s.ready:
+	default:
+		return nil
+	}
+	for _, ep := range s.endpoints {
+		if ep.name == name {
+			return ep.listener.Addr()
+		}
+	}
+	return nil
+}
+
+// listenEndpoints binds the listeners of every added endpoint, wrapping them with
+// wrap. On failure the ones already bound are closed again.
+func (s *Server) listenEndpoints(wrap func(net.Listener) net.Listener) error {
+	for i, ep := range s.endpoints {
+		ln, err := listenOnce(ep.network, ep.addr)
+		if err != nil {
+			s.closeEndpoints(s.endpoints[:i])
+			return fmt.Errorf("endpoint %q: %w", ep.name, err)
+		}
+		ep.listener = wrap(ln)
+		s.logger.Info("Endpoint started", "endpoint", ep.name, "address", ln.Addr().String())
+	}
+	return nil
+}
+
+// closeListeners closes the main listener and those of every endpoint, so all
+// accept loops return
+func (s *Server) closeListeners() {
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	s.closeEndpoints(s.endpoints)
+}
+
+// closeEndpoints closes the bound listeners of endpoints
+func (s *Server) closeEndpoints(endpoints []*endpoint) {
+	for _, ep := range endpoints {
+		if ep.listener != nil {
+			ep.listener.Close()
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"pow/internal/pow"
+	"pow/internal/quotes"
+	"pow/pkg/protocol"
+)
+
+func TestServer_Endpoints(t *testing.T) {
+	public := pow.NewSHA256HashcashService(2, 5*time.Minute)
+	internal := pow.NewSHA256HashcashService(1, time.Minute) // Its own service, with its own TTL
+
+	srv := NewServer(Config{
+		Host:            "127.0.0.1",
+		Port:            "0",
+		ReadTimeout:     5 * time.Second,
+		WriteTimeout:    5 * time.Second,
+		MaxConnections:  10,
+		ShutdownTimeout: 1 * time.Second,
+	}, public, quotes.NewInMemoryService(), nil)
+
+	if err := srv.AddEndpoint(EndpointConfig{Name: "trusted", Addr: "127.0.0.1:0", Difficulty: 1}); err != nil {
+		t.Fatalf("AddEndpoint failed: %v", err)
+	}
+	if err := srv.AddEndpoint(EndpointConfig{Name: "internal", Addr: "127.0.0.1:0", PowService: internal}); err != nil {
+		t.Fatalf("AddEndpoint failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	serverDone := make(chan struct{})
+	go func() {
+		srv.ListenAndServe(ctx)
+		close(serverDone)
+	}()
+	waitReady(t, srv)
+
+	if err := srv.AddEndpoint(EndpointConfig{Name: "late", Addr: "127.0.0.1:0"}); err == nil {
+		t.Error("Expected AddEndpoint to fail once the server has started")
+	}
+
+	dial := func(addr net.Addr) net.Conn {
+		t.Helper()
+		conn, err := net.Dial("tcp", addr.String())
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+
+	// Each endpoint issues challenges of its own difficulty, solvable independently
+	tests := []struct {
+		name       string
+		addr       net.Addr
+		solver     pow.SolverService
+		difficulty int
+	}{
+		{"main", srv.Addr(), public, 2},
+		{"trusted", srv.EndpointAddr("trusted"), public, 1},
+		{"internal", srv.EndpointAddr("internal"), internal, 1},
+	}
+	for _, tt := range tests {
+		if tt.addr == nil {
+			t.Fatalf("Expected an address for the %s endpoint", tt.name)
+		}
+		conn := dial(tt.addr)
+
+		var challengeMsg protocol.ChallengeMessage
+		if err := protocol.ReadMessage(conn, &challengeMsg, 5*time.Second); err != nil {
+			t.Fatalf("Failed to read challenge on %s: %v", tt.name, err)
+		}
+		if challengeMsg.Difficulty != tt.difficulty {
+			t.Errorf("Expected difficulty %d on %s, got %d", tt.difficulty, tt.name, challengeMsg.Difficulty)
+		}
+		nonce, err := tt.solver.SolveChallenge(context.Background(), challengeMsg.Challenge, tt.difficulty)
+		if err != nil {
+			t.Fatalf("Failed to solve challenge on %s: %v", tt.name, err)
+		}
+		proofMsg := protocol.ProofMessage{
+			BaseMessage: protocol.NewBaseMessage(protocol.MsgTypeProof),
+			Challenge:   challengeMsg.Challenge,
+			Nonce:       nonce,
+		}
+		if err := protocol.WriteMessage(conn, proofMsg, 5*time.Second); err != nil {
+			t.Fatalf("Failed to send proof on %s: %v", tt.name, err)
+		}
+		var quoteMsg protocol.QuoteMessage
+		if err := protocol.ReadMessage(conn, &quoteMsg, 5*time.Second); err != nil {
+			t.Fatalf("Failed to read quote on %s: %v", tt.name, err)
+		}
+		if quoteMsg.Type != protocol.MsgTypeQuote || quoteMsg.Quote == "" {
+			t.Errorf("Expected a quote on %s, got: %+v", tt.name, quoteMsg)
+		}
+	}
+
+	// The internal endpoint's challenges live in its own service only
+	if stats, err := internal.Stats(); err != nil || stats.ActiveChallenges != 0 {
+		t.Errorf("Expected the internal challenge to be consumed, got stats=%+v err=%v", stats, err)
+	}
+
+	// Shutdown covers extra endpoints too: a handshake still waiting on one is told why it ends
+	waiting := dial(srv.EndpointAddr("trusted"))
+	var challengeMsg protocol.ChallengeMessage
+	if err := protocol.ReadMessage(waiting, &challengeMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to read challenge: %v", err)
+	}
+
+	cancel()
+	select {
+	case <-serverDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server did not shut down")
+	}
+
+	var errMsg protocol.ErrorMessage
+	if err := protocol.ReadMessage(waiting, &errMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to read goodbye: %v", err)
+	}
+	if errMsg.Code != protocol.ErrCodeShuttingDown {
+		t.Errorf("Expected shutting_down on the waiting endpoint connection, got: %+v", errMsg)
+	}
+	waiting.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := waiting.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("Expected the connection to be closed, got: %v", err)
+	}
+
+	// Every listener is closed
+	for _, tt := range tests {
+		if conn, err := net.DialTimeout("tcp", tt.addr.String(), time.Second); err == nil {
+			conn.Close()
+			t.Errorf("Expected the %s listener to be closed", tt.name)
+		}
+	}
+}
+
+func TestServer_AddEndpointValidation(t *testing.T) {
+	srv := NewServer(Config{}, pow.NewSHA256HashcashService(1, time.Minute), quotes.NewInMemoryService(), nil)
+
+	if err := srv.AddEndpoint(EndpointConfig{Name: "a", Addr: "127.0.0.1:0"}); err != nil {
+		t.Fatalf("AddEndpoint failed: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		config EndpointConfig
+	}{
+		{"no name", EndpointConfig{Addr: "127.0.0.1:0"}},
+		{"duplicate name", EndpointConfig{Name: "a", Addr: "127.0.0.1:0"}},
+		{"no address", EndpointConfig{Name: "b"}},
+		{"unknown network", EndpointConfig{Name: "b", Network: "udp", Addr: "127.0.0.1:0"}},
+		{"negative difficulty", EndpointConfig{Name: "b", Addr: "127.0.0.1:0", Difficulty: -1}},
+	}
+	for _, tt := range tests {
+		if err := srv.AddEndpoint(tt.config); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+	if srv.EndpointAddr("a") != nil {
+		t.Errorf("Expected no endpoint address before the server starts")
+	}
+}
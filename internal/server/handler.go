@@ -0,0 +1,25 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net"
+)
+
+// PostProofHandler serves whatever a client earns by solving a challenge, in place of
+// quotes. Handle is called once per verified proof, or accepted trusted token, with
+// the client connection and a logger tagged with the connection id. ctx ends with the
+// handshake deadline or at forced shutdown. The server closes the connection once
+// Handle returns, so keep-alive and subscriptions don't apply. It must be safe for
+// concurrent use.
+type PostProofHandler interface {
+	Handle(ctx context.Context, conn net.Conn, logger *slog.Logger) error
+}
+
+// PostProofHandlerFunc adapts a function to a PostProofHandler
+type PostProofHandlerFunc func(ctx context.Context, conn net.Conn, logger *slog.Logger) error
+
+// Handle calls f
+func (f PostProofHandlerFunc) Handle(ctx context.Context, conn net.Conn, logger *slog.Logger) error {
+	return f(ctx, conn, logger)
+}
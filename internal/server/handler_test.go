@@ -0,0 +1,138 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"pow/internal/pow"
+	"pow/pkg/protocol"
+)
+
+// sendProof reads the challenge on conn, solves it and sends the proof
+func sendProof(t *testing.T, conn net.Conn, solver pow.SolverService, difficulty int) {
+	t.Helper()
+
+	var challengeMsg protocol.ChallengeMessage
+	if err := protocol.ReadMessage(conn, &challengeMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to read challenge: %v", err)
+	}
+	nonce, err := solver.SolveChallenge(context.Background(), challengeMsg.Challenge, difficulty)
+	if err != nil {
+		t.Fatalf("Failed to solve challenge: %v", err)
+	}
+	proofMsg := protocol.ProofMessage{
+		BaseMessage: protocol.NewBaseMessage(protocol.MsgTypeProof),
+		Challenge:   challengeMsg.Challenge,
+		Nonce:       nonce,
+		KeepAlive:   true, // Ignored with a custom handler
+	}
+	if err := protocol.WriteMessage(conn, proofMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to send proof: %v", err)
+	}
+}
+
+func TestServer_PostProofHandler(t *testing.T) {
+	difficulty := 1
+	powService := pow.NewSHA256HashcashService(difficulty, 5*time.Minute)
+	payload := []byte("the PoW-gated payload")
+
+	var handled atomic.Int32
+	addr := startTestServer(t, Config{
+		ReadTimeout:     5 * time.Second,
+		WriteTimeout:    5 * time.Second,
+		MaxConnections:  10,
+		ShutdownTimeout: 1 * time.Second,
+		PostProofHandler: PostProofHandlerFunc(func(ctx context.Context, conn net.Conn, logger *slog.Logger) error {
+			handled.Add(1)
+			_, err := conn.Write(payload)
+			return err
+		}),
+	}, powService)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	sendProof(t, conn, powService, difficulty)
+
+	// The handler's bytes are all that follows, then the server hangs up
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	got, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("Failed to read payload: %v", err)
+	}
+	if string(got) != string(payload) {
+		t.Errorf("Expected payload %q, got %q", payload, got)
+	}
+	if handled.Load() != 1 {
+		t.Errorf("Expected the handler to run once, ran %d times", handled.Load())
+	}
+
+	// An invalid proof never reaches the handler
+	conn2, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn2.Close()
+	var challengeMsg protocol.ChallengeMessage
+	if err := protocol.ReadMessage(conn2, &challengeMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to read challenge: %v", err)
+	}
+	proofMsg := protocol.ProofMessage{
+		BaseMessage: protocol.NewBaseMessage(protocol.MsgTypeProof),
+		Challenge:   challengeMsg.Challenge,
+		Nonce:       "not-a-solution",
+	}
+	if err := protocol.WriteMessage(conn2, proofMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to send proof: %v", err)
+	}
+	var errMsg protocol.ErrorMessage
+	if err := protocol.ReadMessage(conn2, &errMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	if errMsg.Code != protocol.ErrCodeInvalidProof {
+		t.Errorf("Expected invalid_proof, got: %+v", errMsg)
+	}
+	if handled.Load() != 1 {
+		t.Errorf("Expected the handler not to run for an invalid proof, ran %d times", handled.Load())
+	}
+}
+
+func TestServer_PostProofHandlerError(t *testing.T) {
+	difficulty := 1
+	powService := pow.NewSHA256HashcashService(difficulty, 5*time.Minute)
+
+	addr := startTestServer(t, Config{
+		ReadTimeout:     5 * time.Second,
+		WriteTimeout:    5 * time.Second,
+		MaxConnections:  10,
+		ShutdownTimeout: 1 * time.Second,
+		PostProofHandler: PostProofHandlerFunc(func(ctx context.Context, conn net.Conn, logger *slog.Logger) error {
+			return errors.New("payload unavailable")
+		}),
+	}, powService)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	sendProof(t, conn, powService, difficulty)
+
+	// A failing handler gets the connection closed, with no quote sent in its place
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	got, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("Expected the server to close the connection, got: %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("Expected nothing after a failed handler, got %q", got)
+	}
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	// healthReadHeaderTimeout bounds how long a probe may take to send its headers
+	healthReadHeaderTimeout = 5 * time.Second
+	// healthShutdownTimeout bounds how long in-flight probes may delay shutdown
+	healthShutdownTimeout = 5 * time.Second
+)
+
+// HealthServer serves HTTP liveness and readiness probes for a Server:
+// /healthz answers 200 while the process is up, /readyz answers 200 only
+// while the server is accepting connections and not shutting down.
+type HealthServer struct {
+	addr       string
+	httpServer *http.Server
+	logger     *slog.Logger
+}
+
+// NewHealthServer creates a health server for srv listening on addr. A nil logger discards all logs.
+func NewHealthServer(addr string, srv *Server, logger *slog.Logger) *HealthServer {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !srv.IsReady() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintln(w, "not ready")
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintln(w, "ok")
+	})
+
+	return &HealthServer{
+		addr: addr,
+		httpServer: &http.Server{
+			Handler:           mux,
+			ReadHeaderTimeout: healthReadHeaderTimeout,
+		},
+		logger: orDiscard(logger),
+	}
+}
+
+// ListenAndServe serves health probes on the configured address until ctx is canceled
+func (h *HealthServer) ListenAndServe(ctx context.Context) error {
+	ln, err := net.Listen("tcp", h.addr)
+	if err != nil {
+		return fmt.Errorf("failed to start health listener: %w", err)
+	}
+	return h.Serve(ctx, ln)
+}
+
+// Serve serves health probes on ln until ctx is canceled
+func (h *HealthServer) Serve(ctx context.Context, ln net.Listener) error {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- h.httpServer.Serve(ln)
+	}()
+
+	h.logger.Info("Health server started", "address", ln.Addr().String())
+
+	select {
+	case err := <-errCh:
+		return fmt.Errorf("health server failed: %w", err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), healthShutdownTimeout)
+	defer cancel()
+
+	if err := h.httpServer.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("health server shutdown failed: %w", err)
+	}
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("health server failed: %w", err)
+	}
+
+	h.logger.Info("Health server stopped")
+	return nil
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"pow/internal/pow"
+	"pow/internal/quotes"
+	"pow/pkg/protocol"
+)
+
+// probeClient opens a fresh connection per probe, like orchestrators do, so no
+// pooled connection keeps the health server from shutting down promptly
+var probeClient = &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+
+// probe returns the HTTP status of a health endpoint
+func probe(t *testing.T, addr, path string) int {
+	t.Helper()
+
+	resp, err := probeClient.Get("http://" + addr + path)
+	if err != nil {
+		t.Fatalf("GET %s failed: %v", path, err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestHealthServer(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	powService := pow.NewSHA256HashcashService(1, 5*time.Minute)
+	quotesService := quotes.NewInMemoryService()
+
+	config := Config{
+		Host:            "127.0.0.1",
+		Port:            "0",
+		ReadTimeout:     5 * time.Second,
+		WriteTimeout:    5 * time.Second,
+		MaxConnections:  10,
+		ShutdownTimeout: 1 * time.Second,
+	}
+
+	srv := NewServer(config, powService, quotesService, logger)
+
+	healthLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	healthAddr := healthLn.Addr().String()
+
+	healthCtx, stopHealth := context.WithCancel(context.Background())
+	defer stopHealth()
+
+	healthDone := make(chan error, 1)
+	go func() {
+		healthDone <- NewHealthServer("", srv, logger).Serve(healthCtx, healthLn)
+	}()
+
+	// Before the TCP listener is bound the process is alive but not ready
+	if status := probe(t, healthAddr, "/healthz"); status != http.StatusOK {
+		t.Errorf("Expected /healthz 200 before start, got %d", status)
+	}
+	if status := probe(t, healthAddr, "/readyz"); status != http.StatusServiceUnavailable {
+		t.Errorf("Expected /readyz 503 before start, got %d", status)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	serverDone := make(chan error, 1)
+	go func() {
+		serverDone <- srv.ListenAndServe(ctx)
+	}()
+	waitReady(t, srv)
+
+	if status := probe(t, healthAddr, "/readyz"); status != http.StatusOK {
+		t.Errorf("Expected /readyz 200 once bound, got %d", status)
+	}
+
+	// Keep a handshake in flight so graceful shutdown lasts until ShutdownTimeout
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	var challengeMsg protocol.ChallengeMessage
+	if err := protocol.ReadMessage(conn, &challengeMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to read challenge: %v", err)
+	}
+
+	cancel()
+
+	// While draining, the server stops being ready but stays alive
+	deadline := time.Now().Add(time.Second)
+	for probe(t, healthAddr, "/readyz") != http.StatusServiceUnavailable {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected /readyz 503 during shutdown")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if status := probe(t, healthAddr, "/healthz"); status != http.StatusOK {
+		t.Errorf("Expected /healthz 200 during shutdown, got %d", status)
+	}
+
+	select {
+	case <-serverDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server did not shut down")
+	}
+
+	stopHealth()
+	select {
+	case err := <-healthDone:
+		if err != nil {
+			t.Errorf("Health server returned error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Health server did not shut down")
+	}
+
+	if _, err := probeClient.Get("http://" + healthAddr + "/healthz"); err == nil {
+		t.Error("Expected health server to be closed")
+	}
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"pow/pkg/protocol"
+)
+
+// errUnexpectedMessage is returned by readProof for a well-formed message that
+// can't answer a challenge, such as a quote
+var errUnexpectedMessage = errors.New("unexpected message")
+
+// readProof reads the client's answer to a challenge, a proof or a close message.
+// If authMsg is set, an auth message presenting a token is accepted too and decoded
+// into it instead, leaving proofMsg untouched. With heartbeats enabled, heartbeats sent while the client is idle are answered and
+// each one restarts ReadTimeout; ConnectionDeadline still bounds the whole wait.
+func (s *Server) readProof(ctx context.Context, cs *connState, proofMsg *protocol.ProofMessage, authMsg *protocol.AuthMessage) error {
+	for {
+		var raw json.RawMessage
+		if err := cs.framer.ReadCtx(ctx, &raw); err != nil {
+			return err
+		}
+
+		msgType, err := protocol.PeekType(raw)
+		if err != nil {
+			return err
+		}
+		switch msgType {
+		case protocol.MsgTypeProof, protocol.MsgTypeClose:
+			return s.codec.Decode(raw, proofMsg)
+		case protocol.MsgTypeAuth:
+			if authMsg == nil {
+				return fmt.Errorf("%w of type %q after authenticating", errUnexpectedMessage, msgType)
+			}
+			return s.codec.Decode(raw, authMsg)
+		case protocol.MsgTypeHeartbeat:
+		default:
+			return fmt.Errorf("%w of type %q where a proof was expected", errUnexpectedMessage, msgType)
+		}
+
+		var heartbeat protocol.HeartbeatMessage
+		if err := s.codec.Decode(raw, &heartbeat); err != nil {
+			return err
+		}
+
+		if s.config.HeartbeatInterval <= 0 {
+			return fmt.Errorf("%w: heartbeats are disabled", protocol.ErrMalformedMessage)
+		}
+		cs.logger.Debug("Heartbeat received", "reply", heartbeat.Reply)
+		if !heartbeat.Reply {
+			if err := cs.framer.WriteCtx(ctx, s.newHeartbeat(true)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// newHeartbeat creates a heartbeat, or the answer to one if reply is set
+func (s *Server) newHeartbeat(reply bool) protocol.HeartbeatMessage {
+	return protocol.HeartbeatMessage{
+		BaseMessage: s.codec.NewBaseMessage(protocol.MsgTypeHeartbeat),
+		Reply:       reply,
+	}
+}
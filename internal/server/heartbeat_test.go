@@ -0,0 +1,150 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"pow/internal/pow"
+	"pow/internal/quotes"
+	"pow/pkg/protocol"
+)
+
+// startTestServer serves config on a random local port until the test ends
+func startTestServer(t *testing.T, config Config, powService pow.ChallengeService) string {
+	t.Helper()
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+	srv := NewServer(config, powService, quotes.NewInMemoryService(), logger)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go srv.Serve(ctx, ln)
+
+	return ln.Addr().String()
+}
+
+func TestServer_SubscriptionHeartbeats(t *testing.T) {
+	difficulty := 1
+	powService := pow.NewSHA256HashcashService(difficulty, 5*time.Minute)
+
+	addr := startTestServer(t, Config{
+		ReadTimeout:             5 * time.Second,
+		WriteTimeout:            5 * time.Second,
+		MaxConnections:          10,
+		ShutdownTimeout:         1 * time.Second,
+		SubscriptionMinInterval: time.Second,
+		SubscriptionMaxDuration: 10 * time.Second,
+		HeartbeatInterval:       200 * time.Millisecond,
+	}, powService)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	var challengeMsg protocol.ChallengeMessage
+	if err := protocol.ReadMessage(conn, &challengeMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to read challenge: %v", err)
+	}
+	nonce, err := powService.SolveChallenge(context.Background(), challengeMsg.Challenge, difficulty)
+	if err != nil {
+		t.Fatalf("Failed to solve challenge: %v", err)
+	}
+	proofMsg := protocol.ProofMessage{
+		BaseMessage:     protocol.NewBaseMessage(protocol.MsgTypeProof),
+		Challenge:       challengeMsg.Challenge,
+		Nonce:           nonce,
+		Subscribe:       true,
+		IntervalSeconds: 1,
+	}
+	if err := protocol.WriteMessage(conn, proofMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to send proof: %v", err)
+	}
+
+	// readHeartbeat returns the next message as a heartbeat, failing on anything but a heartbeat or quote
+	readHeartbeat := func() (protocol.HeartbeatMessage, bool) {
+		var msg protocol.HeartbeatMessage
+		if err := protocol.ReadMessage(conn, &msg, 5*time.Second); err != nil {
+			t.Fatalf("Failed to read message: %v", err)
+		}
+		switch msg.Type {
+		case protocol.MsgTypeHeartbeat:
+			return msg, true
+		case protocol.MsgTypeQuote:
+			return msg, false
+		default:
+			t.Fatalf("Unexpected message type: %s", msg.Type)
+			return msg, false
+		}
+	}
+
+	// The first quote comes right away, then the server pings while the next one is due
+	if _, isHeartbeat := readHeartbeat(); isHeartbeat {
+		t.Fatal("Expected the first quote before any heartbeat")
+	}
+	if msg, isHeartbeat := readHeartbeat(); !isHeartbeat || msg.Reply {
+		t.Fatalf("Expected a heartbeat from the server between quotes, got %+v", msg)
+	}
+
+	// A heartbeat from the subscriber is answered and does not end the subscription
+	ping := protocol.HeartbeatMessage{BaseMessage: protocol.NewBaseMessage(protocol.MsgTypeHeartbeat)}
+	if err := protocol.WriteMessage(conn, ping, 5*time.Second); err != nil {
+		t.Fatalf("Failed to send heartbeat: %v", err)
+	}
+	gotReply, gotQuote := false, false
+	for !gotReply || !gotQuote {
+		msg, isHeartbeat := readHeartbeat()
+		if isHeartbeat {
+			gotReply = gotReply || msg.Reply
+		} else {
+			gotQuote = true
+		}
+	}
+}
+
+func TestServer_HeartbeatsDisabled(t *testing.T) {
+	addr := startTestServer(t, Config{
+		ReadTimeout:     5 * time.Second,
+		WriteTimeout:    5 * time.Second,
+		MaxConnections:  10,
+		ShutdownTimeout: 1 * time.Second,
+	}, pow.NewSHA256HashcashService(1, 5*time.Minute))
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	var challengeMsg protocol.ChallengeMessage
+	if err := protocol.ReadMessage(conn, &challengeMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to read challenge: %v", err)
+	}
+
+	ping := protocol.HeartbeatMessage{BaseMessage: protocol.NewBaseMessage(protocol.MsgTypeHeartbeat)}
+	if err := protocol.WriteMessage(conn, ping, 5*time.Second); err != nil {
+		t.Fatalf("Failed to send heartbeat: %v", err)
+	}
+
+	var response json.RawMessage
+	if err := protocol.ReadMessage(conn, &response, 5*time.Second); err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	var errMsg protocol.ErrorMessage
+	if err := json.Unmarshal(response, &errMsg); err != nil || errMsg.Code != protocol.ErrCodeBadRequest {
+		t.Errorf("Expected bad_request for a heartbeat when heartbeats are disabled, got: %s", response)
+	}
+}
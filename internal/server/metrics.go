@@ -0,0 +1,115 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+// latencyBounds are the bucket bounds of handshake latency histograms, spanning
+// a fast local handshake to a client solving a hard challenge
+var latencyBounds = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+	30 * time.Second,
+}
+
+// Histogram counts durations into buckets
+type Histogram struct {
+	Bounds []time.Duration // Inclusive upper bound of each bucket but the last, ascending
+	Counts []int           // One per bucket, the last counting durations above every bound
+	Count  int
+	Sum    time.Duration
+}
+
+// newHistogram creates an empty histogram with buckets up to bounds
+func newHistogram(bounds []time.Duration) Histogram {
+	return Histogram{Bounds: bounds, Counts: make([]int, len(bounds)+1)}
+}
+
+// Mean returns the mean observed duration
+func (h Histogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(h.Count)
+}
+
+// observe adds d to its bucket
+func (h *Histogram) observe(d time.Duration) {
+	bucket := len(h.Bounds)
+	for i, bound := range h.Bounds {
+		if d <= bound {
+			bucket = i
+			break
+		}
+	}
+	h.Counts[bucket]++
+	h.Count++
+	h.Sum += d
+}
+
+// clone returns a copy of h that doesn't share its slices
+func (h Histogram) clone() Histogram {
+	h.Bounds = append([]time.Duration(nil), h.Bounds...)
+	h.Counts = append([]int(nil), h.Counts...)
+	return h
+}
+
+// HandshakeTiming is where the time of one handshake went, telling server-side
+// slowness apart from client solve time
+type HandshakeTiming struct {
+	TimeToChallenge time.Duration // From accepting the connection, or the previous round on it, to sending the challenge
+	ProofWait       time.Duration // From sending the challenge to receiving the proof
+}
+
+// HandshakeMetrics accumulates handshake timings in histograms.
+// It is safe for concurrent use.
+type HandshakeMetrics struct {
+	timeToChallenge Histogram
+	proofWait       Histogram
+	mu              sync.Mutex // Protects both histograms
+}
+
+// HandshakeMetricsSnapshot is a copy of the histograms of a HandshakeMetrics
+type HandshakeMetricsSnapshot struct {
+	TimeToChallenge Histogram // Sent challenges, including those never answered
+	ProofWait       Histogram // Received proofs
+}
+
+// newHandshakeMetrics creates empty handshake metrics
+func newHandshakeMetrics() *HandshakeMetrics {
+	return &HandshakeMetrics{
+		timeToChallenge: newHistogram(latencyBounds),
+		proofWait:       newHistogram(latencyBounds),
+	}
+}
+
+// recordTimeToChallenge adds the time it took to send a challenge
+func (m *HandshakeMetrics) recordTimeToChallenge(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.timeToChallenge.observe(d)
+}
+
+// recordProofWait adds the time a client took to answer a challenge
+func (m *HandshakeMetrics) recordProofWait(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.proofWait.observe(d)
+}
+
+// Snapshot returns a copy of the histograms
+func (m *HandshakeMetrics) Snapshot() HandshakeMetricsSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return HandshakeMetricsSnapshot{
+		TimeToChallenge: m.timeToChallenge.clone(),
+		ProofWait:       m.proofWait.clone(),
+	}
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistogram_Observe(t *testing.T) {
+	h := newHistogram([]time.Duration{time.Millisecond, time.Second})
+
+	for _, d := range []time.Duration{0, time.Millisecond, 2 * time.Millisecond, time.Second, time.Minute} {
+		h.observe(d)
+	}
+
+	// Bounds are inclusive, the last bucket catches everything above them
+	want := []int{2, 2, 1}
+	for i := range want {
+		if h.Counts[i] != want[i] {
+			t.Errorf("Expected bucket counts %v, got %v", want, h.Counts)
+			break
+		}
+	}
+	if h.Count != 5 {
+		t.Errorf("Expected 5 observations, got %d", h.Count)
+	}
+	if wantSum := time.Minute + time.Second + 3*time.Millisecond; h.Sum != wantSum {
+		t.Errorf("Expected sum %v, got %v", wantSum, h.Sum)
+	}
+	if wantMean := h.Sum / 5; h.Mean() != wantMean {
+		t.Errorf("Expected mean %v, got %v", wantMean, h.Mean())
+	}
+	if (Histogram{}).Mean() != 0 {
+		t.Error("Expected an empty histogram to have mean 0")
+	}
+}
+
+func TestHandshakeMetrics_Snapshot(t *testing.T) {
+	m := newHandshakeMetrics()
+	m.recordTimeToChallenge(2 * time.Millisecond)
+	m.recordProofWait(3 * time.Second)
+
+	snapshot := m.Snapshot()
+	if snapshot.TimeToChallenge.Count != 1 || snapshot.TimeToChallenge.Sum != 2*time.Millisecond {
+		t.Errorf("Expected one 2ms time to challenge, got %+v", snapshot.TimeToChallenge)
+	}
+	if snapshot.ProofWait.Count != 1 || snapshot.ProofWait.Sum != 3*time.Second {
+		t.Errorf("Expected one 3s proof wait, got %+v", snapshot.ProofWait)
+	}
+
+	// Snapshots are copies
+	snapshot.ProofWait.Counts[0] = 100
+	m.recordProofWait(time.Millisecond)
+	if got := m.Snapshot().ProofWait; got.Counts[0] != 1 || got.Count != 2 {
+		t.Errorf("Expected the snapshot not to alias the metrics, got %+v", got)
+	}
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// ipRateLimiter implements a token bucket rate limiter keyed by remote IP
+type ipRateLimiter struct {
+	rate      float64 // Tokens added per second
+	burst     float64 // Bucket capacity
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	now       func() time.Time // Overridable for tests
+	mu        sync.Mutex       // Protects buckets and lastSweep
+}
+
+// tokenBucket holds the state of a single IP's bucket
+type tokenBucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+// newIPRateLimiter creates a new per-IP rate limiter
+func newIPRateLimiter(rate float64, burst int) *ipRateLimiter {
+	return &ipRateLimiter{
+		rate:      rate,
+		burst:     float64(burst),
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+// Allow reports whether a request from ip may proceed, consuming a token if so
+func (l *ipRateLimiter) Allow(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	bucket := l.refill(ip)
+	if bucket.tokens < 1 {
+		return false
+	}
+
+	bucket.tokens--
+	return true
+}
+
+// Exhausted reports whether a request from ip would be refused, without consuming a token
+func (l *ipRateLimiter) Exhausted(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.refill(ip).tokens < 1
+}
+
+// refill returns the bucket of ip topped up for the time elapsed since its last
+// request. Must be called with mu held.
+func (l *ipRateLimiter) refill(ip string) *tokenBucket {
+	now := l.now()
+	l.evictStale(now)
+
+	bucket, exists := l.buckets[ip]
+	if !exists {
+		bucket = &tokenBucket{tokens: l.burst, lastSeen: now}
+		l.buckets[ip] = bucket
+	}
+
+	bucket.tokens += now.Sub(bucket.lastSeen).Seconds() * l.rate
+	if bucket.tokens > l.burst {
+		bucket.tokens = l.burst
+	}
+	bucket.lastSeen = now
+	return bucket
+}
+
+// evictStale removes buckets that have fully refilled, since they are
+// indistinguishable from a fresh bucket. Sweeps at most once per refill period
+// to keep Allow cheap. Must be called with mu held.
+func (l *ipRateLimiter) evictStale(now time.Time) {
+	refillPeriod := time.Duration(l.burst / l.rate * float64(time.Second))
+	if now.Sub(l.lastSweep) < refillPeriod {
+		return
+	}
+
+	for ip, bucket := range l.buckets {
+		if now.Sub(bucket.lastSeen) >= refillPeriod {
+			delete(l.buckets, ip)
+		}
+	}
+	l.lastSweep = now
+}
+
+// size returns the number of tracked IPs
+func (l *ipRateLimiter) size() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
+
+// challengeRateLimiter caps challenges issued per second across all clients with a
+// single leaky bucket, so a burst of connections can't saturate a small instance's CPU
+type challengeRateLimiter struct {
+	rate   float64 // Challenges leaking out per second
+	burst  float64 // Bucket capacity, at least one challenge
+	tokens float64
+	last   time.Time
+	now    func() time.Time // Overridable for tests
+	mu     sync.Mutex       // Protects tokens and last
+}
+
+// newChallengeRateLimiter creates a limiter issuing rate challenges per second, allowing
+// bursts of up to a second's worth
+func newChallengeRateLimiter(rate float64) *challengeRateLimiter {
+	burst := max(rate, 1)
+	return &challengeRateLimiter{
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+		now:    time.Now,
+	}
+}
+
+// Allow reports whether a challenge may be issued now, consuming a token if so.
+// Otherwise it returns how long until the next one may be.
+func (l *challengeRateLimiter) Allow() (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*l.rate, l.burst)
+	l.last = now
+
+	if l.tokens < 1 {
+		return false, time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+	}
+	l.tokens--
+	return true, 0
+}
+
+// remoteIP extracts the IP part of a connection's remote address
+func remoteIP(conn net.Conn) string {
+	addr := conn.RemoteAddr().String()
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
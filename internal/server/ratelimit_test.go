@@ -0,0 +1,143 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIPRateLimiter_ThrottlesSingleIP(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	limiter := newIPRateLimiter(1, 5)
+	limiter.now = func() time.Time { return now }
+
+	// Hammer from one IP: only the burst should get through
+	allowed := 0
+	for i := 0; i < 50; i++ {
+		if limiter.Allow("10.0.0.1") {
+			allowed++
+		}
+	}
+
+	if allowed != 5 {
+		t.Errorf("Expected 5 allowed requests (burst), got %d", allowed)
+	}
+
+	// A second IP must be unaffected
+	if !limiter.Allow("10.0.0.2") {
+		t.Error("Second IP should not be throttled")
+	}
+
+	// After one second the first IP earns exactly one token back
+	now = now.Add(time.Second)
+	if !limiter.Allow("10.0.0.1") {
+		t.Error("First IP should be allowed after refill")
+	}
+	if limiter.Allow("10.0.0.1") {
+		t.Error("First IP should be throttled again after spending the refilled token")
+	}
+}
+
+func TestIPRateLimiter_Exhausted(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	limiter := newIPRateLimiter(1, 2)
+	limiter.now = func() time.Time { return now }
+
+	// Checking never spends a token
+	for i := 0; i < 10; i++ {
+		if limiter.Exhausted("10.0.0.1") {
+			t.Fatal("Fresh IP should not be exhausted")
+		}
+	}
+
+	limiter.Allow("10.0.0.1")
+	limiter.Allow("10.0.0.1")
+	if !limiter.Exhausted("10.0.0.1") {
+		t.Error("IP should be exhausted after spending its burst")
+	}
+
+	now = now.Add(time.Second)
+	if limiter.Exhausted("10.0.0.1") {
+		t.Error("IP should not be exhausted after a refill")
+	}
+}
+
+func TestIPRateLimiter_EvictsStaleEntries(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	limiter := newIPRateLimiter(10, 10)
+	limiter.now = func() time.Time { return now }
+	limiter.lastSweep = now
+
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		limiter.Allow(ip)
+	}
+
+	if limiter.size() != 3 {
+		t.Fatalf("Expected 3 tracked IPs, got %d", limiter.size())
+	}
+
+	// Full refill takes burst/rate = 1s; after that idle buckets are dropped
+	now = now.Add(2 * time.Second)
+	limiter.Allow("10.0.0.4")
+
+	if limiter.size() != 1 {
+		t.Errorf("Expected stale IPs to be evicted, %d still tracked", limiter.size())
+	}
+}
+
+func TestChallengeRateLimiter(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	limiter := newChallengeRateLimiter(2)
+	limiter.now = func() time.Time { return now }
+	limiter.last = now
+
+	// A second's worth goes through at once, then the bucket is empty
+	for i := 0; i < 2; i++ {
+		if ok, _ := limiter.Allow(); !ok {
+			t.Fatalf("Expected challenge %d of the burst to be allowed", i)
+		}
+	}
+	ok, wait := limiter.Allow()
+	if ok {
+		t.Fatal("Expected the challenge past the burst to be refused")
+	}
+	if wait != 500*time.Millisecond {
+		t.Errorf("Expected to wait 500ms for the next challenge, got %v", wait)
+	}
+
+	// Refused attempts don't use up the bucket
+	now = now.Add(250 * time.Millisecond)
+	if ok, wait := limiter.Allow(); ok || wait != 250*time.Millisecond {
+		t.Errorf("Expected to wait another 250ms, got ok=%v wait=%v", ok, wait)
+	}
+	now = now.Add(250 * time.Millisecond)
+	if ok, _ := limiter.Allow(); !ok {
+		t.Error("Expected a challenge once the bucket leaked a token")
+	}
+
+	// Idle time refills no more than the burst
+	now = now.Add(time.Hour)
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		if ok, _ := limiter.Allow(); ok {
+			allowed++
+		}
+	}
+	if allowed != 2 {
+		t.Errorf("Expected a burst of 2 after idling, got %d", allowed)
+	}
+}
+
+func TestChallengeRateLimiter_SlowRate(t *testing.T) {
+	// Rates below one per second still allow a single challenge
+	now := time.Unix(1700000000, 0)
+	limiter := newChallengeRateLimiter(0.5)
+	limiter.now = func() time.Time { return now }
+	limiter.last = now
+
+	if ok, _ := limiter.Allow(); !ok {
+		t.Fatal("Expected the first challenge to be allowed")
+	}
+	if ok, wait := limiter.Allow(); ok || wait != 2*time.Second {
+		t.Errorf("Expected to wait 2s, got ok=%v wait=%v", ok, wait)
+	}
+}
@@ -2,117 +2,538 @@ package server
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"math"
+	"math/big"
 	"net"
+	"os"
+	"strconv"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 
+	"go.opentelemetry.io/otel/trace"
 	"pow/internal/pow"
 	"pow/internal/quotes"
 	"pow/pkg/protocol"
 )
 
+// connIDSize is the number of random bytes in a connection id
+const connIDSize = 4
+
+// goodbyeTimeout bounds the shutting_down message sent to clients whose read was
+// aborted by a forced shutdown, which no longer has a context to bound it
+const goodbyeTimeout = time.Second
+
+const (
+	// tokenFailureBurst is the number of untrusted tokens one IP may present before
+	// its auth messages stop being checked
+	tokenFailureBurst = 5
+	// tokenFailureRate is the number of further untrusted tokens per second one IP may
+	// present, so guessing a trusted token takes about a minute per guess
+	tokenFailureRate = 1.0 / 60
+)
+
+const (
+	// minAcceptBackoff is the pause after the first temporary Accept error
+	minAcceptBackoff = 5 * time.Millisecond
+	// maxAcceptBackoff caps the pause between Accept retries while errors persist
+	maxAcceptBackoff = time.Second
+)
+
+// ErrAddressInUse is returned by ListenAndServe when another process holds the
+// address to listen on
+var ErrAddressInUse = errors.New("address already in use")
+
+// discardLogger drops every record, for callers that pass a nil logger
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.Level(math.MaxInt)}))
+
+// orDiscard returns logger, or discardLogger if it is nil
+func orDiscard(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return discardLogger
+	}
+	return logger
+}
+
+// DifficultyPolicy picks the difficulty of the challenge for a client, in the PoW
+// service's units, from its address and the number of connections being served.
+// Values below 1 are raised to 1 unless the service's own difficulty is 0, i.e. proof
+// of work is disabled. It must be safe for concurrent use.
+type DifficultyPolicy func(remoteAddr net.Addr, activeConns int32) int
+
 // Config holds server configuration
 type Config struct {
-	Host            string
-	Port            string
-	ReadTimeout     time.Duration
-	WriteTimeout    time.Duration
-	MaxConnections  int
-	ShutdownTimeout time.Duration
+	Host                     string
+	Port                     string
+	ReadTimeout              time.Duration
+	WriteTimeout             time.Duration
+	MaxConnections           int
+	MaxConnectionsPerIP      int // Cap on concurrent connections from one IP, 0 disables
+	ShutdownTimeout          time.Duration
+	TLSCertFile              string // TLS is enabled when both cert and key files are set
+	TLSKeyFile               string
+	RateLimitPerIP           float64       // Connections per second allowed per IP, 0 disables rate limiting
+	RateLimitBurst           int           // Maximum burst of connections per IP
+	GlobalChallengeRate      float64       // Challenges issued per second across all clients, 0 disables the cap
+	MaxQuotesPerRequest      int           // Cap on quotes returned for a single proof, values < 1 mean 1
+	ConnectionDeadline       time.Duration // Total time allowed for each handshake, 0 disables
+	MaxRequestsPerConnection int           // Cap on keep-alive handshakes per connection, values < 1 mean 1
+	LegacyFraming            bool          // Speak little-endian protocol version 2 framing
+	Network                  string        // "tcp" (default) or "unix"
+	SocketPath               string        // Socket file to listen on when Network is "unix"
+	BusyRetryAfter           time.Duration // Advisory retry delay sent when no challenge slot is free, 0 omits it
+	BindToIP                 bool          // Bind each challenge to the client IP so its proof is useless from elsewhere
+	AuditHook                AuditHook     // Receives every issued challenge and proof outcome, nil disables auditing
+	ServerInfo               string        // Sent to clients with each challenge for diagnostics, empty sends nothing
+	SubscriptionMinInterval  time.Duration // Floor on the interval between quotes pushed to a subscriber
+	SubscriptionMaxDuration  time.Duration // How long one quote subscription may last, 0 disables subscriptions
+	HeartbeatInterval        time.Duration // Ping idle subscribers and answer client heartbeats, 0 disables heartbeats
+	AcceptQueueSize          int           // Connections that may wait for a slot once MaxConnections is reached, 0 rejects them
+	AcceptQueueTimeout       time.Duration // How long a queued connection waits for a slot before being closed
+	Tracer                   trace.Tracer  // Traces each connection in a span, nil disables tracing
+	StrictDecoding           bool          // Reject client messages carrying unknown fields
+	TrustedTokens            []string      // Pre-shared tokens whose holders get their challenges at difficulty 0
+	MaxMessageSize           int           // Cap on messages read or written in bytes, 0 means protocol.MaxMessageSize
+	AcceptWorkers            int           // Goroutines accepting connections concurrently, values < 1 mean 1
+	TCPKeepAlive             time.Duration // Keep-alive probe period on accepted TCP connections, 0 uses the OS default, negative disables
+	ListenRetries            int           // Times ListenAndServe retries an address in use, e.g. while an old process exits. 0 fails at once
+	ListenRetryDelay         time.Duration // Pause between those retries
+
+	// DifficultyPolicy picks each challenge's difficulty, nil uses the PoW service's current one
+	DifficultyPolicy DifficultyPolicy
+	// MinDifficulty is the floor, in the PoW service's units, on the difficulty a
+	// DifficultyPolicy or an endpoint picks for a challenge. 0 disables it.
+	MinDifficulty int
+	// PostProofHandler serves each client that solved a challenge, nil sends quotes
+	PostProofHandler PostProofHandler
+	// Encoding encodes message payloads and must match the clients' encoding, nil means JSON
+	Encoding protocol.Encoding
+	// OnAcceptError is called with every error Accept returns outside shutdown and the
+	// number of consecutive failures, so operators can alert on persistent ones. nil disables it.
+	OnAcceptError func(err error, consecutive int)
 }
 
 // Server represents the TCP server
 type Server struct {
 	config        Config
+	codec         protocol.Codec
 	powService    pow.ChallengeService // Server only needs challenge operations
 	quotesService quotes.Service
 	logger        *slog.Logger
 	listener      net.Listener
+	ready         chan struct{} // Closed once the listener is bound
 	activeConns   int32
+	queued        int32         // Connections waiting for a slot
+	slots         chan struct{} // One entry per connection being served, nil when MaxConnections is unlimited
 	wg            sync.WaitGroup
 	shutdownCh    chan struct{}
 	shutdownOnce  sync.Once
+	drainCh       chan struct{} // Closed by Drain
+	drainOnce     sync.Once
+	rateLimiter   *ipRateLimiter     // nil when rate limiting is disabled
+	connLimiter   *ipConnLimiter     // nil when the per-IP connection cap is disabled
+	tokenFailures *ipRateLimiter     // Untrusted tokens presented per IP, nil without TrustedTokens
+	audit         *asyncAuditHook    // nil when auditing is disabled
+	tracer        trace.Tracer       // No-op when tracing is disabled
+	connCtx       context.Context    // Parent of all connection contexts
+	cancelConns   context.CancelFunc // Aborts in-flight I/O when graceful shutdown times out
+
+	// challengeLimiter caps challenges issued per second, nil when the cap is disabled
+	challengeLimiter *challengeRateLimiter
+	// metrics times every handshake
+	metrics *HandshakeMetrics
+	// primary is the main listener's endpoint, using powService
+	primary *endpoint
+	// endpoints are the listeners added with AddEndpoint
+	endpoints []*endpoint
+}
+
+// connState is the per-connection state shared by all handshakes on a connection
+type connState struct {
+	conn   net.Conn
+	framer *protocol.Framer
+	id     string       // Short random id correlating log lines and error messages
+	logger *slog.Logger // Server logger tagged with conn_id and remote_addr
+	span   trace.Span   // Covers the whole connection
+
+	// endpoint is the listener the connection was accepted on
+	endpoint *endpoint
 }
 
-// NewServer creates a new TCP server instance
+// NewServer creates a new TCP server instance. A nil logger discards all logs.
 func NewServer(config Config, powService pow.ChallengeService, quotesService quotes.Service, logger *slog.Logger) *Server {
-	return &Server{
+	logger = orDiscard(logger)
+	s := &Server{
 		config:        config,
+		codec:         protocol.CodecFor(config.LegacyFraming).WithMaxSize(config.MaxMessageSize).WithEncoding(config.Encoding),
 		powService:    powService,
 		quotesService: quotesService,
 		logger:        logger,
 		shutdownCh:    make(chan struct{}),
+		drainCh:       make(chan struct{}),
+		tracer:        newTracer(config.Tracer),
+		ready:         make(chan struct{}),
+		metrics:       newHandshakeMetrics(),
+		primary:       &endpoint{powService: powService},
+	}
+	s.connCtx, s.cancelConns = context.WithCancel(context.Background())
+
+	if config.StrictDecoding {
+		s.codec = s.codec.Strict()
+	}
+
+	if config.MaxConnections > 0 {
+		s.slots = make(chan struct{}, config.MaxConnections)
+	}
+	if config.RateLimitPerIP > 0 {
+		s.rateLimiter = newIPRateLimiter(config.RateLimitPerIP, config.RateLimitBurst)
+	}
+	if len(config.TrustedTokens) > 0 {
+		s.tokenFailures = newIPRateLimiter(tokenFailureRate, tokenFailureBurst)
+	}
+	if config.GlobalChallengeRate > 0 {
+		s.challengeLimiter = newChallengeRateLimiter(config.GlobalChallengeRate)
 	}
+	if config.MaxConnectionsPerIP > 0 {
+		s.connLimiter = newIPConnLimiter(config.MaxConnectionsPerIP)
+	}
+	if config.AuditHook != nil {
+		s.audit = newAsyncAuditHook(config.AuditHook, auditBufferSize)
+	}
+
+	// Any nonce solves a difficulty-0 challenge, so make sure that is never silent
+	if config.DifficultyPolicy == nil && config.MinDifficulty < 1 && powService.GetDifficulty() < 1 {
+		logger.Warn("Proof of work disabled, clients get quotes without solving challenges", "difficulty", powService.GetDifficulty())
+	}
+
+	return s
 }
 
 // ListenAndServe starts the server and listens for incoming connections
 func (s *Server) ListenAndServe(ctx context.Context) error {
-	addr := net.JoinHostPort(s.config.Host, s.config.Port)
+	network, addr := s.listenAddr()
+
+	listener, err := s.listen(ctx, network, addr)
+	if err != nil {
+		return err
+	}
 
-	listener, err := net.Listen("tcp", addr)
+	return s.Serve(ctx, listener)
+}
+
+// listen opens the listener on addr, retrying up to ListenRetries times while the
+// address is in use. It gives up early if ctx is canceled.
+func (s *Server) listen(ctx context.Context, network, addr string) (net.Listener, error) {
+	for attempt := 1; ; attempt++ {
+		listener, err := listenOnce(network, addr)
+		if !errors.Is(err, ErrAddressInUse) || attempt > s.config.ListenRetries {
+			return listener, err
+		}
+
+		s.logger.Warn("Address in use, retrying",
+			"address", addr, "attempt", attempt, "retries", s.config.ListenRetries, "delay", s.config.ListenRetryDelay)
+		timer := time.NewTimer(s.config.ListenRetryDelay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		}
+	}
+}
+
+// listenOnce opens the listener on addr, reporting ErrAddressInUse if another
+// process holds it
+func listenOnce(network, addr string) (net.Listener, error) {
+	if network == "unix" {
+		if err := removeStaleSocket(addr); err != nil {
+			return nil, err
+		}
+	}
+
+	// Unix listeners unlink their socket file when closed on shutdown
+	listener, err := net.Listen(network, addr)
+	if errors.Is(err, syscall.EADDRINUSE) {
+		return nil, fmt.Errorf("%w: %s is held by another process, stop it or listen elsewhere: %w", ErrAddressInUse, addr, err)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to start listener: %w", err)
+		return nil, fmt.Errorf("failed to start listener: %w", err)
+	}
+	return listener, nil
+}
+
+// Serve accepts connections on an already-open listener until ctx is canceled.
+// It takes ownership of ln and wraps it in TLS if configured.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	wrap := func(ln net.Listener) net.Listener { return ln }
+
+	tlsEnabled := s.config.TLSCertFile != "" && s.config.TLSKeyFile != ""
+	if tlsEnabled {
+		cert, err := tls.LoadX509KeyPair(s.config.TLSCertFile, s.config.TLSKeyFile)
+		if err != nil {
+			ln.Close()
+			return fmt.Errorf("failed to load TLS key pair: %w", err)
+		}
+		tlsConfig := &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}
+		wrap = func(ln net.Listener) net.Listener { return tls.NewListener(ln, tlsConfig) }
+	}
+
+	// Every endpoint is bound before the server reports ready
+	if err := s.listenEndpoints(wrap); err != nil {
+		ln.Close()
+		return err
 	}
 
+	listener := wrap(ln)
 	s.listener = listener
-	s.logger.Info("Server started", "address", addr)
+	s.primary.listener = listener
+	close(s.ready)
+	s.logger.Info("Server started", "address", ln.Addr().String(), "tls", tlsEnabled)
+
+	// Drain was called before the listeners were bound
+	if s.IsDraining() {
+		s.closeListeners()
+	}
 
 	// Handle graceful shutdown
 	go s.handleShutdown(ctx)
 
-	// Accept connections
+	// Accept connections on several goroutines sharing each listener, so one
+	// slow Accept or TLS setup doesn't hold up the rest during a storm
+	var acceptors sync.WaitGroup
+	var acceptErr error
+	var acceptErrOnce sync.Once
+	for _, ep := range append([]*endpoint{s.primary}, s.endpoints...) {
+		for i := 0; i < max(s.config.AcceptWorkers, 1); i++ {
+			acceptors.Add(1)
+			go func(ep *endpoint) {
+				defer acceptors.Done()
+				if err := s.acceptLoop(ep); err != nil {
+					// A listener is broken, so shut down as if ctx were canceled
+					acceptErrOnce.Do(func() {
+						acceptErr = err
+						s.stop()
+					})
+				}
+			}(ep)
+		}
+	}
+	acceptors.Wait()
+
+	select {
+	case <-s.shutdownCh:
+		// Listener closed due to shutdown - perform graceful shutdown
+		s.logger.Info("Server shutting down...")
+	case <-s.drainCh:
+		// Connections already accepted finish on their own; exit only when told to
+		<-s.shutdownCh
+		s.logger.Info("Drained server shutting down...")
+	}
+	if err := s.shutdown(); err != nil {
+		return err
+	}
+	if acceptErr != nil {
+		return fmt.Errorf("failed to accept connections: %w", acceptErr)
+	}
+	return nil
+}
+
+// acceptLoop accepts connections on the listener of ep until shutdown or Drain
+// closes it. Temporary errors are retried with exponential backoff; any other
+// error ends the loop and is returned.
+func (s *Server) acceptLoop(ep *endpoint) error {
+	var backoff time.Duration
+	failures := 0
 	for {
 		select {
 		case <-s.shutdownCh:
-			s.logger.Info("Server shutting down...")
-			return s.shutdown()
+			return nil
 		default:
-			conn, err := listener.Accept()
-			if err != nil {
-				select {
-				case <-s.shutdownCh:
-					// Listener closed due to shutdown - perform graceful shutdown
-					s.logger.Info("Accept failed due to shutdown, cleaning up...")
-					return s.shutdown()
-				default:
-					s.logger.Error("Failed to accept connection", "error", err)
-					continue
-				}
+		}
+
+		conn, err := ep.listener.Accept()
+		if err != nil {
+			if s.stopping() {
+				return nil
+			}
+
+			failures++
+			if s.config.OnAcceptError != nil {
+				s.config.OnAcceptError(err, failures)
+			}
+			if !isTemporary(err) {
+				s.logger.Error("Failed to accept connection, stopping", "error", err, "consecutive_failures", failures)
+				return err
 			}
 
-			// Check max connections limit
-			if s.config.MaxConnections > 0 && atomic.LoadInt32(&s.activeConns) >= int32(s.config.MaxConnections) {
-				s.logger.Warn("Max connections reached, rejecting connection",
-					"remote_addr", conn.RemoteAddr().String())
-				conn.Close()
-				continue
+			// Back off so a persistent error such as fd exhaustion doesn't spin the loop
+			backoff = min(max(backoff*2, minAcceptBackoff), maxAcceptBackoff)
+			s.logger.Error("Failed to accept connection, retrying", "error", err, "consecutive_failures", failures, "retry_in", backoff)
+			select {
+			case <-s.shutdownCh:
+				return nil
+			case <-s.drainCh:
+				return nil
+			case <-time.After(backoff):
 			}
+			continue
+		}
+		backoff, failures = 0, 0
+
+		s.setSocketOptions(conn)
+
+		// Serve the connection, queue it until a slot frees up, or reject it
+		s.admit(conn, ep)
+	}
+}
+
+// stopping reports whether the server is shutting down or draining, which
+// explains why Accept fails
+func (s *Server) stopping() bool {
+	select {
+	case <-s.shutdownCh:
+		return true
+	case <-s.drainCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// isTemporary reports whether err is an Accept error worth retrying, such as
+// running out of file descriptors. Temporary is deprecated for most errors, but
+// Accept still uses it to mark exactly these.
+func isTemporary(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Temporary()
+}
+
+// tcpSocket is the part of *net.TCPConn used to tune accepted connections
+type tcpSocket interface {
+	SetNoDelay(noDelay bool) error
+	SetKeepAlive(keepalive bool) error
+	SetKeepAlivePeriod(d time.Duration) error
+}
+
+// setSocketOptions disables Nagle's algorithm on an accepted TCP connection, so
+// small handshake messages go out at once, and configures keep-alive probes so a
+// dead peer holding a challenge slot is detected. Other connections, such as Unix
+// sockets, are left alone. Failures are logged; the connection is still served.
+func (s *Server) setSocketOptions(conn net.Conn) {
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+	sock, ok := conn.(tcpSocket)
+	if !ok {
+		return
+	}
+
+	if err := configureTCP(sock, s.config.TCPKeepAlive); err != nil {
+		s.logger.Warn("Failed to set TCP options", "error", err, "remote_addr", conn.RemoteAddr().String())
+	}
+}
 
-			// Handle connection in a new goroutine
-			s.wg.Add(1)
-			atomic.AddInt32(&s.activeConns, 1)
-			go s.handleConnection(conn)
+// configureTCP enables TCP_NODELAY on sock and applies keepAlive: a negative period
+// disables keep-alive, zero enables it with the OS default period
+func configureTCP(sock tcpSocket, keepAlive time.Duration) error {
+	if err := sock.SetNoDelay(true); err != nil {
+		return fmt.Errorf("failed to set TCP_NODELAY: %w", err)
+	}
+	if err := sock.SetKeepAlive(keepAlive >= 0); err != nil {
+		return fmt.Errorf("failed to set keep-alive: %w", err)
+	}
+	if keepAlive > 0 {
+		if err := sock.SetKeepAlivePeriod(keepAlive); err != nil {
+			return fmt.Errorf("failed to set keep-alive period: %w", err)
 		}
 	}
+	return nil
+}
+
+// listenAddr returns the network and address to listen on
+func (s *Server) listenAddr() (string, string) {
+	if s.config.Network == "unix" {
+		return "unix", s.config.SocketPath
+	}
+	return "tcp", net.JoinHostPort(s.config.Host, s.config.Port)
+}
+
+// removeStaleSocket deletes a socket file left behind by a server that did not
+// shut down cleanly. It refuses to touch regular files or a socket still in use.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stat socket path: %w", err)
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("socket path %s exists and is not a socket", path)
+	}
+
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return fmt.Errorf("%w: socket %s is served by another process, stop it or listen elsewhere", ErrAddressInUse, path)
+	}
+
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove stale socket: %w", err)
+	}
+	return nil
+}
+
+// Ready returns a channel that is closed once the server is accepting connections
+func (s *Server) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// Addr returns the address the server is bound to, or nil before it is ready.
+// With Port "0" this reveals the port picked by the OS.
+func (s *Server) Addr() net.Addr {
+	select {
+	case <-s.ready:
+		return s.listener.Addr()
+	default:
+		return nil
+	}
 }
 
 // handleShutdown handles graceful shutdown signal
 func (s *Server) handleShutdown(ctx context.Context) {
-	<-ctx.Done()
+	select {
+	case <-ctx.Done():
+		s.stop()
+	case <-s.shutdownCh:
+	}
+}
+
+// stop starts shutting down: it stops accepting and lets Serve wind down connections
+func (s *Server) stop() {
 	s.shutdownOnce.Do(func() {
 		close(s.shutdownCh)
-		// Close listener to unblock Accept() immediately
-		if s.listener != nil {
-			s.listener.Close()
-		}
+		// Close listeners to unblock Accept() immediately
+		s.closeListeners()
 	})
 }
 
 // shutdown performs graceful shutdown
 func (s *Server) shutdown() error {
+	defer s.closeAudit()
+	defer s.cancelConns()
+
 	// Listener already closed in handleShutdown
 	s.logger.Info("Waiting for active connections to finish...")
 
@@ -127,6 +548,7 @@ func (s *Server) shutdown() error {
 	case <-done:
 		s.logger.Info("All connections closed gracefully")
 	case <-time.After(s.config.ShutdownTimeout):
+		// Canceling the connection context interrupts reads and writes still in flight
 		s.logger.Warn("Shutdown timeout reached, forcing shutdown",
 			"active_connections", atomic.LoadInt32(&s.activeConns))
 	}
@@ -134,102 +556,569 @@ func (s *Server) shutdown() error {
 	return nil
 }
 
-// handleConnection handles a single client connection
-func (s *Server) handleConnection(conn net.Conn) {
+// handleConnection handles a single client connection accepted on the main listener.
+// Canceling ctx aborts any read or write in progress.
+func (s *Server) handleConnection(ctx context.Context, conn net.Conn) {
+	s.handleEndpointConnection(ctx, conn, s.primary)
+}
+
+// handleEndpointConnection handles a single client connection accepted on ep
+func (s *Server) handleEndpointConnection(ctx context.Context, conn net.Conn, ep *endpoint) {
+	acceptedAt := time.Now()
 	defer func() {
 		conn.Close()
 		atomic.AddInt32(&s.activeConns, -1)
 		s.wg.Done()
 	}()
 
-	remoteAddr := conn.RemoteAddr().String()
-	s.logger.Info("New connection", "remote_addr", remoteAddr)
+	// Tag every line about this connection so its lifecycle can be traced
+	id := newConnID()
+	cs := &connState{
+		conn:     conn,
+		framer:   s.newFramer(conn),
+		id:       id,
+		logger:   s.logger.With("conn_id", id, "remote_addr", conn.RemoteAddr().String()),
+		endpoint: ep,
+	}
+	if ep.name != "" {
+		cs.logger = cs.logger.With("endpoint", ep.name)
+	}
+	cs.logger.Info("New connection")
 
-	// Generate challenge
-	challenge, err := s.powService.GenerateChallenge()
-	if err != nil {
-		s.logger.Error("Failed to generate challenge", "error", err, "remote_addr", remoteAddr)
-		s.sendError(conn, "Internal server error")
+	ctx = s.startConnectionSpan(ctx, cs)
+	defer cs.span.End()
+
+	// Throttle abusive IPs before they can consume an active challenge slot
+	ip := remoteIP(conn)
+	if s.rateLimiter != nil && !s.rateLimiter.Allow(ip) {
+		cs.logger.Warn("Rate limit exceeded")
+		traceOutcome(cs, string(protocol.ErrCodeRateLimited), errors.New("rate limited"))
+		s.sendError(ctx, cs, protocol.ErrCodeRateLimited, "rate limited")
 		return
 	}
 
+	// Keep one IP from holding every connection slot
+	if s.connLimiter != nil {
+		if !s.connLimiter.Acquire(ip) {
+			cs.logger.Warn("Per-IP connection limit reached", "max_per_ip", s.config.MaxConnectionsPerIP)
+			traceOutcome(cs, string(protocol.ErrCodeRateLimited), errors.New("per-IP connection limit reached"))
+			s.sendError(ctx, cs, protocol.ErrCodeRateLimited, "too many connections from your address")
+			return
+		}
+		defer s.connLimiter.Release(ip)
+	}
+
+	// Serve handshakes until the client stops asking for keep-alive,
+	// the per-connection request limit is hit, or the server shuts down
+	maxRequests := s.maxRequestsPerConnection()
+	startedAt := acceptedAt
+	for round := 0; round < maxRequests; round++ {
+		cs.span.SetAttributes(attrRequests.Int(round + 1))
+		if !s.handleHandshake(ctx, cs, round, startedAt, round+1 < maxRequests) {
+			return
+		}
+		startedAt = time.Now()
+	}
+}
+
+// handleHandshake runs one challenge -> proof -> quote exchange, timed from startedAt.
+// It returns true if the connection should stay open for another round.
+func (s *Server) handleHandshake(ctx context.Context, cs *connState, round int, startedAt time.Time, allowKeepAlive bool) bool {
+	conn := cs.conn
+	connCtx := ctx // A subscription outlives the handshake deadline
+
+	// Bound the whole handshake so slow clients can't hold a slot indefinitely.
+	// Per-operation timeouts below derive from this context, so they can't outlast it.
+	if s.config.ConnectionDeadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.config.ConnectionDeadline)
+		defer cancel()
+	}
+
+	// Don't hand out challenges that will never be verified
+	if s.isShuttingDown() {
+		cs.logger.Debug("Server shutting down, refusing new handshake", "requests", round)
+		traceOutcome(cs, string(protocol.ErrCodeShuttingDown), nil)
+		s.sendError(ctx, cs, protocol.ErrCodeShuttingDown, "server shutting down")
+		return false
+	}
+
+	// Shed load before spending CPU on a challenge. The connection is closed right
+	// after, so its slot frees up for clients arriving once the bucket has leaked.
+	if s.challengeLimiter != nil {
+		if ok, wait := s.challengeLimiter.Allow(); !ok {
+			retryAfter := (wait + time.Millisecond - 1).Truncate(time.Millisecond) // Round up
+			cs.logger.Warn("Global challenge rate exceeded", "retry_after", retryAfter)
+			traceOutcome(cs, string(protocol.ErrCodeOverloaded), errors.New("global challenge rate exceeded"))
+			s.sendErrorMessage(ctx, cs, protocol.ErrorMessage{
+				Code:         protocol.ErrCodeOverloaded,
+				Message:      "server busy, try again later",
+				RetryAfterMs: retryAfter.Milliseconds(),
+			})
+			return false
+		}
+	}
+
+	// Generate challenge, at the difficulty the policy picks for this client
+	powService := cs.endpoint.powService
+	difficulty := s.challengeDifficulty(cs)
+	challenge, err := powService.GenerateChallengeWithDifficulty(difficulty)
+	if errors.Is(err, pow.ErrTooManyChallenges) {
+		cs.logger.Warn("Active challenge limit reached", "retry_after", s.config.BusyRetryAfter)
+		traceOutcome(cs, string(protocol.ErrCodeOverloaded), err)
+		s.sendErrorMessage(ctx, cs, protocol.ErrorMessage{
+			Code:         protocol.ErrCodeOverloaded,
+			Message:      "server busy, try again later",
+			RetryAfterMs: s.config.BusyRetryAfter.Milliseconds(),
+		})
+		return false
+	}
+	if err != nil {
+		cs.logger.Error("Failed to generate challenge", "error", err)
+		traceOutcome(cs, string(protocol.ErrCodeInternal), err)
+		s.sendError(ctx, cs, protocol.ErrCodeInternal, "Internal server error")
+		return false
+	}
+
 	// Send challenge to client
 	challengeMsg := protocol.ChallengeMessage{
-		BaseMessage: protocol.BaseMessage{Type: protocol.MsgTypeChallenge},
+		BaseMessage: s.codec.NewBaseMessage(protocol.MsgTypeChallenge),
 		Challenge:   challenge,
-		Difficulty:  s.powService.GetDifficulty(),
+		Difficulty:  difficulty,
+		Algorithm:   protocol.AlgorithmSHA256,
+		Namespace:   powService.Namespace(),
+		ServerInfo:  s.config.ServerInfo,
 	}
 
-	if err := protocol.WriteMessage(conn, challengeMsg, s.config.WriteTimeout); err != nil {
-		s.logger.Error("Failed to send challenge", "error", err, "remote_addr", remoteAddr)
-		s.powService.InvalidateChallenge(challenge)
-		return
+	// The client has to hash its IP as seen by us, so a proof can't be relayed from another address
+	if s.config.BindToIP {
+		challengeMsg.Binding = remoteIP(conn)
+	}
+
+	// Proofs are checked against a target instead of the difficulty
+	var target *big.Int
+	if provider, ok := powService.(targetProvider); ok {
+		if target = provider.Target(); target != nil {
+			challengeMsg.Target = pow.FormatTarget(target)
+		}
+	}
+
+	// Memory-hard PoW needs its cost parameters on the client side
+	if argon2Service, ok := powService.(*pow.Argon2HashcashService); ok {
+		params := argon2Service.GetParams()
+		challengeMsg.Algorithm = protocol.AlgorithmArgon2id
+		challengeMsg.Argon2 = &protocol.Argon2Params{
+			Time:    params.Time,
+			Memory:  params.Memory,
+			Threads: params.Threads,
+		}
+	}
+
+	// Advisory only, so clients can tell users roughly how long solving will take
+	challengeMsg.ExpectedIterations = expectedIterations(challengeMsg, target)
+
+	cs.span.SetAttributes(
+		attrDifficulty.Int(challengeMsg.Difficulty),
+		attrAlgorithm.String(challengeMsg.Algorithm),
+	)
+
+	if err := cs.framer.WriteCtx(ctx, challengeMsg); err != nil {
+		cs.logger.Error("Failed to send challenge", "error", err)
+		traceOutcome(cs, outcomeConnectionError, err)
+		powService.InvalidateChallenge(challenge)
+		return false
 	}
 
-	s.logger.Debug("Challenge sent", "remote_addr", remoteAddr, "challenge", challenge)
+	cs.logger.Debug("Challenge sent", "challenge", challenge)
+	challengeSentAt := time.Now()
+	timing := HandshakeTiming{TimeToChallenge: challengeSentAt.Sub(startedAt)}
+	s.metrics.recordTimeToChallenge(timing.TimeToChallenge)
+	s.auditChallengeIssued(cs, challenge)
+	cs.span.AddEvent("challenge sent")
 
-	// Read proof from client
+	// Read proof from client, who may first present a trusted token
 	var proofMsg protocol.ProofMessage
-	if err := protocol.ReadMessage(conn, &proofMsg, s.config.ReadTimeout); err != nil {
-		s.logger.Error("Failed to read proof", "error", err, "remote_addr", remoteAddr)
-		s.powService.InvalidateChallenge(challenge)
-		s.sendError(conn, "Failed to read proof")
-		return
+	var authMsg protocol.AuthMessage
+	err = s.readProof(ctx, cs, &proofMsg, &authMsg)
+	trusted := false
+	if err == nil && authMsg.Type == protocol.MsgTypeAuth {
+		trusted, err = s.answerAuth(ctx, cs, challengeMsg, authMsg)
+		if err == nil {
+			err = s.readProof(ctx, cs, &proofMsg, nil)
+		}
+	}
+	if err != nil {
+		powService.InvalidateChallenge(challenge)
+		// A keep-alive client may simply hang up instead of solving the next challenge
+		if round > 0 && errors.Is(err, io.EOF) {
+			cs.logger.Debug("Client closed keep-alive connection", "requests", round)
+			return false
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			cs.logger.Warn("Connection deadline exceeded, closing connection", "deadline", s.config.ConnectionDeadline)
+			traceOutcome(cs, outcomeDeadline, err)
+			return false
+		}
+		if errors.Is(err, context.Canceled) {
+			cs.logger.Warn("Read aborted by forced shutdown")
+			traceOutcome(cs, outcomeAborted, err)
+			s.sendGoodbye(ctx, cs)
+			return false
+		}
+		// Tell the client what it did wrong; after a network error there is nobody to tell
+		if errors.Is(err, errUnexpectedMessage) {
+			cs.logger.Warn("Unexpected message instead of proof", "error", err)
+			traceOutcome(cs, string(protocol.ErrCodeUnexpectedMessage), err)
+			s.sendError(ctx, cs, protocol.ErrCodeUnexpectedMessage, "Expected a proof message")
+			return false
+		}
+		if protocol.IsProtocolViolation(err) {
+			cs.logger.Warn("Invalid proof message", "error", err)
+			traceOutcome(cs, string(protocol.ErrCodeBadRequest), err)
+			s.sendError(ctx, cs, protocol.ErrCodeBadRequest, "Invalid message: "+protocol.ViolationReason(err))
+			return false
+		}
+		cs.logger.Error("Failed to read proof", "error", err)
+		traceOutcome(cs, outcomeConnectionError, err)
+		return false
+	}
+	cs.span.AddEvent("proof received")
+	cs.span.SetAttributes(attrReportedAttempts.Int(proofMsg.Attempts))
+
+	// Client ends a keep-alive session politely
+	if proofMsg.Type == protocol.MsgTypeClose {
+		cs.logger.Debug("Client closed keep-alive session", "requests", round)
+		powService.InvalidateChallenge(challenge)
+		return false
+	}
+
+	// Tell server-side latency apart from the client's solve time
+	timing.ProofWait = time.Since(challengeSentAt)
+	s.metrics.recordProofWait(timing.ProofWait)
+	s.auditHandshakeTiming(cs, challenge, timing)
+	cs.logger.Debug("Proof received", "time_to_challenge", timing.TimeToChallenge, "proof_wait", timing.ProofWait)
+
+	// Reject clients speaking an incompatible protocol version
+	if err := protocol.CheckVersion(proofMsg.Version); err != nil {
+		cs.logger.Warn("Protocol version mismatch", "error", err)
+		powService.InvalidateChallenge(challenge)
+		s.recordProofResult(cs, challenge, protocol.ErrCodeUnsupportedVersion)
+		s.sendError(ctx, cs, protocol.ErrCodeUnsupportedVersion, err.Error())
+		return false
 	}
 
 	// CRITICAL: Verify that client is solving the challenge issued in THIS connection
 	// This prevents replay attacks where client uses an old challenge from a different connection
 	if proofMsg.Challenge != challenge {
-		s.logger.Warn("Challenge mismatch - possible replay attack",
-			"remote_addr", remoteAddr,
+		cs.logger.Warn("Challenge mismatch - possible replay attack",
 			"expected", challenge,
 			"received", proofMsg.Challenge)
-		s.powService.InvalidateChallenge(challenge)
-		s.sendError(conn, "Challenge mismatch")
-		return
+		powService.InvalidateChallenge(challenge)
+		s.recordProofResult(cs, challenge, protocol.ErrCodeChallengeMismatch)
+		s.sendError(ctx, cs, protocol.ErrCodeChallengeMismatch, "Challenge mismatch")
+		return false
 	}
 
-	// Verify proof
-	valid, err := s.powService.VerifyProof(proofMsg.Challenge, proofMsg.Nonce)
-	if err != nil {
-		s.logger.Error("Failed to verify proof", "error", err, "remote_addr", remoteAddr)
-		s.sendError(conn, fmt.Sprintf("Proof verification error: %v", err))
-		return
+	// Trusted services were let off the work; everyone else proved the challenge
+	if trusted {
+		powService.InvalidateChallenge(challenge)
+		s.recordTrustedHandshake(cs, challenge)
+		cs.logger.Info("Trusted token accepted, proof not verified")
+	} else {
+		if !s.verifyProof(ctx, cs, challengeMsg, proofMsg) {
+			return false
+		}
+		// Attempts are self-reported by the client and only useful for tuning difficulty
+		cs.logger.Info("Proof verified successfully",
+			"difficulty", challengeMsg.Difficulty,
+			"reported_attempts", proofMsg.Attempts,
+			"solve_time", timing.ProofWait)
 	}
 
-	if !valid {
-		s.logger.Warn("Invalid proof", "remote_addr", remoteAddr)
-		s.sendError(conn, "Invalid proof")
-		return
+	// A custom handler replaces quotes and has the connection to itself from here on
+	if s.config.PostProofHandler != nil {
+		if err := s.config.PostProofHandler.Handle(ctx, conn, cs.logger); err != nil {
+			cs.logger.Error("Post-proof handler failed", "error", err)
+			traceOutcome(cs, outcomeHandlerError, err)
+			return false
+		}
+		cs.logger.Info("Post-proof handler completed")
+		return false
+	}
+
+	// Subscription: push quotes over this connection instead of further handshakes
+	if proofMsg.Subscribe && s.config.SubscriptionMaxDuration > 0 {
+		s.serveSubscription(connCtx, cs, proofMsg)
+		return false
 	}
 
-	s.logger.Info("Proof verified successfully", "remote_addr", remoteAddr)
+	// Keep the connection open only if the client asked and the limit allows it
+	keepAlive := proofMsg.KeepAlive && allowKeepAlive && !s.isWindingDown()
+
+	// Batch request: several quotes for a single proof
+	if proofMsg.Count > 1 {
+		count := proofMsg.Count
+		if count > s.maxQuotesPerRequest() {
+			count = s.maxQuotesPerRequest()
+		}
+
+		quotesMsg := protocol.QuotesMessage{
+			BaseMessage: s.codec.NewBaseMessage(protocol.MsgTypeQuotes),
+			Quotes:      make([]string, count),
+			KeepAlive:   keepAlive,
+		}
+		for i := range quotesMsg.Quotes {
+			quotesMsg.Quotes[i] = s.quotesService.GetRandomQuoteByCategory(proofMsg.Category)
+		}
+
+		if err := cs.framer.WriteCtx(ctx, quotesMsg); err != nil {
+			cs.logger.Error("Failed to send quotes", "error", err)
+			traceOutcome(cs, outcomeConnectionError, err)
+			return false
+		}
 
-	// Get and send quote
-	quote := s.quotesService.GetRandomQuote()
+		cs.logger.Info("Quotes sent successfully", "requested", proofMsg.Count, "sent", count)
+		return keepAlive
+	}
+
+	// Get and send quote, from the requested category if any
+	quote := s.quotesService.GetRandomQuoteByCategory(proofMsg.Category)
 	quoteMsg := protocol.QuoteMessage{
-		BaseMessage: protocol.BaseMessage{Type: protocol.MsgTypeQuote},
+		BaseMessage: s.codec.NewBaseMessage(protocol.MsgTypeQuote),
 		Quote:       quote,
+		KeepAlive:   keepAlive,
+	}
+	if proofMsg.Structured {
+		structureQuote(&quoteMsg)
 	}
 
-	if err := protocol.WriteMessage(conn, quoteMsg, s.config.WriteTimeout); err != nil {
-		s.logger.Error("Failed to send quote", "error", err, "remote_addr", remoteAddr)
-		return
+	if err := cs.framer.WriteCtx(ctx, quoteMsg); err != nil {
+		cs.logger.Error("Failed to send quote", "error", err)
+		traceOutcome(cs, outcomeConnectionError, err)
+		return false
 	}
 
-	s.logger.Info("Quote sent successfully", "remote_addr", remoteAddr)
+	cs.logger.Info("Quote sent successfully")
+	return keepAlive
 }
 
-// sendError sends an error message to the client
-func (s *Server) sendError(conn net.Conn, message string) {
-	errMsg := protocol.ErrorMessage{
-		BaseMessage: protocol.BaseMessage{Type: protocol.MsgTypeError},
-		Message:     message,
+// targetProvider is implemented by PoW services that can check proofs against a target
+type targetProvider interface {
+	Target() *big.Int
+}
+
+// structureQuote fills in msg's text and author, split from its plain quote
+func structureQuote(msg *protocol.QuoteMessage) {
+	quote := quotes.ParseQuote(msg.Quote)
+	msg.Text, msg.Author = quote.Text, quote.Author
+}
+
+// verifyProof checks the proof answering challengeMsg, recording the result and
+// telling the client what was wrong. It reports whether the proof is valid.
+func (s *Server) verifyProof(ctx context.Context, cs *connState, challengeMsg protocol.ChallengeMessage, proofMsg protocol.ProofMessage) bool {
+	challenge := challengeMsg.Challenge
+
+	// Recover the exact bytes the client hashed
+	nonce, err := proofMsg.NonceBytes()
+	if err != nil {
+		cs.logger.Warn("Invalid nonce", "error", err)
+		cs.endpoint.powService.InvalidateChallenge(challenge)
+		s.recordProofResult(cs, challenge, protocol.ErrCodeBadRequest)
+		s.sendError(ctx, cs, protocol.ErrCodeBadRequest, "Invalid message: "+protocol.ViolationReason(err))
+		return false
+	}
+
+	valid, err := cs.endpoint.powService.VerifyBoundProof(ctx, challenge, challengeMsg.Binding, nonce)
+	if err != nil {
+		cs.logger.Error("Failed to verify proof", "error", err)
+		s.recordProofResult(cs, challenge, protocol.ErrCodeVerificationFailed)
+		cs.span.RecordError(err)
+		s.sendError(ctx, cs, protocol.ErrCodeVerificationFailed, "Proof verification failed")
+		return false
+	}
+
+	if !valid {
+		cs.logger.Warn("Invalid proof")
+		s.recordProofResult(cs, challenge, protocol.ErrCodeInvalidProof)
+		s.sendError(ctx, cs, protocol.ErrCodeInvalidProof, "Invalid proof")
+		return false
+	}
+
+	s.recordProofResult(cs, challenge, "")
+	return true
+}
+
+// answerAuth answers the auth message a client sent instead of a proof by sending
+// challengeMsg again, at difficulty 0 if the token is trusted. Untrusted tokens get
+// the challenge unchanged, so the client falls back to proof of work. Each one
+// counts against the client's IP; once it presented too many, its tokens are no
+// longer checked and every one gets the challenge unchanged, so guessing them
+// teaches it nothing. It reports whether the token is trusted.
+func (s *Server) answerAuth(ctx context.Context, cs *connState, challengeMsg protocol.ChallengeMessage, authMsg protocol.AuthMessage) (bool, error) {
+	ip := remoteIP(cs.conn)
+	trusted := false
+	switch {
+	case s.tokenFailures == nil:
+		cs.logger.Warn("Token presented but none are trusted, proof of work required")
+	case s.tokenFailures.Exhausted(ip):
+		cs.logger.Warn("Too many untrusted tokens from this address, proof of work required")
+	case s.isTrustedToken(authMsg.Token):
+		trusted = true
+	default:
+		s.tokenFailures.Allow(ip)
+		cs.logger.Warn("Untrusted token presented, proof of work required")
 	}
 
-	if err := protocol.WriteMessage(conn, errMsg, s.config.WriteTimeout); err != nil {
-		s.logger.Error("Failed to send error message", "error", err)
+	if trusted {
+		cs.logger.Debug("Trusted token presented, waiving proof of work")
+		challengeMsg.Difficulty = 0
+		challengeMsg.Target = ""
+		challengeMsg.ExpectedIterations = 1
+	}
+
+	if err := cs.framer.WriteCtx(ctx, challengeMsg); err != nil {
+		return false, fmt.Errorf("failed to answer auth: %w", err)
+	}
+	return trusted, nil
+}
+
+// isTrustedToken reports whether token is one of the configured trusted tokens.
+// Every configured token is compared in constant time, so the time taken does not
+// reveal which one matched or how much of a guess was right.
+func (s *Server) isTrustedToken(token string) bool {
+	if token == "" {
+		return false
+	}
+	match := 0
+	for _, trusted := range s.config.TrustedTokens {
+		match |= subtle.ConstantTimeCompare([]byte(token), []byte(trusted))
+	}
+	return match == 1
+}
+
+// expectedIterations returns the average number of nonces tried to solve challengeMsg,
+// against target if set. SHA256 difficulty counts zero bytes, Argon2id difficulty bits.
+func expectedIterations(challengeMsg protocol.ChallengeMessage, target *big.Int) uint64 {
+	if target != nil {
+		return pow.TargetAttempts(target)
+	}
+	if challengeMsg.Algorithm == protocol.AlgorithmArgon2id {
+		return pow.ExpectedAttempts(challengeMsg.Difficulty)
+	}
+	return pow.ExpectedAttempts(challengeMsg.Difficulty * 8)
+}
+
+// challengeDifficulty returns the difficulty of the next challenge sent on the
+// connection of cs: its endpoint's if set, otherwise the policy's or the service's,
+// raised to MinDifficulty
+func (s *Server) challengeDifficulty(cs *connState) int {
+	difficulty := s.chosenDifficulty(cs)
+	if difficulty < s.config.MinDifficulty {
+		cs.logger.Warn("Challenge difficulty below the floor, raising it",
+			"difficulty", difficulty, "min_difficulty", s.config.MinDifficulty)
+		return s.config.MinDifficulty
+	}
+	return difficulty
+}
+
+// chosenDifficulty returns the difficulty picked for the next challenge of cs
+// before MinDifficulty applies
+func (s *Server) chosenDifficulty(cs *connState) int {
+	if cs.endpoint.difficulty > 0 {
+		return cs.endpoint.difficulty
 	}
+	if s.config.DifficultyPolicy == nil {
+		return cs.endpoint.powService.GetDifficulty()
+	}
+	difficulty := s.config.DifficultyPolicy(cs.conn.RemoteAddr(), s.GetActiveConnections())
+	// Below 1 any nonce solves the challenge, which is the service's call to make, not
+	// the policy's. A value under MinDifficulty is raised to it anyway.
+	if difficulty < 1 && s.config.MinDifficulty < 1 && cs.endpoint.powService.GetDifficulty() >= 1 {
+		cs.logger.Warn("Difficulty policy returned a difficulty below 1, raising it to 1", "difficulty", difficulty)
+		return 1
+	}
+	return max(difficulty, 0)
+}
+
+// maxRequestsPerConnection returns the effective cap on handshakes per connection
+func (s *Server) maxRequestsPerConnection() int {
+	if s.config.MaxRequestsPerConnection < 1 {
+		return 1
+	}
+	return s.config.MaxRequestsPerConnection
+}
+
+// IsReady reports whether the server is accepting connections and neither
+// draining nor shutting down
+func (s *Server) IsReady() bool {
+	select {
+	case <-s.ready:
+		return !s.isWindingDown()
+	default:
+		return false
+	}
+}
+
+// isShuttingDown reports whether graceful shutdown has started
+func (s *Server) isShuttingDown() bool {
+	select {
+	case <-s.shutdownCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// Metrics returns the timings of every handshake this server has run
+func (s *Server) Metrics() *HandshakeMetrics {
+	return s.metrics
+}
+
+// maxQuotesPerRequest returns the effective cap on quotes per proof
+func (s *Server) maxQuotesPerRequest() int {
+	if s.config.MaxQuotesPerRequest < 1 {
+		return 1
+	}
+	return s.config.MaxQuotesPerRequest
+}
+
+// newConnID returns a short random connection id
+func newConnID() string {
+	b := make([]byte, connIDSize)
+	if _, err := rand.Read(b); err != nil {
+		// Ids only correlate log lines, so a clock-based fallback is good enough
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
+
+// sendError sends an error message carrying the connection id to the client, bounded by ctx
+func (s *Server) sendError(ctx context.Context, cs *connState, code protocol.ErrorCode, message string) {
+	s.sendErrorMessage(ctx, cs, protocol.ErrorMessage{Code: code, Message: message})
+}
+
+// sendGoodbye tells a client still owing a proof when shutdown forces its connection
+// closed that the server is going away, so it sees shutting_down rather than a reset.
+// It's best-effort: ctx is already canceled, so the write gets goodbyeTimeout of its own.
+func (s *Server) sendGoodbye(ctx context.Context, cs *connState) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), goodbyeTimeout)
+	defer cancel()
+	s.sendError(ctx, cs, protocol.ErrCodeShuttingDown, "server shutting down")
+}
+
+// sendErrorMessage fills in the header and connection id of errMsg and sends it
+func (s *Server) sendErrorMessage(ctx context.Context, cs *connState, errMsg protocol.ErrorMessage) {
+	errMsg.BaseMessage = s.codec.NewBaseMessage(protocol.MsgTypeError)
+	errMsg.ConnID = cs.id
+
+	if err := cs.framer.WriteCtx(ctx, errMsg); err != nil {
+		cs.logger.Error("Failed to send error message", "error", err)
+	}
+}
+
+// newFramer frames messages on conn, each read within ReadTimeout and written within WriteTimeout
+func (s *Server) newFramer(conn net.Conn) *protocol.Framer {
+	return protocol.NewFramer(conn, s.codec, s.config.ReadTimeout, s.config.WriteTimeout)
 }
 
 // GetActiveConnections returns the number of active connections
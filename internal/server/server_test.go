@@ -1,15 +1,28 @@
 package server
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
 	"log/slog"
+	"net"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 
 	"pow/internal/pow"
 	"pow/internal/quotes"
+	"pow/pkg/protocol"
 )
 
 func TestServer_GracefulShutdown(t *testing.T) {
@@ -43,8 +56,8 @@ func TestServer_GracefulShutdown(t *testing.T) {
 		serverDone <- srv.ListenAndServe(ctx)
 	}()
 
-	// Give server time to start
-	time.Sleep(100 * time.Millisecond)
+	// Wait for the server to bind
+	waitReady(t, srv)
 
 	// Initiate shutdown
 	shutdownStart := time.Now()
@@ -102,8 +115,8 @@ func TestServer_GracefulShutdownWithActiveConnections(t *testing.T) {
 		close(serverDone)
 	}()
 
-	// Give server time to start
-	time.Sleep(100 * time.Millisecond)
+	// Wait for the server to bind
+	waitReady(t, srv)
 
 	// Simulate active connections
 	srv.wg.Add(2)
@@ -191,3 +204,1888 @@ func TestServer_MaxConnections(t *testing.T) {
 		t.Errorf("Expected 2 active connections, got %d", srv.GetActiveConnections())
 	}
 }
+
+func TestServer_RateLimitPerIP(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	powService := pow.NewSHA256HashcashService(1, 5*time.Minute)
+	quotesService := quotes.NewInMemoryService()
+
+	// Allow a single connection and practically no refill
+	config := Config{
+		Host:            "127.0.0.1",
+		Port:            "18084",
+		ReadTimeout:     5 * time.Second,
+		WriteTimeout:    5 * time.Second,
+		MaxConnections:  10,
+		ShutdownTimeout: 1 * time.Second,
+		RateLimitPerIP:  0.001,
+		RateLimitBurst:  1,
+	}
+
+	srv := NewServer(config, powService, quotesService, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go srv.ListenAndServe(ctx)
+	waitReady(t, srv)
+
+	// First connection receives a challenge
+	conn1, err := net.Dial("tcp", "127.0.0.1:18084")
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn1.Close()
+
+	var first map[string]interface{}
+	if err := protocol.ReadMessage(conn1, &first, 5*time.Second); err != nil {
+		t.Fatalf("Failed to read first message: %v", err)
+	}
+	if first["type"] != string(protocol.MsgTypeChallenge) {
+		t.Errorf("Expected challenge for first connection, got: %v", first["type"])
+	}
+
+	// Second connection from the same IP is rejected before any challenge
+	conn2, err := net.Dial("tcp", "127.0.0.1:18084")
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn2.Close()
+
+	var second map[string]interface{}
+	if err := protocol.ReadMessage(conn2, &second, 5*time.Second); err != nil {
+		t.Fatalf("Failed to read second message: %v", err)
+	}
+	if second["type"] != string(protocol.MsgTypeError) || second["message"] != "rate limited" {
+		t.Errorf("Expected rate limited error, got: %v", second)
+	}
+}
+
+func TestServer_ConnectionDeadline(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	powService := pow.NewSHA256HashcashService(1, 5*time.Minute)
+	quotesService := quotes.NewInMemoryService()
+
+	// Read timeout alone would keep a stalled client around for much longer
+	config := Config{
+		Host:               "127.0.0.1",
+		Port:               "18085",
+		ReadTimeout:        10 * time.Second,
+		WriteTimeout:       5 * time.Second,
+		MaxConnections:     10,
+		ShutdownTimeout:    1 * time.Second,
+		ConnectionDeadline: 300 * time.Millisecond,
+	}
+
+	srv := NewServer(config, powService, quotesService, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go srv.ListenAndServe(ctx)
+	waitReady(t, srv)
+
+	conn, err := net.Dial("tcp", "127.0.0.1:18085")
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	var challengeMsg protocol.ChallengeMessage
+	if err := protocol.ReadMessage(conn, &challengeMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to read challenge: %v", err)
+	}
+
+	// Stall: never send a proof. The server must close the connection.
+	start := time.Now()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 1)
+	if _, err := conn.Read(buf); err != io.EOF {
+		t.Fatalf("Expected server to close connection (EOF), got: %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Connection closed after %v, expected within the 300ms deadline", elapsed)
+	}
+
+	// Connection counter must be released
+	time.Sleep(50 * time.Millisecond)
+	if srv.GetActiveConnections() != 0 {
+		t.Errorf("Expected 0 active connections, got %d", srv.GetActiveConnections())
+	}
+}
+
+func TestServer_KeepAlive(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	difficulty := 1
+	powService := pow.NewSHA256HashcashService(difficulty, 5*time.Minute)
+	quotesService := quotes.NewInMemoryService()
+
+	config := Config{
+		Host:                     "127.0.0.1",
+		Port:                     "18086",
+		ReadTimeout:              5 * time.Second,
+		WriteTimeout:             5 * time.Second,
+		MaxConnections:           10,
+		ShutdownTimeout:          1 * time.Second,
+		MaxRequestsPerConnection: 3,
+	}
+
+	srv := NewServer(config, powService, quotesService, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go srv.ListenAndServe(ctx)
+	waitReady(t, srv)
+
+	t.Run("SeveralQuotesOverOneConnection", func(t *testing.T) {
+		conn, err := net.Dial("tcp", "127.0.0.1:18086")
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		defer conn.Close()
+
+		for round := 0; round < 3; round++ {
+			quoteMsg := solveRound(t, conn, powService, difficulty, true)
+
+			if quoteMsg.Quote == "" {
+				t.Errorf("Round %d: empty quote", round)
+			}
+
+			// The last allowed round must announce that the session ends
+			wantKeepAlive := round < 2
+			if quoteMsg.KeepAlive != wantKeepAlive {
+				t.Errorf("Round %d: expected keep_alive=%v, got %v", round, wantKeepAlive, quoteMsg.KeepAlive)
+			}
+		}
+
+		// Server closes after MaxRequestsPerConnection
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+			t.Errorf("Expected connection to be closed after max requests, got: %v", err)
+		}
+	})
+
+	t.Run("ClientClosesSession", func(t *testing.T) {
+		conn, err := net.Dial("tcp", "127.0.0.1:18086")
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		defer conn.Close()
+
+		if quoteMsg := solveRound(t, conn, powService, difficulty, true); !quoteMsg.KeepAlive {
+			t.Fatal("Expected server to keep the connection alive")
+		}
+
+		var challengeMsg protocol.ChallengeMessage
+		if err := protocol.ReadMessage(conn, &challengeMsg, 5*time.Second); err != nil {
+			t.Fatalf("Failed to read next challenge: %v", err)
+		}
+
+		closeMsg := protocol.CloseMessage{BaseMessage: protocol.NewBaseMessage(protocol.MsgTypeClose)}
+		if err := protocol.WriteMessage(conn, closeMsg, 5*time.Second); err != nil {
+			t.Fatalf("Failed to send close: %v", err)
+		}
+
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+			t.Errorf("Expected connection to be closed after close message, got: %v", err)
+		}
+	})
+}
+
+// solveRound reads a challenge, solves it and returns the server's quote
+func solveRound(t *testing.T, conn net.Conn, solver pow.SolverService, difficulty int, keepAlive bool) protocol.QuoteMessage {
+	t.Helper()
+
+	var challengeMsg protocol.ChallengeMessage
+	if err := protocol.ReadMessage(conn, &challengeMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to read challenge: %v", err)
+	}
+
+	nonce, err := solver.SolveChallenge(context.Background(), challengeMsg.Challenge, difficulty)
+	if err != nil {
+		t.Fatalf("Failed to solve challenge: %v", err)
+	}
+
+	proofMsg := protocol.ProofMessage{
+		BaseMessage: protocol.NewBaseMessage(protocol.MsgTypeProof),
+		Challenge:   challengeMsg.Challenge,
+		Nonce:       nonce,
+		KeepAlive:   keepAlive,
+	}
+	if err := protocol.WriteMessage(conn, proofMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to send proof: %v", err)
+	}
+
+	var quoteMsg protocol.QuoteMessage
+	if err := protocol.ReadMessage(conn, &quoteMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to read quote: %v", err)
+	}
+	if quoteMsg.Type != protocol.MsgTypeQuote {
+		t.Fatalf("Expected quote message, got type: %s", quoteMsg.Type)
+	}
+
+	return quoteMsg
+}
+
+func TestServer_InvalidFrameReported(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	config := Config{
+		Host:            "127.0.0.1",
+		Port:            "18087",
+		ReadTimeout:     5 * time.Second,
+		WriteTimeout:    5 * time.Second,
+		MaxConnections:  10,
+		ShutdownTimeout: 1 * time.Second,
+	}
+
+	srv := NewServer(config, pow.NewSHA256HashcashService(1, 5*time.Minute), quotes.NewInMemoryService(), logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go srv.ListenAndServe(ctx)
+	waitReady(t, srv)
+
+	conn, err := net.Dial("tcp", "127.0.0.1:18087")
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	var challengeMsg protocol.ChallengeMessage
+	if err := protocol.ReadMessage(conn, &challengeMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to read challenge: %v", err)
+	}
+
+	// Zero-length frame instead of a proof
+	if _, err := conn.Write(make([]byte, protocol.MessageLengthPrefixSize+protocol.MessageFlagSize)); err != nil {
+		t.Fatalf("Failed to write frame: %v", err)
+	}
+
+	var errMsg protocol.ErrorMessage
+	if err := protocol.ReadMessage(conn, &errMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to read error: %v", err)
+	}
+	if errMsg.Type != protocol.MsgTypeError || errMsg.Code != protocol.ErrCodeBadRequest {
+		t.Errorf("Expected bad_request error, got: %+v", errMsg)
+	}
+}
+
+func TestServer_MalformedProofReported(t *testing.T) {
+	tests := []struct {
+		name    string
+		strict  bool
+		payload string
+		want    error // Violation named in the error message
+	}{
+		{"InvalidJSON", false, `{"type":"proof",`, protocol.ErrInvalidJSON},
+		{"WrongFieldType", false, `{"type":"proof","count":"many"}`, protocol.ErrFieldType},
+		{"TrailingData", false, `{"type":"proof"} {"type":"proof"}`, protocol.ErrTrailingData},
+		{"UnknownFieldStrict", true, `{"type":"proof","challenge":"c","nonce":"1","x":1}`, protocol.ErrUnknownField},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := startTestServer(t, Config{
+				ReadTimeout:     5 * time.Second,
+				WriteTimeout:    5 * time.Second,
+				MaxConnections:  10,
+				ShutdownTimeout: 1 * time.Second,
+				StrictDecoding:  tt.strict,
+			}, pow.NewSHA256HashcashService(1, 5*time.Minute))
+
+			conn, err := net.Dial("tcp", addr)
+			if err != nil {
+				t.Fatalf("Failed to connect: %v", err)
+			}
+			defer conn.Close()
+
+			var challengeMsg protocol.ChallengeMessage
+			if err := protocol.ReadMessage(conn, &challengeMsg, 5*time.Second); err != nil {
+				t.Fatalf("Failed to read challenge: %v", err)
+			}
+
+			frame := make([]byte, protocol.MessageLengthPrefixSize+protocol.MessageFlagSize)
+			binary.BigEndian.PutUint32(frame, uint32(len(tt.payload)))
+			if _, err := conn.Write(append(frame, tt.payload...)); err != nil {
+				t.Fatalf("Failed to write frame: %v", err)
+			}
+
+			var errMsg protocol.ErrorMessage
+			if err := protocol.ReadMessage(conn, &errMsg, 5*time.Second); err != nil {
+				t.Fatalf("Failed to read error: %v", err)
+			}
+			if errMsg.Code != protocol.ErrCodeBadRequest {
+				t.Errorf("Expected bad_request error, got: %+v", errMsg)
+			}
+			if want := "Invalid message: " + tt.want.Error(); errMsg.Message != want {
+				t.Errorf("Expected message %q, got %q", want, errMsg.Message)
+			}
+
+			// The server hangs up after a protocol violation
+			var next json.RawMessage
+			if err := protocol.ReadMessage(conn, &next, 5*time.Second); err == nil {
+				t.Errorf("Expected connection to be closed, got: %s", next)
+			}
+		})
+	}
+}
+
+// failingVerifyService fails every proof check the way a shared store backend
+// does when it cannot be reached
+type failingVerifyService struct {
+	*pow.SHA256HashcashService
+}
+
+func (f failingVerifyService) VerifyBoundProof(ctx context.Context, challenge, binding, nonce string) (bool, error) {
+	return false, errors.New("dial tcp 10.0.0.5:6379: connection refused")
+}
+
+func TestServer_VerificationErrorNotEchoed(t *testing.T) {
+	addr := startTestServer(t, Config{
+		ReadTimeout:     5 * time.Second,
+		WriteTimeout:    5 * time.Second,
+		MaxConnections:  10,
+		ShutdownTimeout: 1 * time.Second,
+	}, failingVerifyService{pow.NewSHA256HashcashService(1, 5*time.Minute)})
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	var challengeMsg protocol.ChallengeMessage
+	if err := protocol.ReadMessage(conn, &challengeMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to read challenge: %v", err)
+	}
+
+	proofMsg := protocol.ProofMessage{
+		BaseMessage: protocol.NewBaseMessage(protocol.MsgTypeProof),
+		Challenge:   challengeMsg.Challenge,
+		Nonce:       "1",
+	}
+	if err := protocol.WriteMessage(conn, proofMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to send proof: %v", err)
+	}
+
+	var errMsg protocol.ErrorMessage
+	if err := protocol.ReadMessage(conn, &errMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to read error: %v", err)
+	}
+	if errMsg.Code != protocol.ErrCodeVerificationFailed {
+		t.Errorf("Expected verification_failed error, got: %+v", errMsg)
+	}
+	if errMsg.Message != "Proof verification failed" {
+		t.Errorf("Expected a fixed message without backend details, got %q", errMsg.Message)
+	}
+}
+
+func TestServer_ForcedShutdownAbortsReads(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	config := Config{
+		Host:            "127.0.0.1",
+		Port:            "18088",
+		ReadTimeout:     30 * time.Second, // Far longer than the test
+		WriteTimeout:    5 * time.Second,
+		MaxConnections:  10,
+		ShutdownTimeout: 200 * time.Millisecond,
+	}
+
+	srv := NewServer(config, pow.NewSHA256HashcashService(1, 5*time.Minute), quotes.NewInMemoryService(), logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go srv.ListenAndServe(ctx)
+	waitReady(t, srv)
+
+	conn, err := net.Dial("tcp", "127.0.0.1:18088")
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	var challengeMsg protocol.ChallengeMessage
+	if err := protocol.ReadMessage(conn, &challengeMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to read challenge: %v", err)
+	}
+
+	// Never send a proof: the server is blocked reading it when shutdown starts
+	start := time.Now()
+	cancel()
+
+	// The client is told why before the connection closes
+	var errMsg protocol.ErrorMessage
+	if err := protocol.ReadMessage(conn, &errMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to read goodbye: %v", err)
+	}
+	if errMsg.Type != protocol.MsgTypeError || errMsg.Code != protocol.ErrCodeShuttingDown {
+		t.Errorf("Expected a shutting_down error, got: %+v", errMsg)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("Expected server to close the connection, got: %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Connection closed after %v, expected shortly after the 200ms shutdown timeout", elapsed)
+	}
+}
+
+func TestServer_NoChallengeDuringShutdown(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	config := Config{
+		ReadTimeout:     5 * time.Second,
+		WriteTimeout:    5 * time.Second,
+		ShutdownTimeout: 1 * time.Second,
+	}
+
+	srv := NewServer(config, pow.NewSHA256HashcashService(1, 5*time.Minute), quotes.NewInMemoryService(), logger)
+
+	// Connection accepted just before shutdown starts, still waiting for its challenge
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+
+	srv.shutdownOnce.Do(func() { close(srv.shutdownCh) })
+
+	srv.wg.Add(1)
+	atomic.AddInt32(&srv.activeConns, 1)
+	go srv.handleConnection(context.Background(), serverConn)
+
+	var errMsg protocol.ErrorMessage
+	if err := protocol.ReadMessage(clientConn, &errMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	if errMsg.Type != protocol.MsgTypeError || errMsg.Code != protocol.ErrCodeShuttingDown {
+		t.Fatalf("Expected shutting_down error instead of a challenge, got: %+v", errMsg)
+	}
+
+	srv.wg.Wait()
+}
+
+func TestServer_Serve(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	difficulty := 1
+	powService := pow.NewSHA256HashcashService(difficulty, 5*time.Minute)
+	quotesService := quotes.NewInMemoryService()
+
+	config := Config{
+		ReadTimeout:     5 * time.Second,
+		WriteTimeout:    5 * time.Second,
+		MaxConnections:  10,
+		ShutdownTimeout: 1 * time.Second,
+	}
+
+	srv := NewServer(config, powService, quotesService, logger)
+
+	// The listener is bound before Serve starts, so no sleep is needed
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	serverDone := make(chan error, 1)
+	go func() {
+		serverDone <- srv.Serve(ctx, ln)
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	if quoteMsg := solveRound(t, conn, powService, difficulty, false); quoteMsg.Quote == "" {
+		t.Error("Expected a quote")
+	}
+
+	cancel()
+	select {
+	case err := <-serverDone:
+		if err != nil {
+			t.Errorf("Serve returned error: %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Serve did not return after cancellation")
+	}
+
+	// Serve owns the listener and closes it on shutdown
+	if _, err := net.Dial("tcp", ln.Addr().String()); err == nil {
+		t.Error("Expected listener to be closed after shutdown")
+	}
+}
+
+// waitReady blocks until srv is accepting connections
+func waitReady(t *testing.T, srv *Server) {
+	t.Helper()
+
+	select {
+	case <-srv.Ready():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server did not become ready")
+	}
+}
+
+func TestServer_Addr(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	difficulty := 1
+	powService := pow.NewSHA256HashcashService(difficulty, 5*time.Minute)
+	quotesService := quotes.NewInMemoryService()
+
+	config := Config{
+		Host:            "127.0.0.1",
+		Port:            "0", // Let the OS pick a free port
+		ReadTimeout:     5 * time.Second,
+		WriteTimeout:    5 * time.Second,
+		MaxConnections:  10,
+		ShutdownTimeout: 1 * time.Second,
+	}
+
+	srv := NewServer(config, powService, quotesService, logger)
+
+	if addr := srv.Addr(); addr != nil {
+		t.Errorf("Expected nil address before start, got %v", addr)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go srv.ListenAndServe(ctx)
+	waitReady(t, srv)
+
+	addr := srv.Addr()
+	if addr == nil {
+		t.Fatal("Expected address once ready")
+	}
+	if tcpAddr, ok := addr.(*net.TCPAddr); !ok || tcpAddr.Port == 0 {
+		t.Fatalf("Expected a bound TCP port, got %v", addr)
+	}
+
+	conn, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	if quoteMsg := solveRound(t, conn, powService, difficulty, false); quoteMsg.Quote == "" {
+		t.Error("Expected a quote")
+	}
+}
+
+func TestServer_AddressInUse(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to bind port: %v", err)
+	}
+	defer taken.Close()
+	_, port, _ := net.SplitHostPort(taken.Addr().String())
+
+	srv := NewServer(Config{
+		Host:            "127.0.0.1",
+		Port:            port,
+		ReadTimeout:     5 * time.Second,
+		WriteTimeout:    5 * time.Second,
+		MaxConnections:  10,
+		ShutdownTimeout: 1 * time.Second,
+	}, pow.NewSHA256HashcashService(1, time.Minute), quotes.NewInMemoryService(), nil)
+
+	err = srv.ListenAndServe(context.Background())
+	if !errors.Is(err, ErrAddressInUse) {
+		t.Fatalf("Expected ErrAddressInUse, got: %v", err)
+	}
+	if !errors.Is(err, syscall.EADDRINUSE) {
+		t.Errorf("Expected the error to wrap EADDRINUSE, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), taken.Addr().String()) {
+		t.Errorf("Expected the error to name the address, got: %v", err)
+	}
+}
+
+func TestServer_ListenRetries(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to bind port: %v", err)
+	}
+	_, port, _ := net.SplitHostPort(taken.Addr().String())
+
+	srv := NewServer(Config{
+		Host:             "127.0.0.1",
+		Port:             port,
+		ReadTimeout:      5 * time.Second,
+		WriteTimeout:     5 * time.Second,
+		MaxConnections:   10,
+		ShutdownTimeout:  1 * time.Second,
+		ListenRetries:    50,
+		ListenRetryDelay: 20 * time.Millisecond,
+	}, pow.NewSHA256HashcashService(1, time.Minute), quotes.NewInMemoryService(), nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	serverErr := make(chan error, 1)
+	go func() { serverErr <- srv.ListenAndServe(ctx) }()
+
+	// The server keeps retrying until the previous holder lets go of the port
+	time.Sleep(50 * time.Millisecond)
+	taken.Close()
+	select {
+	case <-srv.Ready():
+	case err := <-serverErr:
+		t.Fatalf("Expected the server to start once the port was free, got: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server did not become ready")
+	}
+	if got := srv.Addr().String(); got != taken.Addr().String() {
+		t.Errorf("Expected the server on %s, got %s", taken.Addr(), got)
+	}
+
+	cancel()
+	if err := <-serverErr; err != nil {
+		t.Errorf("Expected a clean shutdown, got: %v", err)
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent log writes
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestServer_ConnIDInLogs(t *testing.T) {
+	var logs syncBuffer
+	logger := slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+	}))
+
+	difficulty := 1
+	powService := pow.NewSHA256HashcashService(difficulty, 5*time.Minute)
+
+	config := Config{
+		ReadTimeout:              5 * time.Second,
+		WriteTimeout:             5 * time.Second,
+		MaxConnections:           10,
+		ShutdownTimeout:          1 * time.Second,
+		MaxRequestsPerConnection: 3,
+	}
+
+	srv := NewServer(config, powService, quotes.NewInMemoryService(), logger)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	serverDone := make(chan error, 1)
+	go func() {
+		serverDone <- srv.Serve(ctx, ln)
+	}()
+
+	// First connection: a keep-alive round, then a malformed frame
+	connA, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer connA.Close()
+
+	solveRound(t, connA, powService, difficulty, true)
+
+	var challengeMsg protocol.ChallengeMessage
+	if err := protocol.ReadMessage(connA, &challengeMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to read second challenge: %v", err)
+	}
+	frame := make([]byte, protocol.MessageLengthPrefixSize+protocol.MessageFlagSize)
+	binary.BigEndian.PutUint32(frame, 5)
+	if _, err := connA.Write(append(frame, "{oops"...)); err != nil {
+		t.Fatalf("Failed to write malformed frame: %v", err)
+	}
+
+	var errMsg protocol.ErrorMessage
+	if err := protocol.ReadMessage(connA, &errMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to read error: %v", err)
+	}
+	if errMsg.ConnID == "" {
+		t.Fatal("Expected error message to carry the connection id")
+	}
+
+	// Second connection gets its own id
+	connB, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer connB.Close()
+
+	solveRound(t, connB, powService, difficulty, false)
+
+	// Shutting down waits for both handlers, so every line is logged
+	cancel()
+	if err := <-serverDone; err != nil {
+		t.Fatalf("Serve returned error: %v", err)
+	}
+
+	idsByAddr := make(map[string]map[string]int)
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var entry struct {
+			ConnID     string `json:"conn_id"`
+			RemoteAddr string `json:"remote_addr"`
+		}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("Failed to parse log line %q: %v", line, err)
+		}
+		if entry.RemoteAddr == "" {
+			continue
+		}
+		if idsByAddr[entry.RemoteAddr] == nil {
+			idsByAddr[entry.RemoteAddr] = make(map[string]int)
+		}
+		idsByAddr[entry.RemoteAddr][entry.ConnID]++
+	}
+
+	idsA := idsByAddr[connA.LocalAddr().String()]
+	idsB := idsByAddr[connB.LocalAddr().String()]
+	if len(idsA) != 1 || idsA[errMsg.ConnID] < 4 {
+		t.Errorf("Expected every line of the first connection to carry conn_id %s, got %v", errMsg.ConnID, idsA)
+	}
+	if len(idsB) != 1 {
+		t.Errorf("Expected a single conn_id for the second connection, got %v", idsB)
+	}
+	if _, shared := idsB[errMsg.ConnID]; shared {
+		t.Errorf("Expected connections to get distinct ids, both got %s", errMsg.ConnID)
+	}
+}
+
+func TestServer_GlobalChallengeRate(t *testing.T) {
+	difficulty := 1
+	powService := pow.NewSHA256HashcashService(difficulty, 5*time.Minute)
+
+	// A single connection slot: throttled clients must give it up rather than hold it
+	addr := startTestServer(t, Config{
+		ReadTimeout:         5 * time.Second,
+		WriteTimeout:        5 * time.Second,
+		MaxConnections:      1,
+		AcceptQueueSize:     10,
+		AcceptQueueTimeout:  5 * time.Second,
+		ShutdownTimeout:     1 * time.Second,
+		GlobalChallengeRate: 2,
+	}, powService)
+
+	dial := func() net.Conn {
+		t.Helper()
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+
+	// A second's worth of challenges is issued at once
+	for i := 0; i < 2; i++ {
+		if quoteMsg := solveRound(t, dial(), powService, difficulty, false); quoteMsg.Quote == "" {
+			t.Fatalf("Expected a quote for challenge %d of the burst", i)
+		}
+	}
+
+	// Beyond that clients are turned away with a hint of when to come back
+	var retryAfter time.Duration
+	for i := 0; i < 3; i++ {
+		var errMsg protocol.ErrorMessage
+		if err := protocol.ReadMessage(dial(), &errMsg, 5*time.Second); err != nil {
+			t.Fatalf("Failed to read response: %v", err)
+		}
+		if errMsg.Type != protocol.MsgTypeError || errMsg.Code != protocol.ErrCodeOverloaded {
+			t.Fatalf("Expected overloaded error, got: %+v", errMsg)
+		}
+		if errMsg.RetryAfterMs <= 0 || errMsg.RetryAfterMs > 500 {
+			t.Errorf("Expected a retry hint of at most 500ms, got %dms", errMsg.RetryAfterMs)
+		}
+		retryAfter = time.Duration(errMsg.RetryAfterMs) * time.Millisecond
+	}
+
+	// Honoring the hint gets a challenge again
+	time.Sleep(retryAfter)
+	if quoteMsg := solveRound(t, dial(), powService, difficulty, false); quoteMsg.Quote == "" {
+		t.Error("Expected a quote after waiting for the retry hint")
+	}
+}
+
+func TestServer_BusyRetryAfter(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	difficulty := 1
+	powService := pow.NewSHA256HashcashServiceWithLimit(difficulty, 5*time.Minute, 1)
+
+	config := Config{
+		ReadTimeout:     5 * time.Second,
+		WriteTimeout:    5 * time.Second,
+		MaxConnections:  10,
+		ShutdownTimeout: 1 * time.Second,
+		BusyRetryAfter:  2 * time.Second,
+	}
+
+	srv := NewServer(config, powService, quotes.NewInMemoryService(), logger)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.Serve(ctx, ln)
+
+	// Saturate the only challenge slot
+	pending, err := powService.GenerateChallenge()
+	if err != nil {
+		t.Fatalf("GenerateChallenge failed: %v", err)
+	}
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	var errMsg protocol.ErrorMessage
+	if err := protocol.ReadMessage(conn, &errMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	if errMsg.Type != protocol.MsgTypeError || errMsg.Code != protocol.ErrCodeOverloaded {
+		t.Fatalf("Expected overloaded error, got: %+v", errMsg)
+	}
+	if errMsg.RetryAfterMs != 2000 {
+		t.Errorf("Expected retry hint of 2000ms, got %d", errMsg.RetryAfterMs)
+	}
+
+	// Once the slot frees up, challenges are handed out again
+	powService.InvalidateChallenge(pending)
+
+	conn2, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn2.Close()
+
+	if quoteMsg := solveRound(t, conn2, powService, difficulty, false); quoteMsg.Quote == "" {
+		t.Error("Expected a quote once a challenge slot is free")
+	}
+}
+
+func TestServer_BindToIP(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	difficulty := 2
+	powService := pow.NewSHA256HashcashService(difficulty, 5*time.Minute)
+
+	config := Config{
+		ReadTimeout:     5 * time.Second,
+		WriteTimeout:    5 * time.Second,
+		MaxConnections:  10,
+		ShutdownTimeout: 1 * time.Second,
+		BindToIP:        true,
+	}
+
+	srv := NewServer(config, powService, quotes.NewInMemoryService(), logger)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.Serve(ctx, ln)
+
+	// proveFrom dials from localIP and answers with a proof bound to boundIP
+	proveFrom := func(localIP, boundIP string) (protocol.ChallengeMessage, json.RawMessage) {
+		dialer := net.Dialer{LocalAddr: &net.TCPAddr{IP: net.ParseIP(localIP)}}
+		conn, err := dialer.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Skipf("Cannot dial from %s: %v", localIP, err)
+		}
+		defer conn.Close()
+
+		var challengeMsg protocol.ChallengeMessage
+		if err := protocol.ReadMessage(conn, &challengeMsg, 5*time.Second); err != nil {
+			t.Fatalf("Failed to read challenge: %v", err)
+		}
+
+		nonce, err := powService.SolveChallenge(context.Background(), challengeMsg.Challenge+boundIP, difficulty)
+		if err != nil {
+			t.Fatalf("Failed to solve challenge: %v", err)
+		}
+
+		proofMsg := protocol.ProofMessage{
+			BaseMessage: protocol.NewBaseMessage(protocol.MsgTypeProof),
+			Challenge:   challengeMsg.Challenge,
+			Nonce:       nonce,
+		}
+		if err := protocol.WriteMessage(conn, proofMsg, 5*time.Second); err != nil {
+			t.Fatalf("Failed to send proof: %v", err)
+		}
+
+		var response json.RawMessage
+		if err := protocol.ReadMessage(conn, &response, 5*time.Second); err != nil {
+			t.Fatalf("Failed to read response: %v", err)
+		}
+		return challengeMsg, response
+	}
+
+	// A proof bound to the client's own IP is accepted
+	challengeMsg, response := proveFrom("127.0.0.1", "127.0.0.1")
+	if challengeMsg.Binding != "127.0.0.1" {
+		t.Errorf("Expected challenge bound to 127.0.0.1, got %q", challengeMsg.Binding)
+	}
+	var quoteMsg protocol.QuoteMessage
+	if err := json.Unmarshal(response, &quoteMsg); err != nil || quoteMsg.Type != protocol.MsgTypeQuote {
+		t.Fatalf("Expected quote for proof bound to own IP, got: %s", response)
+	}
+
+	// A proof bound to IP A is rejected when presented from IP B
+	challengeMsg, response = proveFrom("127.0.0.2", "127.0.0.1")
+	if challengeMsg.Binding != "127.0.0.2" {
+		t.Errorf("Expected challenge bound to 127.0.0.2, got %q", challengeMsg.Binding)
+	}
+	var errMsg protocol.ErrorMessage
+	if err := json.Unmarshal(response, &errMsg); err != nil || errMsg.Code != protocol.ErrCodeInvalidProof {
+		t.Errorf("Expected invalid_proof for proof bound to another IP, got: %s", response)
+	}
+}
+
+func TestServer_ChallengeWriteFailureReleasesChallenge(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	config := Config{
+		ReadTimeout:     5 * time.Second,
+		WriteTimeout:    5 * time.Second,
+		ShutdownTimeout: 1 * time.Second,
+	}
+
+	powService := pow.NewSHA256HashcashService(1, 5*time.Minute)
+	srv := NewServer(config, powService, quotes.NewInMemoryService(), logger)
+
+	// The client is gone before the challenge can be written
+	clientConn, serverConn := net.Pipe()
+	clientConn.Close()
+
+	srv.wg.Add(1)
+	atomic.AddInt32(&srv.activeConns, 1)
+	go srv.handleConnection(context.Background(), serverConn)
+	srv.wg.Wait()
+
+	stats, err := powService.Stats()
+	if err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+	if stats.ActiveChallenges != 0 {
+		t.Errorf("Expected the unsent challenge to be released, got %d active challenges", stats.ActiveChallenges)
+	}
+}
+
+func TestServer_NonceEncodings(t *testing.T) {
+	difficulty := 1
+	powService := pow.NewSHA256HashcashService(difficulty, 5*time.Minute)
+	addr := startTestServer(t, Config{
+		ReadTimeout:     5 * time.Second,
+		WriteTimeout:    5 * time.Second,
+		MaxConnections:  10,
+		ShutdownTimeout: 1 * time.Second,
+	}, powService)
+
+	// prove sends the nonce computed by solve for a fresh challenge and returns the response
+	prove := func(t *testing.T, encoding string, solve func(challenge string) string) map[string]interface{} {
+		t.Helper()
+
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		defer conn.Close()
+
+		var challengeMsg protocol.ChallengeMessage
+		if err := protocol.ReadMessage(conn, &challengeMsg, 5*time.Second); err != nil {
+			t.Fatalf("Failed to read challenge: %v", err)
+		}
+
+		proofMsg := protocol.ProofMessage{
+			BaseMessage:   protocol.NewBaseMessage(protocol.MsgTypeProof),
+			Challenge:     challengeMsg.Challenge,
+			Nonce:         solve(challengeMsg.Challenge),
+			NonceEncoding: encoding,
+		}
+		if err := protocol.WriteMessage(conn, proofMsg, 5*time.Second); err != nil {
+			t.Fatalf("Failed to send proof: %v", err)
+		}
+
+		var response map[string]interface{}
+		if err := protocol.ReadMessage(conn, &response, 5*time.Second); err != nil {
+			t.Fatalf("Failed to read response: %v", err)
+		}
+		return response
+	}
+
+	solveDecimal := func(challenge string) string {
+		nonce, err := powService.SolveChallenge(context.Background(), challenge, difficulty)
+		if err != nil {
+			t.Fatalf("Failed to solve challenge: %v", err)
+		}
+		return nonce
+	}
+
+	// solveRaw searches 8-byte big-endian counters, as a solver in another language might
+	solveRaw := func(challenge string) string {
+		raw := make([]byte, 8)
+		for i := uint64(0); ; i++ {
+			binary.BigEndian.PutUint64(raw, i)
+			if pow.Verify(challenge, string(raw), difficulty, pow.SHA256Hasher{}) {
+				return hex.EncodeToString(raw)
+			}
+		}
+	}
+
+	tests := []struct {
+		name     string
+		encoding string
+		solve    func(challenge string) string
+		wantType string
+		wantCode string
+	}{
+		{"Legacy", "", solveDecimal, "quote", ""},
+		{"Decimal", protocol.NonceEncodingDecimal, solveDecimal, "quote", ""},
+		{"HexRawBytes", protocol.NonceEncodingHex, solveRaw, "quote", ""},
+		{"HexOfDecimalDigits", protocol.NonceEncodingHex, func(challenge string) string {
+			return hex.EncodeToString([]byte(solveDecimal(challenge)))
+		}, "quote", ""},
+		{"BadHex", protocol.NonceEncodingHex, func(string) string { return "not hex" }, "error", string(protocol.ErrCodeBadRequest)},
+		{"UnknownEncoding", "base64", solveDecimal, "error", string(protocol.ErrCodeBadRequest)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := prove(t, tt.encoding, tt.solve)
+			if response["type"] != tt.wantType {
+				t.Fatalf("Expected %s response, got: %v", tt.wantType, response)
+			}
+			if tt.wantCode != "" && response["code"] != tt.wantCode {
+				t.Errorf("Expected %s error, got: %v", tt.wantCode, response)
+			}
+		})
+	}
+}
+
+func TestServer_StructuredQuote(t *testing.T) {
+	powService := pow.NewSHA256HashcashService(1, 5*time.Minute)
+	addr := startTestServer(t, Config{
+		ReadTimeout:     5 * time.Second,
+		WriteTimeout:    5 * time.Second,
+		MaxConnections:  10,
+		ShutdownTimeout: 1 * time.Second,
+	}, powService)
+
+	for _, structured := range []bool{false, true} {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		defer conn.Close()
+
+		var challengeMsg protocol.ChallengeMessage
+		if err := protocol.ReadMessage(conn, &challengeMsg, 5*time.Second); err != nil {
+			t.Fatalf("Failed to read challenge: %v", err)
+		}
+		nonce, err := powService.SolveChallenge(context.Background(), challengeMsg.Challenge, challengeMsg.Difficulty)
+		if err != nil {
+			t.Fatalf("Failed to solve challenge: %v", err)
+		}
+		proofMsg := protocol.ProofMessage{
+			BaseMessage: protocol.NewBaseMessage(protocol.MsgTypeProof),
+			Challenge:   challengeMsg.Challenge,
+			Nonce:       nonce,
+			Structured:  structured,
+		}
+		if err := protocol.WriteMessage(conn, proofMsg, 5*time.Second); err != nil {
+			t.Fatalf("Failed to send proof: %v", err)
+		}
+
+		var quoteMsg protocol.QuoteMessage
+		if err := protocol.ReadMessage(conn, &quoteMsg, 5*time.Second); err != nil || quoteMsg.Type != protocol.MsgTypeQuote {
+			t.Fatalf("Expected quote, got type %q: %v", quoteMsg.Type, err)
+		}
+		if !structured {
+			if quoteMsg.Text != "" || quoteMsg.Author != "" {
+				t.Errorf("Expected only the plain quote unless asked, got %+v", quoteMsg)
+			}
+			continue
+		}
+		// Every built-in quote has an author, and the plain quote is kept
+		if quoteMsg.Author == "" || quoteMsg.Text+" - "+quoteMsg.Author != quoteMsg.Quote {
+			t.Errorf("Expected %q split into text and author, got text %q author %q", quoteMsg.Quote, quoteMsg.Text, quoteMsg.Author)
+		}
+	}
+}
+
+func TestServer_ZeroDifficulty(t *testing.T) {
+	config := Config{
+		ReadTimeout:     5 * time.Second,
+		WriteTimeout:    5 * time.Second,
+		MaxConnections:  10,
+		ShutdownTimeout: 1 * time.Second,
+	}
+
+	t.Run("WarnsWhenDisabled", func(t *testing.T) {
+		for _, difficulty := range []int{0, 1} {
+			var logs bytes.Buffer
+			logger := slog.New(slog.NewTextHandler(&logs, nil))
+			powService := pow.NewSHA256HashcashService(difficulty, 5*time.Minute)
+			NewServer(config, powService, quotes.NewInMemoryService(), logger)
+
+			warned := strings.Contains(logs.String(), "Proof of work disabled")
+			if warned != (difficulty == 0) {
+				t.Errorf("Difficulty %d: expected warning %v, got logs: %q", difficulty, difficulty == 0, logs.String())
+			}
+		}
+	})
+
+	t.Run("PolicyZeroRaised", func(t *testing.T) {
+		policyConfig := config
+		policyConfig.DifficultyPolicy = func(net.Addr, int32) int { return -3 }
+		addr := startTestServer(t, policyConfig, pow.NewSHA256HashcashService(1, 5*time.Minute))
+
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		defer conn.Close()
+
+		// A policy can't turn proof of work off, nor break the connection trying
+		var challengeMsg protocol.ChallengeMessage
+		if err := protocol.ReadMessage(conn, &challengeMsg, 5*time.Second); err != nil {
+			t.Fatalf("Failed to read challenge: %v", err)
+		}
+		if challengeMsg.Type != protocol.MsgTypeChallenge || challengeMsg.Difficulty != 1 {
+			t.Errorf("Expected a challenge at difficulty 1, got type %q difficulty %d", challengeMsg.Type, challengeMsg.Difficulty)
+		}
+	})
+
+	t.Run("PolicyZeroClampedToFloor", func(t *testing.T) {
+		policyConfig := config
+		policyConfig.DifficultyPolicy = func(net.Addr, int32) int { return 0 }
+		policyConfig.MinDifficulty = 2
+		addr := startTestServer(t, policyConfig, pow.NewSHA256HashcashService(1, 5*time.Minute))
+
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		defer conn.Close()
+
+		// The floor catches the policy's 0 before it reaches the service
+		var challengeMsg protocol.ChallengeMessage
+		if err := protocol.ReadMessage(conn, &challengeMsg, 5*time.Second); err != nil {
+			t.Fatalf("Failed to read challenge: %v", err)
+		}
+		if challengeMsg.Type != protocol.MsgTypeChallenge || challengeMsg.Difficulty != 2 {
+			t.Errorf("Expected a challenge at the floor difficulty 2, got type %q difficulty %d", challengeMsg.Type, challengeMsg.Difficulty)
+		}
+	})
+
+	t.Run("AllowedExplicitly", func(t *testing.T) {
+		powService := pow.NewSHA256HashcashService(0, 5*time.Minute)
+		powService.SetAllowZeroDifficulty(true)
+		addr := startTestServer(t, config, powService)
+
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		defer conn.Close()
+
+		var challengeMsg protocol.ChallengeMessage
+		if err := protocol.ReadMessage(conn, &challengeMsg, 5*time.Second); err != nil {
+			t.Fatalf("Failed to read challenge: %v", err)
+		}
+		if challengeMsg.Difficulty != 0 {
+			t.Fatalf("Expected difficulty 0, got %d", challengeMsg.Difficulty)
+		}
+
+		proofMsg := protocol.ProofMessage{
+			BaseMessage: protocol.NewBaseMessage(protocol.MsgTypeProof),
+			Challenge:   challengeMsg.Challenge,
+			Nonce:       "0",
+		}
+		if err := protocol.WriteMessage(conn, proofMsg, 5*time.Second); err != nil {
+			t.Fatalf("Failed to send proof: %v", err)
+		}
+		var quoteMsg protocol.QuoteMessage
+		if err := protocol.ReadMessage(conn, &quoteMsg, 5*time.Second); err != nil || quoteMsg.Type != protocol.MsgTypeQuote {
+			t.Errorf("Expected a quote for any nonce, got type %q: %v", quoteMsg.Type, err)
+		}
+	})
+}
+
+func TestServer_DifficultyPolicy(t *testing.T) {
+	powService := pow.NewSHA256HashcashService(1, 5*time.Minute)
+
+	// Charge 127.0.0.2 more, and everyone more once several clients are connected
+	policy := func(remoteAddr net.Addr, activeConns int32) int {
+		if remoteAddr.(*net.TCPAddr).IP.Equal(net.ParseIP("127.0.0.2")) {
+			return 2
+		}
+		if activeConns > 1 {
+			return 3
+		}
+		return 1
+	}
+
+	addr := startTestServer(t, Config{
+		ReadTimeout:      5 * time.Second,
+		WriteTimeout:     5 * time.Second,
+		MaxConnections:   10,
+		ShutdownTimeout:  1 * time.Second,
+		DifficultyPolicy: policy,
+	}, powService)
+
+	first, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer first.Close()
+
+	var challengeMsg protocol.ChallengeMessage
+	if err := protocol.ReadMessage(first, &challengeMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to read challenge: %v", err)
+	}
+	if challengeMsg.Difficulty != 1 {
+		t.Errorf("Expected difficulty 1 for the only client, got %d", challengeMsg.Difficulty)
+	}
+
+	// While the first client holds its challenge, a second one gets a harder one
+	second, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer second.Close()
+
+	var hardMsg protocol.ChallengeMessage
+	if err := protocol.ReadMessage(second, &hardMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to read challenge: %v", err)
+	}
+	if hardMsg.Difficulty != 3 {
+		t.Fatalf("Expected difficulty 3 while busy, got %d", hardMsg.Difficulty)
+	}
+
+	// A nonce meeting only the service's difficulty is not enough for this challenge
+	var weak string
+	for i := 0; ; i++ {
+		nonce := strconv.Itoa(i)
+		if pow.Verify(hardMsg.Challenge, nonce, 1, pow.SHA256Hasher{}) && !pow.Verify(hardMsg.Challenge, nonce, 3, pow.SHA256Hasher{}) {
+			weak = nonce
+			break
+		}
+	}
+	proofMsg := protocol.ProofMessage{
+		BaseMessage: protocol.NewBaseMessage(protocol.MsgTypeProof),
+		Challenge:   hardMsg.Challenge,
+		Nonce:       weak,
+	}
+	if err := protocol.WriteMessage(second, proofMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to send proof: %v", err)
+	}
+	var errMsg protocol.ErrorMessage
+	if err := protocol.ReadMessage(second, &errMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	if errMsg.Code != protocol.ErrCodeInvalidProof {
+		t.Errorf("Expected invalid_proof for a proof below the policy's difficulty, got type %q code %q", errMsg.Type, errMsg.Code)
+	}
+
+	// The first client's easier challenge is still honoured
+	nonce, err := powService.SolveChallenge(context.Background(), challengeMsg.Challenge, 1)
+	if err != nil {
+		t.Fatalf("Failed to solve challenge: %v", err)
+	}
+	proofMsg.Challenge, proofMsg.Nonce = challengeMsg.Challenge, nonce
+	if err := protocol.WriteMessage(first, proofMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to send proof: %v", err)
+	}
+	var quoteMsg protocol.QuoteMessage
+	if err := protocol.ReadMessage(first, &quoteMsg, 5*time.Second); err != nil || quoteMsg.Type != protocol.MsgTypeQuote {
+		t.Fatalf("Expected quote for the first client, got type %q: %v", quoteMsg.Type, err)
+	}
+
+	// The policy picks by address too
+	dialer := net.Dialer{LocalAddr: &net.TCPAddr{IP: net.ParseIP("127.0.0.2")}}
+	other, err := dialer.Dial("tcp", addr)
+	if err != nil {
+		t.Skipf("Cannot dial from 127.0.0.2: %v", err)
+	}
+	defer other.Close()
+
+	var otherMsg protocol.ChallengeMessage
+	if err := protocol.ReadMessage(other, &otherMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to read challenge: %v", err)
+	}
+	if otherMsg.Difficulty != 2 {
+		t.Errorf("Expected difficulty 2 for 127.0.0.2, got %d", otherMsg.Difficulty)
+	}
+	if got := powService.GetDifficulty(); got != 1 {
+		t.Errorf("Expected service difficulty to stay 1, got %d", got)
+	}
+}
+
+func TestServer_TrustedToken(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	const trusted = "0123456789abcdef"
+	const difficulty = 2
+
+	powService := pow.NewSHA256HashcashService(difficulty, 5*time.Minute)
+	hook := &recordingAuditHook{}
+	srv := NewServer(Config{
+		ReadTimeout:     5 * time.Second,
+		WriteTimeout:    5 * time.Second,
+		MaxConnections:  10,
+		ShutdownTimeout: 1 * time.Second,
+		TrustedTokens:   []string{"fedcba9876543210", trusted},
+		AuditHook:       hook,
+	}, powService, quotes.NewInMemoryService(), logger)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	serverDone := make(chan error, 1)
+	go func() {
+		serverDone <- srv.Serve(ctx, ln)
+	}()
+
+	// authenticate presents token in answer to a fresh challenge, returning the
+	// connection, the challenge first issued and the one sent back
+	authenticate := func(t *testing.T, token string) (net.Conn, protocol.ChallengeMessage, protocol.ChallengeMessage) {
+		t.Helper()
+
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+
+		var issued protocol.ChallengeMessage
+		if err := protocol.ReadMessage(conn, &issued, 5*time.Second); err != nil {
+			t.Fatalf("Failed to read challenge: %v", err)
+		}
+		authMsg := protocol.AuthMessage{
+			BaseMessage: protocol.NewBaseMessage(protocol.MsgTypeAuth),
+			Token:       token,
+		}
+		if err := protocol.WriteMessage(conn, authMsg, 5*time.Second); err != nil {
+			t.Fatalf("Failed to send auth: %v", err)
+		}
+		var resent protocol.ChallengeMessage
+		if err := protocol.ReadMessage(conn, &resent, 5*time.Second); err != nil {
+			t.Fatalf("Failed to read challenge after auth: %v", err)
+		}
+		if resent.Type != protocol.MsgTypeChallenge || resent.Challenge != issued.Challenge {
+			t.Fatalf("Expected challenge %q again, got %+v", issued.Challenge, resent)
+		}
+		return conn, issued, resent
+	}
+
+	// prove answers challengeMsg on conn with nonce and returns the server's response
+	prove := func(t *testing.T, conn net.Conn, challengeMsg protocol.ChallengeMessage, nonce string) json.RawMessage {
+		t.Helper()
+
+		proofMsg := protocol.ProofMessage{
+			BaseMessage: protocol.NewBaseMessage(protocol.MsgTypeProof),
+			Challenge:   challengeMsg.Challenge,
+			Nonce:       nonce,
+		}
+		if err := protocol.WriteMessage(conn, proofMsg, 5*time.Second); err != nil {
+			t.Fatalf("Failed to send proof: %v", err)
+		}
+		var response json.RawMessage
+		if err := protocol.ReadMessage(conn, &response, 5*time.Second); err != nil {
+			t.Fatalf("Failed to read response: %v", err)
+		}
+		return response
+	}
+
+	var trustedAddr, trustedChallenge string
+	t.Run("ValidTokenWaivesProof", func(t *testing.T) {
+		conn, _, resent := authenticate(t, trusted)
+		if resent.Difficulty != 0 {
+			t.Errorf("Expected the challenge again at difficulty 0, got %d", resent.Difficulty)
+		}
+
+		response := prove(t, conn, resent, "0")
+		var quoteMsg protocol.QuoteMessage
+		if err := json.Unmarshal(response, &quoteMsg); err != nil || quoteMsg.Type != protocol.MsgTypeQuote {
+			t.Fatalf("Expected quote for a trusted token, got: %s", response)
+		}
+		if stats, _ := powService.Stats(); stats.ActiveChallenges != 0 {
+			t.Errorf("Expected the waived challenge to be released, got %d active", stats.ActiveChallenges)
+		}
+		trustedAddr, trustedChallenge = conn.LocalAddr().String(), resent.Challenge
+	})
+
+	t.Run("InvalidTokenFallsBackToProof", func(t *testing.T) {
+		for _, token := range []string{"", "0123456789abcdeX", trusted + "0", trusted[:8]} {
+			conn, issued, resent := authenticate(t, token)
+			if resent.Difficulty != issued.Difficulty {
+				t.Errorf("Expected token %q to get the challenge unchanged, got difficulty %d", token, resent.Difficulty)
+			}
+
+			nonce, err := powService.SolveChallenge(context.Background(), resent.Challenge, resent.Difficulty)
+			if err != nil {
+				t.Fatalf("Failed to solve challenge: %v", err)
+			}
+			response := prove(t, conn, resent, nonce)
+			var quoteMsg protocol.QuoteMessage
+			if err := json.Unmarshal(response, &quoteMsg); err != nil || quoteMsg.Type != protocol.MsgTypeQuote {
+				t.Errorf("Expected quote for token %q with a valid proof, got: %s", token, response)
+			}
+		}
+	})
+
+	t.Run("InvalidTokenNeedsProof", func(t *testing.T) {
+		conn, _, resent := authenticate(t, "not-a-trusted-token")
+		badNonce := "invalid"
+		for solvesChallenge(resent.Challenge, badNonce, difficulty) {
+			badNonce += "!"
+		}
+
+		response := prove(t, conn, resent, badNonce)
+		var errMsg protocol.ErrorMessage
+		if err := json.Unmarshal(response, &errMsg); err != nil || errMsg.Code != protocol.ErrCodeInvalidProof {
+			t.Errorf("Expected invalid_proof for an untrusted token without a proof, got: %s", response)
+		}
+	})
+
+	// Five untrusted tokens from this address so far; from here on every token gets
+	// the challenge unchanged, so guesses tell nothing, yet proof of work still works
+	t.Run("GuessingThrottled", func(t *testing.T) {
+		conn, issued, resent := authenticate(t, trusted)
+		if resent.Difficulty != issued.Difficulty {
+			t.Fatalf("Expected the challenge unchanged once throttled, got difficulty %d", resent.Difficulty)
+		}
+
+		nonce, err := powService.SolveChallenge(context.Background(), resent.Challenge, resent.Difficulty)
+		if err != nil {
+			t.Fatalf("Failed to solve challenge: %v", err)
+		}
+		response := prove(t, conn, resent, nonce)
+		var quoteMsg protocol.QuoteMessage
+		if err := json.Unmarshal(response, &quoteMsg); err != nil || quoteMsg.Type != protocol.MsgTypeQuote {
+			t.Errorf("Expected quote for a valid proof while throttled, got: %s", response)
+		}
+	})
+
+	t.Run("SecondAuthRejected", func(t *testing.T) {
+		conn, _, _ := authenticate(t, trusted)
+		authMsg := protocol.AuthMessage{
+			BaseMessage: protocol.NewBaseMessage(protocol.MsgTypeAuth),
+			Token:       trusted,
+		}
+		if err := protocol.WriteMessage(conn, authMsg, 5*time.Second); err != nil {
+			t.Fatalf("Failed to send auth: %v", err)
+		}
+		var errMsg protocol.ErrorMessage
+		if err := protocol.ReadMessage(conn, &errMsg, 5*time.Second); err != nil {
+			t.Fatalf("Failed to read response: %v", err)
+		}
+		if errMsg.Code != protocol.ErrCodeUnexpectedMessage {
+			t.Errorf("Expected unexpected_message for a second auth, got: %+v", errMsg)
+		}
+	})
+
+	// Shutting down flushes queued events to the hook
+	cancel()
+	select {
+	case <-serverDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server did not shut down")
+	}
+
+	// Waived proofs are audited apart from verified ones
+	var found bool
+	for _, event := range hook.snapshot() {
+		if event.event != "result" || event.addr != trustedAddr {
+			continue
+		}
+		found = true
+		if !event.ok || event.reason != AuditReasonTrusted || event.challenge != trustedChallenge {
+			t.Errorf("Expected trusted result for %q, got %+v", trustedChallenge, event)
+		}
+	}
+	if !found {
+		t.Errorf("Expected a proof result for the trusted handshake from %s", trustedAddr)
+	}
+}
+
+func TestServer_IsTrustedToken(t *testing.T) {
+	srv := &Server{config: Config{TrustedTokens: []string{"0123456789abcdef", "fedcba9876543210"}}}
+
+	tests := []struct {
+		token string
+		want  bool
+	}{
+		{"0123456789abcdef", true},
+		{"fedcba9876543210", true},
+		{"", false},
+		{"0123456789abcde", false},
+		{"0123456789abcdef0", false},
+		{"0123456789ABCDEF", false},
+	}
+	for _, tt := range tests {
+		if got := srv.isTrustedToken(tt.token); got != tt.want {
+			t.Errorf("isTrustedToken(%q) = %t, want %t", tt.token, got, tt.want)
+		}
+	}
+
+	// With no tokens configured nothing is trusted, not even an empty token
+	if (&Server{}).isTrustedToken("") {
+		t.Error("Expected an empty token to be untrusted")
+	}
+}
+
+func TestServer_MaxMessageSize(t *testing.T) {
+	const limit = 4096
+
+	powService := pow.NewSHA256HashcashService(1, 5*time.Minute)
+	addr := startTestServer(t, Config{
+		ReadTimeout:     5 * time.Second,
+		WriteTimeout:    5 * time.Second,
+		MaxConnections:  10,
+		ShutdownTimeout: 1 * time.Second,
+		MaxMessageSize:  limit,
+	}, powService)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	var challengeMsg protocol.ChallengeMessage
+	if err := protocol.ReadMessage(conn, &challengeMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to read challenge: %v", err)
+	}
+
+	// A proof within the protocol default but over the server's limit is rejected
+	proofMsg := protocol.ProofMessage{
+		BaseMessage: protocol.NewBaseMessage(protocol.MsgTypeProof),
+		Challenge:   challengeMsg.Challenge,
+		Nonce:       "0",
+		Category:    strings.Repeat("x", limit),
+	}
+	if err := protocol.WriteMessage(conn, proofMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to send proof: %v", err)
+	}
+
+	var errMsg protocol.ErrorMessage
+	if err := protocol.ReadMessage(conn, &errMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	if errMsg.Code != protocol.ErrCodeBadRequest || !strings.Contains(errMsg.Message, protocol.ErrMessageTooLarge.Error()) {
+		t.Errorf("Expected bad_request naming the size violation, got code %q: %s", errMsg.Code, errMsg.Message)
+	}
+}
+
+// fakeTCPConn records the socket options set on it
+type fakeTCPConn struct {
+	net.Conn
+	noDelay   bool
+	keepAlive bool
+	period    time.Duration
+	err       error // Returned by SetKeepAlive
+}
+
+func (c *fakeTCPConn) SetNoDelay(noDelay bool) error {
+	c.noDelay = noDelay
+	return nil
+}
+
+func (c *fakeTCPConn) SetKeepAlive(keepAlive bool) error {
+	c.keepAlive = keepAlive
+	return c.err
+}
+
+func (c *fakeTCPConn) SetKeepAlivePeriod(d time.Duration) error {
+	c.period = d
+	return nil
+}
+
+func TestConfigureTCP(t *testing.T) {
+	tests := []struct {
+		name          string
+		keepAlive     time.Duration
+		wantKeepAlive bool
+		wantPeriod    time.Duration
+	}{
+		{"Period", 30 * time.Second, true, 30 * time.Second},
+		{"OSDefault", 0, true, 0},
+		{"Disabled", -1, false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := &fakeTCPConn{}
+			if err := configureTCP(conn, tt.keepAlive); err != nil {
+				t.Fatalf("configureTCP failed: %v", err)
+			}
+			if !conn.noDelay || conn.keepAlive != tt.wantKeepAlive || conn.period != tt.wantPeriod {
+				t.Errorf("Expected no-delay, keep-alive %t every %v, got %+v", tt.wantKeepAlive, tt.wantPeriod, conn)
+			}
+		})
+	}
+
+	conn := &fakeTCPConn{err: errors.New("setsockopt failed")}
+	if err := configureTCP(conn, time.Minute); err == nil || !strings.Contains(err.Error(), "keep-alive") {
+		t.Errorf("Expected keep-alive error, got: %v", err)
+	}
+}
+
+func TestServer_SetSocketOptions(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+	srv := NewServer(Config{TCPKeepAlive: time.Minute}, pow.NewSHA256HashcashService(1, time.Minute), quotes.NewInMemoryService(), logger)
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	plain := &fakeTCPConn{Conn: server}
+	srv.setSocketOptions(plain)
+	if !plain.noDelay || !plain.keepAlive || plain.period != time.Minute {
+		t.Errorf("Expected options on a TCP connection, got %+v", plain)
+	}
+
+	// TLS connections are tuned through the TCP connection beneath them
+	wrapped := &fakeTCPConn{Conn: server}
+	srv.setSocketOptions(tls.Server(wrapped, &tls.Config{}))
+	if !wrapped.noDelay || !wrapped.keepAlive || wrapped.period != time.Minute {
+		t.Errorf("Expected options beneath a TLS connection, got %+v", wrapped)
+	}
+
+	// Connections without TCP options, such as Unix sockets, are left alone
+	srv.setSocketOptions(server)
+
+	// A failure is logged and the connection is still served
+	srv.setSocketOptions(&fakeTCPConn{Conn: server, err: errors.New("setsockopt failed")})
+}
+
+func TestServer_SetSocketOptionsOnTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	dialed, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer dialed.Close()
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("Failed to accept: %v", err)
+	}
+	defer conn.Close()
+
+	sock, ok := conn.(tcpSocket)
+	if !ok {
+		t.Fatalf("Expected *net.TCPConn to provide TCP options, got %T", conn)
+	}
+	for _, keepAlive := range []time.Duration{-1, 0, 30 * time.Second} {
+		if err := configureTCP(sock, keepAlive); err != nil {
+			t.Errorf("configureTCP(%v) failed on a real TCP connection: %v", keepAlive, err)
+		}
+	}
+}
+
+func TestServer_Target(t *testing.T) {
+	powService := pow.NewSHA256HashcashService(4, 5*time.Minute) // Ignored in favour of the target
+	target, err := pow.ParseTarget("0003" + strings.Repeat("f", 60))
+	if err != nil {
+		t.Fatalf("ParseTarget failed: %v", err)
+	}
+	powService.SetTarget(target)
+	addr := startTestServer(t, Config{
+		ReadTimeout:     5 * time.Second,
+		WriteTimeout:    5 * time.Second,
+		MaxConnections:  10,
+		ShutdownTimeout: 1 * time.Second,
+	}, powService)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	var challengeMsg protocol.ChallengeMessage
+	if err := protocol.ReadMessage(conn, &challengeMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to read challenge: %v", err)
+	}
+	if challengeMsg.Target != pow.FormatTarget(target) {
+		t.Fatalf("Expected target %s in the challenge, got %q", pow.FormatTarget(target), challengeMsg.Target)
+	}
+	if challengeMsg.ExpectedIterations != 1<<14 {
+		t.Errorf("Expected 2^14 expected iterations for the target, got %d", challengeMsg.ExpectedIterations)
+	}
+
+	nonce, _, err := powService.SolveTargetWithStats(context.Background(), challengeMsg.Challenge, target)
+	if err != nil {
+		t.Fatalf("Failed to solve challenge: %v", err)
+	}
+	proofMsg := protocol.ProofMessage{
+		BaseMessage: protocol.NewBaseMessage(protocol.MsgTypeProof),
+		Challenge:   challengeMsg.Challenge,
+		Nonce:       nonce,
+	}
+	if err := protocol.WriteMessage(conn, proofMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to send proof: %v", err)
+	}
+
+	var quoteMsg protocol.QuoteMessage
+	if err := protocol.ReadMessage(conn, &quoteMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to read quote: %v", err)
+	}
+	if quoteMsg.Type != protocol.MsgTypeQuote || quoteMsg.Quote == "" {
+		t.Errorf("Expected a quote for a proof meeting the target, got: %+v", quoteMsg)
+	}
+}
+
+func TestServer_UnexpectedMessageInsteadOfProof(t *testing.T) {
+	powService := pow.NewSHA256HashcashService(1, 5*time.Minute)
+	addr := startTestServer(t, Config{
+		ReadTimeout:     5 * time.Second,
+		WriteTimeout:    5 * time.Second,
+		MaxConnections:  10,
+		ShutdownTimeout: 1 * time.Second,
+	}, powService)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	var challengeMsg protocol.ChallengeMessage
+	if err := protocol.ReadMessage(conn, &challengeMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to read challenge: %v", err)
+	}
+
+	// A quote where a proof is expected used to decode into an empty proof
+	quoteMsg := protocol.QuoteMessage{
+		BaseMessage: protocol.NewBaseMessage(protocol.MsgTypeQuote),
+		Quote:       "Not a proof",
+	}
+	if err := protocol.WriteMessage(conn, quoteMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to send quote: %v", err)
+	}
+
+	var errMsg protocol.ErrorMessage
+	if err := protocol.ReadMessage(conn, &errMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	if errMsg.Type != protocol.MsgTypeError || errMsg.Code != protocol.ErrCodeUnexpectedMessage {
+		t.Errorf("Expected an unexpected_message error, got: %+v", errMsg)
+	}
+	if stats, err := powService.Stats(); err != nil || stats.ActiveChallenges != 0 {
+		t.Errorf("Expected the challenge to be invalidated, got stats=%+v err=%v", stats, err)
+	}
+}
+
+func TestServer_ExpectedIterations(t *testing.T) {
+	powService := pow.NewSHA256HashcashService(1, 5*time.Minute)
+	addr := startTestServer(t, Config{
+		ReadTimeout:     5 * time.Second,
+		WriteTimeout:    5 * time.Second,
+		MaxConnections:  10,
+		ShutdownTimeout: 1 * time.Second,
+	}, powService)
+
+	// Each difficulty step, a zero byte, makes solving 256 times more work
+	for _, tt := range []struct {
+		difficulty int
+		want       uint64
+	}{
+		{1, 256},
+		{2, 65536},
+		{3, 1 << 24},
+	} {
+		powService.SetDifficulty(tt.difficulty)
+
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		var challengeMsg protocol.ChallengeMessage
+		err = protocol.ReadMessage(conn, &challengeMsg, 5*time.Second)
+		conn.Close()
+		if err != nil {
+			t.Fatalf("Failed to read challenge: %v", err)
+		}
+		if challengeMsg.ExpectedIterations != tt.want {
+			t.Errorf("Expected %d expected iterations at difficulty %d, got %d", tt.want, tt.difficulty, challengeMsg.ExpectedIterations)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"pow/pkg/protocol"
+)
+
+// errSubscriberLeft ends a subscription whose client hung up or sent anything but a heartbeat
+var errSubscriberLeft = errors.New("subscriber left")
+
+// serveSubscription pushes a quote right away and then one per interval until the
+// client disconnects or sends anything but a heartbeat, SubscriptionMaxDuration passes
+// or the server shuts down. Canceling ctx aborts it like any other connection I/O.
+func (s *Server) serveSubscription(ctx context.Context, cs *connState, proofMsg protocol.ProofMessage) {
+	interval := s.subscriptionInterval(proofMsg.IntervalSeconds)
+	intervalSeconds := int((interval + time.Second - 1) / time.Second) // Rounded up for the client's benefit
+
+	subCtx, cancel := context.WithTimeout(ctx, s.config.SubscriptionMaxDuration)
+	defer cancel()
+	subCtx, leave := context.WithCancelCause(subCtx)
+
+	// Subscribers only listen, so anything else from the client, or EOF, ends the
+	// subscription. Heartbeats to answer are handed to the loop below, the only writer.
+	pings := make(chan struct{}, 1)
+	readerDone := make(chan struct{})
+	go func() {
+		defer close(readerDone)
+		for {
+			var msg protocol.HeartbeatMessage
+			if err := s.codec.ReadMessageCtx(subCtx, cs.conn, &msg); err != nil {
+				// The read deadline is the subscription's own, whose timer may fire a
+				// little later; a deadline is not the client leaving
+				if !errors.Is(err, os.ErrDeadlineExceeded) && !errors.Is(err, context.DeadlineExceeded) {
+					leave(errSubscriberLeft)
+				}
+				return
+			}
+			if msg.Type != protocol.MsgTypeHeartbeat || s.config.HeartbeatInterval <= 0 {
+				leave(errSubscriberLeft)
+				return
+			}
+			if !msg.Reply {
+				select {
+				case pings <- struct{}{}:
+				default: // An answer is already pending
+				}
+			}
+		}
+	}()
+	defer func() {
+		cancel()
+		<-readerDone
+	}()
+
+	cs.logger.Info("Quote subscription started", "interval", interval, "max_duration", s.config.SubscriptionMaxDuration)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// Ping the client whenever nothing went out for a heartbeat interval
+	var heartbeat *time.Ticker
+	var heartbeats <-chan time.Time
+	if s.config.HeartbeatInterval > 0 {
+		heartbeat = time.NewTicker(s.config.HeartbeatInterval)
+		defer heartbeat.Stop()
+		heartbeats = heartbeat.C
+	}
+
+	sent := 0
+	pushQuote := func() error {
+		quoteMsg := protocol.QuoteMessage{
+			BaseMessage:     s.codec.NewBaseMessage(protocol.MsgTypeQuote),
+			Quote:           s.quotesService.GetRandomQuoteByCategory(proofMsg.Category),
+			IntervalSeconds: intervalSeconds,
+		}
+		if proofMsg.Structured {
+			structureQuote(&quoteMsg)
+		}
+		if err := cs.framer.WriteCtx(subCtx, quoteMsg); err != nil {
+			return err
+		}
+		sent++
+		if heartbeat != nil {
+			heartbeat.Reset(s.config.HeartbeatInterval)
+		}
+		return nil
+	}
+
+	err := pushQuote()
+	for {
+		// A write aborted because the subscription ended is explained below
+		if err != nil && subCtx.Err() == nil {
+			cs.logger.Error("Failed to write to subscriber", "error", err, "sent", sent)
+			return
+		}
+
+		select {
+		case <-ticker.C:
+			err = pushQuote()
+		case <-heartbeats:
+			err = cs.framer.WriteCtx(subCtx, s.newHeartbeat(false))
+		case <-pings:
+			err = cs.framer.WriteCtx(subCtx, s.newHeartbeat(true))
+		case <-s.shutdownCh:
+			cs.logger.Info("Quote subscription ended by shutdown", "sent", sent)
+			s.sendError(ctx, cs, protocol.ErrCodeShuttingDown, "server shutting down")
+			return
+		case <-subCtx.Done():
+			s.endSubscription(ctx, cs, context.Cause(subCtx), sent)
+			return
+		}
+	}
+}
+
+// endSubscription logs why a subscription ended and, if it ran out of time,
+// tells the client with a close message
+func (s *Server) endSubscription(ctx context.Context, cs *connState, reason error, sent int) {
+	if ctx.Err() != nil {
+		cs.logger.Warn("Quote subscription aborted by forced shutdown", "sent", sent)
+		return
+	}
+	if !errors.Is(reason, context.DeadlineExceeded) {
+		cs.logger.Info("Quote subscription ended by client", "sent", sent)
+		return
+	}
+
+	cs.logger.Info("Quote subscription reached its maximum duration", "sent", sent)
+	closeMsg := protocol.CloseMessage{BaseMessage: s.codec.NewBaseMessage(protocol.MsgTypeClose)}
+	if err := cs.framer.WriteCtx(ctx, closeMsg); err != nil {
+		cs.logger.Debug("Failed to send close message", "error", err)
+	}
+}
+
+// subscriptionInterval returns the push interval for a requested number of seconds,
+// raised to SubscriptionMinInterval
+func (s *Server) subscriptionInterval(seconds int) time.Duration {
+	interval := time.Duration(seconds) * time.Second
+	if interval < s.config.SubscriptionMinInterval {
+		interval = s.config.SubscriptionMinInterval
+	}
+	if interval <= 0 {
+		interval = time.Second
+	}
+	return interval
+}
@@ -0,0 +1,208 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"pow/internal/pow"
+	"pow/internal/quotes"
+	"pow/pkg/protocol"
+)
+
+func TestServer_Subscription(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	difficulty := 1
+	powService := pow.NewSHA256HashcashService(difficulty, 5*time.Minute)
+
+	config := Config{
+		ReadTimeout:             5 * time.Second,
+		WriteTimeout:            5 * time.Second,
+		MaxConnections:          10,
+		ShutdownTimeout:         1 * time.Second,
+		ConnectionDeadline:      time.Second, // Bounds the handshake, not the subscription
+		SubscriptionMinInterval: time.Second,
+		SubscriptionMaxDuration: 2500 * time.Millisecond,
+	}
+
+	srv := NewServer(config, powService, quotes.NewInMemoryService(), logger)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.Serve(ctx, ln)
+
+	// subscribe solves the challenge on a new connection and asks for a quote every intervalSeconds
+	subscribe := func(t *testing.T, intervalSeconds int) net.Conn {
+		t.Helper()
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+
+		var challengeMsg protocol.ChallengeMessage
+		if err := protocol.ReadMessage(conn, &challengeMsg, 5*time.Second); err != nil {
+			t.Fatalf("Failed to read challenge: %v", err)
+		}
+		nonce, err := powService.SolveChallenge(context.Background(), challengeMsg.Challenge, difficulty)
+		if err != nil {
+			t.Fatalf("Failed to solve challenge: %v", err)
+		}
+
+		proofMsg := protocol.ProofMessage{
+			BaseMessage:     protocol.NewBaseMessage(protocol.MsgTypeProof),
+			Challenge:       challengeMsg.Challenge,
+			Nonce:           nonce,
+			Subscribe:       true,
+			IntervalSeconds: intervalSeconds,
+		}
+		if err := protocol.WriteMessage(conn, proofMsg, 5*time.Second); err != nil {
+			t.Fatalf("Failed to send proof: %v", err)
+		}
+		return conn
+	}
+
+	t.Run("QuotesPushedAtInterval", func(t *testing.T) {
+		conn := subscribe(t, 1)
+
+		var received []time.Time
+		for len(received) < 3 {
+			var quoteMsg protocol.QuoteMessage
+			if err := protocol.ReadMessage(conn, &quoteMsg, 5*time.Second); err != nil {
+				t.Fatalf("Failed to read quote %d: %v", len(received)+1, err)
+			}
+			if quoteMsg.Type != protocol.MsgTypeQuote || quoteMsg.Quote == "" {
+				t.Fatalf("Expected a quote, got %+v", quoteMsg)
+			}
+			if quoteMsg.IntervalSeconds != 1 {
+				t.Errorf("Expected interval_seconds 1, got %d", quoteMsg.IntervalSeconds)
+			}
+			received = append(received, time.Now())
+		}
+
+		for i := 1; i < len(received); i++ {
+			if gap := received[i].Sub(received[i-1]); gap < 800*time.Millisecond || gap > 2*time.Second {
+				t.Errorf("Expected quote %d about 1s after the previous one, got %v", i+1, gap)
+			}
+		}
+
+		// The subscription ends with a close message once its maximum duration is up
+		var closeMsg protocol.CloseMessage
+		if err := protocol.ReadMessage(conn, &closeMsg, 5*time.Second); err != nil {
+			t.Fatalf("Failed to read close message: %v", err)
+		}
+		if closeMsg.Type != protocol.MsgTypeClose {
+			t.Errorf("Expected close message after max duration, got type: %s", closeMsg.Type)
+		}
+	})
+
+	t.Run("IntervalFloor", func(t *testing.T) {
+		conn := subscribe(t, 0)
+
+		var quoteMsg protocol.QuoteMessage
+		if err := protocol.ReadMessage(conn, &quoteMsg, 5*time.Second); err != nil {
+			t.Fatalf("Failed to read quote: %v", err)
+		}
+		if quoteMsg.IntervalSeconds != 1 {
+			t.Errorf("Expected interval raised to the 1s floor, got %d", quoteMsg.IntervalSeconds)
+		}
+	})
+
+	t.Run("ClientDisconnectEndsSubscription", func(t *testing.T) {
+		conn := subscribe(t, 1)
+
+		var quoteMsg protocol.QuoteMessage
+		if err := protocol.ReadMessage(conn, &quoteMsg, 5*time.Second); err != nil {
+			t.Fatalf("Failed to read quote: %v", err)
+		}
+		conn.Close()
+
+		deadline := time.Now().Add(2 * time.Second)
+		for srv.GetActiveConnections() > 0 {
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected subscription to end on disconnect, %d connections still active", srv.GetActiveConnections())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+}
+
+func TestServer_SubscriptionDisabled(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	difficulty := 1
+	powService := pow.NewSHA256HashcashService(difficulty, 5*time.Minute)
+
+	config := Config{
+		ReadTimeout:     5 * time.Second,
+		WriteTimeout:    5 * time.Second,
+		MaxConnections:  10,
+		ShutdownTimeout: 1 * time.Second,
+	}
+
+	srv := NewServer(config, powService, quotes.NewInMemoryService(), logger)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.Serve(ctx, ln)
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	var challengeMsg protocol.ChallengeMessage
+	if err := protocol.ReadMessage(conn, &challengeMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to read challenge: %v", err)
+	}
+	nonce, err := powService.SolveChallenge(context.Background(), challengeMsg.Challenge, difficulty)
+	if err != nil {
+		t.Fatalf("Failed to solve challenge: %v", err)
+	}
+	proofMsg := protocol.ProofMessage{
+		BaseMessage:     protocol.NewBaseMessage(protocol.MsgTypeProof),
+		Challenge:       challengeMsg.Challenge,
+		Nonce:           nonce,
+		Subscribe:       true,
+		IntervalSeconds: 1,
+	}
+	if err := protocol.WriteMessage(conn, proofMsg, 5*time.Second); err != nil {
+		t.Fatalf("Failed to send proof: %v", err)
+	}
+
+	// Without SubscriptionMaxDuration the request is answered with a single quote
+	var response json.RawMessage
+	if err := protocol.ReadMessage(conn, &response, 5*time.Second); err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	var quoteMsg protocol.QuoteMessage
+	if err := json.Unmarshal(response, &quoteMsg); err != nil || quoteMsg.Type != protocol.MsgTypeQuote {
+		t.Fatalf("Expected a single quote, got: %s", response)
+	}
+	if quoteMsg.IntervalSeconds != 0 {
+		t.Errorf("Expected no interval when subscriptions are disabled, got %d", quoteMsg.IntervalSeconds)
+	}
+	if err := protocol.ReadMessage(conn, &response, 5*time.Second); err == nil {
+		t.Errorf("Expected the connection to close after the quote, got: %s", response)
+	}
+}
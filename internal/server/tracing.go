@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	"pow/pkg/protocol"
+)
+
+// connectionSpanName names the span covering one client connection
+const connectionSpanName = "pow.connection"
+
+// Attributes set on connection spans
+const (
+	attrConnID           = attribute.Key("pow.conn_id")
+	attrRemoteAddr       = attribute.Key("pow.remote_addr")
+	attrRequests         = attribute.Key("pow.requests")          // Handshakes started on the connection
+	attrDifficulty       = attribute.Key("pow.difficulty")        // Of the latest challenge
+	attrAlgorithm        = attribute.Key("pow.algorithm")         // Of the latest challenge
+	attrReportedAttempts = attribute.Key("pow.reported_attempts") // Self-reported by the client with its latest proof
+	attrOutcome          = attribute.Key("pow.outcome")           // How the latest handshake ended
+)
+
+// Outcomes of a handshake that are not error codes sent to the client
+const (
+	outcomeSuccess         = "success"
+	outcomeTrusted         = "trusted" // A trusted token stood in for the proof
+	outcomeConnectionError = "connection_error"
+	outcomeDeadline        = "deadline_exceeded"
+	outcomeAborted         = "aborted"
+	outcomeHandlerError    = "handler_error"
+)
+
+// newTracer returns tracer, or a tracer recording nothing if it is nil
+func newTracer(tracer trace.Tracer) trace.Tracer {
+	if tracer == nil {
+		return noop.NewTracerProvider().Tracer("")
+	}
+	return tracer
+}
+
+// startConnectionSpan starts the span covering a connection, returning a context carrying it
+func (s *Server) startConnectionSpan(ctx context.Context, cs *connState) context.Context {
+	ctx, cs.span = s.tracer.Start(ctx, connectionSpanName,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attrConnID.String(cs.id),
+			attrRemoteAddr.String(cs.conn.RemoteAddr().String()),
+		))
+	return ctx
+}
+
+// traceOutcome records how the current handshake on cs ended. A non-nil err
+// marks the connection span as failed.
+func traceOutcome(cs *connState, outcome string, err error) {
+	cs.span.SetAttributes(attrOutcome.String(outcome))
+	if err != nil {
+		cs.span.RecordError(err)
+		cs.span.SetStatus(codes.Error, outcome)
+	}
+}
+
+// recordProofResult reports the outcome of a proof received on cs to the audit
+// hook and the connection span. code is the error sent to the client, empty on success.
+func (s *Server) recordProofResult(cs *connState, challenge string, code protocol.ErrorCode) {
+	s.auditProofResult(cs, challenge, code)
+
+	if code == "" {
+		traceOutcome(cs, outcomeSuccess, nil)
+		return
+	}
+	traceOutcome(cs, string(code), fmt.Errorf("proof rejected: %s", code))
+}
+
+// recordTrustedHandshake reports a handshake on cs let through by a trusted token
+// instead of a verified proof to the audit hook and the connection span
+func (s *Server) recordTrustedHandshake(cs *connState, challenge string) {
+	s.auditTrustedHandshake(cs, challenge)
+	traceOutcome(cs, outcomeTrusted, nil)
+}
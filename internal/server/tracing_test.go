@@ -0,0 +1,158 @@
+package server
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"pow/internal/pow"
+	"pow/pkg/protocol"
+)
+
+// spanAttributes indexes the attributes of a recorded span by key
+func spanAttributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+// waitForSpans waits until recorder holds n ended spans and returns them
+func waitForSpans(t *testing.T, recorder *tracetest.SpanRecorder, n int) []sdktrace.ReadOnlySpan {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if spans := recorder.Ended(); len(spans) >= n {
+			return spans
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d ended spans, got %d", n, len(recorder.Ended()))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestServer_ConnectionSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	defer provider.Shutdown(context.Background())
+
+	difficulty := 1
+	powService := pow.NewSHA256HashcashService(difficulty, 5*time.Minute)
+	addr := startTestServer(t, Config{
+		ReadTimeout:     5 * time.Second,
+		WriteTimeout:    5 * time.Second,
+		MaxConnections:  10,
+		ShutdownTimeout: 1 * time.Second,
+		Tracer:          provider.Tracer("pow/server"),
+	}, powService)
+
+	t.Run("Success", func(t *testing.T) {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		defer conn.Close()
+
+		var challengeMsg protocol.ChallengeMessage
+		if err := protocol.ReadMessage(conn, &challengeMsg, 5*time.Second); err != nil {
+			t.Fatalf("Failed to read challenge: %v", err)
+		}
+		nonce, attempts, err := powService.SolveChallengeWithStats(context.Background(), challengeMsg.Challenge, difficulty)
+		if err != nil {
+			t.Fatalf("Failed to solve challenge: %v", err)
+		}
+		proofMsg := protocol.ProofMessage{
+			BaseMessage: protocol.NewBaseMessage(protocol.MsgTypeProof),
+			Challenge:   challengeMsg.Challenge,
+			Nonce:       nonce,
+			Attempts:    attempts,
+		}
+		if err := protocol.WriteMessage(conn, proofMsg, 5*time.Second); err != nil {
+			t.Fatalf("Failed to send proof: %v", err)
+		}
+		var quoteMsg protocol.QuoteMessage
+		if err := protocol.ReadMessage(conn, &quoteMsg, 5*time.Second); err != nil {
+			t.Fatalf("Failed to read quote: %v", err)
+		}
+
+		span := waitForSpans(t, recorder, 1)[0]
+		if span.Name() != connectionSpanName {
+			t.Errorf("Expected span %q, got %q", connectionSpanName, span.Name())
+		}
+		if span.Status().Code == codes.Error {
+			t.Errorf("Expected no error status, got %+v", span.Status())
+		}
+
+		attrs := spanAttributes(span)
+		if got := attrs[attrDifficulty].AsInt64(); got != int64(difficulty) {
+			t.Errorf("Expected difficulty %d, got %d", difficulty, got)
+		}
+		if got := attrs[attrReportedAttempts].AsInt64(); got != int64(attempts) {
+			t.Errorf("Expected reported attempts %d, got %d", attempts, got)
+		}
+		if got := attrs[attrOutcome].AsString(); got != outcomeSuccess {
+			t.Errorf("Expected outcome %q, got %q", outcomeSuccess, got)
+		}
+		if got := attrs[attrAlgorithm].AsString(); got != protocol.AlgorithmSHA256 {
+			t.Errorf("Expected algorithm %q, got %q", protocol.AlgorithmSHA256, got)
+		}
+		if attrs[attrConnID].AsString() == "" {
+			t.Error("Expected the connection id on the span")
+		}
+
+		var events []string
+		for _, event := range span.Events() {
+			events = append(events, event.Name)
+		}
+		if len(events) != 2 || events[0] != "challenge sent" || events[1] != "proof received" {
+			t.Errorf("Expected challenge and proof events, got %v", events)
+		}
+	})
+
+	t.Run("InvalidProof", func(t *testing.T) {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		defer conn.Close()
+
+		var challengeMsg protocol.ChallengeMessage
+		if err := protocol.ReadMessage(conn, &challengeMsg, 5*time.Second); err != nil {
+			t.Fatalf("Failed to read challenge: %v", err)
+		}
+		// Almost every nonce fails; skip the rare ones that happen to solve the challenge
+		nonce := 0
+		for pow.Verify(challengeMsg.Challenge, strconv.Itoa(nonce), difficulty, pow.SHA256Hasher{}) {
+			nonce++
+		}
+		proofMsg := protocol.ProofMessage{
+			BaseMessage: protocol.NewBaseMessage(protocol.MsgTypeProof),
+			Challenge:   challengeMsg.Challenge,
+			Nonce:       strconv.Itoa(nonce),
+		}
+		if err := protocol.WriteMessage(conn, proofMsg, 5*time.Second); err != nil {
+			t.Fatalf("Failed to send proof: %v", err)
+		}
+		var errMsg protocol.ErrorMessage
+		if err := protocol.ReadMessage(conn, &errMsg, 5*time.Second); err != nil {
+			t.Fatalf("Failed to read error: %v", err)
+		}
+
+		span := waitForSpans(t, recorder, 2)[1]
+		if span.Status().Code != codes.Error {
+			t.Errorf("Expected error status, got %+v", span.Status())
+		}
+		if got := spanAttributes(span)[attrOutcome].AsString(); got != string(protocol.ErrCodeInvalidProof) {
+			t.Errorf("Expected outcome %q, got %q", protocol.ErrCodeInvalidProof, got)
+		}
+	})
+}
@@ -0,0 +1,73 @@
+package protocol
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// Compression identifies how a message payload is encoded on the wire
+type Compression byte
+
+const (
+	// CompressionNone means the payload is sent as encoded
+	CompressionNone Compression = 0
+	// CompressionGzip means the encoded payload is gzip-compressed
+	CompressionGzip Compression = 1
+)
+
+// CompressionThreshold is the encoded size in bytes above which WriteMessage compresses
+const CompressionThreshold = 1024
+
+// compressPayload gzips data if it exceeds CompressionThreshold and compression
+// actually makes it smaller, returning the payload and its compression flag
+func compressPayload(data []byte) ([]byte, Compression, error) {
+	if len(data) <= CompressionThreshold {
+		return data, CompressionNone, nil
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, CompressionNone, fmt.Errorf("failed to compress message: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, CompressionNone, fmt.Errorf("failed to compress message: %w", err)
+	}
+
+	if buf.Len() >= len(data) {
+		return data, CompressionNone, nil
+	}
+
+	return buf.Bytes(), CompressionGzip, nil
+}
+
+// decompressPayload decodes payload according to its compression flag.
+// The decompressed size is limited to limit bytes to defuse zip bombs.
+func decompressPayload(payload []byte, compression Compression, limit int) ([]byte, error) {
+	switch compression {
+	case CompressionNone:
+		return payload, nil
+
+	case CompressionGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to decompress: %v", ErrMalformedMessage, err)
+		}
+		defer zr.Close()
+
+		// Read one byte past the limit to detect oversized messages
+		data, err := io.ReadAll(io.LimitReader(zr, int64(limit)+1))
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to decompress: %v", ErrMalformedMessage, err)
+		}
+		if len(data) > limit {
+			return nil, fmt.Errorf("%w: decompressed size exceeds max allowed (%d)", ErrMessageTooLarge, limit)
+		}
+		return data, nil
+
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedCompression, compression)
+	}
+}
@@ -0,0 +1,88 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	// EncodingNameJSON names JSONEncoding
+	EncodingNameJSON = "json"
+	// EncodingNameMsgpack names MsgpackEncoding
+	EncodingNameMsgpack = "msgpack"
+)
+
+// encodingShift places the encoding id in the high nibble of the frame flag byte,
+// above the compression flag. JSON has id 0, so JSON frames are unchanged and peers
+// that predate encodings reject any other encoding as an unknown compression.
+const encodingShift = 4
+
+// compressionMask selects the compression flag from the frame flag byte
+const compressionMask = 1<<encodingShift - 1
+
+// Encoding marshals messages to and from frame payloads. Messages are defined by
+// their JSON field tags, which every encoding preserves, so a message decoded with
+// any encoding can be re-decoded from its JSON form with Codec.Decode.
+type Encoding interface {
+	// Name identifies the encoding in configuration and errors
+	Name() string
+	// Marshal encodes v
+	Marshal(v interface{}) ([]byte, error)
+	// Unmarshal decodes data into v
+	Unmarshal(data []byte, v interface{}) error
+
+	// id is the encoding's identifier in the frame flag byte
+	id() byte
+	// toJSON converts an encoded payload to JSON, for the decoding rules of Codec.Decode
+	toJSON(data []byte) ([]byte, error)
+}
+
+var (
+	// JSONEncoding encodes messages as JSON, the default
+	JSONEncoding Encoding = jsonEncoding{}
+	// MsgpackEncoding encodes messages as MessagePack maps keyed by the JSON field names
+	MsgpackEncoding Encoding = msgpackEncoding{}
+)
+
+// encodings lists every known encoding
+var encodings = []Encoding{JSONEncoding, MsgpackEncoding}
+
+// EncodingByName returns the encoding called name, or an error for an unknown name
+func EncodingByName(name string) (Encoding, error) {
+	for _, enc := range encodings {
+		if enc.Name() == name {
+			return enc, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown encoding %q (supported: %s, %s)", name, EncodingNameJSON, EncodingNameMsgpack)
+}
+
+// encodingName names the encoding with the given frame id, for error messages
+func encodingName(id byte) string {
+	for _, enc := range encodings {
+		if enc.id() == id {
+			return enc.Name()
+		}
+	}
+	return fmt.Sprintf("unknown encoding %d", id)
+}
+
+// jsonEncoding is the JSON Encoding
+type jsonEncoding struct{}
+
+func (jsonEncoding) Name() string { return EncodingNameJSON }
+func (jsonEncoding) id() byte     { return 0 }
+
+// Marshal encodes v as JSON
+func (jsonEncoding) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal decodes the JSON data into v
+func (jsonEncoding) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (jsonEncoding) toJSON(data []byte) ([]byte, error) {
+	return data, nil
+}
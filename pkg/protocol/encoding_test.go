@@ -0,0 +1,270 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// allMessages returns one populated value of every message type
+func allMessages() []interface{} {
+	base := func(msgType MessageType) BaseMessage { return NewBaseMessage(msgType) }
+	return []interface{}{
+		&ChallengeMessage{
+			BaseMessage: base(MsgTypeChallenge),
+			Challenge:   "1700000000:0badf00d",
+			Difficulty:  20,
+			Algorithm:   AlgorithmArgon2id,
+			Argon2:      &Argon2Params{Time: 1, Memory: 64 * 1024, Threads: 4},
+			Binding:     "192.0.2.1",
+			ServerInfo:  "pow-server/v1.2.3",
+			Namespace:   "tenant-a",
+			Target:      "00000fffffffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+
+			ExpectedIterations: 1 << 20,
+		},
+		&ProofMessage{
+			BaseMessage:     base(MsgTypeProof),
+			Challenge:       "1700000000:0badf00d",
+			Nonce:           "ffffffffffffffff",
+			NonceEncoding:   NonceEncodingHex,
+			Attempts:        math.MaxInt32 + 1,
+			Category:        "wisdom",
+			Count:           3,
+			KeepAlive:       true,
+			Subscribe:       true,
+			IntervalSeconds: 60,
+			Structured:      true,
+		},
+		&QuoteMessage{BaseMessage: base(MsgTypeQuote), Quote: "Know thyself. ✓ - Socrates", Text: "Know thyself. ✓", Author: "Socrates", KeepAlive: true, IntervalSeconds: 5},
+		&QuotesMessage{BaseMessage: base(MsgTypeQuotes), Quotes: []string{"one", "", strings.Repeat("long ", 100)}},
+		&ErrorMessage{BaseMessage: base(MsgTypeError), Code: ErrCodeRateLimited, Message: "slow down", ConnID: "abcd1234", RetryAfterMs: 1500},
+		&CloseMessage{BaseMessage: base(MsgTypeClose)},
+		&HeartbeatMessage{BaseMessage: base(MsgTypeHeartbeat), Reply: true},
+		&AuthMessage{BaseMessage: base(MsgTypeAuth), Token: "0123456789abcdef"},
+		&StatsRequestMessage{BaseMessage: base(MsgTypeStatsRequest), Token: "secret"},
+		&StatsResponseMessage{BaseMessage: base(MsgTypeStatsResponse), Difficulty: 3, ActiveConnections: 70000, QueuedConnections: 1, Draining: true},
+		&SetDifficultyMessage{BaseMessage: base(MsgTypeSetDifficulty), Token: "secret", Difficulty: -1},
+		&DrainMessage{BaseMessage: base(MsgTypeDrain), Token: "secret"},
+	}
+}
+
+// sendThrough writes msg with the writer codec and reads it into target with the reader codec
+func sendThrough(t *testing.T, writer, reader Codec, msg, target interface{}) error {
+	t.Helper()
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- writer.WriteMessage(server, msg, time.Second)
+		server.Close()
+	}()
+
+	err := reader.ReadMessage(client, target, time.Second)
+	client.Close() // Unblock the writer if the reader gave up early
+	<-errCh
+	return err
+}
+
+func TestEncoding_RoundTrip(t *testing.T) {
+	for _, enc := range []Encoding{JSONEncoding, MsgpackEncoding} {
+		codec := DefaultCodec.Strict().WithEncoding(enc)
+		for _, msg := range allMessages() {
+			name := reflect.TypeOf(msg).Elem().Name()
+			t.Run(enc.Name()+"/"+name, func(t *testing.T) {
+				got := reflect.New(reflect.TypeOf(msg).Elem()).Interface()
+				if err := sendThrough(t, codec, codec, msg, got); err != nil {
+					t.Fatalf("Round trip failed: %v", err)
+				}
+				if !reflect.DeepEqual(got, msg) {
+					t.Errorf("Round trip changed the message:\nsent %+v\ngot  %+v", msg, got)
+				}
+
+				// Marshal and Unmarshal agree with the framing
+				data, err := enc.Marshal(msg)
+				if err != nil {
+					t.Fatalf("Marshal failed: %v", err)
+				}
+				direct := reflect.New(reflect.TypeOf(msg).Elem()).Interface()
+				if err := enc.Unmarshal(data, direct); err != nil {
+					t.Fatalf("Unmarshal failed: %v", err)
+				}
+				if !reflect.DeepEqual(direct, msg) {
+					t.Errorf("Unmarshal changed the message:\nsent %+v\ngot  %+v", msg, direct)
+				}
+			})
+		}
+	}
+}
+
+func TestEncoding_Mismatch(t *testing.T) {
+	jsonCodec := DefaultCodec
+	msgpackCodec := DefaultCodec.WithEncoding(MsgpackEncoding)
+	msg := QuoteMessage{BaseMessage: NewBaseMessage(MsgTypeQuote), Quote: "mismatched"}
+
+	for name, codecs := range map[string][2]Codec{
+		"MsgpackToJSON": {msgpackCodec, jsonCodec},
+		"JSONToMsgpack": {jsonCodec, msgpackCodec},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var got QuoteMessage
+			err := sendThrough(t, codecs[0], codecs[1], msg, &got)
+			if !errors.Is(err, ErrEncodingMismatch) {
+				t.Fatalf("Expected ErrEncodingMismatch, got: %v", err)
+			}
+			if !IsProtocolViolation(err) || ViolationReason(err) != ErrEncodingMismatch.Error() {
+				t.Errorf("Expected a reportable protocol violation, got: %v", err)
+			}
+			if !strings.Contains(err.Error(), codecs[0].Encoding().Name()) {
+				t.Errorf("Expected the error to name the peer's encoding, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestEncoding_MaxSize(t *testing.T) {
+	for _, enc := range []Encoding{JSONEncoding, MsgpackEncoding} {
+		t.Run(enc.Name(), func(t *testing.T) {
+			codec := DefaultCodec.WithEncoding(enc).WithMaxSize(512)
+			client, server := net.Pipe()
+			defer client.Close()
+			defer server.Close()
+
+			msg := QuoteMessage{BaseMessage: NewBaseMessage(MsgTypeQuote), Quote: strings.Repeat("A", 512)}
+			if err := codec.WriteMessage(server, msg, time.Second); !errors.Is(err, ErrMessageTooLarge) {
+				t.Errorf("Expected ErrMessageTooLarge, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestEncoding_Compressed(t *testing.T) {
+	codec := DefaultCodec.WithEncoding(MsgpackEncoding)
+	msg := QuoteMessage{BaseMessage: NewBaseMessage(MsgTypeQuote), Quote: strings.Repeat("A long and repetitive quote. ", 200)}
+
+	var got QuoteMessage
+	if err := sendThrough(t, codec, codec, msg, &got); err != nil {
+		t.Fatalf("Round trip failed: %v", err)
+	}
+	if got.Quote != msg.Quote {
+		t.Error("Compressed msgpack quote did not survive the round trip")
+	}
+}
+
+func TestEncoding_StrictMsgpack(t *testing.T) {
+	writer := DefaultCodec.WithEncoding(MsgpackEncoding)
+	reader := writer.Strict()
+	extra := struct {
+		BaseMessage
+		Quote string `json:"quote"`
+		Extra int    `json:"extra"`
+	}{NewBaseMessage(MsgTypeQuote), "q", 1}
+
+	var got QuoteMessage
+	if err := sendThrough(t, writer, reader, extra, &got); !errors.Is(err, ErrUnknownField) {
+		t.Errorf("Expected ErrUnknownField, got: %v", err)
+	}
+}
+
+func TestMsgpack_WireFormat(t *testing.T) {
+	data, err := MsgpackEncoding.Marshal(HeartbeatMessage{BaseMessage: BaseMessage{Type: MsgTypeHeartbeat, Version: 5}})
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+
+	// fixmap of 2: "type": "heartbeat", "version": 5
+	want := []byte{0x82, 0xa4, 't', 'y', 'p', 'e', 0xa9, 'h', 'e', 'a', 'r', 't', 'b', 'e', 'a', 't', 0xa7, 'v', 'e', 'r', 's', 'i', 'o', 'n', 0x05}
+	if !bytes.Equal(data, want) {
+		t.Errorf("Expected % x, got % x", want, data)
+	}
+}
+
+func TestMsgpack_DecodeForms(t *testing.T) {
+	// Integer, float and string forms other encoders may pick for the same values
+	tests := []struct {
+		name  string
+		value []byte
+		want  interface{}
+	}{
+		{"Int8", []byte{0xd0, 0x80}, float64(-128)},
+		{"Int16", []byte{0xd1, 0xff, 0x00}, float64(-256)},
+		{"Int32", []byte{0xd2, 0xff, 0xff, 0xff, 0xfe}, float64(-2)},
+		{"Int64", []byte{0xd3, 0, 0, 0, 0, 0, 0, 0, 7}, float64(7)},
+		{"Uint16", []byte{0xcd, 0x01, 0x00}, float64(256)},
+		{"Uint32", []byte{0xce, 0, 1, 0, 0}, float64(65536)},
+		{"Float32", []byte{0xca, 0x3f, 0xc0, 0, 0}, 1.5},
+		{"Float64", []byte{0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}, 1.5},
+		{"Str8", []byte{0xd9, 2, 'h', 'i'}, "hi"},
+		{"Str16", []byte{0xda, 0, 2, 'h', 'i'}, "hi"},
+		{"Bin8", []byte{0xc4, 2, 'h', 'i'}, "aGk="}, // Base64, like []byte in JSON
+		{"Nil", []byte{0xc0}, nil},
+		{"Array16", []byte{0xdc, 0, 2, 0xc3, 0xc2}, []interface{}{true, false}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got struct {
+				Value interface{} `json:"v"`
+			}
+			data := append([]byte{0x81, 0xa1, 'v'}, tt.value...)
+			if err := MsgpackEncoding.Unmarshal(data, &got); err != nil {
+				t.Fatalf("Unmarshal failed: %v", err)
+			}
+			if !reflect.DeepEqual(got.Value, tt.want) {
+				t.Errorf("Expected %#v, got %#v", tt.want, got.Value)
+			}
+		})
+	}
+}
+
+func TestMsgpack_Malformed(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"Empty", nil, ErrInvalidMsgpack},
+		{"TruncatedString", []byte{0x81, 0xa4, 't', 'y'}, ErrInvalidMsgpack},
+		{"OversizedArray", []byte{0xdd, 0xff, 0xff, 0xff, 0xff}, ErrInvalidMsgpack},
+		{"NonStringKey", []byte{0x81, 0x01, 0x02}, ErrInvalidMsgpack},
+		{"Extension", []byte{0xd4, 0x01, 0x00}, ErrInvalidMsgpack},
+		{"NaN", []byte{0xcb, 0x7f, 0xf8, 0, 0, 0, 0, 0, 1}, ErrInvalidMsgpack},
+		{"TrailingData", []byte{0x80, 0x80}, ErrTrailingData},
+		{"WrongFieldType", []byte{0x81, 0xa4, 't', 'y', 'p', 'e', 0x01}, ErrFieldType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jsonData, err := MsgpackEncoding.toJSON(tt.data)
+			if err == nil {
+				var base BaseMessage
+				err = DefaultCodec.Decode(jsonData, &base)
+			}
+			if !errors.Is(err, tt.want) || !errors.Is(err, ErrMalformedMessage) {
+				t.Errorf("Expected %v wrapped with ErrMalformedMessage, got: %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestEncodingByName(t *testing.T) {
+	for _, enc := range []Encoding{JSONEncoding, MsgpackEncoding} {
+		if got, err := EncodingByName(enc.Name()); err != nil || got != enc {
+			t.Errorf("EncodingByName(%q) = %v, %v", enc.Name(), got, err)
+		}
+	}
+	if _, err := EncodingByName("xml"); err == nil {
+		t.Error("Expected an error for an unknown encoding")
+	}
+	if DefaultCodec.Encoding() != JSONEncoding || DefaultCodec.WithEncoding(nil).Encoding() != JSONEncoding {
+		t.Error("Expected JSON to be the default encoding")
+	}
+}
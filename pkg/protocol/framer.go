@@ -0,0 +1,73 @@
+package protocol
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// Framer reads and writes messages on one connection with fixed settings: the
+// codec's framing, size limit and decoding rules, and a timeout per message.
+// A Framer is as safe for concurrent use as the codec functions it calls, which
+// is to say one reader and one writer at a time.
+type Framer struct {
+	conn         net.Conn
+	codec        Codec
+	readTimeout  time.Duration // Bound on each read, 0 means none
+	writeTimeout time.Duration // Bound on each write, 0 means none
+}
+
+// NewFramer creates a Framer speaking codec on conn. A non-positive timeout leaves
+// reads or writes unbounded.
+func NewFramer(conn net.Conn, codec Codec, readTimeout, writeTimeout time.Duration) *Framer {
+	return &Framer{
+		conn:         conn,
+		codec:        codec,
+		readTimeout:  readTimeout,
+		writeTimeout: writeTimeout,
+	}
+}
+
+// Conn returns the underlying connection
+func (f *Framer) Conn() net.Conn {
+	return f.conn
+}
+
+// Codec returns the codec messages are framed with
+func (f *Framer) Codec() Codec {
+	return f.codec
+}
+
+// Read reads the next message into target within the read timeout
+func (f *Framer) Read(target interface{}) error {
+	return f.codec.ReadMessage(f.conn, target, f.readTimeout)
+}
+
+// Write writes msg within the write timeout
+func (f *Framer) Write(msg interface{}) error {
+	return f.codec.WriteMessage(f.conn, msg, f.writeTimeout)
+}
+
+// ReadCtx is like Read, but the read also ends at ctx's deadline and is aborted
+// as soon as ctx is canceled
+func (f *Framer) ReadCtx(ctx context.Context, target interface{}) error {
+	ctx, cancel := withTimeout(ctx, f.readTimeout)
+	defer cancel()
+	return f.codec.ReadMessageCtx(ctx, f.conn, target)
+}
+
+// WriteCtx is like Write, but the write also ends at ctx's deadline and is aborted
+// as soon as ctx is canceled
+func (f *Framer) WriteCtx(ctx context.Context, msg interface{}) error {
+	ctx, cancel := withTimeout(ctx, f.writeTimeout)
+	defer cancel()
+	return f.codec.WriteMessageCtx(ctx, f.conn, msg)
+}
+
+// withTimeout derives a context bounded by timeout. A non-positive timeout adds no bound.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,123 @@
+package protocol
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFramer_RoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		codec Codec
+		quote string
+	}{
+		{"Default", DefaultCodec, "Short quote"},
+		{"Legacy", LegacyCodec, "Short quote"},
+		{"Strict", DefaultCodec.Strict(), "Short quote"},
+		{"MaxSize", DefaultCodec.WithMaxSize(4096), "Short quote"},
+		{"Compressed", DefaultCodec, strings.Repeat("A long and repetitive quote. ", 200)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+			defer server.Close()
+
+			reader := NewFramer(client, tt.codec, time.Second, time.Second)
+			writer := NewFramer(server, tt.codec, time.Second, time.Second)
+
+			sent := QuoteMessage{BaseMessage: tt.codec.NewBaseMessage(MsgTypeQuote), Quote: tt.quote}
+			errCh := make(chan error, 1)
+			go func() { errCh <- writer.Write(sent) }()
+
+			var got QuoteMessage
+			if err := reader.Read(&got); err != nil {
+				t.Fatalf("Read failed: %v", err)
+			}
+			if err := <-errCh; err != nil {
+				t.Fatalf("Write failed: %v", err)
+			}
+			if got.Quote != tt.quote || got.Version != tt.codec.Version() {
+				t.Errorf("Expected version %d quote of %d bytes, got version %d quote of %d bytes",
+					tt.codec.Version(), len(tt.quote), got.Version, len(got.Quote))
+			}
+		})
+	}
+}
+
+func TestFramer_Accessors(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	codec := LegacyCodec.WithMaxSize(4096)
+	f := NewFramer(client, codec, time.Second, time.Second)
+	if f.Conn() != client {
+		t.Error("Expected Conn to return the framed connection")
+	}
+	if f.Codec() != codec {
+		t.Error("Expected Codec to return the codec the Framer was created with")
+	}
+}
+
+func TestFramer_ReadTimeout(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	f := NewFramer(client, DefaultCodec, 50*time.Millisecond, time.Second)
+
+	// Nothing is ever written, so only the read timeout can end the reads
+	for name, read := range map[string]func(*QuoteMessage) error{
+		"Read":    func(msg *QuoteMessage) error { return f.Read(msg) },
+		"ReadCtx": func(msg *QuoteMessage) error { return f.ReadCtx(context.Background(), msg) },
+	} {
+		start := time.Now()
+		var msg QuoteMessage
+		if err := read(&msg); err == nil {
+			t.Errorf("%s: expected read to fail at the read timeout", name)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("%s: took %v, expected to stop at the 50ms timeout", name, elapsed)
+		}
+	}
+}
+
+func TestFramer_ReadCtxCancel(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	// No read timeout, so only cancellation can end the read
+	f := NewFramer(client, DefaultCodec, 0, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	var msg QuoteMessage
+	if err := f.ReadCtx(ctx, &msg); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got: %v", err)
+	}
+}
+
+func TestFramer_WriteCtxCancel(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	f := NewFramer(server, DefaultCodec, 0, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	// net.Pipe is unbuffered, so the write blocks until canceled
+	err := f.WriteCtx(ctx, QuoteMessage{BaseMessage: NewBaseMessage(MsgTypeQuote), Quote: "never read"})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got: %v", err)
+	}
+}
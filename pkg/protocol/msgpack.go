@@ -0,0 +1,169 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"github.com/vmihailenco/msgpack/v5/msgpcode"
+)
+
+// msgpackMaxDepth bounds how deeply arrays and maps may nest in a decoded message
+const msgpackMaxDepth = 10000
+
+// msgpackEncoding is the MessagePack Encoding. It transcodes through the JSON form
+// of a message, so field names, omitempty and custom marshalers behave as with JSON.
+// The MessagePack itself is read and written by github.com/vmihailenco/msgpack.
+type msgpackEncoding struct{}
+
+func (msgpackEncoding) Name() string { return EncodingNameMsgpack }
+func (msgpackEncoding) id() byte     { return 1 }
+
+// Marshal encodes v as MessagePack
+func (msgpackEncoding) Marshal(v interface{}) ([]byte, error) {
+	jsonData, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(jsonData))
+	dec.UseNumber() // Keep integers exact
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	value, err = msgpackNumbers(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.UseCompactInts(true) // Smallest integer forms, as other implementations expect
+	enc.SetSortMapKeys(true) // Same message, same bytes
+	if err := enc.Encode(value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal decodes the MessagePack data into v
+func (m msgpackEncoding) Unmarshal(data []byte, v interface{}) error {
+	jsonData, err := m.toJSON(data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(jsonData, v)
+}
+
+func (msgpackEncoding) toJSON(data []byte) ([]byte, error) {
+	r := bytes.NewReader(data)
+	value, err := decodeMsgpack(msgpack.NewDecoder(r), r, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w: %v", ErrMalformedMessage, ErrInvalidMsgpack, err)
+	}
+	if r.Len() != 0 {
+		return nil, fmt.Errorf("%w: %w", ErrMalformedMessage, ErrTrailingData)
+	}
+
+	jsonData, err := json.Marshal(value)
+	if err != nil {
+		// NaN and infinite floats, extension types and the like have no JSON form
+		return nil, fmt.Errorf("%w: %w: %v", ErrMalformedMessage, ErrInvalidMsgpack, err)
+	}
+	return jsonData, nil
+}
+
+// decodeMsgpack decodes the next value from dec, which reads from r. The library
+// sizes arrays and maps by their declared length, so containers are walked here
+// and their length checked against the bytes left before anything is allocated.
+func decodeMsgpack(dec *msgpack.Decoder, r *bytes.Reader, depth int) (interface{}, error) {
+	if depth > msgpackMaxDepth {
+		return nil, errors.New("nested too deeply")
+	}
+	code, err := dec.PeekCode()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case msgpcode.IsFixedArray(code) || code == msgpcode.Array16 || code == msgpcode.Array32:
+		n, err := dec.DecodeArrayLen()
+		if err != nil {
+			return nil, err
+		}
+		// Every element takes at least a byte
+		if n > r.Len() {
+			return nil, fmt.Errorf("array of %d elements in %d bytes", n, r.Len())
+		}
+		array := make([]interface{}, n)
+		for i := range array {
+			if array[i], err = decodeMsgpack(dec, r, depth+1); err != nil {
+				return nil, err
+			}
+		}
+		return array, nil
+	case msgpcode.IsFixedMap(code) || code == msgpcode.Map16 || code == msgpcode.Map32:
+		n, err := dec.DecodeMapLen()
+		if err != nil {
+			return nil, err
+		}
+		// Every key and every value takes at least a byte
+		if n > r.Len()/2 {
+			return nil, fmt.Errorf("map of %d entries in %d bytes", n, r.Len())
+		}
+		m := make(map[string]interface{}, n)
+		for i := 0; i < n; i++ {
+			key, err := dec.DecodeString() // JSON objects only have string keys
+			if err != nil {
+				return nil, err
+			}
+			if m[key], err = decodeMsgpack(dec, r, depth+1); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	default:
+		return dec.DecodeInterface()
+	}
+}
+
+// msgpackNumbers replaces the json.Numbers in a value decoded from JSON with
+// UseNumber by the integer or float they hold, so they are encoded as numbers
+func msgpackNumbers(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			return i, nil
+		}
+		if u, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			return u, nil
+		}
+		f, err := strconv.ParseFloat(string(v), 64)
+		if err != nil || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("number %s out of range", v)
+		}
+		return f, nil
+	case []interface{}:
+		for i, elem := range v {
+			n, err := msgpackNumbers(elem)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = n
+		}
+	case map[string]interface{}:
+		for key, elem := range v {
+			n, err := msgpackNumbers(elem)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = n
+		}
+	}
+	return value, nil
+}
@@ -1,21 +1,87 @@
 package protocol
 
 import (
+	"bytes"
+	"context"
 	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
+	"strings"
 	"time"
 )
 
 const (
-	// MaxMessageSize defines the maximum size of a message (64KB)
+	// MaxMessageSize is the default maximum size of a message (64KB), before compression
 	MaxMessageSize = 1 << 16
 	// MessageLengthPrefixSize is the size of the length prefix in bytes
 	MessageLengthPrefixSize = 4
+	// MessageFlagSize is the size of the flag byte following the length prefix, holding
+	// the compression flag in its low nibble and the encoding id in its high nibble
+	MessageFlagSize = 1
+
+	// CurrentProtocolVersion is the protocol version spoken by this implementation.
+	// Version 3 switched the length prefix to big-endian (network byte order).
+	// Version 4 added the nonce_encoding field to proofs.
+	// Version 5 added auth messages for clients holding a trusted token.
+	CurrentProtocolVersion = 5
+	// TokenProtocolVersion is the first protocol version whose servers accept auth messages
+	TokenProtocolVersion = 5
+	// LegacyProtocolVersion is the last protocol version using little-endian framing
+	LegacyProtocolVersion = 2
+	// MinSupportedProtocolVersion is the oldest protocol version still accepted.
+	// Version 2 added the compression flag to the framing, so version 1 peers cannot be read.
+	MinSupportedProtocolVersion = 2
+)
+
+// Framing errors returned by ReadMessage and WriteMessage when a peer violates the
+// protocol, as opposed to network errors. Check them with errors.Is.
+var (
+	ErrZeroLengthMessage      = errors.New("zero-length message")
+	ErrMessageTooLarge        = errors.New("message too large")
+	ErrUnsupportedCompression = errors.New("unsupported message compression")
+	ErrEncodingMismatch       = errors.New("message encoding mismatch")
+	ErrMalformedMessage       = errors.New("malformed message")
+)
+
+// Decoding errors telling why a frame's payload was rejected. They are always
+// returned together with ErrMalformedMessage, so either can be checked.
+var (
+	ErrInvalidJSON    = errors.New("invalid JSON")
+	ErrInvalidMsgpack = errors.New("invalid msgpack")
+	ErrFieldType      = errors.New("field has the wrong type")
+	ErrUnknownField   = errors.New("unknown field")
+	ErrTrailingData   = errors.New("trailing data after message")
+	ErrInvalidNonce   = errors.New("invalid nonce")
 )
 
+// IsProtocolViolation reports whether err was caused by a peer violating the framing
+// or encoding rules, in which case reporting it back to the peer makes sense
+func IsProtocolViolation(err error) bool {
+	return errors.Is(err, ErrZeroLengthMessage) ||
+		errors.Is(err, ErrMessageTooLarge) ||
+		errors.Is(err, ErrUnsupportedCompression) ||
+		errors.Is(err, ErrEncodingMismatch) ||
+		errors.Is(err, ErrMalformedMessage)
+}
+
+// ViolationReason names the protocol violation err without echoing decoder output,
+// so it is safe to send back to the peer
+func ViolationReason(err error) string {
+	for _, reason := range []error{
+		ErrInvalidJSON, ErrInvalidMsgpack, ErrFieldType, ErrUnknownField, ErrTrailingData, ErrInvalidNonce,
+		ErrZeroLengthMessage, ErrMessageTooLarge, ErrUnsupportedCompression, ErrEncodingMismatch, ErrMalformedMessage,
+	} {
+		if errors.Is(err, reason) {
+			return reason.Error()
+		}
+	}
+	return "protocol violation"
+}
+
 // MessageType defines the type of message
 type MessageType string
 
@@ -23,54 +89,314 @@ const (
 	MsgTypeChallenge MessageType = "challenge"
 	MsgTypeProof     MessageType = "proof"
 	MsgTypeQuote     MessageType = "quote"
+	MsgTypeQuotes    MessageType = "quotes"
 	MsgTypeError     MessageType = "error"
+	MsgTypeClose     MessageType = "close"
+	MsgTypeHeartbeat MessageType = "heartbeat"
+	MsgTypeAuth      MessageType = "auth"
+
+	// Admin messages, accepted only on the admin listener
+	MsgTypeStatsRequest  MessageType = "stats_request"
+	MsgTypeStatsResponse MessageType = "stats_response"
+	MsgTypeSetDifficulty MessageType = "set_difficulty"
+	MsgTypeDrain         MessageType = "drain"
+)
+
+const (
+	// AlgorithmSHA256 is SHA256 Hashcash (difficulty in leading zero bytes)
+	AlgorithmSHA256 = "sha256"
+	// AlgorithmArgon2id is memory-hard Argon2id Hashcash (difficulty in leading zero bits)
+	AlgorithmArgon2id = "argon2id"
+)
+
+const (
+	// NonceEncodingDecimal sends the nonce as the decimal digits that were hashed (the default)
+	NonceEncodingDecimal = "decimal"
+	// NonceEncodingHex sends the raw nonce bytes that were hashed, hex-encoded
+	NonceEncodingHex = "hex"
 )
 
 // BaseMessage for all messages
 type BaseMessage struct {
-	Type MessageType `json:"type"`
+	Type    MessageType `json:"type"`
+	Version int         `json:"version,omitempty"` // Protocol version of the sender, 0 if unversioned
+}
+
+// NewBaseMessage creates a BaseMessage stamped with the current protocol version
+func NewBaseMessage(msgType MessageType) BaseMessage {
+	return DefaultCodec.NewBaseMessage(msgType)
+}
+
+// CheckVersion returns an error if the peer's protocol version is not supported
+func CheckVersion(version int) error {
+	if version < MinSupportedProtocolVersion || version > CurrentProtocolVersion {
+		return fmt.Errorf("unsupported protocol version %d (supported: %d-%d)",
+			version, MinSupportedProtocolVersion, CurrentProtocolVersion)
+	}
+	return nil
+}
+
+// Argon2Params carries Argon2id cost parameters to the client
+type Argon2Params struct {
+	Time    uint32 `json:"time"`    // Number of passes over memory
+	Memory  uint32 `json:"memory"`  // Memory cost in KiB
+	Threads uint8  `json:"threads"` // Degree of parallelism
 }
 
 // ChallengeMessage is sent by the server
 type ChallengeMessage struct {
 	BaseMessage
-	Challenge  string `json:"challenge"`  // Random string + timestamp
-	Difficulty int    `json:"difficulty"` // Number of leading zeros in hash
+	Challenge  string        `json:"challenge"`             // Random string + timestamp
+	Difficulty int           `json:"difficulty"`            // Number of leading zeros in hash
+	Algorithm  string        `json:"algorithm,omitempty"`   // PoW algorithm, empty means sha256
+	Argon2     *Argon2Params `json:"argon2,omitempty"`      // Set only for argon2id challenges
+	Binding    string        `json:"binding,omitempty"`     // Client IP to hash between challenge and nonce, if bound
+	Namespace  string        `json:"namespace,omitempty"`   // Hashed with a colon before the challenge, if the server is namespaced
+	Target     string        `json:"target,omitempty"`      // 256-bit hex number the sha256 hash must not exceed, replacing Difficulty if set
+	ServerInfo string        `json:"server_info,omitempty"` // Server name and version, informational only
+
+	// ExpectedIterations is the average number of nonces tried before one solves the
+	// challenge, for telling users how long it may take. Advisory only.
+	ExpectedIterations uint64 `json:"expected_iterations,omitempty"`
 }
 
 // ProofMessage is sent by the client
 type ProofMessage struct {
 	BaseMessage
-	Challenge string `json:"challenge"` // Echo the received challenge
-	Nonce     string `json:"nonce"`     // Found nonce
+	Challenge       string `json:"challenge"`                  // Echo the received challenge
+	Nonce           string `json:"nonce"`                      // Found nonce, encoded as NonceEncoding says
+	NonceEncoding   string `json:"nonce_encoding,omitempty"`   // How Nonce is encoded, empty means decimal
+	Attempts        int    `json:"attempts,omitempty"`         // Nonces tried by the client, informational only
+	Category        string `json:"category,omitempty"`         // Optional quote category
+	Count           int    `json:"count,omitempty"`            // Number of quotes requested, 0 or 1 means a single quote
+	KeepAlive       bool   `json:"keep_alive,omitempty"`       // Ask the server for another challenge afterwards
+	Subscribe       bool   `json:"subscribe,omitempty"`        // Ask the server to keep pushing quotes until disconnect
+	IntervalSeconds int    `json:"interval_seconds,omitempty"` // Seconds between pushed quotes when subscribing
+	Structured      bool   `json:"structured,omitempty"`       // Ask for each single quote's text and author separately too
+}
+
+// NonceBytes returns the nonce exactly as it was hashed after the challenge.
+// A decimal nonce is hashed as its digits, a hex one as the bytes it encodes.
+// An unknown encoding or undecodable nonce is an ErrInvalidNonce.
+func (m ProofMessage) NonceBytes() (string, error) {
+	switch m.NonceEncoding {
+	case "", NonceEncodingDecimal:
+		return m.Nonce, nil
+	case NonceEncodingHex:
+		raw, err := hex.DecodeString(m.Nonce)
+		if err != nil {
+			return "", fmt.Errorf("%w: %w: bad hex: %v", ErrMalformedMessage, ErrInvalidNonce, err)
+		}
+		return string(raw), nil
+	default:
+		return "", fmt.Errorf("%w: %w: unknown encoding %q", ErrMalformedMessage, ErrInvalidNonce, m.NonceEncoding)
+	}
+}
+
+// CloseMessage is sent by the client instead of a proof to end a keep-alive session,
+// and by the server when a quote subscription reaches its maximum duration
+type CloseMessage struct {
+	BaseMessage
+}
+
+// HeartbeatMessage keeps an idle connection alive. A peer waiting for a message
+// answers one with Reply set; the answer itself is not answered.
+type HeartbeatMessage struct {
+	BaseMessage
+	Reply bool `json:"reply,omitempty"` // Set on the answer to a heartbeat
+}
+
+// AuthMessage answers a challenge with a pre-shared token instead of a proof. The
+// server replies by sending the challenge again, at difficulty 0 if it trusts the
+// token and unchanged otherwise, and the client then proves it as usual.
+type AuthMessage struct {
+	BaseMessage
+	Token string `json:"token"`
+}
+
+// StatsRequestMessage asks the admin listener for a StatsResponseMessage
+type StatsRequestMessage struct {
+	BaseMessage
+	Token string `json:"token"` // Shared admin secret
+}
+
+// SetDifficultyMessage changes the difficulty of newly issued challenges. The admin
+// listener answers it with a StatsResponseMessage reflecting the new difficulty.
+type SetDifficultyMessage struct {
+	BaseMessage
+	Token      string `json:"token"` // Shared admin secret
+	Difficulty int    `json:"difficulty"`
+}
+
+// DrainMessage tells the server to stop accepting connections and finish the ones
+// it has. The admin listener answers it with a StatsResponseMessage.
+type DrainMessage struct {
+	BaseMessage
+	Token string `json:"token"` // Shared admin secret
+}
+
+// StatsResponseMessage is the admin listener's snapshot of the running server
+type StatsResponseMessage struct {
+	BaseMessage
+	Difficulty        int  `json:"difficulty"`         // Difficulty of newly issued challenges
+	ActiveConnections int  `json:"active_connections"` // Connections being served
+	QueuedConnections int  `json:"queued_connections"` // Connections waiting for a slot
+	ActiveChallenges  int  `json:"active_challenges"`  // Issued challenges not yet solved or expired, 0 if not tracked
+	Draining          bool `json:"draining,omitempty"` // No new connections are accepted
 }
 
 // QuoteMessage is sent by the server
 type QuoteMessage struct {
 	BaseMessage
-	Quote string `json:"quote"`
+	Quote           string `json:"quote"`
+	Text            string `json:"text,omitempty"`             // Quote without its attribution, set only when structured quotes were asked for
+	Author          string `json:"author,omitempty"`           // Attribution of Quote, empty if structured but unknown
+	KeepAlive       bool   `json:"keep_alive,omitempty"`       // Another challenge follows on this connection
+	IntervalSeconds int    `json:"interval_seconds,omitempty"` // Seconds until the next pushed quote, set only when subscribed
 }
 
+// QuotesMessage is sent by the server when the client requested several quotes
+type QuotesMessage struct {
+	BaseMessage
+	Quotes    []string `json:"quotes"`
+	KeepAlive bool     `json:"keep_alive,omitempty"` // Another challenge follows on this connection
+}
+
+// ErrorCode identifies the kind of error for programmatic handling
+type ErrorCode string
+
+const (
+	ErrCodeInternal           ErrorCode = "internal"
+	ErrCodeRateLimited        ErrorCode = "rate_limited"
+	ErrCodeShuttingDown       ErrorCode = "shutting_down"
+	ErrCodeOverloaded         ErrorCode = "overloaded"
+	ErrCodeBadRequest         ErrorCode = "bad_request"
+	ErrCodeUnsupportedVersion ErrorCode = "unsupported_version"
+	ErrCodeChallengeMismatch  ErrorCode = "challenge_mismatch"
+	ErrCodeVerificationFailed ErrorCode = "verification_failed"
+	ErrCodeInvalidProof       ErrorCode = "invalid_proof"
+	ErrCodeUnauthorized       ErrorCode = "unauthorized"
+	ErrCodeUnexpectedMessage  ErrorCode = "unexpected_message"
+)
+
 // ErrorMessage for errors
 type ErrorMessage struct {
 	BaseMessage
-	Message string `json:"message"`
+	Code         ErrorCode `json:"code,omitempty"`           // Machine-readable error kind
+	Message      string    `json:"message"`                  // Human-readable description
+	ConnID       string    `json:"conn_id,omitempty"`        // Server-side connection id for correlating logs
+	RetryAfterMs int64     `json:"retry_after_ms,omitempty"` // Advisory delay before retrying, in milliseconds
 }
 
-// WriteMessage writes a message to net.Conn with length prefix
-func WriteMessage(conn net.Conn, msg interface{}, timeout time.Duration) error {
-	jsonData, err := json.Marshal(msg)
-	if err != nil {
-		return fmt.Errorf("failed to marshal message: %w", err)
+// Codec frames messages with a given length prefix byte order and the protocol
+// version that implies, and encodes their payloads with an Encoding. The zero
+// value is equivalent to DefaultCodec.
+type Codec struct {
+	legacy   bool     // Little-endian framing of protocol version 2
+	strict   bool     // Reject fields the decoding target does not have
+	limit    int      // Maximum message size in bytes, 0 means MaxMessageSize
+	encoding Encoding // Payload encoding, nil means JSONEncoding
+}
+
+var (
+	// DefaultCodec uses big-endian (network byte order) framing
+	DefaultCodec = Codec{}
+	// LegacyCodec uses the little-endian framing of protocol version 2,
+	// for talking to peers that predate version 3
+	LegacyCodec = Codec{legacy: true}
+)
+
+// CodecFor returns LegacyCodec if legacy is set, DefaultCodec otherwise
+func CodecFor(legacy bool) Codec {
+	return Codec{legacy: legacy}
+}
+
+// Strict returns a copy of c that rejects messages carrying fields unknown to
+// the type they are decoded into
+func (c Codec) Strict() Codec {
+	c.strict = true
+	return c
+}
+
+// WithMaxSize returns a copy of c that refuses to read or write messages larger
+// than size bytes before compression. A non-positive size means MaxMessageSize.
+func (c Codec) WithMaxSize(size int) Codec {
+	c.limit = max(size, 0)
+	return c
+}
+
+// WithEncoding returns a copy of c that encodes payloads with enc. It only reads
+// frames in that encoding, so both peers must use the same one. A nil enc means
+// JSONEncoding.
+func (c Codec) WithEncoding(enc Encoding) Codec {
+	c.encoding = enc
+	return c
+}
+
+// Encoding returns the encoding of c's payloads
+func (c Codec) Encoding() Encoding {
+	if c.encoding == nil {
+		return JSONEncoding
 	}
+	return c.encoding
+}
 
-	if len(jsonData) > MaxMessageSize {
-		return fmt.Errorf("message size (%d) exceeds max allowed (%d)", len(jsonData), MaxMessageSize)
+// MaxSize returns the largest message c reads or writes, in bytes before compression
+func (c Codec) MaxSize() int {
+	if c.limit == 0 {
+		return MaxMessageSize
 	}
+	return c.limit
+}
 
-	length := uint32(len(jsonData))
-	lenBuf := make([]byte, MessageLengthPrefixSize)
-	binary.LittleEndian.PutUint32(lenBuf, length)
+// ByteOrder returns the byte order of the length prefix
+func (c Codec) ByteOrder() binary.ByteOrder {
+	if c.legacy {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}
+
+// Version returns the protocol version spoken with this framing
+func (c Codec) Version() int {
+	if c.legacy {
+		return LegacyProtocolVersion
+	}
+	return CurrentProtocolVersion
+}
+
+// NewBaseMessage creates a BaseMessage stamped with the codec's protocol version
+func (c Codec) NewBaseMessage(msgType MessageType) BaseMessage {
+	return BaseMessage{Type: msgType, Version: c.Version()}
+}
+
+// WriteMessage writes a message to net.Conn using DefaultCodec
+func WriteMessage(conn net.Conn, msg interface{}, timeout time.Duration) error {
+	return DefaultCodec.WriteMessage(conn, msg, timeout)
+}
+
+// ReadMessage reads a message from net.Conn using DefaultCodec
+func ReadMessage(conn net.Conn, target interface{}, timeout time.Duration) error {
+	return DefaultCodec.ReadMessage(conn, target, timeout)
+}
+
+// WriteMessageCtx writes a message to net.Conn using DefaultCodec, honoring ctx
+func WriteMessageCtx(ctx context.Context, conn net.Conn, msg interface{}) error {
+	return DefaultCodec.WriteMessageCtx(ctx, conn, msg)
+}
+
+// ReadMessageCtx reads a message from net.Conn using DefaultCodec, honoring ctx
+func ReadMessageCtx(ctx context.Context, conn net.Conn, target interface{}) error {
+	return DefaultCodec.ReadMessageCtx(ctx, conn, target)
+}
+
+// WriteMessage writes a message to net.Conn with length prefix and compression flag.
+// Messages larger than CompressionThreshold are gzip-compressed.
+func (c Codec) WriteMessage(conn net.Conn, msg interface{}, timeout time.Duration) error {
+	header, payload, err := c.encode(msg)
+	if err != nil {
+		return err
+	}
 
 	// Set write deadline
 	if timeout > 0 {
@@ -80,23 +406,69 @@ func WriteMessage(conn net.Conn, msg interface{}, timeout time.Duration) error {
 		defer conn.SetWriteDeadline(time.Time{}) // Reset deadline
 	}
 
-	// Write length prefix - ensure all bytes are written
-	if err := writeAll(conn, lenBuf); err != nil {
+	return writeFrame(context.Background(), conn, header, payload)
+}
+
+// WriteMessageCtx is like WriteMessage, but the write is bounded by ctx's deadline
+// and aborted as soon as ctx is canceled
+func (c Codec) WriteMessageCtx(ctx context.Context, conn net.Conn, msg interface{}) error {
+	header, payload, err := c.encode(msg)
+	if err != nil {
+		return err
+	}
+
+	return withContext(ctx, conn.SetWriteDeadline, func() error {
+		return writeFrame(ctx, conn, header, payload)
+	})
+}
+
+// encode marshals msg and builds its frame header
+func (c Codec) encode(msg interface{}) ([]byte, []byte, error) {
+	data, err := c.Encoding().Marshal(msg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	if len(data) > c.MaxSize() {
+		return nil, nil, fmt.Errorf("%w: size %d exceeds max allowed (%d)", ErrMessageTooLarge, len(data), c.MaxSize())
+	}
+
+	payload, compression, err := compressPayload(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	header := make([]byte, MessageLengthPrefixSize+MessageFlagSize)
+	c.ByteOrder().PutUint32(header, uint32(len(payload)))
+	header[MessageLengthPrefixSize] = c.Encoding().id()<<encodingShift | byte(compression)
+
+	return header, payload, nil
+}
+
+// writeFrame writes a frame header and payload to conn, giving up once ctx ends
+func writeFrame(ctx context.Context, conn net.Conn, header, payload []byte) error {
+	// Write length prefix and flag - ensure all bytes are written
+	if err := writeAll(ctx, conn, header); err != nil {
 		return fmt.Errorf("failed to write message length: %w", err)
 	}
 
 	// Write message data - ensure all bytes are written
-	if err := writeAll(conn, jsonData); err != nil {
+	if err := writeAll(ctx, conn, payload); err != nil {
 		return fmt.Errorf("failed to write message data: %w", err)
 	}
 
 	return nil
 }
 
-// writeAll writes all data to conn, handling partial writes
-func writeAll(conn net.Conn, data []byte) error {
+// writeAll writes all data to conn, handling partial writes. It checks ctx before
+// each write, so a peer draining a large frame a few bytes at a time cannot keep
+// the loop going after ctx ends, even on a conn whose deadlines do not interrupt it.
+func writeAll(ctx context.Context, conn net.Conn, data []byte) error {
 	written := 0
 	for written < len(data) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		n, err := conn.Write(data[written:])
 		if err != nil {
 			return err
@@ -106,10 +478,8 @@ func writeAll(conn net.Conn, data []byte) error {
 	return nil
 }
 
-// ReadMessage reads a message from net.Conn with length prefix
-func ReadMessage(conn net.Conn, target interface{}, timeout time.Duration) error {
-	lenBuf := make([]byte, MessageLengthPrefixSize)
-
+// ReadMessage reads a message from net.Conn with length prefix and compression flag
+func (c Codec) ReadMessage(conn net.Conn, target interface{}, timeout time.Duration) error {
 	// Set read deadline
 	if timeout > 0 {
 		if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
@@ -118,14 +488,32 @@ func ReadMessage(conn net.Conn, target interface{}, timeout time.Duration) error
 		defer conn.SetReadDeadline(time.Time{}) // Reset deadline
 	}
 
-	// Read length prefix
-	if _, err := io.ReadFull(conn, lenBuf); err != nil {
+	return c.readFrame(conn, target)
+}
+
+// ReadMessageCtx is like ReadMessage, but the read is bounded by ctx's deadline
+// and aborted as soon as ctx is canceled
+func (c Codec) ReadMessageCtx(ctx context.Context, conn net.Conn, target interface{}) error {
+	return withContext(ctx, conn.SetReadDeadline, func() error {
+		return c.readFrame(conn, target)
+	})
+}
+
+// readFrame reads and decodes a single frame from conn
+func (c Codec) readFrame(conn net.Conn, target interface{}) error {
+	header := make([]byte, MessageLengthPrefixSize+MessageFlagSize)
+
+	// Read length prefix and flag
+	if _, err := io.ReadFull(conn, header); err != nil {
 		return fmt.Errorf("failed to read message length: %w", err)
 	}
 
-	length := binary.LittleEndian.Uint32(lenBuf)
-	if length == 0 || length > MaxMessageSize {
-		return fmt.Errorf("invalid message length: %d", length)
+	length := c.ByteOrder().Uint32(header)
+	if length == 0 {
+		return ErrZeroLengthMessage
+	}
+	if uint64(length) > uint64(c.MaxSize()) {
+		return fmt.Errorf("%w: length %d exceeds max allowed (%d)", ErrMessageTooLarge, length, c.MaxSize())
 	}
 
 	// Read message data
@@ -134,10 +522,102 @@ func ReadMessage(conn net.Conn, target interface{}, timeout time.Duration) error
 		return fmt.Errorf("failed to read message data: %w", err)
 	}
 
-	// Unmarshal message
-	if err := json.Unmarshal(msgBuf, target); err != nil {
-		return fmt.Errorf("failed to unmarshal message: %w", err)
+	flag := header[MessageLengthPrefixSize]
+	if id := flag >> encodingShift; id != c.Encoding().id() {
+		return fmt.Errorf("%w: got %s, expected %s", ErrEncodingMismatch, encodingName(id), c.Encoding().Name())
+	}
+
+	data, err := decompressPayload(msgBuf, Compression(flag&compressionMask), c.MaxSize())
+	if err != nil {
+		return err
+	}
+
+	jsonData, err := c.Encoding().toJSON(data)
+	if err != nil {
+		return err
+	}
+
+	return c.Decode(jsonData, target)
+}
+
+// Decode unmarshals a single JSON message into target. Syntax errors, type mismatches,
+// unknown fields (with a strict codec) and trailing data are reported as distinct
+// errors, each wrapped with ErrMalformedMessage.
+func (c Codec) Decode(data []byte, target interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if c.strict {
+		dec.DisallowUnknownFields()
 	}
 
+	if err := dec.Decode(target); err != nil {
+		return decodeError(err)
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%w: %w", ErrMalformedMessage, ErrTrailingData)
+	}
 	return nil
 }
+
+// PeekType returns the type of an encoded message, ignoring its other fields
+func PeekType(data []byte) (MessageType, error) {
+	var base BaseMessage
+	if err := DefaultCodec.Decode(data, &base); err != nil {
+		return "", err
+	}
+	return base.Type, nil
+}
+
+// decodeError classifies an error from json.Decoder
+func decodeError(err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.As(err, &syntaxErr):
+		return fmt.Errorf("%w: %w at offset %d", ErrMalformedMessage, ErrInvalidJSON, syntaxErr.Offset)
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return fmt.Errorf("%w: %w: unexpected end of input", ErrMalformedMessage, ErrInvalidJSON)
+	case errors.As(err, &typeErr):
+		return fmt.Errorf("%w: %w: %q is not %s", ErrMalformedMessage, ErrFieldType, typeErr.Field, typeErr.Type)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// The decoder has no typed error for unknown fields
+		return fmt.Errorf("%w: %w %s", ErrMalformedMessage, ErrUnknownField, strings.TrimPrefix(err.Error(), "json: unknown field "))
+	default:
+		return fmt.Errorf("%w: %v", ErrMalformedMessage, err)
+	}
+}
+
+// withContext runs op with the connection deadline taken from ctx. A watchdog
+// moves the deadline into the past when ctx is canceled, so a blocked op
+// returns promptly. The returned error wraps ctx.Err() if ctx ended the op.
+func withContext(ctx context.Context, setDeadline func(time.Time) error, op func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	deadline, _ := ctx.Deadline() // Zero time means no deadline
+	if err := setDeadline(deadline); err != nil {
+		return fmt.Errorf("failed to set deadline: %w", err)
+	}
+	defer setDeadline(time.Time{}) // Reset deadline
+
+	done := make(chan struct{})
+	watchdogDone := make(chan struct{})
+	go func() {
+		defer close(watchdogDone)
+		select {
+		case <-ctx.Done():
+			setDeadline(time.Unix(1, 0)) // Any past time fails pending I/O immediately
+		case <-done:
+		}
+	}()
+
+	err := op()
+	close(done)
+	<-watchdogDone // The watchdog must not touch the deadline after it is reset
+
+	if err != nil && ctx.Err() != nil {
+		return fmt.Errorf("%w: %v", ctx.Err(), err)
+	}
+	return err
+}
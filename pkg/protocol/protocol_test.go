@@ -0,0 +1,622 @@
+package protocol
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// captureFrame writes msg through a pipe and returns the raw bytes sent
+func captureFrame(t *testing.T, msg interface{}) []byte {
+	t.Helper()
+
+	client, server := net.Pipe()
+	defer client.Close()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- WriteMessage(server, msg, time.Second)
+		server.Close()
+	}()
+
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(client); err != nil {
+		t.Fatalf("Failed to read frame: %v", err)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("WriteMessage failed: %v", err)
+	}
+
+	return buf.Bytes()
+}
+
+// readFrame feeds raw bytes through a pipe into ReadMessage
+func readFrame(frame []byte, target interface{}) error {
+	client, server := net.Pipe()
+	defer client.Close()
+
+	go func() {
+		server.Write(frame)
+		server.Close()
+	}()
+
+	return ReadMessage(client, target, time.Second)
+}
+
+func TestMessage_RoundTrip(t *testing.T) {
+	tests := []struct {
+		name        string
+		quote       string
+		compression Compression
+	}{
+		{"Uncompressed", "Short quote", CompressionNone},
+		{"Compressed", strings.Repeat("A long and repetitive quote. ", 200), CompressionGzip},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sent := QuoteMessage{BaseMessage: NewBaseMessage(MsgTypeQuote), Quote: tt.quote}
+			frame := captureFrame(t, sent)
+
+			if got := Compression(frame[MessageLengthPrefixSize]); got != tt.compression {
+				t.Errorf("Expected compression flag %d, got %d", tt.compression, got)
+			}
+			if length := DefaultCodec.ByteOrder().Uint32(frame); int(length) != len(frame)-MessageLengthPrefixSize-MessageFlagSize {
+				t.Errorf("Length prefix %d does not match payload size %d", length, len(frame)-MessageLengthPrefixSize-MessageFlagSize)
+			}
+
+			var received QuoteMessage
+			if err := readFrame(frame, &received); err != nil {
+				t.Fatalf("ReadMessage failed: %v", err)
+			}
+			if received != sent {
+				t.Errorf("Round trip mismatch: sent %+v, received %+v", sent, received)
+			}
+		})
+	}
+}
+
+func TestChallengeMessage_ServerInfo(t *testing.T) {
+	sent := ChallengeMessage{
+		BaseMessage: NewBaseMessage(MsgTypeChallenge),
+		Challenge:   "1700000000:feedface",
+		Difficulty:  2,
+		ServerInfo:  "pow-server/v1.2.3",
+	}
+
+	var received ChallengeMessage
+	if err := readFrame(captureFrame(t, sent), &received); err != nil {
+		t.Fatalf("ReadMessage failed: %v", err)
+	}
+	if received.ServerInfo != sent.ServerInfo {
+		t.Errorf("Expected server info %q, got %q", sent.ServerInfo, received.ServerInfo)
+	}
+
+	// Servers without version info don't send the field, so older clients see no change
+	sent.ServerInfo = ""
+	frame := captureFrame(t, sent)
+	if strings.Contains(string(frame), "server_info") {
+		t.Errorf("Expected empty server info to be omitted, got %s", frame[MessageLengthPrefixSize+MessageFlagSize:])
+	}
+}
+
+func TestChallengeMessage_Algorithm(t *testing.T) {
+	sent := ChallengeMessage{
+		BaseMessage: NewBaseMessage(MsgTypeChallenge),
+		Challenge:   "1700000000:feedface",
+		Difficulty:  12,
+		Algorithm:   AlgorithmArgon2id,
+		Argon2:      &Argon2Params{Time: 2, Memory: 16 * 1024, Threads: 4},
+	}
+
+	var received ChallengeMessage
+	if err := readFrame(captureFrame(t, sent), &received); err != nil {
+		t.Fatalf("ReadMessage failed: %v", err)
+	}
+	if received.Algorithm != sent.Algorithm {
+		t.Errorf("Expected algorithm %q, got %q", sent.Algorithm, received.Algorithm)
+	}
+	if received.Argon2 == nil || *received.Argon2 != *sent.Argon2 {
+		t.Errorf("Expected argon2 params %+v, got %+v", sent.Argon2, received.Argon2)
+	}
+
+	// A sha256 challenge carries no cost parameters
+	sent.Algorithm, sent.Argon2 = AlgorithmSHA256, nil
+	frame := captureFrame(t, sent)
+	if strings.Contains(string(frame), "argon2") {
+		t.Errorf("Expected argon2 params to be omitted, got %s", frame[MessageLengthPrefixSize+MessageFlagSize:])
+	}
+}
+
+func TestProofMessage_NonceBytes(t *testing.T) {
+	tests := []struct {
+		name     string
+		nonce    string
+		encoding string
+		want     string
+		wantErr  bool
+	}{
+		{"Unset", "12345", "", "12345", false},
+		{"Decimal", "12345", NonceEncodingDecimal, "12345", false},
+		{"Hex", "00ff10", NonceEncodingHex, "\x00\xff\x10", false},
+		{"HexOfDigits", "3432", NonceEncodingHex, "42", false},
+		{"BadHex", "0g", NonceEncodingHex, "", true},
+		{"OddHex", "abc", NonceEncodingHex, "", true},
+		{"UnknownEncoding", "12345", "base64", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sent := ProofMessage{
+				BaseMessage:   NewBaseMessage(MsgTypeProof),
+				Challenge:     "1700000000:feedface",
+				Nonce:         tt.nonce,
+				NonceEncoding: tt.encoding,
+			}
+
+			// The encoding survives the wire
+			var received ProofMessage
+			if err := readFrame(captureFrame(t, sent), &received); err != nil {
+				t.Fatalf("ReadMessage failed: %v", err)
+			}
+
+			got, err := received.NonceBytes()
+			if tt.wantErr {
+				if !errors.Is(err, ErrMalformedMessage) {
+					t.Errorf("Expected ErrMalformedMessage, got: %v", err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("NonceBytes() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadMessage_DecompressedSizeLimit(t *testing.T) {
+	// A small compressed payload that expands past MaxMessageSize
+	var payload bytes.Buffer
+	zw := gzip.NewWriter(&payload)
+	zw.Write([]byte(`{"type":"quote","quote":"`))
+	zw.Write(bytes.Repeat([]byte("A"), MaxMessageSize))
+	zw.Write([]byte(`"}`))
+	zw.Close()
+
+	frame := make([]byte, MessageLengthPrefixSize+MessageFlagSize, MessageLengthPrefixSize+MessageFlagSize+payload.Len())
+	binary.BigEndian.PutUint32(frame, uint32(payload.Len()))
+	frame[MessageLengthPrefixSize] = byte(CompressionGzip)
+	frame = append(frame, payload.Bytes()...)
+
+	var msg QuoteMessage
+	err := readFrame(frame, &msg)
+	if !errors.Is(err, ErrMessageTooLarge) {
+		t.Errorf("Expected ErrMessageTooLarge, got: %v", err)
+	}
+}
+
+func TestReadMessage_UnknownCompression(t *testing.T) {
+	payload := []byte(`{"type":"quote"}`)
+	frame := make([]byte, MessageLengthPrefixSize+MessageFlagSize)
+	binary.BigEndian.PutUint32(frame, uint32(len(payload)))
+	frame[MessageLengthPrefixSize] = 7
+	frame = append(frame, payload...)
+
+	var msg QuoteMessage
+	if err := readFrame(frame, &msg); !errors.Is(err, ErrUnsupportedCompression) {
+		t.Errorf("Expected ErrUnsupportedCompression, got: %v", err)
+	}
+}
+
+func TestCodec_ByteOrder(t *testing.T) {
+	tests := []struct {
+		name   string
+		writer Codec
+		reader Codec
+		ok     bool
+	}{
+		{"BigEndianRoundTrip", DefaultCodec, DefaultCodec, true},
+		{"LittleEndianRoundTrip", LegacyCodec, LegacyCodec, true},
+		{"BigEndianReadAsLittle", DefaultCodec, LegacyCodec, false},
+		{"LittleEndianReadAsBig", LegacyCodec, DefaultCodec, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+
+			sent := QuoteMessage{BaseMessage: tt.writer.NewBaseMessage(MsgTypeQuote), Quote: "Byte order matters"}
+			go func() {
+				tt.writer.WriteMessage(server, sent, time.Second)
+				server.Close()
+			}()
+
+			var received QuoteMessage
+			err := tt.reader.ReadMessage(client, &received, time.Second)
+			if tt.ok {
+				if err != nil {
+					t.Fatalf("ReadMessage failed: %v", err)
+				}
+				if received != sent {
+					t.Errorf("Round trip mismatch: sent %+v, received %+v", sent, received)
+				}
+				return
+			}
+			if err == nil {
+				t.Errorf("Expected error reading mismatched byte order, got message %+v", received)
+			}
+		})
+	}
+}
+
+func TestCodec_Version(t *testing.T) {
+	if v := DefaultCodec.NewBaseMessage(MsgTypeQuote).Version; v != CurrentProtocolVersion {
+		t.Errorf("Expected default codec to speak version %d, got %d", CurrentProtocolVersion, v)
+	}
+	if v := LegacyCodec.NewBaseMessage(MsgTypeQuote).Version; v != LegacyProtocolVersion {
+		t.Errorf("Expected legacy codec to speak version %d, got %d", LegacyProtocolVersion, v)
+	}
+	if CodecFor(true) != LegacyCodec || CodecFor(false) != DefaultCodec {
+		t.Error("CodecFor returned the wrong codec")
+	}
+}
+
+func TestReadMessage_InvalidFrames(t *testing.T) {
+	tests := []struct {
+		name    string
+		length  uint32
+		payload []byte
+		want    error
+	}{
+		{"ZeroLength", 0, nil, ErrZeroLengthMessage},
+		{"TooLarge", MaxMessageSize + 1, nil, ErrMessageTooLarge},
+		{"MalformedJSON", 5, []byte("{oops"), ErrMalformedMessage},
+		{"InvalidJSON", 5, []byte("{oops"), ErrInvalidJSON},
+		{"TruncatedJSON", 8, []byte(`{"quote"`), ErrInvalidJSON},
+		{"WrongFieldType", 11, []byte(`{"quote":1}`), ErrFieldType},
+		{"TrailingData", 4, []byte("{}{}"), ErrTrailingData},
+		{"TrailingGarbage", 6, []byte("{} xyz"), ErrTrailingData},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frame := make([]byte, MessageLengthPrefixSize+MessageFlagSize)
+			binary.BigEndian.PutUint32(frame, tt.length)
+			frame = append(frame, tt.payload...)
+
+			var msg QuoteMessage
+			err := readFrame(frame, &msg)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got: %v", tt.want, err)
+			}
+			if !IsProtocolViolation(err) {
+				t.Errorf("Expected %v to be a protocol violation", err)
+			}
+		})
+	}
+}
+
+func TestReadMessage_NetworkErrorIsNotProtocolViolation(t *testing.T) {
+	// Truncated frame: the peer hangs up mid-header
+	var msg QuoteMessage
+	err := readFrame([]byte{0, 0}, &msg)
+	if err == nil {
+		t.Fatal("Expected error for truncated frame")
+	}
+	if IsProtocolViolation(err) {
+		t.Errorf("Truncated read should not be a protocol violation: %v", err)
+	}
+}
+
+func TestWriteMessage_TooLarge(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	msg := QuoteMessage{BaseMessage: NewBaseMessage(MsgTypeQuote), Quote: strings.Repeat("A", MaxMessageSize)}
+	if err := WriteMessage(server, msg, time.Second); !errors.Is(err, ErrMessageTooLarge) {
+		t.Errorf("Expected ErrMessageTooLarge, got: %v", err)
+	}
+}
+
+func TestCodec_WithMaxSize(t *testing.T) {
+	// messageOfSize returns a quote message whose JSON is exactly size bytes
+	messageOfSize := func(size int) QuoteMessage {
+		overhead := len(`{"type":"quote","quote":""}`)
+		return QuoteMessage{BaseMessage: BaseMessage{Type: MsgTypeQuote}, Quote: strings.Repeat("A", size-overhead)}
+	}
+
+	// 512 bytes stays below CompressionThreshold, so frames are checked by length;
+	// 4096 bytes are compressed and checked once decompressed
+	for _, limit := range []int{512, 4 * CompressionThreshold} {
+		codec := DefaultCodec.WithMaxSize(limit)
+		if codec.MaxSize() != limit {
+			t.Fatalf("Expected max size %d, got %d", limit, codec.MaxSize())
+		}
+
+		for _, size := range []int{limit - 1, limit, limit + 1} {
+			t.Run(fmt.Sprintf("Limit%d/Size%d", limit, size), func(t *testing.T) {
+				msg := messageOfSize(size)
+				wantErr := size > limit
+
+				// Write: an oversized message is refused before anything is sent
+				reader, writer := net.Pipe()
+				defer reader.Close()
+				go io.Copy(io.Discard, reader)
+				err := codec.WriteMessage(writer, msg, time.Second)
+				writer.Close()
+				if wantErr != errors.Is(err, ErrMessageTooLarge) || !wantErr && err != nil {
+					t.Errorf("WriteMessage of %d bytes with limit %d: got %v", size, limit, err)
+				}
+
+				// Read: a peer with the default limit sends it anyway
+				client, server := net.Pipe()
+				defer client.Close()
+				go func() {
+					WriteMessage(server, msg, time.Second)
+					server.Close()
+				}()
+				var received QuoteMessage
+				err = codec.ReadMessage(client, &received, time.Second)
+				if wantErr {
+					if !errors.Is(err, ErrMessageTooLarge) {
+						t.Errorf("Expected ErrMessageTooLarge reading %d bytes with limit %d, got: %v", size, limit, err)
+					}
+					return
+				}
+				if err != nil || received != msg {
+					t.Errorf("Expected %d-byte message to round-trip with limit %d, got: %v", size, limit, err)
+				}
+			})
+		}
+	}
+
+	// A non-positive size restores the default
+	if got := DefaultCodec.WithMaxSize(0).MaxSize(); got != MaxMessageSize {
+		t.Errorf("Expected default max size %d, got %d", MaxMessageSize, got)
+	}
+	if got := DefaultCodec.WithMaxSize(-1).MaxSize(); got != MaxMessageSize {
+		t.Errorf("Expected default max size %d for a negative size, got %d", MaxMessageSize, got)
+	}
+	if DefaultCodec.WithMaxSize(MaxMessageSize).Version() != CurrentProtocolVersion {
+		t.Error("Expected WithMaxSize to keep the framing")
+	}
+}
+
+func TestReadMessageCtx_Cancel(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	// Nothing is ever written, so only cancellation can end the read
+	start := time.Now()
+	var msg QuoteMessage
+	err := ReadMessageCtx(ctx, client, &msg)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Read took %v to notice cancellation", elapsed)
+	}
+
+	// The connection deadline must be reset so the conn stays usable
+	go WriteMessage(server, QuoteMessage{BaseMessage: NewBaseMessage(MsgTypeQuote), Quote: "after"}, time.Second)
+	if err := ReadMessageCtx(context.Background(), client, &msg); err != nil {
+		t.Fatalf("Read after cancellation failed: %v", err)
+	}
+	if msg.Quote != "after" {
+		t.Errorf("Expected quote 'after', got %q", msg.Quote)
+	}
+}
+
+func TestReadMessageCtx_Deadline(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	var msg QuoteMessage
+	if err := ReadMessageCtx(ctx, client, &msg); err == nil {
+		t.Fatal("Expected read to fail at the context deadline")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Read took %v, expected to stop at the 50ms deadline", elapsed)
+	}
+}
+
+func TestWriteMessageCtx_Cancel(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	// net.Pipe is unbuffered, so the write blocks until canceled
+	err := WriteMessageCtx(ctx, server, QuoteMessage{BaseMessage: NewBaseMessage(MsgTypeQuote), Quote: "never read"})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got: %v", err)
+	}
+}
+
+// throttledConn accepts a few bytes per Write and ignores deadlines, like a peer
+// reading slowly through a conn that deadlines cannot interrupt
+type throttledConn struct {
+	net.Conn
+	written int64 // Accessed atomically
+}
+
+func (c *throttledConn) Write(b []byte) (int, error) {
+	time.Sleep(time.Millisecond)
+	n := min(len(b), 16)
+	atomic.AddInt64(&c.written, int64(n))
+	return n, nil
+}
+
+func (c *throttledConn) SetWriteDeadline(time.Time) error {
+	return nil
+}
+
+func TestWriteMessageCtx_CancelPartialWrites(t *testing.T) {
+	// Random hex barely compresses, so the frame takes well over a second to trickle out
+	random := make([]byte, 16*1024)
+	rand.Read(random)
+	msg := QuoteMessage{BaseMessage: NewBaseMessage(MsgTypeQuote), Quote: hex.EncodeToString(random)}
+
+	conn := &throttledConn{}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	err := WriteMessageCtx(ctx, conn, msg)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Write took %v to notice cancellation", elapsed)
+	}
+	if written := atomic.LoadInt64(&conn.written); written == 0 || written >= int64(len(msg.Quote)/2) {
+		t.Errorf("Expected the write to stop partway, %d bytes were written", written)
+	}
+}
+
+func TestReadMessageCtx_AlreadyCanceled(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var msg QuoteMessage
+	if err := ReadMessageCtx(ctx, client, &msg); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got: %v", err)
+	}
+}
+
+func TestCodec_Decode(t *testing.T) {
+	tests := []struct {
+		name    string
+		codec   Codec
+		payload string
+		want    error // nil if the payload decodes
+	}{
+		{"Valid", DefaultCodec, `{"type":"quote","quote":"q"}`, nil},
+		{"TrailingWhitespace", DefaultCodec, "{\"quote\":\"q\"}\n\t ", nil},
+		{"UnknownFieldIgnored", DefaultCodec, `{"quote":"q","extra":1}`, nil},
+		{"UnknownFieldStrict", DefaultCodec.Strict(), `{"quote":"q","extra":1}`, ErrUnknownField},
+		{"ValidStrict", LegacyCodec.Strict(), `{"type":"quote","quote":"q"}`, nil},
+		{"WrongType", DefaultCodec, `{"quote":["q"]}`, ErrFieldType},
+		{"Empty", DefaultCodec, "   ", ErrInvalidJSON},
+		{"NotAnObject", DefaultCodec, `"quote"`, ErrFieldType},
+		{"Trailing", DefaultCodec, `{"quote":"q"}]`, ErrTrailingData},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var msg QuoteMessage
+			err := tt.codec.Decode([]byte(tt.payload), &msg)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("Decode failed: %v", err)
+				}
+				if msg.Quote != "q" {
+					t.Errorf("Expected quote %q, got %q", "q", msg.Quote)
+				}
+				return
+			}
+			if !errors.Is(err, tt.want) || !errors.Is(err, ErrMalformedMessage) {
+				t.Errorf("Expected %v wrapped with ErrMalformedMessage, got: %v", tt.want, err)
+			}
+			if reason := ViolationReason(err); reason != tt.want.Error() {
+				t.Errorf("Expected reason %q, got %q", tt.want.Error(), reason)
+			}
+		})
+	}
+}
+
+func TestViolationReason_HidesDecoderOutput(t *testing.T) {
+	var msg ProofMessage
+	err := DefaultCodec.Decode([]byte(`{"count":"many"}`), &msg)
+	if err == nil {
+		t.Fatal("Expected error for wrong field type")
+	}
+	if reason := ViolationReason(err); strings.Contains(reason, "json") || strings.Contains(reason, "many") {
+		t.Errorf("Reason %q leaks decoder output", reason)
+	}
+}
+
+// garbageSeeds are payloads of valid length that are not well-formed messages
+var garbageSeeds = []string{
+	"{", "}", "null", "[]", "0", `"x"`, "{}{}", `{"type":1}`, `{"type":"proof","count":1e400}`,
+	`{"challenge":{"a":[1,2,{}]}}`, `{"nonce":-0.5}`, "\x00\xff\xfe", `{"a":"\ud800"}`,
+	`{"keep_alive":"yes"}`, strings.Repeat("[", 10000),
+}
+
+// checkGarbage decodes payload as a framed proof and fails if decoding panics,
+// or fails with anything but a protocol violation
+func checkGarbage(t *testing.T, payload []byte) {
+	t.Helper()
+
+	frame := make([]byte, MessageLengthPrefixSize+MessageFlagSize)
+	binary.BigEndian.PutUint32(frame, uint32(len(payload)))
+	frame = append(frame, payload...)
+
+	var msg ProofMessage
+	if err := readFrame(frame, &msg); err != nil && !IsProtocolViolation(err) {
+		t.Errorf("Expected protocol violation for payload %q, got: %v", payload, err)
+	}
+}
+
+func TestReadMessage_GarbagePayloads(t *testing.T) {
+	for _, seed := range garbageSeeds {
+		checkGarbage(t, []byte(seed))
+	}
+
+	// Random bytes, and random mutations of a valid proof, with a fixed seed
+	valid := []byte(`{"type":"proof","version":4,"challenge":"c","nonce":"42","count":2}`)
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		payload := make([]byte, 1+rng.Intn(64))
+		rng.Read(payload)
+		checkGarbage(t, payload)
+
+		mutated := bytes.Clone(valid)
+		for j := 0; j < 1+rng.Intn(4); j++ {
+			mutated[rng.Intn(len(mutated))] = byte(rng.Intn(256))
+		}
+		checkGarbage(t, mutated)
+	}
+}
+
+func FuzzCodec_Decode(f *testing.F) {
+	for _, seed := range garbageSeeds {
+		f.Add([]byte(seed))
+	}
+	f.Add([]byte(`{"type":"proof","challenge":"c","nonce":"42"}`))
+
+	f.Fuzz(func(t *testing.T, payload []byte) {
+		var msg ProofMessage
+		if err := DefaultCodec.Strict().Decode(payload, &msg); err != nil && !errors.Is(err, ErrMalformedMessage) {
+			t.Errorf("Expected ErrMalformedMessage, got: %v", err)
+		}
+	})
+}